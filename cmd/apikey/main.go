@@ -0,0 +1,162 @@
+// Command apikey manages the API keys of client services from the shell,
+// for example to create the first admin key:
+//
+//	apikey create -name ops -scopes admin
+//	apikey list
+//	apikey revoke <id>
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/infrastructure/persistence/database"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage:
+  apikey create -name <client> -scopes <scope,...> [-senders <address|domain,...>] [-templates <name,...>]
+  apikey list
+  apikey revoke <id>`
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("no .env file")
+	}
+
+	cfg := config.MustLoad()
+
+	logg, err := logger.New("warn", "console")
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logg.Sync()
+
+	db, err := database.NewDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if err := db.Migrate(ctx); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	signingKeys, err := usecase.NewSigningKeys(cfg.Server)
+	if err != nil {
+		log.Fatalf("Failed to init signing keys: %v", err)
+	}
+
+	uc := usecase.NewManageAPIKeysUseCase(database.NewAPIKeyRepository(db), signingKeys, logg)
+
+	switch os.Args[1] {
+	case "create":
+		err = create(ctx, uc, os.Args[2:])
+	case "list":
+		err = list(ctx, uc)
+	case "revoke":
+		err = revoke(ctx, uc, os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown command %q\n%s", os.Args[1], usage)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func create(ctx context.Context, uc *usecase.ManageAPIKeysUseCase, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	name := flags.String("name", "", "client name")
+	scopes := flags.String("scopes", "", "comma separated scopes")
+	senders := flags.String("senders", "", "comma separated addresses and domains the client may send from")
+	templates := flags.String("templates", "", "comma separated templates the client may use")
+	flags.Parse(args)
+
+	apiKey, key, err := uc.Create(ctx, usecase.APIKeyInput{
+		Name:             *name,
+		Scopes:           splitList(*scopes),
+		AllowedSenders:   splitList(*senders),
+		AllowedTemplates: splitList(*templates),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("id:  %s\nkey: %s\n\nThe key is not shown again.\n", apiKey.ID, key)
+	return nil
+}
+
+func list(ctx context.Context, uc *usecase.ManageAPIKeysUseCase) error {
+	keys, err := uc.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tSENDERS\tCREATED\tLAST USED\tREVOKED")
+
+	for _, k := range keys {
+		scopes := make([]string, len(k.Scopes))
+		for i, scope := range k.Scopes {
+			scopes[i] = string(scope)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID, k.Name, k.Prefix, strings.Join(scopes, ","), cmp.Or(strings.Join(k.AllowedSenders, ","), "any"),
+			k.CreatedAt.Format(time.RFC3339), formatTime(k.LastUsedAt), formatTime(k.RevokedAt))
+	}
+
+	return w.Flush()
+}
+
+func revoke(ctx context.Context, uc *usecase.ManageAPIKeysUseCase, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%s", usage)
+	}
+
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid API key ID: %w", err)
+	}
+
+	apiKey, err := uc.Revoke(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %s (%s)\n", apiKey.ID, apiKey.Name)
+	return nil
+}
+
+// splitList splits a comma separated flag, empty meaning none.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -10,11 +10,19 @@ import (
 	"time"
 
 	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/service"
 	"github.com/an3wers/notification-serv/internal/infrastructure/email"
+	"github.com/an3wers/notification-serv/internal/infrastructure/jwks"
+	"github.com/an3wers/notification-serv/internal/infrastructure/mailbox"
 	"github.com/an3wers/notification-serv/internal/infrastructure/persistence/database"
+	"github.com/an3wers/notification-serv/internal/infrastructure/storage"
 	"github.com/an3wers/notification-serv/internal/pkg/config"
 	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/tracing"
+	"github.com/an3wers/notification-serv/internal/pkg/verp"
 	"github.com/an3wers/notification-serv/internal/presentation/http/handlers"
+	"github.com/an3wers/notification-serv/internal/presentation/http/middleware"
 	"github.com/an3wers/notification-serv/internal/presentation/http/router"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
@@ -42,6 +50,12 @@ func main() {
 		"Init logger",
 		zap.String("level", cfg.Logger.Level), zap.String("format", cfg.Logger.Format))
 
+	// Tracing is set up first so that every query can be traced
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logg.Fatal("Failed to init tracing", zap.String("error", err.Error()))
+	}
+
 	// Connect to database
 	db, err := database.NewDB(cfg.Database)
 	if err != nil {
@@ -50,22 +64,159 @@ func main() {
 	defer db.Close()
 	logg.Info("Connected to database")
 
+	if cfg.Server.LegacySecretKey && cfg.Server.SecretKey != "" {
+		logg.Warn("The shared SECRET_KEY is accepted, set LEGACY_SECRET_KEY=false once clients use API keys")
+	}
+
+	if err := db.Migrate(context.Background()); err != nil {
+		logg.Fatal("Failed to migrate database", zap.String("error", err.Error()))
+	}
+
+	// metrics
+	appMetrics := metrics.New()
+	appMetrics.Register(database.NewPoolCollector(db))
+
 	// repositories
 	emailRepo := database.NewEmailRepository(db)
+	attachmentRepo := database.NewAttachmentRepository(db)
+	retentionRepo := database.NewRetentionRepository(db)
+	erasureRepo := database.NewErasureRepository(db)
+	eventRepo := database.NewEmailEventRepository(db)
+	suppressionRepo := database.NewSuppressionRepository(db)
+	apiKeyRepo := database.NewAPIKeyRepository(db)
+	nonceRepo := database.NewNonceRepository(db)
+	quotaRepo := database.NewQuotaRepository(db)
+	locker := database.NewLocker(db)
+	transactor := database.NewTransactor(db)
+
+	appMetrics.Register(metrics.QueueDepth(emailRepo.CountQueued))
+	appMetrics.Register(metrics.AttachmentStoredBytes(attachmentRepo.StoredSize))
+
+	// storage
+	fileStorage, err := storage.New(cfg.Storage)
+	if err != nil {
+		logg.Fatal("Failed to init storage", zap.String("error", err.Error()))
+	}
+
+	// VERP return paths, shared by sending and bounce processing
+	var returnPath *verp.Encoder
+
+	if cfg.SMTP.VERPAddress != "" {
+		returnPath, err = verp.New(cfg.SMTP.VERPAddress, cfg.SMTP.VERPSigningKey)
+		if err != nil {
+			logg.Fatal("Failed to init VERP", zap.String("error", err.Error()))
+		}
+	}
+
+	// bearer tokens from the platform's issuer
+	var tokenVerifier service.TokenVerifier
+
+	if cfg.JWT.JWKSFile != "" || cfg.JWT.JWKSURL != "" {
+		tokenVerifier, err = jwks.New(cfg.JWT)
+		if err != nil {
+			logg.Fatal("Failed to init JWT verification", zap.String("error", err.Error()))
+		}
+	}
 
 	// providers
-	emailProvider := email.NewSMTPProvider(cfg.SMTP)
+	unsubscribeLinks, err := usecase.NewUnsubscribeLinks(cfg.Links)
+	if err != nil {
+		logg.Fatal("Failed to init unsubscribe links", zap.String("error", err.Error()))
+	}
+	emailProvider := email.NewSMTPProvider(cfg.SMTP, fileStorage, returnPath, unsubscribeLinks, appMetrics)
 
 	// usecases
-	sendEmailUC := usecase.NewSendEmailUseCase(emailRepo, emailProvider, cfg.SMTP, logg)
-	getEmailStatusUC := usecase.NewGetEmailStatusUseCase(emailRepo)
+	attachmentPolicy := usecase.NewAttachmentPolicy(cfg.Attachments)
+	attachmentLinks, err := usecase.NewAttachmentLinks(cfg.Links)
+	if err != nil {
+		logg.Fatal("Failed to init attachment links", zap.String("error", err.Error()))
+	}
+	attachmentOffloader := usecase.NewAttachmentOffloader(attachmentLinks, cfg.Attachments)
+	quotaUC := usecase.NewQuotaUseCase(quotaRepo, cfg.RateLimit)
+	domainThrottle := usecase.NewDomainThrottle(cfg.Throttle)
+	sendEmailUC := usecase.NewSendEmailUseCase(
+		emailRepo, attachmentRepo, suppressionRepo, transactor, emailProvider,
+		attachmentPolicy, attachmentLinks, attachmentOffloader, quotaUC, domainThrottle, appMetrics, cfg.SMTP, cfg.Suppression, logg,
+	)
+	deliverQueuedUC := usecase.NewDeliverQueuedUseCase(emailRepo, locker, sendEmailUC, appMetrics, cfg.Throttle, logg)
+	getEmailStatusUC := usecase.NewGetEmailStatusUseCase(emailRepo, attachmentLinks)
+	uploadAttachmentUC := usecase.NewUploadAttachmentUseCase(attachmentRepo, transactor, fileStorage, attachmentPolicy, cfg.Storage, logg)
+	deleteAttachmentUC := usecase.NewDeleteAttachmentUseCase(attachmentRepo, fileStorage, logg)
+	downloadAttachmentUC := usecase.NewDownloadAttachmentUseCase(emailRepo, fileStorage)
+	deleteEmailUC := usecase.NewDeleteEmailUseCase(emailRepo, logg)
+	getEmailEventsUC := usecase.NewGetEmailEventsUseCase(emailRepo, eventRepo)
+	cancelEmailUC := usecase.NewCancelEmailUseCase(emailRepo, transactor, appMetrics, logg)
+	listEmailsUC := usecase.NewListEmailsUseCase(emailRepo)
+	recordDeliveryEventUC := usecase.NewRecordDeliveryEventUseCase(emailRepo, suppressionRepo, transactor, appMetrics, cfg.Suppression, logg)
+	manageSuppressionsUC := usecase.NewManageSuppressionsUseCase(suppressionRepo, transactor, logg)
+	unsubscribeUC := usecase.NewUnsubscribeUseCase(suppressionRepo, unsubscribeLinks, logg)
+	signingKeys, err := usecase.NewSigningKeys(cfg.Server)
+	if err != nil {
+		logg.Fatal("Failed to init signing keys", zap.String("error", err.Error()))
+	}
+	if !signingKeys.Enabled() {
+		logg.Warn("SIGNING_KEY_ENCRYPTION_KEY is not set; API keys cannot sign requests")
+	}
+	authUC := usecase.NewAuthenticateUseCase(apiKeyRepo, nonceRepo, tokenVerifier, signingKeys, cfg.Server, logg)
+	manageAPIKeysUC := usecase.NewManageAPIKeysUseCase(apiKeyRepo, signingKeys, logg)
+
+	var bounceMailbox service.Mailbox
+
+	if cfg.Bounces.Mailbox != "" {
+		bounceMailbox, err = mailbox.New(cfg.Bounces)
+		if err != nil {
+			logg.Fatal("Failed to init bounce mailbox", zap.String("error", err.Error()))
+		}
+	}
+
+	processBouncesUC := usecase.NewProcessBouncesUseCase(bounceMailbox, locker, recordDeliveryEventUC, returnPath, cfg.Bounces, logg)
+	eraseAddressUC := usecase.NewEraseAddressUseCase(erasureRepo, deleteAttachmentUC, logg)
+	retentionUC := usecase.NewRetentionUseCase(retentionRepo, locker, fileStorage, cfg.Retention, logg)
+	cleanupOrphansUC := usecase.NewCleanupOrphansUseCase(deleteAttachmentUC, locker, cfg.Storage, logg)
 
 	// init handlers
 	healthHandler := handlers.NewHealthHandler(db.Pool)
-	emailHandler := handlers.NewEmailHandler(sendEmailUC, getEmailStatusUC, cfg.Storage, cfg.Server, logg)
+	emailHandler := handlers.NewEmailHandler(
+		sendEmailUC, getEmailStatusUC, uploadAttachmentUC, deleteEmailUC, getEmailEventsUC, cancelEmailUC, listEmailsUC, cfg.Storage, logg,
+	)
+	attachmentHandler := handlers.NewAttachmentHandler(uploadAttachmentUC, deleteAttachmentUC, downloadAttachmentUC, attachmentLinks, cfg.Storage, logg)
+	erasureHandler := handlers.NewErasureHandler(eraseAddressUC, logg)
+	webhookHandler := handlers.NewWebhookHandler(recordDeliveryEventUC, processBouncesUC, logg)
+	suppressionHandler := handlers.NewSuppressionHandler(manageSuppressionsUC, logg)
+	unsubscribeHandler := handlers.NewUnsubscribeHandler(unsubscribeUC, logg)
+	apiKeyHandler := handlers.NewAPIKeyHandler(manageAPIKeysUC, logg)
+	quotaHandler := handlers.NewQuotaHandler(quotaUC, logg)
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		logg.Fatal("Failed to parse trusted proxies", zap.String("error", err.Error()))
+	}
 
 	// setup chi router
-	r := router.NewRouter(healthHandler, emailHandler, logg)
+	r := router.NewRouter(
+		healthHandler, emailHandler, attachmentHandler, erasureHandler, webhookHandler, suppressionHandler, unsubscribeHandler, apiKeyHandler,
+		quotaHandler, authUC, trustedProxies, cfg.Storage, cfg.RateLimit, appMetrics, cfg.Metrics, logg,
+	)
+
+	// background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	if cfg.Retention.Interval > 0 {
+		go runRetention(jobsCtx, retentionUC, cfg.Retention, logg)
+	}
+
+	if cfg.Storage.OrphanTTL > 0 && cfg.Storage.OrphanInterval > 0 {
+		go runOrphanCleanup(jobsCtx, cleanupOrphansUC, cfg.Storage, logg)
+	}
+
+	if cfg.Throttle.Interval > 0 {
+		go runDelivery(jobsCtx, deliverQueuedUC, cfg.Throttle, logg)
+	}
+
+	if bounceMailbox != nil {
+		go runBounceProcessing(jobsCtx, processBouncesUC, cfg.Bounces, logg)
+	}
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -90,6 +241,7 @@ func main() {
 	<-quit
 
 	logg.Info("Shutting down server...")
+	stopJobs()
 
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout)*time.Second)
@@ -99,6 +251,77 @@ func main() {
 		logg.Fatal("Server forced to shutdown", zap.String("error", err.Error()))
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		logg.Error("Failed to flush traces", zap.String("error", err.Error()))
+	}
+
 	logg.Info("Server stopped")
+}
+
+// runRetention periodically removes content past its retention period.
+func runRetention(ctx context.Context, uc *usecase.RetentionUseCase, cfg config.RetentionConfig, logg *logger.Logger) {
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := uc.Execute(ctx); err != nil {
+				logg.Error("Retention failed", zap.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// runOrphanCleanup periodically removes unreferenced attachments.
+func runOrphanCleanup(ctx context.Context, uc *usecase.CleanupOrphansUseCase, cfg config.StorageConfig, logg *logger.Logger) {
+	ticker := time.NewTicker(time.Duration(cfg.OrphanInterval) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := uc.Execute(ctx); err != nil {
+				logg.Error("Orphan cleanup failed", zap.String("error", err.Error()))
+			}
+		}
+	}
+}
 
+// runBounceProcessing periodically reads the bounce mailbox.
+func runBounceProcessing(ctx context.Context, uc *usecase.ProcessBouncesUseCase, cfg config.BounceConfig, logg *logger.Logger) {
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := uc.Execute(ctx); err != nil {
+				logg.Error("Bounce processing failed", zap.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// runDelivery periodically sends the queued emails that are due.
+func runDelivery(ctx context.Context, uc *usecase.DeliverQueuedUseCase, cfg config.ThrottleConfig, logg *logger.Logger) {
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := uc.Execute(ctx); err != nil {
+				logg.Error("Delivery of queued emails failed", zap.String("error", err.Error()))
+			}
+		}
+	}
 }
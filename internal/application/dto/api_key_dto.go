@@ -0,0 +1,28 @@
+package dto
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	// AllowedSenders takes addresses and domains the client may send
+	// from, AllowedTemplates template names; empty lists allow any
+	AllowedSenders   []string `json:"allowedSenders" validate:"max=100"`
+	AllowedTemplates []string `json:"allowedTemplates" validate:"max=100"`
+}
+
+type APIKeyResponse struct {
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	Prefix           string   `json:"prefix"`
+	Scopes           []string `json:"scopes"`
+	AllowedSenders   []string `json:"allowedSenders,omitempty"`
+	AllowedTemplates []string `json:"allowedTemplates,omitempty"`
+	CreatedAt        string   `json:"createdAt"`
+	LastUsedAt       *string  `json:"lastUsedAt,omitempty"`
+	RevokedAt        *string  `json:"revokedAt,omitempty"`
+	// Key is only returned when the key is created
+	Key string `json:"key,omitempty"`
+}
+
+type APIKeyListResponse struct {
+	Keys []APIKeyResponse `json:"keys"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+type EmailEventResponse struct {
+	ID         string  `json:"id"`
+	FromStatus *string `json:"fromStatus,omitempty"`
+	Status     string  `json:"status"`
+	Actor      string  `json:"actor"`
+	Provider   string  `json:"provider,omitempty"`
+	Detail     *string `json:"detail,omitempty"`
+	CreatedAt  string  `json:"createdAt"`
+}
+
+type EmailTimelineResponse struct {
+	EmailID string               `json:"emailId"`
+	Events  []EmailEventResponse `json:"events"`
+}
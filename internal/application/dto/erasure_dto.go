@@ -0,0 +1,15 @@
+package dto
+
+type EraseAddressRequest struct {
+	Address string `json:"address" validate:"required,email"`
+}
+
+type ErasureReportResponse struct {
+	ID                 string   `json:"id"`
+	AddressHash        string   `json:"addressHash"`
+	EmailsAffected     int      `json:"emailsAffected"`
+	EmailIDs           []string `json:"emailIds"`
+	AttachmentsDeleted int      `json:"attachmentsDeleted"`
+	AttachmentIDs      []string `json:"attachmentIds"`
+	CreatedAt          string   `json:"createdAt"`
+}
@@ -0,0 +1,15 @@
+package dto
+
+type QuotaResponse struct {
+	ClientID string               `json:"clientId"`
+	Quotas   []QuotaUsageResponse `json:"quotas"`
+}
+
+type QuotaUsageResponse struct {
+	Period string `json:"period"`
+	// Limit and Remaining are null for unlimited periods
+	Limit     *int   `json:"limit"`
+	Used      int    `json:"used"`
+	Remaining *int   `json:"remaining"`
+	ResetsAt  string `json:"resetsAt"`
+}
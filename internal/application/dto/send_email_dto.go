@@ -11,33 +11,78 @@ type SendEmailRequest struct {
 	Body            string   `json:"body,omitempty" validate:"omitempty,min=1"`
 	Message         string   `json:"message,omitempty" validate:"omitempty,min=1"`
 	HTML            *string  `json:"html,omitempty"`
+	AttachmentIDs   []string `json:"attachmentIds,omitempty" validate:"omitempty,dive,uuid"`
+	// Category lets recipients unsubscribe from this kind of email only.
+	// ListUnsubscribe adds one-click unsubscribe headers (RFC 8058).
+	Category        string `json:"category,omitempty" validate:"omitempty,max=64"`
+	ListUnsubscribe bool   `json:"listUnsubscribe,omitempty"`
 }
 
 type SendEmailNormalizedRequest struct {
-	To          []string `validate:"required,dive,email"`
-	From        *string  `validate:"omitempty,email"`
-	DisplayName *string  `validate:"omitempty,min=1,max=255"`
-	CC          []string `validate:"omitempty,dive,email"`
-	BCC         []string `validate:"omitempty,dive,email"`
-	Subject     *string  `validate:"omitempty,min=1,max=255"`
-	Body        *string  `validate:"omitempty,min=1"`
-	HTML        *string  `validate:"omitempty"`
+	To              []string `validate:"required,dive,email"`
+	From            *string  `validate:"omitempty,email"`
+	DisplayName     *string  `validate:"omitempty,min=1,max=255"`
+	CC              []string `validate:"omitempty,dive,email"`
+	BCC             []string `validate:"omitempty,dive,email"`
+	Subject         *string  `validate:"omitempty,min=1,max=255"`
+	Body            *string  `validate:"omitempty,min=1"`
+	HTML            *string  `validate:"omitempty"`
+	AttachmentIDs   []string `validate:"omitempty,dive,uuid"`
+	Category        *string  `validate:"omitempty,max=64"`
+	ListUnsubscribe bool
 }
 
+// AttachmentDTO references a stored attachment and the name it is sent under.
 type AttachmentDTO struct {
-	Filename     string
+	ID           string
 	OriginalName string
-	Mimetype     string
-	Size         int64
-	Path         string
+}
+
+type AttachmentResponse struct {
+	ID        string  `json:"id"`
+	Filename  string  `json:"filename"`
+	Mimetype  string  `json:"mimetype"`
+	Size      int64   `json:"size"`
+	URL       *string `json:"url,omitempty"`
+	Offloaded bool    `json:"offloaded,omitempty"`
+	Purged    bool    `json:"purged,omitempty"`
 }
 
 type EmailResponse struct {
-	ID        string   `json:"id"`
-	Status    string   `json:"status"`
-	To        []string `json:"to"`
-	Subject   string   `json:"subject"`
-	CreatedAt string   `json:"createdAt"`
-	SentAt    *string  `json:"sentAt,omitempty"`
-	Error     *string  `json:"error,omitempty"`
+	ID              string               `json:"id"`
+	Status          string               `json:"status"`
+	To              []string             `json:"to"`
+	Subject         string               `json:"subject"`
+	Category        *string              `json:"category,omitempty"`
+	ListUnsubscribe bool                 `json:"listUnsubscribe,omitempty"`
+	ClientID        *string              `json:"clientId,omitempty"`
+	CreatedAt       string               `json:"createdAt"`
+	SentAt          *string              `json:"sentAt,omitempty"`
+	SendAfter       *string              `json:"sendAfter,omitempty"`
+	Error           *string              `json:"error,omitempty"`
+	RedactedAt      *string              `json:"redactedAt,omitempty"`
+	PurgedAt        *string              `json:"purgedAt,omitempty"`
+	Attachments     []AttachmentResponse `json:"attachments,omitempty"`
+	Recipients      []RecipientResponse  `json:"recipients,omitempty"`
+}
+
+type RecipientResponse struct {
+	Address   string  `json:"address"`
+	Kind      string  `json:"kind"`
+	Status    string  `json:"status"`
+	SMTPCode  *int    `json:"smtpCode,omitempty"`
+	Response  *string `json:"response,omitempty"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+type CancelEmailRequest struct {
+	Reason string `json:"reason" validate:"max=1000"`
+}
+
+type EmailListResponse struct {
+	Emails []EmailResponse `json:"emails"`
+	// NextBefore is passed as before to fetch the next page, it is absent
+	// on the last page. It holds the creation time and ID of the last email
+	// on the page, since several emails can share a creation time.
+	NextBefore *string `json:"nextBefore,omitempty"`
 }
@@ -0,0 +1,36 @@
+package dto
+
+import "time"
+
+type AddSuppressionRequest struct {
+	Address string `json:"address" validate:"required,email"`
+	// Category limits the entry to emails of that category
+	Category  string     `json:"category" validate:"max=64"`
+	Reason    string     `json:"reason" validate:"omitempty,oneof=hard_bounce complaint unsubscribe manual HARD_BOUNCE COMPLAINT UNSUBSCRIBE MANUAL"`
+	Detail    string     `json:"detail" validate:"max=1000"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type SuppressionResponse struct {
+	Address   string  `json:"address"`
+	Category  string  `json:"category,omitempty"`
+	Reason    string  `json:"reason"`
+	Source    string  `json:"source"`
+	Detail    *string `json:"detail,omitempty"`
+	EmailID   *string `json:"emailId,omitempty"`
+	ExpiresAt *string `json:"expiresAt,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+type SuppressionListResponse struct {
+	Suppressions []SuppressionResponse `json:"suppressions"`
+	// NextAfter and NextAfterCategory are passed as the after and
+	// afterCategory parameters to get the next page
+	NextAfter         *string `json:"nextAfter,omitempty"`
+	NextAfterCategory *string `json:"nextAfterCategory,omitempty"`
+}
+
+type SuppressionImportResponse struct {
+	Imported int `json:"imported"`
+}
@@ -0,0 +1,15 @@
+package dto
+
+// DeliveryWebhookRequest reports the outcome for one recipient of a sent
+// email.
+type DeliveryWebhookRequest struct {
+	EmailID   string `json:"emailId" validate:"required,uuid"`
+	Recipient string `json:"recipient" validate:"required,email"`
+	Event     string `json:"event" validate:"required,oneof=delivered bounced complained DELIVERED BOUNCED COMPLAINED"`
+	Provider  string `json:"provider" validate:"max=64"`
+	Detail    string `json:"detail" validate:"max=1000"`
+	SMTPCode  int    `json:"smtpCode" validate:"omitempty,min=200,max=599"`
+	// BounceType tells a hard bounce, the default, from a soft one. Only
+	// hard bounces add the recipient to the suppression list.
+	BounceType string `json:"bounceType" validate:"omitempty,oneof=hard soft"`
+}
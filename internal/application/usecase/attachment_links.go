@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/signature"
+	"github.com/google/uuid"
+)
+
+// AttachmentLinks builds and verifies signed, expiring download URLs that
+// work without the API secret.
+type AttachmentLinks struct {
+	signer  *signature.Signer
+	baseURL string
+	ttl     time.Duration
+}
+
+// NewAttachmentLinks fails without a signing key, since a signed link is
+// accepted in place of the API secret.
+func NewAttachmentLinks(cfg config.LinksConfig) (*AttachmentLinks, error) {
+	if cfg.SigningKey == "" {
+		return nil, errors.New("link signing key is not set")
+	}
+
+	return &AttachmentLinks{
+		signer:  signature.New(cfg.SigningKey),
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		ttl:     time.Duration(cfg.TTL) * time.Minute,
+	}, nil
+}
+
+// URL returns a download URL for the attachment of an email that expires
+// after the configured TTL.
+func (l *AttachmentLinks) URL(emailID, attachmentID uuid.UUID) string {
+	return l.URLUntil(emailID, attachmentID, time.Now().Add(l.ttl))
+}
+
+func (l *AttachmentLinks) URLUntil(emailID, attachmentID uuid.UUID, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.signer.Sign(signedParts(emailID, attachmentID, expires)...))
+
+	return fmt.Sprintf("%s/api/v1/emails/%s/attachments/%s?%s", l.baseURL, emailID, attachmentID, query.Encode())
+}
+
+// Verify checks the expires and signature query values of a download URL.
+func (l *AttachmentLinks) Verify(emailID, attachmentID uuid.UUID, expires, sig string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid expires", apperrors.ErrInvalidInput)
+	}
+
+	if !l.signer.Verify(sig, signedParts(emailID, attachmentID, expires)...) {
+		return fmt.Errorf("%w: invalid signature", apperrors.ErrInvalidInput)
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("%w: link expired", apperrors.ErrInvalidInput)
+	}
+
+	return nil
+}
+
+// Populate sets a fresh download URL on every attachment of the email
+// whose content is still stored.
+func (l *AttachmentLinks) Populate(email *entity.Email) {
+	for i := range email.Attachments {
+		if email.Attachments[i].PurgedAt != nil {
+			continue
+		}
+
+		link := l.URL(email.ID, email.Attachments[i].ID)
+		email.Attachments[i].URL = &link
+	}
+}
+
+func signedParts(emailID, attachmentID uuid.UUID, expires string) []string {
+	return []string{"attachment", emailID.String(), attachmentID.String(), expires}
+}
@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+func TestAttachmentLinks(t *testing.T) {
+	links, err := NewAttachmentLinks(config.LinksConfig{BaseURL: "http://localhost/", SigningKey: "key", TTL: 60})
+	if err != nil {
+		t.Fatalf("NewAttachmentLinks: %v", err)
+	}
+
+	emailID, attachmentID := uuid.New(), uuid.New()
+
+	link, err := url.Parse(links.URL(emailID, attachmentID))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	query := link.Query()
+
+	if err := links.Verify(emailID, attachmentID, query.Get("expires"), query.Get("signature")); err != nil {
+		t.Errorf("Verify = %v, want the link accepted", err)
+	}
+
+	if err := links.Verify(emailID, uuid.New(), query.Get("expires"), query.Get("signature")); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Verify for another attachment = %v, want ErrInvalidInput", err)
+	}
+
+	expired, _ := url.Parse(links.URLUntil(emailID, attachmentID, time.Now().Add(-time.Minute)))
+	query = expired.Query()
+	if err := links.Verify(emailID, attachmentID, query.Get("expires"), query.Get("signature")); !errors.Is(err, apperrors.ErrInvalidInput) {
+		t.Errorf("Verify of an expired link = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestAttachmentLinks_RequiresKey(t *testing.T) {
+	if _, err := NewAttachmentLinks(config.LinksConfig{BaseURL: "http://localhost"}); err == nil {
+		t.Error("NewAttachmentLinks without a signing key succeeded, want an error")
+	}
+}
@@ -0,0 +1,133 @@
+package usecase
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+)
+
+// AttachmentOffloader replaces attachments that are too large to embed with
+// signed download links appended to the email bodies.
+type AttachmentOffloader struct {
+	links     *AttachmentLinks
+	threshold int64
+}
+
+func NewAttachmentOffloader(links *AttachmentLinks, cfg config.AttachmentPolicyConfig) *AttachmentOffloader {
+	return &AttachmentOffloader{
+		links:     links,
+		threshold: cfg.OffloadThreshold,
+	}
+}
+
+// Mark flags the attachments of the email that will be sent as links. The
+// largest ones are offloaded until the embedded rest fits the threshold.
+func (o *AttachmentOffloader) Mark(email *entity.Email) {
+	if o.threshold <= 0 {
+		return
+	}
+
+	var embedded int64
+	bySize := make([]int, len(email.Attachments))
+
+	for i := range email.Attachments {
+		email.Attachments[i].Offloaded = false
+		embedded += email.Attachments[i].Size
+		bySize[i] = i
+	}
+
+	slices.SortStableFunc(bySize, func(a, b int) int {
+		return cmp.Compare(email.Attachments[b].Size, email.Attachments[a].Size)
+	})
+
+	for _, i := range bySize {
+		if embedded <= o.threshold {
+			break
+		}
+
+		email.Attachments[i].Offloaded = true
+		embedded -= email.Attachments[i].Size
+	}
+}
+
+// Message returns the email as it should be handed to the provider: offloaded
+// attachments are removed and listed with download links at the end of the
+// text and HTML bodies. The email itself is not modified.
+func (o *AttachmentOffloader) Message(email *entity.Email) *entity.Email {
+	var embedded, offloaded []entity.Attachment
+
+	for _, att := range email.Attachments {
+		if att.Offloaded {
+			offloaded = append(offloaded, att)
+		} else {
+			embedded = append(embedded, att)
+		}
+	}
+
+	if len(offloaded) == 0 {
+		return email
+	}
+
+	expiresAt := time.Now().Add(o.links.ttl)
+
+	var text, markup strings.Builder
+
+	text.WriteString("\n\n--\n")
+	fmt.Fprintf(&text, "Attachments available for download until %s:\n", expiresAt.UTC().Format("2006-01-02 15:04 MST"))
+
+	markup.WriteString(`<hr><p>`)
+	fmt.Fprintf(&markup, "Attachments available for download until %s:", expiresAt.UTC().Format("2006-01-02 15:04 MST"))
+	markup.WriteString(`</p><ul>`)
+
+	for _, att := range offloaded {
+		link := o.links.URLUntil(email.ID, att.ID, expiresAt)
+
+		fmt.Fprintf(&text, "- %s (%s): %s\n", att.OriginalName, formatSize(att.Size), link)
+		fmt.Fprintf(&markup, `<li><a href="%s">%s</a> (%s)</li>`,
+			html.EscapeString(link), html.EscapeString(att.OriginalName), formatSize(att.Size))
+	}
+
+	markup.WriteString(`</ul>`)
+
+	message := *email
+	message.Attachments = embedded
+	message.Body = email.Body + text.String()
+
+	if email.HTML != nil {
+		body := appendToHTML(*email.HTML, markup.String())
+		message.HTML = &body
+	}
+
+	return &message
+}
+
+// appendToHTML inserts fragment before the closing body tag, if there is one.
+func appendToHTML(document, fragment string) string {
+	if i := strings.LastIndex(strings.ToLower(document), "</body>"); i >= 0 {
+		return document[:i] + fragment + document[i:]
+	}
+
+	return document + fragment
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+)
+
+func TestAttachmentOffloader_Mark(t *testing.T) {
+	links, err := NewAttachmentLinks(config.LinksConfig{BaseURL: "http://localhost", SigningKey: "key", TTL: 60})
+	if err != nil {
+		t.Fatalf("NewAttachmentLinks: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		threshold     int64
+		sizes         []int64
+		wantOffloaded []bool
+	}{
+		{name: "fits", threshold: 100, sizes: []int64{40, 60}, wantOffloaded: []bool{false, false}},
+		{name: "each under the threshold", threshold: 100, sizes: []int64{40, 70, 50}, wantOffloaded: []bool{false, true, false}},
+		{name: "largest first until the rest fits", threshold: 100, sizes: []int64{60, 90, 30, 80}, wantOffloaded: []bool{false, true, false, true}},
+		{name: "single file over the threshold", threshold: 100, sizes: []int64{150, 10}, wantOffloaded: []bool{true, false}},
+		{name: "disabled", threshold: 0, sizes: []int64{400, 500}, wantOffloaded: []bool{false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offloader := NewAttachmentOffloader(links, config.AttachmentPolicyConfig{OffloadThreshold: tt.threshold})
+
+			email := &entity.Email{}
+			for _, size := range tt.sizes {
+				email.Attachments = append(email.Attachments,
+					*entity.NewAttachment("stored", "file.bin", "application/octet-stream", size, "", "/files/stored", nil))
+			}
+
+			offloader.Mark(email)
+
+			for i, att := range email.Attachments {
+				if att.Offloaded != tt.wantOffloaded[i] {
+					t.Errorf("attachment %d of %d bytes offloaded = %v, want %v", i, att.Size, att.Offloaded, tt.wantOffloaded[i])
+				}
+			}
+		})
+	}
+}
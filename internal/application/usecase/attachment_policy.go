@@ -0,0 +1,176 @@
+package usecase
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+const defaultAttachmentName = "attachment"
+
+// AttachmentPolicy decides which files may be attached to an email.
+type AttachmentPolicy struct {
+	cfg config.AttachmentPolicyConfig
+}
+
+func NewAttachmentPolicy(cfg config.AttachmentPolicyConfig) *AttachmentPolicy {
+	return &AttachmentPolicy{cfg: cfg}
+}
+
+// CheckName sanitizes a client supplied filename and validates its length
+// and extension. It returns the sanitized name.
+func (p *AttachmentPolicy) CheckName(name string) (string, error) {
+	sanitized := SanitizeFilename(name)
+
+	if p.cfg.MaxFilenameLength > 0 && len([]rune(sanitized)) > p.cfg.MaxFilenameLength {
+		return "", apperrors.NewFileError(name,
+			fmt.Errorf("%w: filename is longer than %d characters", apperrors.ErrInvalidInput, p.cfg.MaxFilenameLength))
+	}
+
+	ext := strings.ToLower(filepath.Ext(sanitized))
+
+	if matchExtension(p.cfg.BlockedExtensions, ext) {
+		return "", apperrors.NewFileError(name,
+			fmt.Errorf("%w: extension %q is not allowed", apperrors.ErrInvalidInput, ext))
+	}
+
+	if len(p.cfg.AllowedExtensions) > 0 && !matchExtension(p.cfg.AllowedExtensions, ext) {
+		return "", apperrors.NewFileError(name,
+			fmt.Errorf("%w: extension %q is not allowed", apperrors.ErrInvalidInput, ext))
+	}
+
+	return sanitized, nil
+}
+
+// CheckMimetype validates the MIME type sniffed from the file content.
+func (p *AttachmentPolicy) CheckMimetype(name, mimeType string) error {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = mimeType
+	}
+
+	if matchMimetype(p.cfg.BlockedMimeTypes, mediaType) {
+		return apperrors.NewFileError(name,
+			fmt.Errorf("%w: content type %q is not allowed", apperrors.ErrInvalidInput, mediaType))
+	}
+
+	if len(p.cfg.AllowedMimeTypes) > 0 && !matchMimetype(p.cfg.AllowedMimeTypes, mediaType) {
+		return apperrors.NewFileError(name,
+			fmt.Errorf("%w: content type %q is not allowed", apperrors.ErrInvalidInput, mediaType))
+	}
+
+	return nil
+}
+
+// CheckFile applies the per-file rules to a stored attachment. The policy
+// may have changed since the file was uploaded.
+func (p *AttachmentPolicy) CheckFile(att entity.Attachment) error {
+	if _, err := p.CheckName(att.OriginalName); err != nil {
+		return err
+	}
+
+	return p.CheckMimetype(att.OriginalName, att.Mimetype)
+}
+
+// CheckCount validates that an email may have count attachments. name is
+// the file that would exceed the limit.
+func (p *AttachmentPolicy) CheckCount(name string, count int) error {
+	if p.cfg.MaxFiles > 0 && count > p.cfg.MaxFiles {
+		return apperrors.NewFileError(name,
+			fmt.Errorf("%w: at most %d files can be attached", apperrors.ErrInvalidInput, p.cfg.MaxFiles))
+	}
+
+	return nil
+}
+
+// CheckEmail validates the attachments of a composed email as a whole.
+func (p *AttachmentPolicy) CheckEmail(attachments []entity.Attachment) error {
+	var total int64
+
+	for i, att := range attachments {
+		if err := p.CheckCount(att.OriginalName, i+1); err != nil {
+			return err
+		}
+
+		if err := p.CheckFile(att); err != nil {
+			return err
+		}
+
+		total += att.Size
+		if p.cfg.MaxTotalSize > 0 && total > p.cfg.MaxTotalSize {
+			return apperrors.NewFileError(att.OriginalName,
+				fmt.Errorf("%w: attachments exceed %d bytes in total", apperrors.ErrTooLarge, p.cfg.MaxTotalSize))
+		}
+	}
+
+	return nil
+}
+
+// MaxTotalSize returns the limit for all attachments of an email, or 0.
+func (p *AttachmentPolicy) MaxTotalSize() int64 {
+	return p.cfg.MaxTotalSize
+}
+
+// SanitizeFilename strips directories, control and reserved characters from
+// a client supplied filename.
+func SanitizeFilename(name string) string {
+	// Clients may send Windows paths
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = filepath.Base(name)
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	name = strings.Trim(name, " .")
+
+	if name == "" {
+		return defaultAttachmentName
+	}
+
+	return name
+}
+
+func matchExtension(list []string, ext string) bool {
+	for _, item := range list {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if !strings.HasPrefix(item, ".") {
+			item = "." + item
+		}
+		if item == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchMimetype(list []string, mediaType string) bool {
+	mediaType = strings.ToLower(mediaType)
+
+	for _, item := range list {
+		item = strings.ToLower(strings.TrimSpace(item))
+
+		if prefix, ok := strings.CutSuffix(item, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+			continue
+		}
+
+		if item == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
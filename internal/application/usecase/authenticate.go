@@ -0,0 +1,277 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/signature"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// touchInterval limits how often the last use of a key is written.
+const touchInterval = time.Minute
+
+// Nonces of signed requests must be long enough to be unique and short
+// enough to store.
+const (
+	minNonceLength = 16
+	maxNonceLength = 128
+)
+
+type clientContextKey struct{}
+
+// WithClient returns a context carrying the authenticated client.
+func WithClient(ctx context.Context, client *entity.Client) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+// ClientFromContext returns the authenticated client, nil when the request
+// was not authenticated.
+func ClientFromContext(ctx context.Context) *entity.Client {
+	client, _ := ctx.Value(clientContextKey{}).(*entity.Client)
+	return client
+}
+
+// authorizeEmail checks that the client of the request may access the
+// email. Requests without a client come from the service itself.
+func authorizeEmail(ctx context.Context, email *entity.Email) error {
+	client := ClientFromContext(ctx)
+	if client == nil || client.CanAccess(email) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: email %s belongs to another client", apperrors.ErrForbidden, email.ID)
+}
+
+// attachmentOwner returns the client whose ownership of an attachment must
+// be checked, or "" when the request may use any attachment: requests of
+// the service itself and of admins.
+func attachmentOwner(ctx context.Context) string {
+	client := ClientFromContext(ctx)
+	if client == nil || client.HasScope(entity.ScopeAdmin) {
+		return ""
+	}
+
+	return client.ID
+}
+
+// isAttachmentOwner reports whether the client of the request may use the
+// attachment.
+func isAttachmentOwner(ctx context.Context, attachmentRepo repository.AttachmentRepository, id uuid.UUID) (bool, error) {
+	owner := attachmentOwner(ctx)
+	if owner == "" {
+		return true, nil
+	}
+
+	owners, err := attachmentRepo.FindOwners(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to load attachment owners: %w", err)
+	}
+
+	return slices.Contains(owners, owner), nil
+}
+
+type AuthenticateUseCase struct {
+	apiKeyRepo repository.APIKeyRepository
+	nonceRepo  repository.NonceRepository
+	tokens     service.TokenVerifier
+	signing    *SigningKeys
+	serverCfg  config.ServerConfig
+	maxSkew    time.Duration
+	logger     *logger.Logger
+
+	mu        sync.Mutex
+	cleanedAt time.Time
+}
+
+// NewAuthenticateUseCase returns the use case; tokens may be nil when no
+// token issuer is configured.
+func NewAuthenticateUseCase(
+	apiKeyRepo repository.APIKeyRepository,
+	nonceRepo repository.NonceRepository,
+	tokens service.TokenVerifier,
+	signing *SigningKeys,
+	serverCfg config.ServerConfig,
+	logger *logger.Logger,
+) *AuthenticateUseCase {
+	return &AuthenticateUseCase{
+		apiKeyRepo: apiKeyRepo,
+		nonceRepo:  nonceRepo,
+		tokens:     tokens,
+		signing:    signing,
+		serverCfg:  serverCfg,
+		maxSkew:    time.Duration(serverCfg.SignatureMaxSkew) * time.Second,
+		logger:     logger,
+	}
+}
+
+// APIKey returns the client of an API key. Unknown and revoked keys
+// return ErrUnauthorized.
+func (uc *AuthenticateUseCase) APIKey(ctx context.Context, key string) (*entity.Client, error) {
+	apiKey, err := uc.apiKeyRepo.FindByHash(ctx, entity.HashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return nil, fmt.Errorf("%w: unknown API key", apperrors.ErrUnauthorized)
+		}
+		return nil, err
+	}
+
+	if apiKey.Revoked() {
+		return nil, fmt.Errorf("%w: API key %s is revoked", apperrors.ErrUnauthorized, apiKey.Prefix)
+	}
+
+	uc.touch(ctx, apiKey)
+
+	return apiKey.Client(), nil
+}
+
+// SignedRequest is a request signed with the signing key of an API key.
+// The signature covers the method, the path with its query, the timestamp,
+// the nonce and the hex encoded SHA-256 of the body, joined by newlines.
+type SignedRequest struct {
+	KeyID     string
+	Signature string
+	Method    string
+	Path      string
+	// Timestamp is in Unix seconds.
+	Timestamp string
+	Nonce     string
+	BodyHash  string
+}
+
+// Signature returns the client of the API key that signed the request.
+// Bad signatures, timestamps further than the allowed skew from now,
+// nonces used before and keys without a signing key return
+// ErrUnauthorized.
+func (uc *AuthenticateUseCase) Signature(ctx context.Context, req SignedRequest) (*entity.Client, error) {
+	keyID, err := uuid.Parse(req.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signing key ID", apperrors.ErrUnauthorized)
+	}
+
+	seconds, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature timestamp", apperrors.ErrUnauthorized)
+	}
+
+	now := time.Now().UTC()
+	timestamp := time.Unix(seconds, 0).UTC()
+
+	if timestamp.Before(now.Add(-uc.maxSkew)) || timestamp.After(now.Add(uc.maxSkew)) {
+		return nil, fmt.Errorf("%w: signature timestamp %s is outside the allowed skew", apperrors.ErrUnauthorized, timestamp.Format(time.RFC3339))
+	}
+
+	if len(req.Nonce) < minNonceLength || len(req.Nonce) > maxNonceLength {
+		return nil, fmt.Errorf("%w: nonce must be %d to %d characters", apperrors.ErrUnauthorized, minNonceLength, maxNonceLength)
+	}
+
+	apiKey, err := uc.apiKeyRepo.FindByID(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return nil, fmt.Errorf("%w: unknown signing key", apperrors.ErrUnauthorized)
+		}
+		return nil, err
+	}
+
+	if apiKey.Revoked() {
+		return nil, fmt.Errorf("%w: API key %s is revoked", apperrors.ErrUnauthorized, apiKey.Prefix)
+	}
+
+	signingKey, err := uc.signing.Open(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := signature.New(signingKey)
+	if !signer.Verify(req.Signature, req.Method, req.Path, req.Timestamp, req.Nonce, req.BodyHash) {
+		return nil, fmt.Errorf("%w: invalid request signature", apperrors.ErrUnauthorized)
+	}
+
+	// Only signed requests record nonces, so forgeries cannot use them up.
+	// Once the timestamp is out of the skew the nonce is no longer needed.
+	fresh, err := uc.nonceRepo.Use(ctx, apiKey.ID, req.Nonce, timestamp.Add(uc.maxSkew))
+	if err != nil {
+		return nil, err
+	}
+
+	if !fresh {
+		return nil, fmt.Errorf("%w: nonce was already used", apperrors.ErrUnauthorized)
+	}
+
+	uc.deleteExpiredNonces(ctx, now)
+	uc.touch(ctx, apiKey)
+
+	return apiKey.Client(), nil
+}
+
+// touch records the use of a key, at most once per touchInterval. Failing
+// to record it does not fail the request.
+func (uc *AuthenticateUseCase) touch(ctx context.Context, apiKey *entity.APIKey) {
+	now := time.Now().UTC()
+
+	if apiKey.LastUsedAt != nil && now.Sub(*apiKey.LastUsedAt) < touchInterval {
+		return
+	}
+
+	if err := uc.apiKeyRepo.Touch(ctx, apiKey.ID, now); err != nil {
+		uc.logger.Warn("Failed to record API key use",
+			zap.String("key_id", apiKey.ID.String()),
+			zap.String("error", err.Error()))
+	}
+}
+
+// deleteExpiredNonces removes expired nonces, at most once per skew
+// window.
+func (uc *AuthenticateUseCase) deleteExpiredNonces(ctx context.Context, now time.Time) {
+	uc.mu.Lock()
+	due := now.Sub(uc.cleanedAt) >= uc.maxSkew
+	if due {
+		uc.cleanedAt = now
+	}
+	uc.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	if _, err := uc.nonceRepo.DeleteExpired(ctx, now); err != nil {
+		uc.logger.Warn("Failed to delete expired nonces", zap.String("error", err.Error()))
+	}
+}
+
+// Token returns the client a JWT bearer token was issued to. Without a
+// configured issuer every token returns ErrUnauthorized.
+func (uc *AuthenticateUseCase) Token(ctx context.Context, token string) (*entity.Client, error) {
+	if uc.tokens == nil {
+		return nil, fmt.Errorf("%w: bearer tokens are not accepted", apperrors.ErrUnauthorized)
+	}
+
+	return uc.tokens.Verify(ctx, token)
+}
+
+// SharedSecret accepts the legacy secret shared by all clients, while it
+// is enabled and set. Its client has every scope.
+func (uc *AuthenticateUseCase) SharedSecret(secret string) (*entity.Client, error) {
+	if !uc.serverCfg.LegacySecretKey || uc.serverCfg.SecretKey == "" {
+		return nil, fmt.Errorf("%w: the shared secret is disabled", apperrors.ErrUnauthorized)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(uc.serverCfg.SecretKey)) != 1 {
+		return nil, fmt.Errorf("%w: invalid secret key", apperrors.ErrUnauthorized)
+	}
+
+	return &entity.Client{Name: "legacy", Scopes: []entity.Scope{entity.ScopeAdmin}}, nil
+}
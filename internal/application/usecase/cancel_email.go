@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type CancelEmailUseCase struct {
+	emailRepo  repository.EmailRepository
+	transactor repository.Transactor
+	metrics    *metrics.Metrics
+	logger     *logger.Logger
+}
+
+func NewCancelEmailUseCase(
+	emailRepo repository.EmailRepository,
+	transactor repository.Transactor,
+	metrics *metrics.Metrics,
+	logger *logger.Logger,
+) *CancelEmailUseCase {
+	return &CancelEmailUseCase{
+		emailRepo:  emailRepo,
+		transactor: transactor,
+		metrics:    metrics,
+		logger:     logger,
+	}
+}
+
+// Execute cancels an email that was not sent yet. Emails already handed to
+// a relay cannot be cancelled and return ErrInvalidTransition.
+func (uc *CancelEmailUseCase) Execute(ctx context.Context, emailID uuid.UUID, reason string) (*entity.Email, error) {
+	var email *entity.Email
+
+	err := uc.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		email, err = uc.emailRepo.FindByID(ctx, emailID)
+		if err != nil {
+			return err
+		}
+
+		if err := authorizeEmail(ctx, email); err != nil {
+			return err
+		}
+
+		if err := email.Cancel(entity.EventSource{Actor: entity.ActorAPI}, reason); err != nil {
+			return err
+		}
+
+		return uc.emailRepo.Update(ctx, email)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	uc.metrics.EmailStatus(string(email.Status), "")
+	uc.logger.Info("Email cancelled", zap.Any("email_id", emailID))
+	return email, nil
+}
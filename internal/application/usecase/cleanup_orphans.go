@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+)
+
+const orphanLockName = "notification-service:orphans"
+
+// CleanupOrphansUseCase removes uploads that no email references once they
+// are older than the orphan TTL, including attachments left behind by
+// deleted emails. Only one replica runs it at a time.
+type CleanupOrphansUseCase struct {
+	deleteAttachmentUC *DeleteAttachmentUseCase
+	locker             repository.Locker
+	ttl                time.Duration
+	logger             *logger.Logger
+}
+
+func NewCleanupOrphansUseCase(
+	deleteAttachmentUC *DeleteAttachmentUseCase,
+	locker repository.Locker,
+	cfg config.StorageConfig,
+	logger *logger.Logger,
+) *CleanupOrphansUseCase {
+	return &CleanupOrphansUseCase{
+		deleteAttachmentUC: deleteAttachmentUC,
+		locker:             locker,
+		ttl:                time.Duration(cfg.OrphanTTL) * time.Hour,
+		logger:             logger,
+	}
+}
+
+// Execute removes all current orphans and returns how many were removed.
+// It does nothing if another replica is already running it.
+func (uc *CleanupOrphansUseCase) Execute(ctx context.Context) (int, error) {
+	release, acquired, err := uc.locker.TryLock(ctx, orphanLockName)
+	if err != nil {
+		return 0, err
+	}
+
+	if !acquired {
+		uc.logger.Debug("Orphan cleanup is running on another replica")
+		return 0, nil
+	}
+	defer release()
+
+	total := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		removed, err := uc.deleteAttachmentUC.CleanupOrphans(ctx, uc.ttl)
+		total += removed
+		if err != nil {
+			return total, err
+		}
+
+		if removed < orphanBatchSize {
+			return total, nil
+		}
+	}
+}
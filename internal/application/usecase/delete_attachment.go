@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const orphanBatchSize = 100
+
+type DeleteAttachmentUseCase struct {
+	attachmentRepo repository.AttachmentRepository
+	storage        service.FileStorage
+	logger         *logger.Logger
+}
+
+func NewDeleteAttachmentUseCase(
+	attachmentRepo repository.AttachmentRepository,
+	storage service.FileStorage,
+	logger *logger.Logger,
+) *DeleteAttachmentUseCase {
+	return &DeleteAttachmentUseCase{
+		attachmentRepo: attachmentRepo,
+		storage:        storage,
+		logger:         logger,
+	}
+}
+
+// Execute deletes an attachment that no email references. Clients other
+// than admins may only delete their own attachments; while other clients
+// uploaded the same content, only their ownership is removed.
+func (uc *DeleteAttachmentUseCase) Execute(ctx context.Context, id uuid.UUID) error {
+	attachment, err := uc.attachmentRepo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if owner := attachmentOwner(ctx); owner != "" {
+		owners, err := uc.attachmentRepo.FindOwners(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(owners, owner) {
+			return fmt.Errorf("%w: attachment %s", apperrors.ErrNotFound, id)
+		}
+
+		if len(owners) > 1 {
+			return uc.attachmentRepo.RemoveOwner(ctx, id, owner)
+		}
+	}
+
+	if err := uc.attachmentRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if err := uc.storage.Delete(ctx, attachment.Path); err != nil {
+		uc.logger.Warn("Failed to delete attachment file", zap.Any("attachment_id", id), zap.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// CleanupOrphans deletes attachments older than ttl that no email
+// references, and returns how many were removed.
+func (uc *DeleteAttachmentUseCase) CleanupOrphans(ctx context.Context, ttl time.Duration) (int, error) {
+	orphans, err := uc.attachmentRepo.FindOrphans(ctx, time.Now().UTC().Add(-ttl), orphanBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for _, att := range orphans {
+		if err := uc.Execute(ctx, att.ID); err != nil {
+			// Referenced or removed since it was listed
+			if errors.Is(err, apperrors.ErrAttachmentInUse) || errors.Is(err, apperrors.ErrNotFound) {
+				continue
+			}
+			return removed, err
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		uc.logger.Info("Orphan attachments removed", zap.Int("count", removed))
+	}
+
+	return removed, nil
+}
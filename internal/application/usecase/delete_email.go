@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type DeleteEmailUseCase struct {
+	emailRepo repository.EmailRepository
+	logger    *logger.Logger
+}
+
+func NewDeleteEmailUseCase(emailRepo repository.EmailRepository, logger *logger.Logger) *DeleteEmailUseCase {
+	return &DeleteEmailUseCase{
+		emailRepo: emailRepo,
+		logger:    logger,
+	}
+}
+
+// Execute soft deletes the email: it is kept in the database but hidden from reads.
+func (uc *DeleteEmailUseCase) Execute(ctx context.Context, emailID uuid.UUID) error {
+	email, err := uc.emailRepo.FindByID(ctx, emailID)
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeEmail(ctx, email); err != nil {
+		return err
+	}
+
+	if err := uc.emailRepo.SoftDelete(ctx, emailID); err != nil {
+		return err
+	}
+
+	uc.logger.Info("Email deleted", zap.Any("email_id", emailID))
+	return nil
+}
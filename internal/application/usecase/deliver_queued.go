@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const deliveryLockName = "notification-service:delivery"
+
+// DeliverQueuedUseCase sends the queued emails that are due, such as those
+// deferred while their recipient domain was at its sending limit. Only one
+// replica runs it at a time.
+type DeliverQueuedUseCase struct {
+	emailRepo   repository.EmailRepository
+	locker      repository.Locker
+	sendEmailUC *SendEmailUseCase
+	metrics     *metrics.Metrics
+	batchSize   int
+	logger      *logger.Logger
+}
+
+func NewDeliverQueuedUseCase(
+	emailRepo repository.EmailRepository,
+	locker repository.Locker,
+	sendEmailUC *SendEmailUseCase,
+	metrics *metrics.Metrics,
+	cfg config.ThrottleConfig,
+	logger *logger.Logger,
+) *DeliverQueuedUseCase {
+	return &DeliverQueuedUseCase{
+		emailRepo:   emailRepo,
+		locker:      locker,
+		sendEmailUC: sendEmailUC,
+		metrics:     metrics,
+		batchSize:   max(cfg.BatchSize, 1),
+		logger:      logger,
+	}
+}
+
+// Execute sends one batch of due emails and returns how many were sent.
+// Emails still over a limit are deferred again; failed sends are logged and
+// left failed.
+func (uc *DeliverQueuedUseCase) Execute(ctx context.Context) (sent int, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "DeliverQueuedUseCase.Execute")
+	defer func() { tracing.End(span, err) }()
+
+	release, acquired, err := uc.locker.TryLock(ctx, deliveryLockName)
+	if err != nil {
+		return 0, err
+	}
+
+	if !acquired {
+		uc.logger.Debug("Delivery is running on another replica")
+		return 0, nil
+	}
+	defer release()
+
+	ids, err := uc.emailRepo.ListDue(ctx, time.Now().UTC(), uc.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+
+		email, err := uc.emailRepo.FindByID(ctx, id)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		// Cancelled or sent since it was listed
+		if email.Status != entity.StatusQueued {
+			continue
+		}
+
+		uc.metrics.Retry("queued")
+
+		if uc.deliver(ctx, email) {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		uc.logger.Info("Queued emails sent", zap.Int("count", sent), zap.Int("due", len(ids)))
+	}
+
+	return sent, nil
+}
+
+// deliver sends one email, continuing the trace of the request that queued
+// it, and reports whether it was sent.
+func (uc *DeliverQueuedUseCase) deliver(ctx context.Context, email *entity.Email) bool {
+	run := trace.LinkFromContext(ctx)
+
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, email.TraceContext), "DeliverQueuedUseCase.deliver",
+		trace.WithLinks(run),
+		trace.WithAttributes(attribute.String("email.id", email.ID.String())),
+	)
+
+	email, err := uc.sendEmailUC.Deliver(ctx, email)
+	tracing.End(span, err)
+
+	if err != nil {
+		uc.logger.Error("Failed to deliver queued email", zap.String("error", err.Error()), zap.Any("email_id", email.ID))
+		return false
+	}
+
+	return email.Status == entity.StatusSent
+}
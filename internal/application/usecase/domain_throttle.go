@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+)
+
+// throttleWindow is the window of the per minute limits.
+const throttleWindow = time.Minute
+
+// DomainThrottle limits the messages sent to each configured recipient
+// domain at once and per minute. The counts are kept in memory, so each
+// replica applies the limits on its own.
+type DomainThrottle struct {
+	limits map[string]config.DomainLimit
+	// busyDelay is how long an email waits when a domain has no free
+	// connection; one will usually be free by the next worker run.
+	busyDelay time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]int
+	started  map[string][]time.Time
+}
+
+func NewDomainThrottle(cfg config.ThrottleConfig) *DomainThrottle {
+	limits := make(map[string]config.DomainLimit, len(cfg.Domains))
+	for domain, limit := range cfg.Domains {
+		limits[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))] = limit
+	}
+
+	return &DomainThrottle{
+		limits:    limits,
+		busyDelay: time.Duration(max(cfg.Interval, 1)) * time.Second,
+		inFlight:  make(map[string]int),
+		started:   make(map[string][]time.Time),
+	}
+}
+
+// Acquire reserves a send of one message to the domains of the recipients
+// that will be offered to the relay. The caller must call release once the
+// send is over. When a domain is at its limit, release is nil and the
+// domain is returned with the time to try again.
+func (t *DomainThrottle) Acquire(recipients []entity.Recipient, now time.Time) (release func(), domain string, retryAt time.Time) {
+	keys := t.keys(recipients)
+	if len(keys) == 0 {
+		return func() {}, "", time.Time{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		if retryAt, ok := t.check(key, now); !ok {
+			return nil, key, retryAt
+		}
+	}
+
+	for _, key := range keys {
+		t.inFlight[key]++
+		t.started[key] = append(t.started[key], now)
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			for _, key := range keys {
+				t.inFlight[key]--
+			}
+		})
+	}, "", time.Time{}
+}
+
+// check reports whether a message may be sent to the domain, or else when
+// to try again. Callers must hold the lock.
+func (t *DomainThrottle) check(key string, now time.Time) (time.Time, bool) {
+	limit := t.limits[key]
+
+	// Drop the starts that left the window
+	started := t.started[key]
+	for len(started) > 0 && !started[0].After(now.Add(-throttleWindow)) {
+		started = started[1:]
+	}
+	t.started[key] = started
+
+	if limit.PerMinute > 0 && len(started) >= limit.PerMinute {
+		return started[len(started)-limit.PerMinute].Add(throttleWindow), false
+	}
+
+	if limit.Concurrency > 0 && t.inFlight[key] >= limit.Concurrency {
+		return now.Add(t.busyDelay), false
+	}
+
+	return time.Time{}, true
+}
+
+// keys returns the limited domains the recipients are counted under, once
+// each. A domain is counted under the closest configured parent.
+func (t *DomainThrottle) keys(recipients []entity.Recipient) []string {
+	var keys []string
+
+	for _, recipient := range recipients {
+		if recipient.Status != entity.RecipientPending {
+			continue
+		}
+
+		for domain := recipient.Domain(); domain != ""; {
+			if _, ok := t.limits[domain]; ok {
+				if !slices.Contains(keys, domain) {
+					keys = append(keys, domain)
+				}
+				break
+			}
+
+			_, parent, found := strings.Cut(domain, ".")
+			if !found {
+				break
+			}
+			domain = parent
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+)
+
+func TestDomainThrottle(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	to := func(addresses ...string) []entity.Recipient {
+		return entity.NewRecipients(addresses, nil, nil)
+	}
+
+	t.Run("Concurrency", func(t *testing.T) {
+		throttle := NewDomainThrottle(config.ThrottleConfig{
+			Interval: 10,
+			Domains:  map[string]config.DomainLimit{"Gmail.com": {Concurrency: 1}},
+		})
+
+		release, _, _ := throttle.Acquire(to("a@gmail.com"), now)
+		if release == nil {
+			t.Fatal("first send throttled")
+		}
+
+		if r, domain, retryAt := throttle.Acquire(to("b@GMAIL.com"), now); r != nil || domain != "gmail.com" || !retryAt.Equal(now.Add(10*time.Second)) {
+			t.Errorf("second send = %v, %q, %v, want throttled on gmail.com until the next run", r != nil, domain, retryAt)
+		}
+
+		// Other domains are not limited
+		if r, _, _ := throttle.Acquire(to("c@example.com"), now); r == nil {
+			t.Error("unlimited domain throttled")
+		}
+
+		release()
+		release()
+
+		if r, _, _ := throttle.Acquire(to("b@gmail.com"), now); r == nil {
+			t.Error("send throttled after release")
+		}
+	})
+
+	t.Run("PerMinute", func(t *testing.T) {
+		throttle := NewDomainThrottle(config.ThrottleConfig{
+			Domains: map[string]config.DomainLimit{"mail.ru": {PerMinute: 2}},
+		})
+
+		for i := range 2 {
+			release, _, _ := throttle.Acquire(to("a@mail.ru"), now.Add(time.Duration(i)*time.Second))
+			if release == nil {
+				t.Fatalf("send %d throttled", i)
+			}
+			release()
+		}
+
+		// Subdomains count against their parent
+		r, domain, retryAt := throttle.Acquire(to("a@corp.mail.ru"), now.Add(30*time.Second))
+		if r != nil || domain != "mail.ru" || !retryAt.Equal(now.Add(time.Minute)) {
+			t.Errorf("third send = %v, %q, %v, want throttled on mail.ru until the first leaves the window", r != nil, domain, retryAt)
+		}
+
+		if r, _, _ := throttle.Acquire(to("a@mail.ru"), now.Add(time.Minute)); r == nil {
+			t.Error("send throttled after the window moved on")
+		}
+	})
+
+	t.Run("SkipsSettledRecipients", func(t *testing.T) {
+		throttle := NewDomainThrottle(config.ThrottleConfig{
+			Domains: map[string]config.DomainLimit{"yandex.ru": {Concurrency: 1}},
+		})
+
+		if release, _, _ := throttle.Acquire(to("a@yandex.ru"), now); release == nil {
+			t.Fatal("first send throttled")
+		}
+
+		recipients := to("b@yandex.ru", "c@example.com")
+		if err := recipients[0].MarkAsSuppressed("suppressed: unsubscribe"); err != nil {
+			t.Fatalf("MarkAsSuppressed: %v", err)
+		}
+
+		if r, _, _ := throttle.Acquire(recipients, now); r == nil {
+			t.Error("send throttled on a suppressed recipient")
+		}
+	})
+}
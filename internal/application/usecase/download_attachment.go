@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+type DownloadAttachmentUseCase struct {
+	emailRepo repository.EmailRepository
+	storage   service.FileStorage
+}
+
+func NewDownloadAttachmentUseCase(
+	emailRepo repository.EmailRepository,
+	storage service.FileStorage,
+) *DownloadAttachmentUseCase {
+	return &DownloadAttachmentUseCase{
+		emailRepo: emailRepo,
+		storage:   storage,
+	}
+}
+
+// Execute opens the content of an attachment sent with the given email.
+// The caller must close the returned reader.
+func (uc *DownloadAttachmentUseCase) Execute(
+	ctx context.Context,
+	emailID uuid.UUID,
+	attachmentID uuid.UUID,
+) (*entity.Attachment, io.ReadCloser, error) {
+	email, err := uc.emailRepo.FindByID(ctx, emailID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := authorizeEmail(ctx, email); err != nil {
+		return nil, nil, err
+	}
+
+	for _, att := range email.Attachments {
+		if att.ID != attachmentID {
+			continue
+		}
+
+		if att.PurgedAt != nil {
+			return nil, nil, apperrors.ErrGone
+		}
+
+		content, err := uc.storage.Open(ctx, att.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open attachment: %w", err)
+		}
+
+		return &att, content, nil
+	}
+
+	return nil, nil, apperrors.ErrNotFound
+}
@@ -0,0 +1,73 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// EraseAddressUseCase removes an email address and the content sent to or
+// from it, keeping anonymized status data for statistics.
+type EraseAddressUseCase struct {
+	erasureRepo        repository.ErasureRepository
+	deleteAttachmentUC *DeleteAttachmentUseCase
+	logger             *logger.Logger
+}
+
+func NewEraseAddressUseCase(
+	erasureRepo repository.ErasureRepository,
+	deleteAttachmentUC *DeleteAttachmentUseCase,
+	logger *logger.Logger,
+) *EraseAddressUseCase {
+	return &EraseAddressUseCase{
+		erasureRepo:        erasureRepo,
+		deleteAttachmentUC: deleteAttachmentUC,
+		logger:             logger,
+	}
+}
+
+func (uc *EraseAddressUseCase) Execute(ctx context.Context, address string) (*entity.ErasureReport, error) {
+	report := entity.NewErasureReport(address)
+
+	emailIDs, attachmentIDs, err := uc.erasureRepo.EraseAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	report.EmailIDs = emailIDs
+
+	// Attachments shared with emails of other recipients are kept
+	for _, id := range attachmentIDs {
+		err := uc.deleteAttachmentUC.Execute(ctx, id)
+		if errors.Is(err, apperrors.ErrAttachmentInUse) || errors.Is(err, apperrors.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete attachment %s: %w", id, err)
+		}
+
+		report.AttachmentIDs = append(report.AttachmentIDs, id)
+	}
+
+	if err := uc.erasureRepo.SaveReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	uc.logger.Info("Address erased",
+		zap.Any("erasure_id", report.ID),
+		zap.Int("emails", len(report.EmailIDs)),
+		zap.Int("attachments", len(report.AttachmentIDs)))
+
+	return report, nil
+}
+
+func (uc *EraseAddressUseCase) GetReport(ctx context.Context, id uuid.UUID) (*entity.ErasureReport, error) {
+	return uc.erasureRepo.FindReport(ctx, id)
+}
@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+type GetEmailEventsUseCase struct {
+	emailRepo repository.EmailRepository
+	eventRepo repository.EmailEventRepository
+}
+
+func NewGetEmailEventsUseCase(emailRepo repository.EmailRepository, eventRepo repository.EmailEventRepository) *GetEmailEventsUseCase {
+	return &GetEmailEventsUseCase{
+		emailRepo: emailRepo,
+		eventRepo: eventRepo,
+	}
+}
+
+// Execute returns the timeline of an email, including one removed by
+// retention. Soft deleted emails are not found.
+func (uc *GetEmailEventsUseCase) Execute(ctx context.Context, emailID uuid.UUID) ([]entity.EmailEvent, error) {
+	email, err := uc.emailRepo.FindByID(ctx, emailID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		email, err = uc.emailRepo.FindTombstone(ctx, emailID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeEmail(ctx, email); err != nil {
+		return nil, err
+	}
+
+	return uc.eventRepo.FindByEmailID(ctx, emailID)
+}
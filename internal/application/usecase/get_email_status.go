@@ -2,22 +2,46 @@ package usecase
 
 import (
 	"context"
+	"errors"
 
 	"github.com/an3wers/notification-serv/internal/domain/entity"
 	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
 	"github.com/google/uuid"
 )
 
 type GetEmailStatusUseCase struct {
 	emailRepo repository.EmailRepository
+	links     *AttachmentLinks
 }
 
-func NewGetEmailStatusUseCase(emailRepo repository.EmailRepository) *GetEmailStatusUseCase {
+func NewGetEmailStatusUseCase(emailRepo repository.EmailRepository, links *AttachmentLinks) *GetEmailStatusUseCase {
 	return &GetEmailStatusUseCase{
 		emailRepo: emailRepo,
+		links:     links,
 	}
 }
 
 func (uc *GetEmailStatusUseCase) Execute(ctx context.Context, emailID uuid.UUID) (*entity.Email, error) {
-	return uc.emailRepo.FindByID(ctx, emailID)
+	email, err := uc.emailRepo.FindByID(ctx, emailID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		// Removed by retention, only the status is left
+		email, err = uc.emailRepo.FindTombstone(ctx, emailID)
+		if err != nil {
+			return nil, err
+		}
+
+		return email, authorizeEmail(ctx, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeEmail(ctx, email); err != nil {
+		return nil, err
+	}
+
+	uc.links.Populate(email)
+
+	return email, nil
 }
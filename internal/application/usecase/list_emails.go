@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// EmailPage is one page of a listing. NextBefore and NextBeforeID are set
+// when more emails follow.
+type EmailPage struct {
+	Emails       []entity.Email
+	NextBefore   *time.Time
+	NextBeforeID *uuid.UUID
+}
+
+type ListEmailsUseCase struct {
+	emailRepo repository.EmailRepository
+}
+
+func NewListEmailsUseCase(emailRepo repository.EmailRepository) *ListEmailsUseCase {
+	return &ListEmailsUseCase{emailRepo: emailRepo}
+}
+
+// Execute lists emails newest first. A missing limit defaults to 50, and at
+// most 200 emails are returned at once. Clients other than admins only see
+// their own emails.
+func (uc *ListEmailsUseCase) Execute(ctx context.Context, filter repository.EmailFilter) (*EmailPage, error) {
+	if client := ClientFromContext(ctx); client != nil && !client.HasScope(entity.ScopeAdmin) {
+		filter.ClientID = &client.ID
+	}
+
+	switch {
+	case filter.Limit < 0:
+		return nil, fmt.Errorf("%w: negative limit", apperrors.ErrInvalidInput)
+	case filter.Limit == 0:
+		filter.Limit = defaultListLimit
+	case filter.Limit > maxListLimit:
+		filter.Limit = maxListLimit
+	}
+
+	// One more email tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+
+	emails, err := uc.emailRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &EmailPage{Emails: emails}
+
+	if len(emails) > limit {
+		page.Emails = emails[:limit]
+		last := page.Emails[limit-1]
+		page.NextBefore = &last.CreatedAt
+		page.NextBeforeID = &last.ID
+	}
+
+	return page, nil
+}
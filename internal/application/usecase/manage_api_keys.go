@@ -0,0 +1,116 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// APIKeyInput describes the client a key is issued to. Empty allowed
+// senders and templates allow any.
+type APIKeyInput struct {
+	Name             string
+	Scopes           []string
+	AllowedSenders   []string
+	AllowedTemplates []string
+}
+
+type ManageAPIKeysUseCase struct {
+	apiKeyRepo repository.APIKeyRepository
+	signing    *SigningKeys
+	logger     *logger.Logger
+}
+
+func NewManageAPIKeysUseCase(apiKeyRepo repository.APIKeyRepository, signing *SigningKeys, logger *logger.Logger) *ManageAPIKeysUseCase {
+	return &ManageAPIKeysUseCase{
+		apiKeyRepo: apiKeyRepo,
+		signing:    signing,
+		logger:     logger,
+	}
+}
+
+// Create issues a key to a client. The key is returned only here.
+func (uc *ManageAPIKeysUseCase) Create(ctx context.Context, input APIKeyInput) (*entity.APIKey, string, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: a client name is required", apperrors.ErrInvalidInput)
+	}
+
+	scopes, err := entity.ParseScopes(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", apperrors.ErrInvalidInput)
+	}
+
+	senders, err := entity.ParseSenders(input.AllowedSenders)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var templates []string
+	for _, template := range input.AllowedTemplates {
+		template = strings.TrimSpace(template)
+		if template == "" {
+			return nil, "", fmt.Errorf("%w: empty template name", apperrors.ErrInvalidInput)
+		}
+		if !slices.Contains(templates, template) {
+			templates = append(templates, template)
+		}
+	}
+
+	apiKey, key, err := entity.NewAPIKey(name, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey.AllowedSenders = senders
+	apiKey.AllowedTemplates = templates
+
+	apiKey.SealedSigningKey, err = uc.signing.Seal(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := uc.apiKeyRepo.Create(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+
+	uc.logger.Info("API key created",
+		zap.String("key_id", apiKey.ID.String()),
+		zap.String("name", apiKey.Name),
+		zap.Any("scopes", apiKey.Scopes),
+		zap.Strings("allowed_senders", apiKey.AllowedSenders))
+
+	return apiKey, key, nil
+}
+
+func (uc *ManageAPIKeysUseCase) List(ctx context.Context) ([]entity.APIKey, error) {
+	return uc.apiKeyRepo.List(ctx)
+}
+
+// Revoke stops a key from authenticating. Emails sent with it keep their
+// client.
+func (uc *ManageAPIKeysUseCase) Revoke(ctx context.Context, id uuid.UUID) (*entity.APIKey, error) {
+	if err := uc.apiKeyRepo.Revoke(ctx, id, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	apiKey, err := uc.apiKeyRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.logger.Info("API key revoked", zap.String("key_id", apiKey.ID.String()), zap.String("name", apiKey.Name))
+
+	return apiKey, nil
+}
@@ -0,0 +1,275 @@
+package usecase
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// exportBatchSize is how many entries Export reads at once.
+const exportBatchSize = 1000
+
+// suppressionColumns are the CSV columns of an export. Imports need the
+// address column only and ignore the ones they do not know.
+var suppressionColumns = []string{"address", "category", "reason", "source", "expires_at", "detail", "created_at"}
+
+// SuppressionInput is an entry added through the API or an import. A zero
+// reason is MANUAL, a zero category covers every email.
+type SuppressionInput struct {
+	Address   string
+	Category  string
+	Reason    string
+	Detail    string
+	ExpiresAt *time.Time
+}
+
+// SuppressionPage is one page of a listing. Next is the last entry when
+// more entries follow.
+type SuppressionPage struct {
+	Suppressions []entity.Suppression
+	Next         *entity.Suppression
+}
+
+type ManageSuppressionsUseCase struct {
+	suppressionRepo repository.SuppressionRepository
+	transactor      repository.Transactor
+	logger          *logger.Logger
+}
+
+func NewManageSuppressionsUseCase(
+	suppressionRepo repository.SuppressionRepository,
+	transactor repository.Transactor,
+	logger *logger.Logger,
+) *ManageSuppressionsUseCase {
+	return &ManageSuppressionsUseCase{
+		suppressionRepo: suppressionRepo,
+		transactor:      transactor,
+		logger:          logger,
+	}
+}
+
+// Add suppresses an address, replacing its entry if it has one.
+func (uc *ManageSuppressionsUseCase) Add(ctx context.Context, input SuppressionInput) (*entity.Suppression, error) {
+	suppression, err := newSuppression(input, entity.SuppressionSourceAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := uc.suppressionRepo.Upsert(ctx, suppression); err != nil {
+		return nil, err
+	}
+
+	uc.logger.Info("Address suppressed",
+		zap.String("reason", string(suppression.Reason)),
+		zap.String("address_hash", entity.HashAddress(suppression.Address)))
+
+	return suppression, nil
+}
+
+func (uc *ManageSuppressionsUseCase) Get(ctx context.Context, address, category string) (*entity.Suppression, error) {
+	return uc.suppressionRepo.Find(ctx, address, category)
+}
+
+// Remove lets the address receive emails of the category again.
+func (uc *ManageSuppressionsUseCase) Remove(ctx context.Context, address, category string) error {
+	if err := uc.suppressionRepo.Delete(ctx, address, category); err != nil {
+		return err
+	}
+
+	uc.logger.Info("Address unsuppressed", zap.String("address_hash", entity.HashAddress(address)))
+
+	return nil
+}
+
+// List returns entries ordered by address. A missing limit defaults to 50,
+// and at most 200 entries are returned at once.
+func (uc *ManageSuppressionsUseCase) List(ctx context.Context, filter repository.SuppressionFilter) (*SuppressionPage, error) {
+	switch {
+	case filter.Limit < 0:
+		return nil, fmt.Errorf("%w: negative limit", apperrors.ErrInvalidInput)
+	case filter.Limit == 0:
+		filter.Limit = defaultListLimit
+	case filter.Limit > maxListLimit:
+		filter.Limit = maxListLimit
+	}
+
+	// One more entry tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+
+	suppressions, err := uc.suppressionRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SuppressionPage{Suppressions: suppressions}
+
+	if len(suppressions) > limit {
+		page.Suppressions = suppressions[:limit]
+		page.Next = &page.Suppressions[limit-1]
+	}
+
+	return page, nil
+}
+
+// Import adds the entries of a CSV file with a header row, all or none.
+// Columns are found by name: address is required, category, reason,
+// expires_at (RFC 3339) and detail are optional. It returns the number of entries.
+func (uc *ManageSuppressionsUseCase) Import(ctx context.Context, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("%w: missing CSV header: %v", apperrors.ErrInvalidInput, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["address"]; !ok {
+		return 0, fmt.Errorf("%w: CSV header has no address column", apperrors.ErrInvalidInput)
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var suppressions []*entity.Suppression
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", apperrors.ErrInvalidInput, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		input := SuppressionInput{
+			Address:  field(record, "address"),
+			Category: field(record, "category"),
+			Reason:   field(record, "reason"),
+			Detail:   field(record, "detail"),
+		}
+
+		if value := field(record, "expires_at"); value != "" {
+			expiresAt, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return 0, fmt.Errorf("%w: line %d: expires_at must be an RFC 3339 time", apperrors.ErrInvalidInput, line)
+			}
+			input.ExpiresAt = &expiresAt
+		}
+
+		suppression, err := newSuppression(input, entity.SuppressionSourceImport)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		suppressions = append(suppressions, suppression)
+	}
+
+	err = uc.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		for _, suppression := range suppressions {
+			if err := uc.suppressionRepo.Upsert(ctx, suppression); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to import suppressions: %w", err)
+	}
+
+	uc.logger.Info("Suppressions imported", zap.Int("count", len(suppressions)))
+
+	return len(suppressions), nil
+}
+
+// Export writes every entry as CSV, ordered by address.
+func (uc *ManageSuppressionsUseCase) Export(ctx context.Context, w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(suppressionColumns); err != nil {
+		return err
+	}
+
+	filter := repository.SuppressionFilter{Limit: exportBatchSize}
+
+	for {
+		suppressions, err := uc.suppressionRepo.List(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range suppressions {
+			var expiresAt, detail string
+			if s.ExpiresAt != nil {
+				expiresAt = s.ExpiresAt.UTC().Format(time.RFC3339)
+			}
+			if s.Detail != nil {
+				detail = *s.Detail
+			}
+
+			record := []string{s.Address, s.Category, string(s.Reason), string(s.Source), expiresAt, detail, s.CreatedAt.UTC().Format(time.RFC3339)}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+
+		if len(suppressions) < exportBatchSize {
+			break
+		}
+
+		last := suppressions[len(suppressions)-1]
+		filter.After, filter.AfterCategory = last.Address, last.Category
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func newSuppression(input SuppressionInput, source entity.SuppressionSource) (*entity.Suppression, error) {
+	addr, err := mail.ParseAddress(input.Address)
+	if err != nil || addr.Address != strings.TrimSpace(input.Address) {
+		return nil, fmt.Errorf("%w: invalid address %q", apperrors.ErrInvalidInput, input.Address)
+	}
+
+	reason := entity.SuppressionManual
+	if input.Reason != "" {
+		if reason, err = entity.ParseSuppressionReason(input.Reason); err != nil {
+			return nil, err
+		}
+	}
+
+	suppression := entity.NewSuppression(addr.Address, reason, source)
+	suppression.Category = input.Category
+	suppression.ExpiresAt = input.ExpiresAt
+
+	if input.Detail != "" {
+		suppression.Detail = &input.Detail
+	}
+
+	return suppression, nil
+}
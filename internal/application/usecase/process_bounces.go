@@ -0,0 +1,266 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/an3wers/notification-serv/internal/pkg/dsn"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/verp"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const bounceLockName = "notification-service:bounces"
+
+// bounceSource attributes status changes to bounce processing.
+var bounceSource = entity.EventSource{Actor: entity.ActorSystem, Provider: "dsn"}
+
+// BounceReport counts what one bounce processing pass did.
+type BounceReport struct {
+	Messages int
+	// Applied counts recipient outcomes recorded, Ignored messages that
+	// were not notifications or could not be traced to an email.
+	Applied int
+	Ignored int
+}
+
+// ProcessBouncesUseCase records the outcomes reported by delivery status
+// notifications, read from the bounce mailbox or posted to the inbound
+// endpoint. Notifications are traced to the email through the VERP return
+// path they were sent to, or else the Message-ID they quote.
+type ProcessBouncesUseCase struct {
+	mailbox               service.Mailbox
+	locker                repository.Locker
+	recordDeliveryEventUC *RecordDeliveryEventUseCase
+	returnPath            *verp.Encoder
+	cfg                   config.BounceConfig
+	logger                *logger.Logger
+}
+
+// NewProcessBouncesUseCase returns the use case. The mailbox is nil when
+// bounces only arrive through the inbound endpoint, and returnPath is nil
+// unless VERP is enabled.
+func NewProcessBouncesUseCase(
+	mailbox service.Mailbox,
+	locker repository.Locker,
+	recordDeliveryEventUC *RecordDeliveryEventUseCase,
+	returnPath *verp.Encoder,
+	cfg config.BounceConfig,
+	logger *logger.Logger,
+) *ProcessBouncesUseCase {
+	return &ProcessBouncesUseCase{
+		mailbox:               mailbox,
+		locker:                locker,
+		recordDeliveryEventUC: recordDeliveryEventUC,
+		returnPath:            returnPath,
+		cfg:                   cfg,
+		logger:                logger,
+	}
+}
+
+// Execute processes one batch of unread messages from the mailbox. Only one
+// replica runs it at a time. Messages are marked as processed unless
+// recording their outcome failed, so those are retried on the next pass.
+func (uc *ProcessBouncesUseCase) Execute(ctx context.Context) (*BounceReport, error) {
+	if uc.mailbox == nil {
+		return nil, errors.New("no bounce mailbox configured")
+	}
+
+	release, acquired, err := uc.locker.TryLock(ctx, bounceLockName)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BounceReport{}
+
+	if !acquired {
+		uc.logger.Debug("Bounce processing is running on another replica")
+		return report, nil
+	}
+	defer release()
+
+	messages, err := uc.mailbox.Unread(ctx, uc.cfg.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bounce mailbox: %w", err)
+	}
+
+	var processed []string
+	var errs []error
+
+	for _, msg := range messages {
+		report.Messages++
+
+		applied, err := uc.ProcessMessage(ctx, nil, msg.Data)
+		if err != nil {
+			uc.logger.Error("Failed to process bounce", zap.String("message", msg.ID), zap.String("error", err.Error()))
+			errs = append(errs, err)
+			continue
+		}
+
+		if applied == 0 {
+			report.Ignored++
+		}
+		report.Applied += applied
+		processed = append(processed, msg.ID)
+	}
+
+	if err := uc.mailbox.MarkProcessed(ctx, processed...); err != nil {
+		errs = append(errs, fmt.Errorf("failed to mark bounces as processed: %w", err))
+	}
+
+	if report.Messages > 0 {
+		uc.logger.Info("Bounces processed",
+			zap.Int("messages", report.Messages), zap.Int("applied", report.Applied), zap.Int("ignored", report.Ignored))
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// ProcessMessage records the outcomes reported by one message and returns
+// how many were applied. envelopeTo lists the addresses the message was
+// delivered to when known; the Delivered-To, X-Original-To and To headers
+// are checked as well. Only unexpected failures are returned as errors: a
+// message that does not apply to any stored email is ignored.
+func (uc *ProcessBouncesUseCase) ProcessMessage(ctx context.Context, envelopeTo []string, data []byte) (int, error) {
+	notification, err := dsn.Parse(bytes.NewReader(data))
+	if err != nil {
+		uc.logger.Debug("Ignoring message that is not a bounce", zap.String("reason", err.Error()))
+		return 0, nil
+	}
+
+	emailID, position, found, err := uc.returnPathTarget(notification, envelopeTo)
+	if err != nil {
+		uc.logger.Warn("Ignoring bounce with an invalid return path", zap.String("reason", err.Error()))
+		return 0, nil
+	}
+
+	if found {
+		// The return path names a single recipient, whatever address the
+		// reporting server ended up delivering to
+		for _, rcpt := range notification.Recipients {
+			if outcome, ok := recipientOutcome(rcpt); ok {
+				report := uc.deliveryReport(emailID, rcpt, outcome)
+				report.RecipientPosition = &position
+				return uc.record(ctx, report)
+			}
+		}
+		return 0, nil
+	}
+
+	emailID, ok := entity.EmailIDFromMessageID(notification.OriginalMessageID)
+	if !ok {
+		uc.logger.Warn("Bounce does not reference a known message", zap.String("message_id", notification.OriginalMessageID))
+		return 0, nil
+	}
+
+	applied := 0
+
+	for _, rcpt := range notification.Recipients {
+		outcome, ok := recipientOutcome(rcpt)
+		if !ok {
+			continue
+		}
+
+		n, err := uc.record(ctx, uc.deliveryReport(emailID, rcpt, outcome))
+		if err != nil {
+			return applied, err
+		}
+		applied += n
+	}
+
+	return applied, nil
+}
+
+// returnPathTarget decodes the VERP return path the notification was sent
+// to. An address carrying a forged or damaged token is an error.
+func (uc *ProcessBouncesUseCase) returnPathTarget(notification *dsn.Report, envelopeTo []string) (uuid.UUID, int, bool, error) {
+	if uc.returnPath == nil {
+		return uuid.Nil, 0, false, nil
+	}
+
+	candidates := slices.Clone(envelopeTo)
+
+	for _, name := range []string{"Delivered-To", "X-Original-To", "To"} {
+		for _, value := range notification.Header[name] {
+			addresses, err := mail.ParseAddressList(value)
+			if err != nil {
+				continue
+			}
+			for _, addr := range addresses {
+				candidates = append(candidates, addr.Address)
+			}
+		}
+	}
+
+	for _, address := range candidates {
+		emailID, position, err := uc.returnPath.Decode(address)
+		if errors.Is(err, verp.ErrNotVERP) {
+			continue
+		}
+		if err != nil {
+			return uuid.Nil, 0, false, fmt.Errorf("%s: %w", address, err)
+		}
+		return emailID, position, true, nil
+	}
+
+	return uuid.Nil, 0, false, nil
+}
+
+func (uc *ProcessBouncesUseCase) deliveryReport(emailID uuid.UUID, rcpt dsn.Recipient, outcome entity.RecipientStatus) DeliveryReport {
+	detail := rcpt.Status
+	if rcpt.DiagnosticCode != "" {
+		detail = rcpt.DiagnosticCode
+	}
+
+	return DeliveryReport{
+		EmailID:   emailID,
+		Recipient: rcpt.Address(),
+		Outcome:   outcome,
+		Permanent: rcpt.Permanent(),
+		Code:      rcpt.SMTPCode(),
+		Detail:    detail,
+		Source:    bounceSource,
+	}
+}
+
+// record applies one outcome and returns 1 if it changed anything.
+func (uc *ProcessBouncesUseCase) record(ctx context.Context, report DeliveryReport) (int, error) {
+	_, err := uc.recordDeliveryEventUC.Execute(ctx, report)
+
+	switch {
+	case err == nil:
+		return 1, nil
+	case errors.Is(err, apperrors.ErrNotFound),
+		errors.Is(err, apperrors.ErrInvalidInput),
+		errors.Is(err, apperrors.ErrInvalidTransition):
+		// Unknown email or recipient, or a duplicate notification
+		uc.logger.Warn("Bounce does not apply", zap.Any("email_id", report.EmailID), zap.String("reason", err.Error()))
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+// recipientOutcome maps a DSN action to a recipient status. A failure with
+// a temporary status still means the server gave up, while delays and relays
+// are not final and are not recorded.
+func recipientOutcome(rcpt dsn.Recipient) (entity.RecipientStatus, bool) {
+	switch rcpt.Action {
+	case dsn.ActionFailed:
+		return entity.RecipientBounced, true
+	case dsn.ActionDelivered:
+		return entity.RecipientDelivered, true
+	default:
+		return "", false
+	}
+}
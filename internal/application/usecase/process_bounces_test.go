@@ -0,0 +1,269 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/infrastructure/mailbox"
+	"github.com/an3wers/notification-serv/internal/infrastructure/persistence/memory"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/verp"
+	"go.uber.org/zap"
+)
+
+type processBouncesFixture struct {
+	uc         *ProcessBouncesUseCase
+	returnPath *verp.Encoder
+	emails     *failingEmailRepository
+	store      *memory.Store
+	maildir    string
+}
+
+func newProcessBouncesFixture(t *testing.T) *processBouncesFixture {
+	t.Helper()
+
+	store := memory.NewStore()
+	log := &logger.Logger{Logger: zap.NewNop()}
+	dir := t.TempDir()
+
+	box, err := mailbox.NewMaildir(dir)
+	if err != nil {
+		t.Fatalf("NewMaildir: %v", err)
+	}
+
+	f := &processBouncesFixture{
+		emails:  &failingEmailRepository{EmailRepository: memory.NewEmailRepository(store)},
+		store:   store,
+		maildir: dir,
+	}
+
+	f.returnPath, err = verp.New("bounces@example.com", "key")
+	if err != nil {
+		t.Fatalf("verp.New: %v", err)
+	}
+
+	recordUC := NewRecordDeliveryEventUseCase(f.emails, memory.NewSuppressionRepository(store), memory.NewTransactor(store), metrics.New(), config.SuppressionConfig{}, log)
+	f.uc = NewProcessBouncesUseCase(box, memory.NewLocker(), recordUC, f.returnPath, config.BounceConfig{BatchSize: 10}, log)
+
+	return f
+}
+
+// sentEmail stores an email the relay accepted for all recipients.
+func (f *processBouncesFixture) sentEmail(t *testing.T, to ...string) *entity.Email {
+	t.Helper()
+
+	email := entity.NewEmail("sender@example.com", to, "", "Subject", "Body")
+	email.Recipients = entity.NewRecipients(to, nil, nil)
+
+	for i := range email.Recipients {
+		if err := email.Recipients[i].MarkAsAccepted(250, "OK"); err != nil {
+			t.Fatalf("MarkAsAccepted: %v", err)
+		}
+	}
+	if err := email.MarkAsSent(entity.EventSource{Actor: entity.ActorAPI}, "sent"); err != nil {
+		t.Fatalf("MarkAsSent: %v", err)
+	}
+	if err := f.emails.Create(context.Background(), email); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	return email
+}
+
+// deliver drops a message into the Maildir like a local delivery agent.
+func (f *processBouncesFixture) deliver(t *testing.T, name, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(f.maildir, "new", name), []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func (f *processBouncesFixture) unread(t *testing.T) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(filepath.Join(f.maildir, "new"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+// dsnMessage builds a delivery status notification sent to the given
+// address for one recipient of the message with the given Message-ID. An
+// empty Message-ID leaves out the returned header.
+func dsnMessage(to, messageID, recipient, action, status, diagnostic string) string {
+	returned := ""
+	if messageID != "" {
+		returned = "--b\nContent-Type: text/rfc822-headers\n\nMessage-ID: " + messageID + "\nSubject: Subject\n\n"
+	}
+
+	return strings.ReplaceAll(fmt.Sprintf(`From: MAILER-DAEMON@mx.example.org
+To: %s
+Subject: Delivery Status Notification
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b"
+
+--b
+Content-Type: text/plain
+
+Delivery report.
+
+--b
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+
+Final-Recipient: rfc822; %s
+Action: %s
+Status: %s
+Diagnostic-Code: %s
+
+%s--b--
+`, to, recipient, action, status, diagnostic, returned), "\n", "\r\n")
+}
+
+func TestProcessBounces(t *testing.T) {
+	ctx := context.Background()
+	f := newProcessBouncesFixture(t)
+
+	email := f.sentEmail(t, "gone@example.org", "here@example.org")
+
+	f.deliver(t, "1.M1.mx", dsnMessage("bounces@example.com", email.MessageID(), "gone@example.org", "failed", "5.1.1", "smtp; 550 5.1.1 User unknown"))
+	f.deliver(t, "2.M2.mx", dsnMessage("bounces@example.com", email.MessageID(), "here@example.org", "delivered", "2.0.0", "smtp; 250 2.0.0 OK"))
+	f.deliver(t, "3.M3.mx", dsnMessage("bounces@example.com", email.MessageID(), "here@example.org", "delayed", "4.4.7", "smtp; 421 try later"))
+	f.deliver(t, "4.M4.mx", dsnMessage("bounces@example.com", "<unrelated@example.net>", "gone@example.org", "failed", "5.1.1", "smtp; 550"))
+	f.deliver(t, "5.M5.mx", "From: someone@example.org\r\nSubject: Out of office\r\n\r\nAway.\r\n")
+
+	report, err := f.uc.Execute(ctx)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if report.Messages != 5 || report.Applied != 2 || report.Ignored != 3 {
+		t.Errorf("report = %+v, want 5 messages, 2 applied, 3 ignored", report)
+	}
+	if unread := f.unread(t); len(unread) != 0 {
+		t.Errorf("unread after processing = %v", unread)
+	}
+
+	found, err := f.emails.FindByID(ctx, email.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if found.Status != entity.StatusDelivered {
+		t.Errorf("status = %s, want DELIVERED", found.Status)
+	}
+
+	gone := found.Recipient("gone@example.org")
+	if gone.Status != entity.RecipientBounced || gone.SMTPCode == nil || *gone.SMTPCode != 550 {
+		t.Errorf("bounced recipient = %+v", gone)
+	}
+	if here := found.Recipient("here@example.org"); here.Status != entity.RecipientDelivered {
+		t.Errorf("delivered recipient = %+v", here)
+	}
+
+	// The hard bounce suppressed its address
+	suppressions := memory.NewSuppressionRepository(f.store)
+
+	suppression, err := suppressions.Find(ctx, "gone@example.org", "")
+	if err != nil {
+		t.Fatalf("Find suppression: %v", err)
+	}
+	if suppression.Reason != entity.SuppressionHardBounce || suppression.Source != entity.SuppressionSourceBounce ||
+		suppression.EmailID == nil || *suppression.EmailID != email.ID {
+		t.Errorf("suppression = %+v, want a hard bounce of the email", suppression)
+	}
+	if _, err := suppressions.Find(ctx, "here@example.org", ""); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("delivered address suppressed: %v", err)
+	}
+
+	events, err := memory.NewEmailEventRepository(f.store).FindByEmailID(ctx, email.ID)
+	if err != nil {
+		t.Fatalf("FindByEmailID: %v", err)
+	}
+	if last := events[len(events)-1]; last.ToStatus != entity.StatusDelivered || last.Actor != entity.ActorSystem || last.Provider != "dsn" {
+		t.Errorf("last event = %+v, want DELIVERED by bounce processing", last)
+	}
+
+	// The same bounce again is a duplicate and is ignored
+	f.deliver(t, "6.M6.mx", dsnMessage("bounces@example.com", email.MessageID(), "gone@example.org", "failed", "5.1.1", "smtp; 550 5.1.1 User unknown"))
+
+	report, err = f.uc.Execute(ctx)
+	if err != nil || report.Messages != 1 || report.Ignored != 1 {
+		t.Errorf("second pass = %+v, %v, want the duplicate ignored", report, err)
+	}
+}
+
+func TestProcessBounces_KeepsFailedMessages(t *testing.T) {
+	f := newProcessBouncesFixture(t)
+
+	email := f.sentEmail(t, "gone@example.org")
+	f.emails.beforeUpdate = func(*entity.Email) error { return errors.New("database is down") }
+
+	f.deliver(t, "1.M1.mx", dsnMessage("bounces@example.com", email.MessageID(), "gone@example.org", "failed", "5.1.1", "smtp; 550"))
+
+	if _, err := f.uc.Execute(context.Background()); err == nil {
+		t.Fatal("Execute succeeded, want the update error")
+	}
+	if unread := f.unread(t); len(unread) != 1 {
+		t.Errorf("unread = %v, want the message kept for the next pass", unread)
+	}
+}
+
+func TestProcessBounces_VERP(t *testing.T) {
+	ctx := context.Background()
+	f := newProcessBouncesFixture(t)
+
+	email := f.sentEmail(t, "first@example.org", "forwarded@example.org")
+
+	// The second recipient forwards to another address and the bounce
+	// quotes no header, only the return path tells who bounced
+	returnPath := f.returnPath.Address(email.ID, 1)
+	f.deliver(t, "1.M1.mx", dsnMessage(returnPath, "", "elsewhere@example.net", "failed", "5.2.1", "smtp; 550 5.2.1 Mailbox disabled"))
+
+	forged := []byte(f.returnPath.Address(email.ID, 0))
+	forged[len("bounces+")+1] ^= 1
+	f.deliver(t, "2.M2.mx", dsnMessage(string(forged), email.MessageID(), "first@example.org", "failed", "5.1.1", "smtp; 550"))
+
+	report, err := f.uc.Execute(ctx)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if report.Applied != 1 || report.Ignored != 1 {
+		t.Errorf("report = %+v, want the VERP bounce applied and the forged one ignored", report)
+	}
+
+	found, err := f.emails.FindByID(ctx, email.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if rcpt := found.Recipient("forwarded@example.org"); rcpt.Status != entity.RecipientBounced {
+		t.Errorf("forwarded recipient = %+v, want BOUNCED", rcpt)
+	}
+	if rcpt := found.Recipient("first@example.org"); rcpt.Status != entity.RecipientAccepted {
+		t.Errorf("first recipient = %+v, want ACCEPTED", rcpt)
+	}
+
+	// The inbound endpoint passes the envelope recipient instead
+	data := dsnMessage("postmaster@example.com", "", "first@example.org", "delivered", "2.0.0", "smtp; 250 OK")
+
+	applied, err := f.uc.ProcessMessage(ctx, []string{f.returnPath.Address(email.ID, 0)}, []byte(data))
+	if err != nil || applied != 1 {
+		t.Fatalf("ProcessMessage = %d, %v, want 1 applied", applied, err)
+	}
+}
@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+// quotaPeriods are the periods every client is counted in, whether or not
+// they are limited, so usage can be reported.
+var quotaPeriods = []entity.QuotaPeriod{entity.QuotaDaily, entity.QuotaMonthly}
+
+// QuotaUseCase counts the emails clients create against their daily and
+// monthly quotas.
+type QuotaUseCase struct {
+	quotaRepo repository.QuotaRepository
+	cfg       config.RateLimitConfig
+}
+
+func NewQuotaUseCase(quotaRepo repository.QuotaRepository, cfg config.RateLimitConfig) *QuotaUseCase {
+	return &QuotaUseCase{
+		quotaRepo: quotaRepo,
+		cfg:       cfg,
+	}
+}
+
+func (uc *QuotaUseCase) limit(period entity.QuotaPeriod) int {
+	if period == entity.QuotaMonthly {
+		return uc.cfg.MonthlyQuota
+	}
+	return uc.cfg.DailyQuota
+}
+
+// Consume counts an email of the client in every period. A full quota
+// returns a QuotaError. It must run in the transaction creating the email,
+// so a failure in a later period or in saving the email takes the count
+// back. Clients without an ID, like the legacy secret, have no quota.
+func (uc *QuotaUseCase) Consume(ctx context.Context, client *entity.Client) error {
+	if client == nil || client.ID == "" {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	for _, period := range quotaPeriods {
+		start, end := period.Bounds(now)
+		limit := uc.limit(period)
+
+		ok, err := uc.quotaRepo.Consume(ctx, client.ID, period, start, 1, limit)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return &apperrors.QuotaError{Period: string(period), Limit: limit, ResetAt: end}
+		}
+	}
+
+	return nil
+}
+
+// Usage returns the usage of a client in the current periods. An empty
+// clientID means the client of the request; only admins see other clients.
+func (uc *QuotaUseCase) Usage(ctx context.Context, clientID string) ([]entity.QuotaUsage, error) {
+	client := ClientFromContext(ctx)
+
+	if clientID == "" && client != nil {
+		clientID = client.ID
+	}
+
+	if clientID == "" {
+		return nil, fmt.Errorf("%w: clientId is required for clients without quota", apperrors.ErrInvalidInput)
+	}
+
+	if client != nil && client.ID != clientID && !client.HasScope(entity.ScopeAdmin) {
+		return nil, fmt.Errorf("%w: quota of client %s", apperrors.ErrForbidden, clientID)
+	}
+
+	now := time.Now().UTC()
+	usage := make([]entity.QuotaUsage, 0, len(quotaPeriods))
+
+	for _, period := range quotaPeriods {
+		start, end := period.Bounds(now)
+
+		used, err := uc.quotaRepo.Usage(ctx, clientID, period, start)
+		if err != nil {
+			return nil, err
+		}
+
+		usage = append(usage, entity.QuotaUsage{
+			Period: period,
+			Limit:  uc.limit(period),
+			Used:   used,
+			Start:  start,
+			End:    end,
+		})
+	}
+
+	return usage, nil
+}
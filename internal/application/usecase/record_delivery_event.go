@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// conflictAttempts is how often a report is applied to a freshly read email
+// when the email keeps being updated concurrently.
+const conflictAttempts = 3
+
+// DeliveryReport is what was learned about a recipient after the relay
+// accepted the message, from a DSN or a provider webhook.
+type DeliveryReport struct {
+	EmailID   uuid.UUID
+	Recipient string
+	// RecipientPosition identifies the recipient by its position instead of
+	// Recipient, as VERP return paths do.
+	RecipientPosition *int
+	Outcome           entity.RecipientStatus
+	// Permanent marks a hard bounce, which suppresses the address.
+	Permanent bool
+	// Code is the SMTP status reported for the recipient, zero if unknown.
+	Code   int
+	Detail string
+	Source entity.EventSource
+}
+
+type RecordDeliveryEventUseCase struct {
+	emailRepo       repository.EmailRepository
+	suppressionRepo repository.SuppressionRepository
+	transactor      repository.Transactor
+	metrics         *metrics.Metrics
+	cfg             config.SuppressionConfig
+	logger          *logger.Logger
+}
+
+func NewRecordDeliveryEventUseCase(
+	emailRepo repository.EmailRepository,
+	suppressionRepo repository.SuppressionRepository,
+	transactor repository.Transactor,
+	metrics *metrics.Metrics,
+	cfg config.SuppressionConfig,
+	logger *logger.Logger,
+) *RecordDeliveryEventUseCase {
+	return &RecordDeliveryEventUseCase{
+		emailRepo:       emailRepo,
+		suppressionRepo: suppressionRepo,
+		transactor:      transactor,
+		metrics:         metrics,
+		cfg:             cfg,
+		logger:          logger,
+	}
+}
+
+// Execute applies a delivery report to the recipient and the status of the
+// email follows. Outcomes that contradict the recorded state, like a
+// delivery of a rejected address, return ErrInvalidTransition. Hard bounces
+// and complaints also put the address on the suppression list.
+func (uc *RecordDeliveryEventUseCase) Execute(ctx context.Context, report DeliveryReport) (*entity.Email, error) {
+	var email *entity.Email
+	var changed bool
+	var err error
+
+	// Reports for several recipients of an email often arrive together
+	for attempt := 1; ; attempt++ {
+		email, changed, err = uc.record(ctx, report)
+		if !errors.Is(err, apperrors.ErrConflict) || attempt == conflictAttempts {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		uc.metrics.EmailStatus(string(email.Status), report.Source.Provider)
+	}
+
+	uc.logger.Info("Delivery event recorded",
+		zap.Any("email_id", report.EmailID),
+		zap.String("outcome", string(report.Outcome)),
+		zap.String("actor", string(report.Source.Actor)),
+		zap.String("status", string(email.Status)))
+
+	return email, nil
+}
+
+// record applies the report and reports whether the status of the email
+// changed.
+func (uc *RecordDeliveryEventUseCase) record(ctx context.Context, report DeliveryReport) (*entity.Email, bool, error) {
+	var email *entity.Email
+	var previous entity.EmailStatus
+
+	err := uc.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		email, err = uc.emailRepo.FindByID(ctx, report.EmailID)
+		if err != nil {
+			return err
+		}
+
+		previous = email.Status
+		address := report.Recipient
+
+		if report.RecipientPosition != nil {
+			recipient := email.RecipientAt(*report.RecipientPosition)
+			if recipient == nil {
+				return fmt.Errorf("%w: email %s has no recipient %d", apperrors.ErrInvalidInput, email.ID, *report.RecipientPosition)
+			}
+			address = recipient.Address
+		}
+
+		err = email.RecordRecipientOutcome(report.Source, address, report.Outcome, report.Code, report.Detail)
+		if err != nil {
+			return err
+		}
+
+		if err := uc.emailRepo.Update(ctx, email); err != nil {
+			return err
+		}
+
+		return uc.suppress(ctx, email.ID, address, report)
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return email, email.Status != previous, nil
+}
+
+// suppress adds the address of a hard bounce or a complaint to the
+// suppression list.
+func (uc *RecordDeliveryEventUseCase) suppress(ctx context.Context, emailID uuid.UUID, address string, report DeliveryReport) error {
+	var reason entity.SuppressionReason
+	var days int
+
+	switch {
+	case report.Outcome == entity.RecipientComplained:
+		reason, days = entity.SuppressionComplaint, uc.cfg.ComplaintDays
+	case report.Outcome == entity.RecipientBounced && report.Permanent:
+		reason, days = entity.SuppressionHardBounce, uc.cfg.HardBounceDays
+	default:
+		return nil
+	}
+
+	source := entity.SuppressionSourceBounce
+	if report.Source.Actor == entity.ActorWebhook {
+		source = entity.SuppressionSourceWebhook
+	}
+
+	suppression := entity.NewSuppression(address, reason, source)
+	suppression.EmailID = &emailID
+
+	if report.Detail != "" {
+		suppression.Detail = &report.Detail
+	}
+	if days > 0 {
+		expiresAt := suppression.CreatedAt.AddDate(0, 0, days)
+		suppression.ExpiresAt = &expiresAt
+	}
+
+	if err := uc.suppressionRepo.Upsert(ctx, suppression); err != nil {
+		return err
+	}
+
+	uc.logger.Info("Address suppressed",
+		zap.Any("email_id", emailID),
+		zap.String("reason", string(reason)),
+		zap.String("address_hash", entity.HashAddress(address)))
+
+	return nil
+}
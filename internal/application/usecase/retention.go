@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const retentionLockName = "notification-service:retention"
+
+// RetentionUseCase deletes stored content once it is older than the
+// configured retention periods. Only one replica runs it at a time.
+type RetentionUseCase struct {
+	retentionRepo repository.RetentionRepository
+	locker        repository.Locker
+	storage       service.FileStorage
+	cfg           config.RetentionConfig
+	logger        *logger.Logger
+}
+
+func NewRetentionUseCase(
+	retentionRepo repository.RetentionRepository,
+	locker repository.Locker,
+	storage service.FileStorage,
+	cfg config.RetentionConfig,
+	logger *logger.Logger,
+) *RetentionUseCase {
+	return &RetentionUseCase{
+		retentionRepo: retentionRepo,
+		locker:        locker,
+		storage:       storage,
+		cfg:           cfg,
+		logger:        logger,
+	}
+}
+
+// Execute runs one retention pass. It does nothing if another replica is
+// already running one.
+func (uc *RetentionUseCase) Execute(ctx context.Context) error {
+	release, acquired, err := uc.locker.TryLock(ctx, retentionLockName)
+	if err != nil {
+		return err
+	}
+
+	if !acquired {
+		uc.logger.Debug("Retention is running on another replica")
+		return nil
+	}
+	defer release()
+
+	now := time.Now().UTC()
+
+	if days := uc.cfg.AttachmentDays; days > 0 {
+		if err := uc.purgeAttachments(ctx, now.AddDate(0, 0, -days)); err != nil {
+			return err
+		}
+	}
+
+	if days := uc.cfg.BodyDays; days > 0 {
+		err := uc.drain(ctx, "Email bodies redacted", func(limit int) ([]uuid.UUID, error) {
+			return uc.retentionRepo.RedactEmails(ctx, now.AddDate(0, 0, -days), limit)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if days := uc.cfg.EmailDays; days > 0 {
+		err := uc.drain(ctx, "Emails deleted", func(limit int) ([]uuid.UUID, error) {
+			return uc.retentionRepo.DeleteEmails(ctx, now.AddDate(0, 0, -days), limit)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (uc *RetentionUseCase) purgeAttachments(ctx context.Context, cutoff time.Time) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		attachments, err := uc.retentionRepo.FindExpiredAttachments(ctx, cutoff, uc.batchSize())
+		if err != nil {
+			return err
+		}
+
+		for _, att := range attachments {
+			purged, err := uc.retentionRepo.MarkAttachmentPurged(ctx, att.ID, cutoff)
+			if err != nil {
+				return err
+			}
+
+			// Referenced by a newer email since it was listed
+			if !purged {
+				continue
+			}
+
+			if err := uc.storage.Delete(ctx, att.Path); err != nil {
+				uc.logger.Warn("Failed to delete attachment file", zap.Any("attachment_id", att.ID), zap.String("error", err.Error()))
+				continue
+			}
+
+			uc.logger.Info("Attachment file purged",
+				zap.Any("attachment_id", att.ID), zap.String("path", att.Path), zap.Int64("size", att.Size))
+		}
+
+		if len(attachments) < uc.batchSize() {
+			return nil
+		}
+	}
+}
+
+// drain calls step with the batch size until it returns a partial batch.
+func (uc *RetentionUseCase) drain(ctx context.Context, message string, step func(limit int) ([]uuid.UUID, error)) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ids, err := step(uc.batchSize())
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			uc.logger.Info(message, zap.Int("count", len(ids)), zap.Any("email_ids", ids))
+		}
+
+		if len(ids) < uc.batchSize() {
+			return nil
+		}
+	}
+}
+
+func (uc *RetentionUseCase) batchSize() int {
+	if uc.cfg.BatchSize <= 0 {
+		return 100
+	}
+
+	return uc.cfg.BatchSize
+}
@@ -2,35 +2,75 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/an3wers/notification-serv/internal/application/dto"
 	"github.com/an3wers/notification-serv/internal/domain/entity"
 	"github.com/an3wers/notification-serv/internal/domain/repository"
 	"github.com/an3wers/notification-serv/internal/domain/service"
 	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
 	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type SendEmailUseCase struct {
-	emailRepo     repository.EmailRepository
-	emailProvider service.EmailProvider
-	cfg           config.SMTPConfig
-	logger        *logger.Logger
+	emailRepo       repository.EmailRepository
+	attachmentRepo  repository.AttachmentRepository
+	suppressionRepo repository.SuppressionRepository
+	transactor      repository.Transactor
+	emailProvider   service.EmailProvider
+	policy          *AttachmentPolicy
+	links           *AttachmentLinks
+	offloader       *AttachmentOffloader
+	quotas          *QuotaUseCase
+	throttle        *DomainThrottle
+	metrics         *metrics.Metrics
+	cfg             config.SMTPConfig
+	suppressionCfg  config.SuppressionConfig
+	logger          *logger.Logger
 }
 
 func NewSendEmailUseCase(
 	emailRepo repository.EmailRepository,
+	attachmentRepo repository.AttachmentRepository,
+	suppressionRepo repository.SuppressionRepository,
+	transactor repository.Transactor,
 	emailProvider service.EmailProvider,
+	policy *AttachmentPolicy,
+	links *AttachmentLinks,
+	offloader *AttachmentOffloader,
+	quotas *QuotaUseCase,
+	throttle *DomainThrottle,
+	metrics *metrics.Metrics,
 	cfg config.SMTPConfig,
+	suppressionCfg config.SuppressionConfig,
 	logger *logger.Logger,
 ) *SendEmailUseCase {
 	return &SendEmailUseCase{
-		emailRepo:     emailRepo,
-		emailProvider: emailProvider,
-		cfg:           cfg,
-		logger:        logger,
+		emailRepo:       emailRepo,
+		attachmentRepo:  attachmentRepo,
+		suppressionRepo: suppressionRepo,
+		transactor:      transactor,
+		emailProvider:   emailProvider,
+		policy:          policy,
+		links:           links,
+		offloader:       offloader,
+		quotas:          quotas,
+		throttle:        throttle,
+		metrics:         metrics,
+		cfg:             cfg,
+		suppressionCfg:  suppressionCfg,
+		logger:          logger,
 	}
 }
 
@@ -39,6 +79,22 @@ func (uc *SendEmailUseCase) Execute(
 	req *dto.SendEmailNormalizedRequest,
 	attachments []dto.AttachmentDTO,
 ) (*entity.Email, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "SendEmailUseCase.Execute")
+
+	email, err := uc.execute(ctx, req, attachments)
+	if email != nil {
+		span.SetAttributes(attribute.String("email.id", email.ID.String()), attribute.String("email.status", string(email.Status)))
+	}
+
+	tracing.End(span, err)
+	return email, err
+}
+
+func (uc *SendEmailUseCase) execute(
+	ctx context.Context,
+	req *dto.SendEmailNormalizedRequest,
+	attachments []dto.AttachmentDTO,
+) (*entity.Email, error) {
 
 	// Create email entity
 	var subject string
@@ -64,6 +120,10 @@ func (uc *SendEmailUseCase) Execute(
 		from = uc.cfg.From
 	}
 
+	if err := authorizeSend(ctx, from); err != nil {
+		return nil, err
+	}
+
 	var displayName string
 	if req.DisplayName != nil {
 		displayName = *req.DisplayName
@@ -75,37 +135,119 @@ func (uc *SendEmailUseCase) Execute(
 	email.CC = req.CC
 	email.BCC = req.BCC
 	email.HTML = req.HTML
+	email.Category = req.Category
+	email.ListUnsubscribe = req.ListUnsubscribe
+	email.Recipients = entity.NewRecipients(email.To, email.CC, email.BCC)
+
+	if client := ClientFromContext(ctx); client != nil && client.ID != "" {
+		email.ClientID = &client.ID
+	}
+
+	// Add uploaded attachments followed by previously stored ones
+	for i, id := range req.AttachmentIDs {
+		if slices.Contains(req.AttachmentIDs[:i], id) {
+			return nil, fmt.Errorf("%w: attachment %s listed twice", apperrors.ErrInvalidInput, id)
+		}
+		attachments = append(attachments, dto.AttachmentDTO{ID: id})
+	}
 
-	// Add attachments
 	for _, att := range attachments {
-		attachment := entity.NewAttachment(
-			email.ID,
-			att.Filename,
-			att.OriginalName,
-			att.Mimetype,
-			att.Size,
-			att.Path,
-			nil,
-		)
+		attachment, err := uc.findAttachment(ctx, att.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if att.OriginalName != "" {
+			attachment.OriginalName = att.OriginalName
+		}
 
 		email.Attachments = append(email.Attachments, *attachment)
 	}
 
-	// Save to database
-	if err := uc.emailRepo.Create(ctx, email); err != nil {
+	if err := uc.policy.CheckEmail(email.Attachments); err != nil {
+		return nil, err
+	}
+
+	uc.offloader.Mark(email)
+
+	suppressed, err := uc.suppress(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	email.RecordCreated(entity.EventSource{Actor: entity.ActorAPI})
+
+	// The email is kept, cancelled, so the refusal shows in its timeline
+	refused := len(suppressed) > 0 &&
+		(uc.suppressionCfg.Mode == config.SuppressionReject || len(suppressed) == len(email.Recipients))
+
+	if refused {
+		if err := email.Cancel(entity.EventSource{Actor: entity.ActorAPI}, "recipients suppressed: "+strings.Join(suppressed, ", ")); err != nil {
+			return nil, err
+		}
+	}
+
+	// Save the email with its attachment links atomically. Emails that
+	// will not be sent do not count against the quota.
+	err = uc.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if !refused {
+			if err := uc.quotas.Consume(ctx, ClientFromContext(ctx)); err != nil {
+				return err
+			}
+		}
+
+		return uc.emailRepo.Create(ctx, email)
+	})
+
+	if errors.Is(err, apperrors.ErrQuotaExceeded) {
+		uc.logger.Warn("Send quota exceeded", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	if err != nil {
 		uc.logger.Error("Failed to save email", zap.String("error", err.Error()))
 		return nil, fmt.Errorf("failed to save email: %w", err)
 	}
 
 	uc.logger.Info("Email saved to database", zap.Any("email_id", email.ID))
 
-	// Send email
-	result, err := uc.emailProvider.Send(ctx, email)
+	if refused {
+		uc.metrics.EmailStatus(string(email.Status), uc.emailProvider.Name())
+		uc.logger.Warn("Email not sent to suppressed recipients",
+			zap.Any("email_id", email.ID), zap.Int("suppressed", len(suppressed)))
+		return email, fmt.Errorf("%w: email %s not sent to %s", apperrors.ErrSuppressed, email.ID, strings.Join(suppressed, ", "))
+	}
+
+	return uc.Deliver(ctx, email)
+}
+
+// Deliver hands a saved email to the relay and records the outcome. When a
+// recipient domain is at its sending limit, the email is deferred rather
+// than failed and returned without an error, still queued.
+func (uc *SendEmailUseCase) Deliver(ctx context.Context, email *entity.Email) (*entity.Email, error) {
+	actor := entity.ActorAPI
+	if email.Status == entity.StatusQueued {
+		actor = entity.ActorWorker
+	}
+
+	source := entity.EventSource{Actor: actor, Provider: uc.emailProvider.Name()}
+
+	release, domain, retryAt := uc.throttle.Acquire(email.Recipients, time.Now().UTC())
+	if release == nil {
+		trace.SpanFromContext(ctx).AddEvent("throttled", trace.WithAttributes(attribute.String("email.domain", domain)))
+		return uc.deferSend(ctx, email, actor, domain, retryAt)
+	}
+	defer release()
+
+	if err := uc.claim(ctx, email, source); err != nil {
+		return email, err
+	}
+
+	result, err := uc.emailProvider.Send(ctx, uc.offloader.Message(email))
 
 	if err != nil {
 		uc.logger.Error("Failed to send email", zap.String("error", err.Error()), zap.Any("email_id", email.ID))
-		email.MarkAsFailed(err.Error())
-		uc.emailRepo.Update(ctx, email)
+		uc.fail(ctx, email, source, err.Error())
 		return email, err
 	}
 
@@ -117,18 +259,231 @@ func (uc *SendEmailUseCase) Execute(
 		}
 
 		uc.logger.Error("Email send failed", zap.String("error", errMsg), zap.Any("email_id", email.ID))
-		email.MarkAsFailed(errMsg)
-		uc.emailRepo.Update(ctx, email)
+		applyRecipientResults(email, result.Recipients, false)
+		uc.fail(ctx, email, source, errMsg)
 		return email, fmt.Errorf("email send failed: %s", errMsg)
 	}
 
 	// Mark as sent
-	email.MarkAsSent()
+	detail := "message " + result.MessageID
+
+	if rejected := applyRecipientResults(email, result.Recipients, true); rejected > 0 {
+		uc.logger.Warn("Email sent to some recipients only",
+			zap.Any("email_id", email.ID), zap.Int("rejected", rejected), zap.Int("recipients", len(email.Recipients)))
+		detail += fmt.Sprintf(", %d of %d recipients rejected", rejected, len(email.Recipients))
+	}
+
+	if suppressed := countRecipients(email, entity.RecipientSuppressed); suppressed > 0 {
+		detail += fmt.Sprintf(", %d of %d recipients suppressed", suppressed, len(email.Recipients))
+	}
+
+	if err := email.MarkAsSent(source, detail); err != nil {
+		return email, err
+	}
+
 	if err := uc.emailRepo.Update(ctx, email); err != nil {
 		uc.logger.Error("Failed to update email status", zap.String("error", err.Error()), zap.Any("email_id", email.ID))
 		return email, err
 	}
 
+	uc.metrics.EmailStatus(string(email.Status), source.Provider)
 	uc.logger.Info("Email sent successfully", zap.Any("email_id", email.ID), zap.String("message_id", result.MessageID))
+
+	uc.links.Populate(email)
+
 	return email, nil
 }
+
+// claim stores the email as SENDING before it is handed to the relay. The
+// update is version checked, so an email cancelled concurrently is not
+// sent, and a cancel arriving later is refused.
+func (uc *SendEmailUseCase) claim(ctx context.Context, email *entity.Email, source entity.EventSource) error {
+	if err := email.MarkAsSending(source); err != nil {
+		return err
+	}
+
+	if err := uc.emailRepo.Update(ctx, email); err != nil {
+		if errors.Is(err, apperrors.ErrConflict) {
+			uc.logger.Warn("Email changed before it was sent", zap.Any("email_id", email.ID))
+			return fmt.Errorf("%w: email %s changed before it was sent", apperrors.ErrConflict, email.ID)
+		}
+		return fmt.Errorf("failed to claim email: %w", err)
+	}
+
+	return nil
+}
+
+// deferSend queues the email until its recipient domain has room again.
+func (uc *SendEmailUseCase) deferSend(ctx context.Context, email *entity.Email, actor entity.EventActor, domain string, retryAt time.Time) (*entity.Email, error) {
+	source := entity.EventSource{Actor: actor}
+
+	if err := email.Defer(source, retryAt, "throttled: "+domain); err != nil {
+		return email, err
+	}
+
+	// The worker sending it continues the trace of the request
+	email.TraceContext = tracing.Inject(ctx)
+
+	if err := uc.emailRepo.Update(ctx, email); err != nil {
+		uc.logger.Error("Failed to update email status", zap.String("error", err.Error()), zap.Any("email_id", email.ID))
+		return email, err
+	}
+
+	uc.metrics.EmailStatus(string(email.Status), uc.emailProvider.Name())
+	uc.metrics.Retry("throttled")
+
+	uc.logger.Info("Email deferred, recipient domain at its sending limit",
+		zap.Any("email_id", email.ID), zap.String("domain", domain), zap.Time("send_after", retryAt))
+
+	uc.links.Populate(email)
+
+	return email, nil
+}
+
+// fail records a failed send attempt. Errors are only logged, the caller
+// reports the send failure itself.
+func (uc *SendEmailUseCase) fail(ctx context.Context, email *entity.Email, source entity.EventSource, errMsg string) {
+	if err := email.MarkAsFailed(source, errMsg); err != nil {
+		uc.logger.Error("Failed to mark email as failed", zap.String("error", err.Error()), zap.Any("email_id", email.ID))
+		return
+	}
+
+	if err := uc.emailRepo.Update(ctx, email); err != nil {
+		uc.logger.Error("Failed to update email status", zap.String("error", err.Error()), zap.Any("email_id", email.ID))
+		return
+	}
+
+	uc.metrics.EmailStatus(string(email.Status), source.Provider)
+}
+
+// suppress marks the recipients on the suppression list for the category
+// of the email and returns their addresses.
+func (uc *SendEmailUseCase) suppress(ctx context.Context, email *entity.Email) ([]string, error) {
+	addresses := make([]string, len(email.Recipients))
+	for i, recipient := range email.Recipients {
+		addresses[i] = recipient.Address
+	}
+
+	var category string
+	if email.Category != nil {
+		category = *email.Category
+	}
+
+	suppressions, err := uc.suppressionRepo.FindActive(ctx, addresses, category, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check suppression list: %w", err)
+	}
+
+	var suppressed []string
+
+	for _, s := range suppressions {
+		recipient := email.Recipient(s.Address)
+		if recipient == nil || recipient.Status == entity.RecipientSuppressed {
+			continue
+		}
+
+		if err := recipient.MarkAsSuppressed("suppressed: " + strings.ToLower(string(s.Reason))); err != nil {
+			return nil, err
+		}
+
+		suppressed = append(suppressed, recipient.Address)
+	}
+
+	return suppressed, nil
+}
+
+func (uc *SendEmailUseCase) findAttachment(ctx context.Context, rawID string) (*entity.Attachment, error) {
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attachment ID %q", apperrors.ErrInvalidInput, rawID)
+	}
+
+	attachment, err := uc.attachmentRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return nil, fmt.Errorf("%w: attachment %s not found", apperrors.ErrInvalidInput, id)
+		}
+		return nil, fmt.Errorf("failed to load attachment: %w", err)
+	}
+
+	// Another client's attachment is reported like a missing one
+	owned, err := isAttachmentOwner(ctx, uc.attachmentRepo, id)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, fmt.Errorf("%w: attachment %s not found", apperrors.ErrInvalidInput, id)
+	}
+
+	if attachment.PurgedAt != nil {
+		return nil, fmt.Errorf("%w: attachment %s content was deleted", apperrors.ErrInvalidInput, id)
+	}
+
+	// Shared content is sent under the name this client uploaded it as
+	if client := ClientFromContext(ctx); client != nil && client.ID != "" {
+		name, err := uc.attachmentRepo.FindOwnerName(ctx, id, client.ID)
+		switch {
+		case err == nil:
+			attachment.OriginalName = name
+		case !errors.Is(err, apperrors.ErrNotFound):
+			return nil, fmt.Errorf("failed to load attachment owner: %w", err)
+		}
+	}
+
+	return attachment, nil
+}
+
+// countRecipients returns how many recipients of the email have the status.
+func countRecipients(email *entity.Email, status entity.RecipientStatus) int {
+	count := 0
+
+	for _, recipient := range email.Recipients {
+		if recipient.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
+// applyRecipientResults records the relay's replies on the recipients of
+// the email and returns how many were rejected. Accepted recipients are only
+// marked as such when the message was sent to them, so that a later attempt
+// after a failure does not send it again.
+func applyRecipientResults(email *entity.Email, results []service.RecipientResult, sent bool) int {
+	rejected := 0
+
+	for _, result := range results {
+		recipient := email.Recipient(result.Address)
+		if recipient == nil {
+			continue
+		}
+
+		switch {
+		case !result.Accepted:
+			recipient.MarkAsRejected(result.Code, result.Response)
+			rejected++
+		case sent || result.Sent:
+			recipient.MarkAsAccepted(result.Code, result.Response)
+		}
+	}
+
+	return rejected
+}
+
+// authorizeSend checks that the client of the request may send emails, and
+// from that address.
+func authorizeSend(ctx context.Context, from string) error {
+	client := ClientFromContext(ctx)
+
+	switch {
+	case client == nil:
+		return nil
+	case !client.HasScope(entity.ScopeEmailsSend):
+		return fmt.Errorf("%w: client %s lacks the %s scope", apperrors.ErrForbidden, client.Name, entity.ScopeEmailsSend)
+	case !client.CanSendAs(from):
+		return fmt.Errorf("%w: client %s may not send from %s", apperrors.ErrForbidden, client.Name, from)
+	}
+
+	return nil
+}
@@ -0,0 +1,738 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/dto"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/infrastructure/persistence/memory"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+)
+
+type fakeProvider struct {
+	result *service.SendEmailResult
+	err    error
+	sent   []*entity.Email
+	// onSend runs while the provider has the email
+	onSend func(email *entity.Email)
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Send(ctx context.Context, email *entity.Email) (*service.SendEmailResult, error) {
+	p.sent = append(p.sent, email)
+
+	if p.onSend != nil {
+		p.onSend(email)
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	if p.result != nil {
+		return p.result, nil
+	}
+
+	return &service.SendEmailResult{Success: true, MessageID: "<message@test>"}, nil
+}
+
+// failingEmailRepository fails the configured calls and passes the others
+// through to the wrapped repository.
+type failingEmailRepository struct {
+	repository.EmailRepository
+	createErr error
+	// beforeUpdate runs before each update and fails it with its error
+	beforeUpdate func(email *entity.Email) error
+}
+
+func (r *failingEmailRepository) Create(ctx context.Context, email *entity.Email) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
+	return r.EmailRepository.Create(ctx, email)
+}
+
+func (r *failingEmailRepository) Update(ctx context.Context, email *entity.Email) error {
+	if r.beforeUpdate != nil {
+		if err := r.beforeUpdate(email); err != nil {
+			return err
+		}
+	}
+	return r.EmailRepository.Update(ctx, email)
+}
+
+type failingAttachmentRepository struct {
+	repository.AttachmentRepository
+	findErr error
+}
+
+func (r *failingAttachmentRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.Attachment, error) {
+	if r.findErr != nil {
+		return nil, r.findErr
+	}
+	return r.AttachmentRepository.FindByID(ctx, id)
+}
+
+type sendEmailFixture struct {
+	uc           *SendEmailUseCase
+	provider     *fakeProvider
+	emails       *failingEmailRepository
+	attachments  *failingAttachmentRepository
+	suppressions repository.SuppressionRepository
+	events       repository.EmailEventRepository
+	transactor   repository.Transactor
+	throttle     *DomainThrottle
+}
+
+func newSendEmailFixture() *sendEmailFixture {
+	return newSendEmailFixtureWithSuppression(config.SuppressionConfig{Mode: config.SuppressionRemove})
+}
+
+func newSendEmailFixtureWithSuppression(suppressionCfg config.SuppressionConfig) *sendEmailFixture {
+	return newSendEmailFixtureWith(suppressionCfg, config.ThrottleConfig{})
+}
+
+func newSendEmailFixtureWith(suppressionCfg config.SuppressionConfig, throttleCfg config.ThrottleConfig) *sendEmailFixture {
+	store := memory.NewStore()
+	links, err := NewAttachmentLinks(config.LinksConfig{BaseURL: "http://localhost", SigningKey: "key", TTL: 60})
+	if err != nil {
+		panic(err)
+	}
+
+	f := &sendEmailFixture{
+		provider:     &fakeProvider{},
+		emails:       &failingEmailRepository{EmailRepository: memory.NewEmailRepository(store)},
+		attachments:  &failingAttachmentRepository{AttachmentRepository: memory.NewAttachmentRepository(store)},
+		suppressions: memory.NewSuppressionRepository(store),
+		events:       memory.NewEmailEventRepository(store),
+		transactor:   memory.NewTransactor(store),
+		throttle:     NewDomainThrottle(throttleCfg),
+	}
+
+	f.uc = NewSendEmailUseCase(
+		f.emails,
+		f.attachments,
+		f.suppressions,
+		f.transactor,
+		f.provider,
+		NewAttachmentPolicy(config.AttachmentPolicyConfig{}),
+		links,
+		NewAttachmentOffloader(links, config.AttachmentPolicyConfig{}),
+		NewQuotaUseCase(memory.NewQuotaRepository(store), config.RateLimitConfig{}),
+		f.throttle,
+		metrics.New(),
+		config.SMTPConfig{From: "noreply@example.com", FromDisplayName: "Notifications"},
+		suppressionCfg,
+		&logger.Logger{Logger: zap.NewNop()},
+	)
+
+	return f
+}
+
+func (f *sendEmailFixture) stored(t *testing.T, id uuid.UUID) *entity.Email {
+	t.Helper()
+
+	email, err := f.emails.FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("stored email %s: %v", id, err)
+	}
+
+	return email
+}
+
+func newSendRequest() *dto.SendEmailNormalizedRequest {
+	subject := "Welcome"
+	body := "Hello"
+
+	return &dto.SendEmailNormalizedRequest{
+		To:      []string{"user@example.com"},
+		CC:      []string{},
+		BCC:     []string{},
+		Subject: &subject,
+		Body:    &body,
+	}
+}
+
+func TestSendEmailUseCase_Success(t *testing.T) {
+	ctx := context.Background()
+	f := newSendEmailFixture()
+
+	att := entity.NewAttachment("stored.pdf", "terms.pdf", "application/pdf", 100, "hash", "/files/stored.pdf", nil)
+	if err := f.attachments.Create(ctx, att); err != nil {
+		t.Fatalf("Create attachment: %v", err)
+	}
+
+	req := newSendRequest()
+	req.AttachmentIDs = []string{att.ID.String()}
+
+	email, err := f.uc.Execute(ctx, req, nil)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if email.Status != entity.StatusSent || email.SentAt == nil || email.Error != nil {
+		t.Errorf("email status %s, sent at %v, error %v", email.Status, email.SentAt, email.Error)
+	}
+	if email.From != "noreply@example.com" || email.DisplayName != "Notifications" {
+		t.Errorf("sender = %q %q, want the configured defaults", email.DisplayName, email.From)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0].URL == nil {
+		t.Errorf("attachments = %+v, want one with a download URL", email.Attachments)
+	}
+
+	if len(f.provider.sent) != 1 {
+		t.Fatalf("provider called %d times, want 1", len(f.provider.sent))
+	}
+	if sent := f.provider.sent[0]; sent.ID != email.ID || len(sent.Attachments) != 1 {
+		t.Errorf("provider got %+v, want the email with its attachment", sent)
+	}
+
+	if stored := f.stored(t, email.ID); stored.Status != entity.StatusSent || stored.SentAt == nil {
+		t.Errorf("stored status %s, sent at %v", stored.Status, stored.SentAt)
+	}
+}
+
+func TestSendEmailUseCase_ProviderError(t *testing.T) {
+	f := newSendEmailFixture()
+	f.provider.err = errors.New("dial tcp: connection refused")
+
+	email, err := f.uc.Execute(context.Background(), newSendRequest(), nil)
+	if !errors.Is(err, f.provider.err) {
+		t.Fatalf("Execute = %v, want %v", err, f.provider.err)
+	}
+
+	if email == nil {
+		t.Fatal("email is nil, want the stored email")
+	}
+
+	stored := f.stored(t, email.ID)
+	if stored.Status != entity.StatusFailed || stored.Error == nil || *stored.Error != f.provider.err.Error() {
+		t.Errorf("stored status %s, error %v", stored.Status, stored.Error)
+	}
+	if stored.SentAt != nil {
+		t.Errorf("stored SentAt = %v, want nil", stored.SentAt)
+	}
+}
+
+func TestSendEmailUseCase_Unsuccessful(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  *service.SendEmailResult
+		wantErr string
+	}{
+		{
+			name:    "with error",
+			result:  &service.SendEmailResult{Error: errors.New("550 mailbox unavailable")},
+			wantErr: "550 mailbox unavailable",
+		},
+		{
+			name:    "without error",
+			result:  &service.SendEmailResult{},
+			wantErr: "unknown error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSendEmailFixture()
+			f.provider.result = tt.result
+
+			email, err := f.uc.Execute(context.Background(), newSendRequest(), nil)
+			if err == nil {
+				t.Fatal("Execute succeeded, want an error")
+			}
+
+			if email == nil {
+				t.Fatal("email is nil, want the stored email")
+			}
+
+			stored := f.stored(t, email.ID)
+			if stored.Status != entity.StatusFailed || stored.Error == nil || *stored.Error != tt.wantErr {
+				t.Errorf("stored status %s, error %v, want FAILED with %q", stored.Status, stored.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSendEmailUseCase_PartialRecipients(t *testing.T) {
+	f := newSendEmailFixture()
+	f.provider.result = &service.SendEmailResult{
+		Success:   true,
+		MessageID: "<message@test>",
+		Recipients: []service.RecipientResult{
+			{Address: "user@example.com", Accepted: true, Code: 250, Response: "OK"},
+			{Address: "gone@example.com", Code: 550, Response: "5.1.1 user unknown"},
+		},
+	}
+
+	req := newSendRequest()
+	req.CC = []string{"gone@example.com"}
+
+	email, err := f.uc.Execute(context.Background(), req, nil)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	stored := f.stored(t, email.ID)
+	if stored.Status != entity.StatusSent {
+		t.Errorf("stored status %s, want SENT", stored.Status)
+	}
+
+	if r := stored.Recipient("user@example.com"); r == nil || r.Status != entity.RecipientAccepted {
+		t.Errorf("accepted recipient = %+v", r)
+	}
+	if r := stored.Recipient("gone@example.com"); r == nil || r.Status != entity.RecipientRejected ||
+		r.SMTPCode == nil || *r.SMTPCode != 550 {
+		t.Errorf("rejected recipient = %+v", r)
+	}
+}
+
+func TestSendEmailUseCase_AllRecipientsRejected(t *testing.T) {
+	f := newSendEmailFixture()
+	f.provider.result = &service.SendEmailResult{
+		Error: errors.New("recipients rejected"),
+		Recipients: []service.RecipientResult{
+			{Address: "user@example.com", Code: 550, Response: "5.1.1 user unknown"},
+		},
+	}
+
+	email, err := f.uc.Execute(context.Background(), newSendRequest(), nil)
+	if err == nil {
+		t.Fatal("Execute succeeded, want an error")
+	}
+
+	stored := f.stored(t, email.ID)
+	if stored.Status != entity.StatusFailed {
+		t.Errorf("stored status %s, want FAILED", stored.Status)
+	}
+	if r := stored.Recipient("user@example.com"); r == nil || r.Status != entity.RecipientRejected {
+		t.Errorf("recipient = %+v, want REJECTED", r)
+	}
+}
+
+func TestSendEmailUseCase_FailedAfterSomeSent(t *testing.T) {
+	f := newSendEmailFixture()
+	f.provider.result = &service.SendEmailResult{
+		Error: errors.New("connection lost"),
+		Recipients: []service.RecipientResult{
+			{Address: "user@example.com", Accepted: true, Sent: true, Code: 250, Response: "OK"},
+		},
+	}
+
+	req := newSendRequest()
+	req.CC = []string{"later@example.com"}
+
+	email, err := f.uc.Execute(context.Background(), req, nil)
+	if err == nil {
+		t.Fatal("Execute succeeded, want an error")
+	}
+
+	// The recipient that got its copy is not offered again on a retry
+	stored := f.stored(t, email.ID)
+	if stored.Status != entity.StatusFailed {
+		t.Errorf("stored status %s, want FAILED", stored.Status)
+	}
+	if r := stored.Recipient("user@example.com"); r == nil || r.Status != entity.RecipientAccepted {
+		t.Errorf("sent recipient = %+v, want ACCEPTED", r)
+	}
+	if r := stored.Recipient("later@example.com"); r == nil || r.Status != entity.RecipientPending {
+		t.Errorf("remaining recipient = %+v, want PENDING", r)
+	}
+}
+
+func TestSendEmailUseCase_Suppression(t *testing.T) {
+	suppress := func(t *testing.T, f *sendEmailFixture, address string, expiresAt *time.Time) {
+		t.Helper()
+
+		s := entity.NewSuppression(address, entity.SuppressionHardBounce, entity.SuppressionSourceBounce)
+		s.ExpiresAt = expiresAt
+		if err := f.suppressions.Upsert(context.Background(), s); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+
+	t.Run("Remove", func(t *testing.T) {
+		f := newSendEmailFixture()
+		suppress(t, f, "Gone@example.com", nil)
+
+		expired := time.Now().Add(-time.Hour)
+		suppress(t, f, "back@example.com", &expired)
+
+		req := newSendRequest()
+		req.CC = []string{"gone@example.com", "back@example.com"}
+
+		email, err := f.uc.Execute(context.Background(), req, nil)
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+
+		if len(f.provider.sent) != 1 {
+			t.Fatalf("provider called %d times, want 1", len(f.provider.sent))
+		}
+
+		stored := f.stored(t, email.ID)
+		if stored.Status != entity.StatusSent {
+			t.Errorf("stored status %s, want SENT", stored.Status)
+		}
+		if r := stored.Recipient("gone@example.com"); r == nil || r.Status != entity.RecipientSuppressed {
+			t.Errorf("suppressed recipient = %+v, want SUPPRESSED", r)
+		}
+		if r := stored.Recipient("back@example.com"); r == nil || r.Status == entity.RecipientSuppressed {
+			t.Errorf("recipient with expired entry = %+v, want it sent to", r)
+		}
+	})
+
+	t.Run("AllSuppressed", func(t *testing.T) {
+		f := newSendEmailFixture()
+		suppress(t, f, "user@example.com", nil)
+
+		email, err := f.uc.Execute(context.Background(), newSendRequest(), nil)
+		if !errors.Is(err, apperrors.ErrSuppressed) {
+			t.Fatalf("Execute = %v, want ErrSuppressed", err)
+		}
+		if len(f.provider.sent) != 0 {
+			t.Errorf("provider called %d times, want 0", len(f.provider.sent))
+		}
+
+		if stored := f.stored(t, email.ID); stored.Status != entity.StatusCancelled {
+			t.Errorf("stored status %s, want CANCELLED", stored.Status)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		f := newSendEmailFixtureWithSuppression(config.SuppressionConfig{Mode: config.SuppressionReject})
+		suppress(t, f, "gone@example.com", nil)
+
+		req := newSendRequest()
+		req.BCC = []string{"gone@example.com"}
+
+		email, err := f.uc.Execute(context.Background(), req, nil)
+		if !errors.Is(err, apperrors.ErrSuppressed) {
+			t.Fatalf("Execute = %v, want ErrSuppressed", err)
+		}
+		if len(f.provider.sent) != 0 {
+			t.Errorf("provider called %d times, want 0", len(f.provider.sent))
+		}
+
+		stored := f.stored(t, email.ID)
+		if stored.Status != entity.StatusCancelled {
+			t.Errorf("stored status %s, want CANCELLED", stored.Status)
+		}
+		if r := stored.Recipient("user@example.com"); r == nil || r.Status != entity.RecipientPending {
+			t.Errorf("other recipient = %+v, want PENDING", r)
+		}
+	})
+}
+
+func TestSendEmailUseCase_CreateFails(t *testing.T) {
+	f := newSendEmailFixture()
+	f.emails.createErr = errors.New("connection reset")
+
+	email, err := f.uc.Execute(context.Background(), newSendRequest(), nil)
+	if !errors.Is(err, f.emails.createErr) {
+		t.Fatalf("Execute = %v, want %v", err, f.emails.createErr)
+	}
+
+	if email != nil {
+		t.Errorf("email = %+v, want nil when it was not stored", email)
+	}
+	if len(f.provider.sent) != 0 {
+		t.Errorf("provider called %d times, want 0", len(f.provider.sent))
+	}
+}
+
+func TestSendEmailUseCase_UpdateFails(t *testing.T) {
+	f := newSendEmailFixture()
+	updateErr := errors.New("connection reset")
+	f.emails.beforeUpdate = func(email *entity.Email) error {
+		if email.Status == entity.StatusSent {
+			return updateErr
+		}
+		return nil
+	}
+
+	email, err := f.uc.Execute(context.Background(), newSendRequest(), nil)
+	if !errors.Is(err, updateErr) {
+		t.Fatalf("Execute = %v, want %v", err, updateErr)
+	}
+
+	// The message went out even though its status could not be recorded
+	if len(f.provider.sent) != 1 {
+		t.Errorf("provider called %d times, want 1", len(f.provider.sent))
+	}
+	if email == nil || email.Status != entity.StatusSent {
+		t.Errorf("email = %+v, want it marked as sent", email)
+	}
+}
+
+func TestSendEmailUseCase_CancelRace(t *testing.T) {
+	ctx := context.Background()
+
+	// The cancel reads and writes the store directly, not through the
+	// hooks of the fixture
+	cancelUC := func(f *sendEmailFixture) *CancelEmailUseCase {
+		return NewCancelEmailUseCase(f.emails.EmailRepository, f.transactor, metrics.New(), &logger.Logger{Logger: zap.NewNop()})
+	}
+
+	t.Run("CancelWhileSending", func(t *testing.T) {
+		f := newSendEmailFixture()
+		cancel := cancelUC(f)
+
+		var cancelErr error
+		f.provider.onSend = func(email *entity.Email) {
+			_, cancelErr = cancel.Execute(ctx, email.ID, "changed my mind")
+		}
+
+		email, err := f.uc.Execute(ctx, newSendRequest(), nil)
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+
+		if !errors.Is(cancelErr, apperrors.ErrInvalidTransition) {
+			t.Errorf("cancel during the send = %v, want ErrInvalidTransition", cancelErr)
+		}
+		if stored := f.stored(t, email.ID); stored.Status != entity.StatusSent {
+			t.Errorf("stored status %s, want SENT", stored.Status)
+		}
+	})
+
+	t.Run("CancelBeforeClaim", func(t *testing.T) {
+		f := newSendEmailFixture()
+		cancel := cancelUC(f)
+
+		var cancelErr error
+		f.emails.beforeUpdate = func(email *entity.Email) error {
+			if email.Status == entity.StatusSending && cancelErr == nil {
+				_, cancelErr = cancel.Execute(ctx, email.ID, "changed my mind")
+			}
+			return nil
+		}
+
+		email, err := f.uc.Execute(ctx, newSendRequest(), nil)
+		if !errors.Is(err, apperrors.ErrConflict) {
+			t.Fatalf("Execute = %v, want ErrConflict", err)
+		}
+		if cancelErr != nil {
+			t.Fatalf("cancel: %v", cancelErr)
+		}
+
+		if len(f.provider.sent) != 0 {
+			t.Errorf("provider called %d times, want a cancelled email not sent", len(f.provider.sent))
+		}
+		if stored := f.stored(t, email.ID); stored.Status != entity.StatusCancelled {
+			t.Errorf("stored status %s, want CANCELLED", stored.Status)
+		}
+	})
+}
+
+func TestSendEmailUseCase_Throttled(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	// The request sending the email is part of a trace
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35}
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	f := newSendEmailFixtureWith(
+		config.SuppressionConfig{Mode: config.SuppressionRemove},
+		config.ThrottleConfig{Interval: 10, BatchSize: 10, Domains: map[string]config.DomainLimit{"gmail.com": {Concurrency: 1}}},
+	)
+
+	// Another send to the domain is in progress
+	release, _, _ := f.throttle.Acquire(entity.NewRecipients([]string{"other@gmail.com"}, nil, nil), time.Now().UTC())
+	if release == nil {
+		t.Fatal("Acquire throttled")
+	}
+
+	req := newSendRequest()
+	req.To = []string{"user@gmail.com"}
+
+	email, err := f.uc.Execute(ctx, req, nil)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if email.Status != entity.StatusQueued || email.SendAfter == nil || !email.SendAfter.After(time.Now()) {
+		t.Fatalf("email status %s, send after %v, want deferred", email.Status, email.SendAfter)
+	}
+	if len(f.provider.sent) != 0 {
+		t.Fatalf("provider called %d times, want 0", len(f.provider.sent))
+	}
+
+	stored := f.stored(t, email.ID)
+	if stored.Status != entity.StatusQueued || stored.Error != nil {
+		t.Fatalf("stored status %s, error %v, want queued", stored.Status, stored.Error)
+	}
+	if !strings.Contains(stored.TraceContext["traceparent"], traceID.String()) {
+		t.Errorf("trace context = %v, want the trace of the request", stored.TraceContext)
+	}
+
+	events, err := f.events.FindByEmailID(ctx, email.ID)
+	if err != nil {
+		t.Fatalf("FindByEmailID: %v", err)
+	}
+	if last := events[len(events)-1]; last.ToStatus != entity.StatusQueued || last.Actor != entity.ActorAPI {
+		t.Errorf("last event = %+v, want QUEUED by the API", last)
+	}
+
+	release()
+
+	// The worker sends it once it is due, in the trace of the request
+	ctx = context.Background()
+	deliverMetrics := metrics.New()
+	deliver := NewDeliverQueuedUseCase(f.emails, memory.NewLocker(), f.uc, deliverMetrics, config.ThrottleConfig{BatchSize: 10}, &logger.Logger{Logger: zap.NewNop()})
+
+	if sent, err := deliver.Execute(ctx); err != nil || sent != 0 {
+		t.Fatalf("Execute before due = %d, %v, want nothing sent", sent, err)
+	}
+
+	due := time.Now().UTC().Add(-time.Second)
+	stored.SendAfter = &due
+	if err := f.emails.Update(ctx, stored); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if sent, err := deliver.Execute(ctx); err != nil || sent != 1 {
+		t.Fatalf("Execute = %d, %v, want 1 sent", sent, err)
+	}
+
+	if len(f.provider.sent) != 1 {
+		t.Fatalf("provider called %d times, want 1", len(f.provider.sent))
+	}
+
+	scrape := httptest.NewRecorder()
+	deliverMetrics.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `notification_email_retries_total{reason="queued"} 1`; !strings.Contains(scrape.Body.String(), want) {
+		t.Errorf("metrics lack %s", want)
+	}
+
+	stored = f.stored(t, email.ID)
+	if stored.Status != entity.StatusSent || stored.SendAfter != nil || stored.TraceContext != nil {
+		t.Errorf("stored status %s, send after %v, trace context %v, want sent", stored.Status, stored.SendAfter, stored.TraceContext)
+	}
+
+	var delivered bool
+	for _, span := range recorder.Ended() {
+		if span.Name() == "DeliverQueuedUseCase.deliver" {
+			delivered = true
+
+			if span.SpanContext().TraceID() != traceID || len(span.Links()) != 1 {
+				t.Errorf("deliver span in trace %s with %d links, want the request's linked to the worker run",
+					span.SpanContext().TraceID(), len(span.Links()))
+			}
+		}
+	}
+	if !delivered {
+		t.Error("no span for the queued delivery")
+	}
+}
+
+func TestSendEmailUseCase_AttachmentErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		findErr     error
+		wantInvalid bool
+	}{
+		{name: "invalid ID", id: "not-a-uuid", wantInvalid: true},
+		{name: "unknown attachment", id: uuid.NewString(), wantInvalid: true},
+		{name: "repository failure", id: uuid.NewString(), findErr: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSendEmailFixture()
+			f.attachments.findErr = tt.findErr
+
+			req := newSendRequest()
+			req.AttachmentIDs = []string{tt.id}
+
+			email, err := f.uc.Execute(context.Background(), req, nil)
+			if err == nil {
+				t.Fatal("Execute succeeded, want an error")
+			}
+
+			if got := errors.Is(err, apperrors.ErrInvalidInput); got != tt.wantInvalid {
+				t.Errorf("Execute = %v, invalid input %v, want %v", err, got, tt.wantInvalid)
+			}
+			if tt.findErr != nil && !errors.Is(err, tt.findErr) {
+				t.Errorf("Execute = %v, want %v", err, tt.findErr)
+			}
+
+			if email != nil || len(f.provider.sent) != 0 {
+				t.Errorf("email %+v stored or sent, want neither", email)
+			}
+		})
+	}
+}
+
+func TestSendEmailUseCase_StoredAttachmentPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		mimetype string
+	}{
+		{name: "blocked extension", filename: "setup.exe", mimetype: "application/octet-stream"},
+		{name: "blocked content type", filename: "report.pdf", mimetype: "application/x-dosexec"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newSendEmailFixture()
+			// Stored before the policy was tightened
+			f.uc.policy = NewAttachmentPolicy(config.AttachmentPolicyConfig{
+				BlockedExtensions: []string{".exe"},
+				BlockedMimeTypes:  []string{"application/x-dosexec"},
+			})
+
+			att := entity.NewAttachment("stored", tt.filename, tt.mimetype, 100, "hash", "/files/stored", nil)
+			if err := f.attachments.Create(ctx, att); err != nil {
+				t.Fatalf("Create attachment: %v", err)
+			}
+
+			req := newSendRequest()
+			req.AttachmentIDs = []string{att.ID.String()}
+
+			email, err := f.uc.Execute(ctx, req, nil)
+			if !errors.Is(err, apperrors.ErrInvalidInput) {
+				t.Fatalf("Execute = %v, want ErrInvalidInput", err)
+			}
+
+			if email != nil || len(f.provider.sent) != 0 {
+				t.Errorf("email %+v stored or sent, want neither", email)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/seal"
+)
+
+// SigningKeys stores the request signing keys of API keys encrypted, so
+// that a copy of the database is not enough to sign requests. Without an
+// encryption key, signing is disabled.
+type SigningKeys struct {
+	box *seal.Box
+}
+
+func NewSigningKeys(cfg config.ServerConfig) (*SigningKeys, error) {
+	if cfg.SigningKeyEncryptionKey == "" {
+		return &SigningKeys{}, nil
+	}
+
+	box, err := seal.New(cfg.SigningKeyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKeys{box: box}, nil
+}
+
+// Enabled reports whether API keys can sign requests.
+func (s *SigningKeys) Enabled() bool {
+	return s.box != nil
+}
+
+// Seal returns the stored form of the signing key of key, or nil while
+// signing is disabled.
+func (s *SigningKeys) Seal(key string) ([]byte, error) {
+	if s.box == nil {
+		return nil, nil
+	}
+
+	sealed, err := s.box.Seal([]byte(entity.SigningKey(key)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal signing key: %w", err)
+	}
+
+	return sealed, nil
+}
+
+// Open returns the signing key of the API key. Keys created while signing
+// was disabled return ErrUnauthorized.
+func (s *SigningKeys) Open(apiKey *entity.APIKey) (string, error) {
+	if s.box == nil {
+		return "", fmt.Errorf("%w: request signing is disabled", apperrors.ErrUnauthorized)
+	}
+
+	if apiKey.SealedSigningKey == nil {
+		return "", fmt.Errorf("%w: API key %s cannot sign requests", apperrors.ErrUnauthorized, apiKey.Prefix)
+	}
+
+	key, err := s.box.Open(apiKey.SealedSigningKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to open signing key of API key %s: %w", apiKey.Prefix, err)
+	}
+
+	return string(key), nil
+}
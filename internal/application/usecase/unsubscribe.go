@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/signature"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// UnsubscribeLinks builds and verifies the signed URLs recipients
+// unsubscribe with, as RFC 8058 one-click links. They do not expire. It
+// implements service.UnsubscribeLinks for the email providers.
+type UnsubscribeLinks struct {
+	signer  *signature.Signer
+	baseURL string
+}
+
+// NewUnsubscribeLinks fails without a signing key, which would let anyone
+// unsubscribe any address.
+func NewUnsubscribeLinks(cfg config.LinksConfig) (*UnsubscribeLinks, error) {
+	if cfg.SigningKey == "" {
+		return nil, errors.New("link signing key is not set")
+	}
+
+	return &UnsubscribeLinks{
+		signer:  signature.New(cfg.SigningKey),
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+	}, nil
+}
+
+// URL returns the link unsubscribing address from the category of the
+// email, or from every email if it has none.
+func (l *UnsubscribeLinks) URL(email *entity.Email, address string) string {
+	var category string
+	if email.Category != nil {
+		category = *email.Category
+	}
+
+	address = entity.NormalizeAddress(address)
+
+	query := url.Values{}
+	query.Set("email", email.ID.String())
+	query.Set("address", address)
+	if category != "" {
+		query.Set("category", category)
+	}
+	query.Set("signature", l.signer.Sign(unsubscribeParts(email.ID, address, category)...))
+
+	return l.baseURL + "/api/v1/unsubscribe?" + query.Encode()
+}
+
+// Unsubscribe is a verified unsubscribe request.
+type Unsubscribe struct {
+	EmailID  uuid.UUID
+	Address  string
+	Category string
+}
+
+// Verify checks the query of an unsubscribe URL.
+func (l *UnsubscribeLinks) Verify(query url.Values) (*Unsubscribe, error) {
+	emailID, err := uuid.Parse(query.Get("email"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid email ID", apperrors.ErrInvalidInput)
+	}
+
+	req := &Unsubscribe{
+		EmailID:  emailID,
+		Address:  entity.NormalizeAddress(query.Get("address")),
+		Category: query.Get("category"),
+	}
+
+	if req.Address == "" || !l.signer.Verify(query.Get("signature"), unsubscribeParts(req.EmailID, req.Address, req.Category)...) {
+		return nil, fmt.Errorf("%w: invalid signature", apperrors.ErrInvalidInput)
+	}
+
+	return req, nil
+}
+
+func unsubscribeParts(emailID uuid.UUID, address, category string) []string {
+	return []string{"unsubscribe", emailID.String(), address, category}
+}
+
+// UnsubscribeUseCase records recipients unsubscribing through the links in
+// the emails they received.
+type UnsubscribeUseCase struct {
+	suppressionRepo repository.SuppressionRepository
+	links           *UnsubscribeLinks
+	logger          *logger.Logger
+}
+
+func NewUnsubscribeUseCase(
+	suppressionRepo repository.SuppressionRepository,
+	links *UnsubscribeLinks,
+	logger *logger.Logger,
+) *UnsubscribeUseCase {
+	return &UnsubscribeUseCase{
+		suppressionRepo: suppressionRepo,
+		links:           links,
+		logger:          logger,
+	}
+}
+
+// Verify checks an unsubscribe link without recording anything, for the
+// page asking the recipient to confirm.
+func (uc *UnsubscribeUseCase) Verify(query url.Values) (*Unsubscribe, error) {
+	return uc.links.Verify(query)
+}
+
+// Execute suppresses the address for the category of the link. Repeating
+// it is harmless.
+func (uc *UnsubscribeUseCase) Execute(ctx context.Context, query url.Values) (*Unsubscribe, error) {
+	req, err := uc.links.Verify(query)
+	if err != nil {
+		return nil, err
+	}
+
+	suppression := entity.NewSuppression(req.Address, entity.SuppressionUnsubscribe, entity.SuppressionSourceRecipient)
+	suppression.Category = req.Category
+	suppression.EmailID = &req.EmailID
+
+	if err := uc.suppressionRepo.Upsert(ctx, suppression); err != nil {
+		return nil, err
+	}
+
+	uc.logger.Info("Recipient unsubscribed",
+		zap.Any("email_id", req.EmailID),
+		zap.String("category", req.Category),
+		zap.String("address_hash", entity.HashAddress(req.Address)))
+
+	return req, nil
+}
@@ -0,0 +1,50 @@
+package usecase
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+func TestUnsubscribeLinks(t *testing.T) {
+	links, err := NewUnsubscribeLinks(config.LinksConfig{BaseURL: "http://localhost", SigningKey: "key"})
+	if err != nil {
+		t.Fatalf("NewUnsubscribeLinks: %v", err)
+	}
+
+	email := entity.NewEmail("noreply@example.com", []string{"user@example.com"}, "", "News", "Hello")
+	category := "newsletter"
+	email.Category = &category
+
+	link, err := url.Parse(links.URL(email, "User@Example.com"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	req, err := links.Verify(link.Query())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if req.EmailID != email.ID || req.Address != "user@example.com" || req.Category != category {
+		t.Errorf("Verify = %+v, want the email, normalized address and category", req)
+	}
+
+	// Another address or category is not covered by the signature
+	for key, value := range map[string]string{"address": "other@example.com", "category": ""} {
+		query := link.Query()
+		query.Set(key, value)
+		if _, err := links.Verify(query); !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Errorf("Verify with %s %q = %v, want ErrInvalidInput", key, value, err)
+		}
+	}
+}
+
+func TestUnsubscribeLinks_RequiresKey(t *testing.T) {
+	if _, err := NewUnsubscribeLinks(config.LinksConfig{BaseURL: "http://localhost"}); err == nil {
+		t.Error("NewUnsubscribeLinks without a signing key succeeded, want an error")
+	}
+}
@@ -0,0 +1,318 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// sniffLen is how much leading content is inspected to detect the MIME type.
+const sniffLen = 3072
+
+type UploadAttachmentUseCase struct {
+	attachmentRepo repository.AttachmentRepository
+	transactor     repository.Transactor
+	storage        service.FileStorage
+	policy         *AttachmentPolicy
+	cfg            config.StorageConfig
+	logger         *logger.Logger
+}
+
+func NewUploadAttachmentUseCase(
+	attachmentRepo repository.AttachmentRepository,
+	transactor repository.Transactor,
+	storage service.FileStorage,
+	policy *AttachmentPolicy,
+	cfg config.StorageConfig,
+	logger *logger.Logger,
+) *UploadAttachmentUseCase {
+	return &UploadAttachmentUseCase{
+		attachmentRepo: attachmentRepo,
+		transactor:     transactor,
+		storage:        storage,
+		policy:         policy,
+		cfg:            cfg,
+		logger:         logger,
+	}
+}
+
+// Execute streams the content into storage and returns its attachment.
+// Content that was uploaded before is not stored twice: the existing
+// attachment is returned, named as in this upload, and created is false. The MIME type is detected
+// from the content itself.
+func (uc *UploadAttachmentUseCase) Execute(
+	ctx context.Context,
+	originalName string,
+	content io.Reader,
+) (attachment *entity.Attachment, created bool, err error) {
+	return uc.upload(ctx, originalName, content, uc.fileLimit(), nil)
+}
+
+// NewBatch starts uploading the files of a single email.
+func (uc *UploadAttachmentUseCase) NewBatch() *UploadBatch {
+	return &UploadBatch{uc: uc}
+}
+
+// upload checks the file against the attachment policy before anything is
+// stored. Reading more than maxSize bytes fails with tooLarge, or with a
+// per-file error when tooLarge is nil. A negative maxSize means no limit.
+func (uc *UploadAttachmentUseCase) upload(
+	ctx context.Context,
+	originalName string,
+	content io.Reader,
+	maxSize int64,
+	tooLarge error,
+) (*entity.Attachment, bool, error) {
+	name, err := uc.policy.CheckName(originalName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if tooLarge == nil {
+		tooLarge = fmt.Errorf("%w: file exceeds %d bytes", apperrors.ErrTooLarge, maxSize)
+	}
+
+	content = &limitedReader{
+		r:         content,
+		remaining: maxSize,
+		unlimited: maxSize < 0,
+		err:       apperrors.NewFileError(originalName, tooLarge),
+	}
+
+	mimeType, content, err := sniffMimetype(content)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	if err := uc.policy.CheckMimetype(originalName, mimeType); err != nil {
+		return nil, false, err
+	}
+
+	originalName = name
+
+	hasher := sha256.New()
+	filename := uuid.New().String() + filepath.Ext(originalName)
+
+	path, size, err := uc.storage.Save(ctx, filename, io.TeeReader(content, hasher))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to store attachment %q: %w", originalName, err)
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	var attachment *entity.Attachment
+	created := false
+
+	err = uc.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		// Also covers a rollback of an outer transaction the upload joined
+		uc.transactor.OnRollback(ctx, func(ctx context.Context) { uc.discardFile(ctx, path) })
+
+		existing, err := uc.attachmentRepo.FindByHash(ctx, hash)
+		if err == nil {
+			// Restart the orphan grace period for the client reusing it
+			err = uc.attachmentRepo.Touch(ctx, existing.ID, time.Now().UTC())
+			if err == nil {
+				attachment = existing
+				return uc.addOwner(ctx, existing.ID, originalName)
+			}
+		}
+
+		// Not found, or removed by orphan cleanup since it was found
+		if !errors.Is(err, apperrors.ErrNotFound) {
+			return err
+		}
+
+		attachment = entity.NewAttachment(filename, originalName, mimeType, size, hash, path, nil)
+		created = true
+
+		if err := uc.attachmentRepo.Create(ctx, attachment); err != nil {
+			return err
+		}
+
+		return uc.addOwner(ctx, attachment.ID, originalName)
+	})
+
+	if err != nil {
+		// The same content was stored concurrently
+		if errors.Is(err, apperrors.ErrAlreadyExists) {
+			existing, err := uc.attachmentRepo.FindByHash(ctx, hash)
+			if err != nil {
+				return nil, false, err
+			}
+			if err := uc.attachmentRepo.Touch(ctx, existing.ID, time.Now().UTC()); err != nil {
+				return nil, false, err
+			}
+			if err := uc.addOwner(ctx, existing.ID, originalName); err != nil {
+				return nil, false, err
+			}
+			existing.OriginalName = originalName
+			return existing, false, nil
+		}
+
+		return nil, false, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	if !created {
+		// The content is shared, the name is the one given by this upload
+		attachment.OriginalName = originalName
+		uc.discardFile(ctx, path)
+		uc.logger.Debug("Attachment deduplicated", zap.Any("attachment_id", attachment.ID), zap.String("hash", hash))
+		return attachment, false, nil
+	}
+
+	uc.logger.Info("Attachment stored",
+		zap.Any("attachment_id", attachment.ID), zap.String("mimetype", mimeType), zap.Int64("size", size))
+	return attachment, true, nil
+}
+
+// addOwner records the client of the request as an owner of the attachment,
+// with the name it uploaded it under.
+func (uc *UploadAttachmentUseCase) addOwner(ctx context.Context, id uuid.UUID, originalName string) error {
+	client := ClientFromContext(ctx)
+	if client == nil || client.ID == "" {
+		return nil
+	}
+
+	return uc.attachmentRepo.AddOwner(ctx, id, client.ID, originalName)
+}
+
+// discardAttachments removes attachments created for a request that failed.
+// Attachments that got referenced by an email in the meantime are kept.
+func (uc *UploadAttachmentUseCase) discardAttachments(ctx context.Context, attachments []*entity.Attachment) {
+	for _, att := range attachments {
+		if err := uc.attachmentRepo.Delete(ctx, att.ID); err != nil {
+			if !errors.Is(err, apperrors.ErrAttachmentInUse) && !errors.Is(err, apperrors.ErrNotFound) {
+				uc.logger.Warn("Failed to discard attachment", zap.Any("attachment_id", att.ID), zap.String("error", err.Error()))
+			}
+			continue
+		}
+
+		uc.discardFile(ctx, att.Path)
+	}
+}
+
+func (uc *UploadAttachmentUseCase) fileLimit() int64 {
+	if uc.cfg.MaxFileSize <= 0 {
+		return -1
+	}
+
+	return uc.cfg.MaxFileSize
+}
+
+func (uc *UploadAttachmentUseCase) discardFile(ctx context.Context, path string) {
+	if err := uc.storage.Delete(ctx, path); err != nil {
+		uc.logger.Warn("Failed to delete stored file", zap.String("path", path), zap.String("error", err.Error()))
+	}
+}
+
+// UploadBatch uploads the files of a single email, enforcing the policy
+// limits on file count and total size across them while streaming.
+type UploadBatch struct {
+	uc        *UploadAttachmentUseCase
+	count     int
+	totalSize int64
+	created   []*entity.Attachment
+}
+
+func (b *UploadBatch) Upload(ctx context.Context, originalName string, content io.Reader) (*entity.Attachment, error) {
+	if err := b.uc.policy.CheckCount(originalName, b.count+1); err != nil {
+		return nil, err
+	}
+
+	maxSize := b.uc.fileLimit()
+	var tooLarge error
+
+	if total := b.uc.policy.MaxTotalSize(); total > 0 {
+		if remaining := total - b.totalSize; maxSize < 0 || remaining < maxSize {
+			maxSize = remaining
+			tooLarge = fmt.Errorf("%w: attachments exceed %d bytes in total", apperrors.ErrTooLarge, total)
+		}
+	}
+
+	attachment, created, err := b.uc.upload(ctx, originalName, content, maxSize, tooLarge)
+	if err != nil {
+		return nil, err
+	}
+
+	b.count++
+	b.totalSize += attachment.Size
+
+	if created {
+		b.created = append(b.created, attachment)
+	}
+
+	return attachment, nil
+}
+
+// Discard removes the attachments this batch created.
+func (b *UploadBatch) Discard(ctx context.Context) {
+	if len(b.created) == 0 {
+		return
+	}
+
+	b.uc.discardAttachments(ctx, b.created)
+	b.created = nil
+}
+
+// sniffMimetype detects the MIME type from the leading bytes of r and returns
+// a reader that still yields the full content.
+func sniffMimetype(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, err
+	}
+	head = head[:n]
+
+	return mimetype.Detect(head).String(), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// limitedReader fails with err once more than remaining bytes are read,
+// unlike io.LimitReader which silently truncates, and keeps failing after
+// that.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	unlimited bool
+	err       error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.unlimited {
+		return l.r.Read(p)
+	}
+
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	if l.remaining < 0 {
+		return n, l.err
+	}
+
+	return n, err
+}
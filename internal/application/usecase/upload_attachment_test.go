@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/infrastructure/persistence/memory"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// fakeStorage keeps files in memory and, like a remote backend, fails
+// calls made with a cancelled context.
+type fakeStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *fakeStorage) Save(ctx context.Context, name string, r io.Reader) (string, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return "", 0, err
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = content
+
+	return name, int64(len(content)), nil
+}
+
+func (s *fakeStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.files[path]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (s *fakeStorage) Delete(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, path)
+
+	return nil
+}
+
+func TestUploadAttachmentUseCase_RollbackAfterUpload(t *testing.T) {
+	store := memory.NewStore()
+	attachments := memory.NewAttachmentRepository(store)
+	transactor := memory.NewTransactor(store)
+	storage := &fakeStorage{files: make(map[string][]byte)}
+
+	uc := NewUploadAttachmentUseCase(
+		attachments, transactor, storage, NewAttachmentPolicy(config.AttachmentPolicyConfig{}),
+		config.StorageConfig{}, &logger.Logger{Logger: zap.NewNop()},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failure := errors.New("saving the email failed")
+	var uploaded *entity.Attachment
+
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		attachment, _, err := uc.Execute(ctx, "report.txt", strings.NewReader("quarterly numbers"))
+		if err != nil {
+			return err
+		}
+		uploaded = attachment
+
+		if len(storage.files) != 1 {
+			t.Fatalf("storage has %d files after the upload, want 1", len(storage.files))
+		}
+
+		// The client disconnects before the rest of the transaction fails
+		cancel()
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("WithinTransaction = %v, want %v", err, failure)
+	}
+
+	if len(storage.files) != 0 {
+		t.Errorf("storage has %d files after the rollback, want the upload discarded", len(storage.files))
+	}
+
+	if _, err := attachments.FindByID(context.Background(), uploaded.ID); !errors.Is(err, apperrors.ErrNotFound) {
+		t.Errorf("attachment after the rollback: %v, want ErrNotFound", err)
+	}
+}
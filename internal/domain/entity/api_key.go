@@ -0,0 +1,208 @@
+package entity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// Scope is a permission granted to an API client.
+type Scope string
+
+const (
+	ScopeEmailsSend     Scope = "emails:send"
+	ScopeEmailsRead     Scope = "emails:read"
+	ScopeTemplatesWrite Scope = "templates:write"
+	// ScopeAdmin grants every other scope and the management of clients.
+	ScopeAdmin Scope = "admin"
+)
+
+var scopes = []Scope{ScopeEmailsSend, ScopeEmailsRead, ScopeTemplatesWrite, ScopeAdmin}
+
+// ParseScopes checks scope names, dropping duplicates.
+func ParseScopes(names []string) ([]Scope, error) {
+	parsed := make([]Scope, 0, len(names))
+
+	for _, name := range names {
+		scope := Scope(strings.ToLower(strings.TrimSpace(name)))
+
+		if !slices.Contains(scopes, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", apperrors.ErrInvalidInput, name)
+		}
+
+		if !slices.Contains(parsed, scope) {
+			parsed = append(parsed, scope)
+		}
+	}
+
+	return parsed, nil
+}
+
+// FilterScopes keeps the scopes of this service among names, for
+// credentials that also carry the scopes of other services.
+func FilterScopes(names []string) []Scope {
+	filtered := []Scope{}
+
+	for _, name := range names {
+		if scope := Scope(name); slices.Contains(scopes, scope) && !slices.Contains(filtered, scope) {
+			filtered = append(filtered, scope)
+		}
+	}
+
+	return filtered
+}
+
+// ParseSenders checks the senders a client may use: addresses, or domains
+// allowing any address of the domain. They are returned in lower case.
+func ParseSenders(entries []string) ([]string, error) {
+	senders := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		sender := strings.TrimPrefix(NormalizeAddress(entry), "@")
+
+		if sender == "" || strings.ContainsAny(sender, " ,;<>") || strings.Count(sender, "@") > 1 ||
+			strings.HasPrefix(sender, "@") || strings.HasSuffix(sender, "@") || !strings.Contains(sender, ".") {
+			return nil, fmt.Errorf("%w: invalid sender %q", apperrors.ErrInvalidInput, entry)
+		}
+
+		if !slices.Contains(senders, sender) {
+			senders = append(senders, sender)
+		}
+	}
+
+	return senders, nil
+}
+
+// apiKeyPrefix starts every key so they are recognizable, for example by
+// secret scanners.
+const apiKeyPrefix = "nsk_"
+
+// APIKey is the credential of a client service. Only a hash of the key is
+// stored; the key is shown once, when it is created.
+type APIKey struct {
+	ID   uuid.UUID
+	Name string
+	// Prefix is the start of the key, enough to tell keys apart.
+	Prefix string
+	Hash   []byte
+	// SealedSigningKey is the signing key of the key, encrypted under a
+	// server secret. Keys without one cannot sign requests.
+	SealedSigningKey []byte
+	Scopes           []Scope
+	// AllowedSenders restricts the From addresses of the client to these
+	// addresses and domains; empty allows any. AllowedTemplates restricts
+	// the templates it may use the same way.
+	AllowedSenders   []string
+	AllowedTemplates []string
+	CreatedAt        time.Time
+	LastUsedAt       *time.Time
+	RevokedAt        *time.Time
+}
+
+// NewAPIKey generates a key for the client name and returns it with its
+// stored form.
+func NewAPIKey(name string, scopes []Scope) (*APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	return &APIKey{
+		ID:        uuid.New(),
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      HashAPIKey(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}, key, nil
+}
+
+// IsAPIKey reports whether s looks like a key made by NewAPIKey.
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, apiKeyPrefix)
+}
+
+// HashAPIKey returns the stored form of a key. Keys are random, so a fast
+// hash is enough to keep them from being usable when the table leaks.
+func HashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// signingKeyLabel separates the signing key from the stored hash of the
+// key, which must not be usable to sign requests.
+const signingKeyLabel = "notification-service request signing"
+
+// SigningKey returns the HMAC key requests signed with an API key use: the
+// hex encoded HMAC-SHA256 of a fixed label under the key. Both sides can
+// derive it without the key itself ever being sent.
+func SigningKey(key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(signingKeyLabel))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Client returns the identity requests authenticated with the key act as.
+func (k *APIKey) Client() *Client {
+	return &Client{
+		ID:               k.ID.String(),
+		Name:             k.Name,
+		Scopes:           k.Scopes,
+		AllowedSenders:   k.AllowedSenders,
+		AllowedTemplates: k.AllowedTemplates,
+	}
+}
+
+// Client is the authenticated caller of the API.
+type Client struct {
+	// ID is recorded on the emails the client creates. It is empty for
+	// the legacy shared secret.
+	ID               string
+	Name             string
+	Scopes           []Scope
+	AllowedSenders   []string
+	AllowedTemplates []string
+}
+
+// HasScope reports whether the client was granted scope.
+func (c *Client) HasScope(scope Scope) bool {
+	return slices.Contains(c.Scopes, scope) || slices.Contains(c.Scopes, ScopeAdmin)
+}
+
+// CanSendAs reports whether the client may send from the address.
+func (c *Client) CanSendAs(from string) bool {
+	if len(c.AllowedSenders) == 0 {
+		return true
+	}
+
+	from = NormalizeAddress(from)
+	_, domain, _ := strings.Cut(from, "@")
+
+	return slices.Contains(c.AllowedSenders, from) || (domain != "" && slices.Contains(c.AllowedSenders, domain))
+}
+
+// CanUseTemplate reports whether the client may use the named template.
+func (c *Client) CanUseTemplate(name string) bool {
+	return len(c.AllowedTemplates) == 0 || slices.Contains(c.AllowedTemplates, name)
+}
+
+// CanAccess reports whether the client may read or change the email:
+// admins may access every email, other clients the ones they created.
+func (c *Client) CanAccess(email *Email) bool {
+	return c.HasScope(ScopeAdmin) || (email.ClientID != nil && *email.ClientID == c.ID)
+}
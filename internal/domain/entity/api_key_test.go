@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+func TestClientPermissions(t *testing.T) {
+	senders, err := ParseSenders([]string{"Billing@Example.com", "@example.org", "example.org"})
+	if err != nil {
+		t.Fatalf("ParseSenders: %v", err)
+	}
+	if !slices.Equal(senders, []string{"billing@example.com", "example.org"}) {
+		t.Errorf("ParseSenders = %v", senders)
+	}
+
+	for _, invalid := range []string{"", "billing@", "a@b@example.com", "localhost", "a@example.com, b@example.com"} {
+		if _, err := ParseSenders([]string{invalid}); !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Errorf("ParseSenders(%q) = %v, want ErrInvalidInput", invalid, err)
+		}
+	}
+
+	clientID := "client"
+	otherID := "other"
+
+	client := &Client{
+		ID:               clientID,
+		Scopes:           []Scope{ScopeEmailsSend},
+		AllowedSenders:   senders,
+		AllowedTemplates: []string{"invoice"},
+	}
+
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"granted scope", client.HasScope(ScopeEmailsSend), true},
+		{"missing scope", client.HasScope(ScopeEmailsRead), false},
+		{"allowed address", client.CanSendAs("Billing@example.com"), true},
+		{"other address", client.CanSendAs("support@example.com"), false},
+		{"allowed domain", client.CanSendAs("anyone@example.org"), true},
+		{"subdomain", client.CanSendAs("anyone@mail.example.org"), false},
+		{"allowed template", client.CanUseTemplate("invoice"), true},
+		{"other template", client.CanUseTemplate("welcome"), false},
+		{"own email", client.CanAccess(&Email{ClientID: &clientID}), true},
+		{"other email", client.CanAccess(&Email{ClientID: &otherID}), false},
+		{"email without client", client.CanAccess(&Email{}), false},
+		{"unrestricted sender", (&Client{}).CanSendAs("anyone@example.net"), true},
+		{"admin scopes", (&Client{Scopes: []Scope{ScopeAdmin}}).HasScope(ScopeTemplatesWrite), true},
+		{"admin access", (&Client{Scopes: []Scope{ScopeAdmin}}).CanAccess(&Email{ClientID: &otherID}), true},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -6,28 +6,35 @@ import (
 	"github.com/google/uuid"
 )
 
+// Attachment is a stored file that can be referenced by any number of emails.
+// Files with identical content share a single Attachment, keyed by Hash.
 type Attachment struct {
 	ID           uuid.UUID
-	EmailID      uuid.UUID
 	Filename     string
 	OriginalName string
 	Mimetype     string
 	Size         int64
+	Hash         string
 	Path         string
 	URL          *string
 	CreatedAt    time.Time
+	// PurgedAt is set once retention deleted the stored content.
+	PurgedAt *time.Time
+	// Offloaded is set per email when the file is sent as a download link
+	// instead of being embedded in the message.
+	Offloaded bool
 }
 
-func NewAttachment(emailID uuid.UUID, filename, originalName, mimetype string, size int64, path string, url *string) *Attachment {
+func NewAttachment(filename, originalName, mimetype string, size int64, hash, path string, url *string) *Attachment {
 	return &Attachment{
 		ID:           uuid.New(),
-		EmailID:      emailID,
 		Filename:     filename,
 		OriginalName: originalName,
 		Mimetype:     mimetype,
 		Size:         size,
+		Hash:         hash,
 		Path:         path,
 		URL:          url,
-		CreatedAt:    time.Now(),
+		CreatedAt:    time.Now().UTC(),
 	}
 }
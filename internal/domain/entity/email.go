@@ -1,20 +1,14 @@
 package entity
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
 	"github.com/google/uuid"
 )
 
-type EmailStatus string
-
-const (
-	StatusPending EmailStatus = "PENDING"
-	StatusQueued  EmailStatus = "QUEUED"
-	StatusSent    EmailStatus = "SENT"
-	StatusFailed  EmailStatus = "FAILED"
-)
-
 type Email struct {
 	ID          uuid.UUID
 	From        string
@@ -25,13 +19,34 @@ type Email struct {
 	Subject     string
 	Body        string
 	HTML        *string
-	Status      EmailStatus
-	Error       *string
-	SentAt      *time.Time
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	DeletedAt   *time.Time
+	// Category groups emails recipients can unsubscribe from, like
+	// "newsletter". ListUnsubscribe adds one-click unsubscribe headers.
+	Category        *string
+	ListUnsubscribe bool
+	// ClientID is the API client that created the email.
+	ClientID *string
+	Status   EmailStatus
+	Error    *string
+	SentAt   *time.Time
+	// SendAfter is when a queued email is due to be sent. TraceContext
+	// carries the trace of the request that queued it to the worker
+	// sending it, in W3C headers.
+	SendAfter    *time.Time
+	TraceContext map[string]string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time
+	// RedactedAt is set once retention removed the bodies, PurgedAt once
+	// the whole email was removed and only its status remains.
+	RedactedAt  *time.Time
+	PurgedAt    *time.Time
 	Attachments []Attachment
+	Recipients  []Recipient
+	// Version is the number of stored updates when the email was read.
+	Version int
+
+	// events are status changes not stored yet
+	events []EmailEvent
 }
 
 func NewEmail(from string, to []string, displayName, subject, body string) *Email {
@@ -52,20 +67,205 @@ func NewEmail(from string, to []string, displayName, subject, body string) *Emai
 	}
 }
 
-func (e *Email) MarkAsSent() {
+// RecordCreated records the creation of the email as the first event of
+// its timeline.
+func (e *Email) RecordCreated(source EventSource) {
+	e.events = append(e.events, newEmailEvent(e.ID, nil, e.Status, source, "", e.CreatedAt))
+}
+
+// MarkAsSending claims the email for a send, so it is not cancelled while
+// the relay may already have it.
+func (e *Email) MarkAsSending(source EventSource) error {
+	return e.transition(StatusSending, source, "", time.Now().UTC())
+}
+
+func (e *Email) MarkAsSent(source EventSource, detail string) error {
 	now := time.Now().UTC()
-	e.Status = StatusSent
+
+	if err := e.transition(StatusSent, source, detail, now); err != nil {
+		return err
+	}
+
 	e.SentAt = &now
-	e.UpdatedAt = now
+	e.Error = nil
+	return nil
 }
 
-func (e *Email) MarkAsFailed(errMsg string) {
-	e.Status = StatusFailed
+func (e *Email) MarkAsFailed(source EventSource, errMsg string) error {
+	if err := e.transition(StatusFailed, source, errMsg, time.Now().UTC()); err != nil {
+		return err
+	}
+
 	e.Error = &errMsg
-	e.UpdatedAt = time.Now().UTC()
+	return nil
 }
 
-func (e *Email) MarkAsQueued() {
-	e.Status = StatusQueued
-	e.UpdatedAt = time.Now().UTC()
+func (e *Email) MarkAsQueued(source EventSource) error {
+	return e.transition(StatusQueued, source, "", time.Now().UTC())
+}
+
+// Defer queues the email to be sent at until instead of now. Deferring a
+// queued email again only moves the time.
+func (e *Email) Defer(source EventSource, until time.Time, reason string) error {
+	now := time.Now().UTC()
+
+	if e.Status != StatusQueued {
+		if err := e.transition(StatusQueued, source, reason, now); err != nil {
+			return err
+		}
+	}
+
+	until = until.UTC()
+	e.SendAfter = &until
+	e.UpdatedAt = now
+	return nil
+}
+
+// Cancel stops an email that has not been handed to a relay yet. Emails
+// being sent cannot be cancelled.
+func (e *Email) Cancel(source EventSource, reason string) error {
+	return e.transition(StatusCancelled, source, reason, time.Now().UTC())
+}
+
+// RecordRecipientOutcome applies what was learned about an accepted
+// recipient after sending: a delivery, a bounce or a complaint. The email
+// follows its recipients: it is COMPLAINED once any recipient complained,
+// and otherwise DELIVERED or BOUNCED once none awaits an outcome, BOUNCED
+// only if no recipient got the message.
+func (e *Email) RecordRecipientOutcome(source EventSource, address string, outcome RecipientStatus, code int, detail string) error {
+	recipient := e.Recipient(address)
+	if recipient == nil {
+		return fmt.Errorf("%w: %s is not a recipient of email %s", apperrors.ErrInvalidInput, address, e.ID)
+	}
+
+	now := time.Now().UTC()
+
+	if err := recipient.transition(outcome, code, detail, now); err != nil {
+		return err
+	}
+
+	e.UpdatedAt = now
+
+	status := e.deliveryStatus()
+	if status == e.Status {
+		return nil
+	}
+
+	eventDetail := recipient.Address
+	if detail != "" {
+		eventDetail += ": " + detail
+	}
+
+	return e.transition(status, source, eventDetail, now)
+}
+
+// deliveryStatus derives the status of a sent email from its recipients.
+func (e *Email) deliveryStatus() EmailStatus {
+	var awaiting, delivered, bounced, complained int
+
+	for _, r := range e.Recipients {
+		switch r.Status {
+		case RecipientAccepted:
+			awaiting++
+		case RecipientDelivered:
+			delivered++
+		case RecipientBounced:
+			bounced++
+		case RecipientComplained:
+			complained++
+		}
+	}
+
+	switch {
+	case complained > 0:
+		return StatusComplained
+	case awaiting > 0:
+		return e.Status
+	case delivered > 0:
+		return StatusDelivered
+	case bounced > 0:
+		return StatusBounced
+	default:
+		return e.Status
+	}
+}
+
+func (e *Email) transition(to EmailStatus, source EventSource, detail string, at time.Time) error {
+	from := e.Status
+
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: email %s to %s", apperrors.ErrInvalidTransition, from, to)
+	}
+
+	e.Status = to
+	e.UpdatedAt = at
+	if to != StatusQueued {
+		e.SendAfter = nil
+		e.TraceContext = nil
+	}
+	e.events = append(e.events, newEmailEvent(e.ID, &from, to, source, detail, at))
+
+	return nil
+}
+
+// PendingEvents returns the events recorded since the email was last
+// stored.
+func (e *Email) PendingEvents() []EmailEvent {
+	return e.events
+}
+
+// ClearEvents is called by repositories once the pending events are stored.
+func (e *Email) ClearEvents() {
+	e.events = nil
+}
+
+// Recipient returns the delivery state of an address, or nil if the email
+// is not addressed to it.
+func (e *Email) Recipient(address string) *Recipient {
+	for i := range e.Recipients {
+		if strings.EqualFold(e.Recipients[i].Address, address) {
+			return &e.Recipients[i]
+		}
+	}
+
+	return nil
+}
+
+// RecipientAt returns the recipient at position in the order the email is
+// addressed, or nil if there is none.
+func (e *Email) RecipientAt(position int) *Recipient {
+	if position < 0 || position >= len(e.Recipients) {
+		return nil
+	}
+
+	return &e.Recipients[position]
+}
+
+// MessageID is the Message-ID header the email is sent with. It carries
+// the email ID so replies and bounces quoting it can be traced back.
+func (e *Email) MessageID() string {
+	domain := "localhost"
+	if at := strings.LastIndex(e.From, "@"); at >= 0 && at < len(e.From)-1 {
+		domain = e.From[at+1:]
+	}
+
+	return "<" + e.ID.String() + "@" + domain + ">"
+}
+
+// EmailIDFromMessageID returns the email ID carried by a Message-ID built
+// by MessageID.
+func EmailIDFromMessageID(messageID string) (uuid.UUID, bool) {
+	messageID = strings.Trim(strings.TrimSpace(messageID), "<>")
+
+	local, _, ok := strings.Cut(messageID, "@")
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(local)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return id, true
 }
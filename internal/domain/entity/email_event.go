@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventActor is the part of the system that changed the status of an email.
+type EventActor string
+
+const (
+	ActorAPI     EventActor = "API"
+	ActorWorker  EventActor = "WORKER"
+	ActorWebhook EventActor = "WEBHOOK"
+	ActorSystem  EventActor = "SYSTEM"
+)
+
+// EventSource attributes a status change.
+type EventSource struct {
+	Actor    EventActor
+	Provider string
+}
+
+// EmailEvent records a status change of an email. Events are only ever
+// appended, so together they form the timeline of the email.
+type EmailEvent struct {
+	ID      uuid.UUID
+	EmailID uuid.UUID
+	// FromStatus is nil for the event that created the email.
+	FromStatus *EmailStatus
+	ToStatus   EmailStatus
+	Actor      EventActor
+	Provider   string
+	Detail     *string
+	CreatedAt  time.Time
+}
+
+func newEmailEvent(emailID uuid.UUID, from *EmailStatus, to EmailStatus, source EventSource, detail string, at time.Time) EmailEvent {
+	event := EmailEvent{
+		ID:         uuid.New(),
+		EmailID:    emailID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      source.Actor,
+		Provider:   source.Provider,
+		CreatedAt:  at,
+	}
+
+	if detail != "" {
+		event.Detail = &detail
+	}
+
+	return event
+}
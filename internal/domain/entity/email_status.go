@@ -0,0 +1,73 @@
+package entity
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+type EmailStatus string
+
+// An email is PENDING when accepted by the API and QUEUED while it waits
+// for a worker. It is SENDING while it is handed to the relay, and can no
+// longer be cancelled. SENT means a relay accepted it, which is not yet
+// delivery: DSNs and provider webhooks later move it to DELIVERED, BOUNCED
+// or COMPLAINED. FAILED emails may be retried; CANCELLED ones never will.
+const (
+	StatusPending    EmailStatus = "PENDING"
+	StatusQueued     EmailStatus = "QUEUED"
+	StatusSending    EmailStatus = "SENDING"
+	StatusSent       EmailStatus = "SENT"
+	StatusFailed     EmailStatus = "FAILED"
+	StatusDelivered  EmailStatus = "DELIVERED"
+	StatusBounced    EmailStatus = "BOUNCED"
+	StatusComplained EmailStatus = "COMPLAINED"
+	StatusCancelled  EmailStatus = "CANCELLED"
+)
+
+// transitions is the state machine of an email: the statuses it may move
+// to from each status. A failed email may fail again on retry, and each
+// attempt is recorded. A delivered message may still bounce later or be
+// reported as spam.
+var transitions = map[EmailStatus][]EmailStatus{
+	StatusPending:    {StatusQueued, StatusSending, StatusSent, StatusFailed, StatusCancelled},
+	StatusQueued:     {StatusSending, StatusSent, StatusFailed, StatusCancelled},
+	StatusFailed:     {StatusQueued, StatusSending, StatusSent, StatusFailed, StatusCancelled},
+	StatusSending:    {StatusSent, StatusFailed},
+	StatusSent:       {StatusDelivered, StatusBounced, StatusComplained},
+	StatusDelivered:  {StatusBounced, StatusComplained},
+	StatusBounced:    {},
+	StatusComplained: {},
+	StatusCancelled:  {},
+}
+
+// EmailStatuses lists every status.
+func EmailStatuses() []EmailStatus {
+	return []EmailStatus{
+		StatusPending, StatusQueued, StatusSending, StatusSent, StatusFailed,
+		StatusDelivered, StatusBounced, StatusComplained, StatusCancelled,
+	}
+}
+
+// ParseEmailStatus accepts a status name in any case.
+func ParseEmailStatus(s string) (EmailStatus, error) {
+	status := EmailStatus(strings.ToUpper(strings.TrimSpace(s)))
+
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("%w: unknown email status %q", apperrors.ErrInvalidInput, s)
+	}
+
+	return status, nil
+}
+
+// CanTransition reports whether an email in status from may move to to.
+func CanTransition(from, to EmailStatus) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// IsFinal reports whether no further transition is possible.
+func (s EmailStatus) IsFinal() bool {
+	return len(transitions[s]) == 0
+}
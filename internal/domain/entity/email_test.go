@@ -0,0 +1,134 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+func TestEmailTransitions(t *testing.T) {
+	source := EventSource{Actor: ActorWorker, Provider: "smtp"}
+
+	email := NewEmail("from@example.com", []string{"to@example.com"}, "", "Subject", "Body")
+	email.RecordCreated(EventSource{Actor: ActorAPI})
+
+	steps := []struct {
+		name    string
+		mark    func() error
+		want    EmailStatus
+		invalid bool
+	}{
+		{"queue", func() error { return email.MarkAsQueued(source) }, StatusQueued, false},
+		{"fail", func() error { return email.MarkAsFailed(source, "421 try later") }, StatusFailed, false},
+		{"fail again", func() error { return email.MarkAsFailed(source, "421 try later") }, StatusFailed, false},
+		{"retry", func() error { return email.MarkAsQueued(source) }, StatusQueued, false},
+		{"send", func() error { return email.MarkAsSent(source, "message 1") }, StatusSent, false},
+		{"queue after send", func() error { return email.MarkAsQueued(source) }, StatusSent, true},
+		{"fail after send", func() error { return email.MarkAsFailed(source, "late") }, StatusSent, true},
+	}
+
+	for _, step := range steps {
+		err := step.mark()
+
+		if step.invalid != errors.Is(err, apperrors.ErrInvalidTransition) {
+			t.Fatalf("%s: err = %v, want invalid %v", step.name, err, step.invalid)
+		}
+		if email.Status != step.want {
+			t.Fatalf("%s: status = %s, want %s", step.name, email.Status, step.want)
+		}
+	}
+
+	if email.Error != nil || email.SentAt == nil {
+		t.Errorf("after send: error %v, sent at %v", email.Error, email.SentAt)
+	}
+
+	// Creation plus the five valid transitions
+	events := email.PendingEvents()
+	if len(events) != 6 {
+		t.Fatalf("got %d events, want 6", len(events))
+	}
+	if events[0].FromStatus != nil || events[0].ToStatus != StatusPending {
+		t.Errorf("first event = %+v, want creation", events[0])
+	}
+	if last := events[5]; *last.FromStatus != StatusQueued || last.ToStatus != StatusSent || *last.Detail != "message 1" {
+		t.Errorf("last event = %+v", last)
+	}
+
+	email.ClearEvents()
+	if len(email.PendingEvents()) != 0 {
+		t.Error("events pending after ClearEvents")
+	}
+}
+
+func TestEmailDefer(t *testing.T) {
+	source := EventSource{Actor: ActorWorker}
+	email := NewEmail("from@example.com", []string{"to@example.com"}, "", "Subject", "Body")
+
+	first := time.Now().Add(time.Minute)
+	if err := email.Defer(source, first, "throttled: example.com"); err != nil {
+		t.Fatalf("Defer: %v", err)
+	}
+
+	second := first.Add(time.Minute)
+	if err := email.Defer(source, second, "throttled: example.com"); err != nil {
+		t.Fatalf("Defer again: %v", err)
+	}
+
+	if email.Status != StatusQueued || email.SendAfter == nil || !email.SendAfter.Equal(second) {
+		t.Errorf("status %s, send after %v, want queued until %v", email.Status, email.SendAfter, second)
+	}
+	if events := email.PendingEvents(); len(events) != 1 || *events[0].Detail != "throttled: example.com" {
+		t.Errorf("events = %+v, want one queued event", events)
+	}
+
+	if err := email.MarkAsSent(source, "message 1"); err != nil {
+		t.Fatalf("MarkAsSent: %v", err)
+	}
+	if err := email.Defer(source, second, "throttled"); !errors.Is(err, apperrors.ErrInvalidTransition) {
+		t.Errorf("Defer after send = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestEmailDeliveryOutcomes(t *testing.T) {
+	source := EventSource{Actor: ActorWebhook, Provider: "relay"}
+
+	tests := []struct {
+		name     string
+		outcomes []RecipientStatus
+		want     []EmailStatus
+	}{
+		{"all delivered", []RecipientStatus{RecipientDelivered, RecipientDelivered}, []EmailStatus{StatusSent, StatusDelivered}},
+		{"all bounced", []RecipientStatus{RecipientBounced, RecipientBounced}, []EmailStatus{StatusSent, StatusBounced}},
+		{"partly bounced", []RecipientStatus{RecipientBounced, RecipientDelivered}, []EmailStatus{StatusSent, StatusDelivered}},
+		{"complaint", []RecipientStatus{RecipientComplained, RecipientDelivered}, []EmailStatus{StatusComplained, StatusComplained}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := NewEmail("from@example.com", []string{"a@example.com", "b@example.com"}, "", "Subject", "Body")
+			email.Recipients = NewRecipients(email.To, nil, nil)
+
+			for i := range email.Recipients {
+				if err := email.Recipients[i].MarkAsAccepted(250, "OK"); err != nil {
+					t.Fatalf("MarkAsAccepted: %v", err)
+				}
+			}
+			if err := email.MarkAsSent(source, "message 1"); err != nil {
+				t.Fatalf("MarkAsSent: %v", err)
+			}
+
+			for i, outcome := range tt.outcomes {
+				// Once complained the email is final, later outcomes only update the recipient
+				err := email.RecordRecipientOutcome(source, email.Recipients[i].Address, outcome, 0, "")
+				if err != nil {
+					t.Fatalf("outcome %d: %v", i, err)
+				}
+				if email.Status != tt.want[i] {
+					t.Errorf("after outcome %d status = %s, want %s", i, email.Status, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErasedAddress replaces an erased address so recipient counts survive.
+const ErasedAddress = "erased@erased.invalid"
+
+// ErasureReport records what was removed for an erasure request.
+type ErasureReport struct {
+	ID            uuid.UUID
+	AddressHash   string
+	EmailIDs      []uuid.UUID
+	AttachmentIDs []uuid.UUID
+	CreatedAt     time.Time
+}
+
+func NewErasureReport(address string) *ErasureReport {
+	return &ErasureReport{
+		ID:            uuid.New(),
+		AddressHash:   HashAddress(address),
+		EmailIDs:      []uuid.UUID{},
+		AttachmentIDs: []uuid.UUID{},
+		CreatedAt:     time.Now().UTC(),
+	}
+}
+
+// HashAddress identifies an address in audit records without storing it.
+func HashAddress(address string) string {
+	sum := sha256.Sum256([]byte(NormalizeAddress(address)))
+	return hex.EncodeToString(sum[:])
+}
+
+func NormalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,44 @@
+package entity
+
+import "time"
+
+// QuotaPeriod is the window a send quota counts emails in. Periods follow
+// the UTC calendar.
+type QuotaPeriod string
+
+const (
+	QuotaDaily   QuotaPeriod = "daily"
+	QuotaMonthly QuotaPeriod = "monthly"
+)
+
+// Bounds returns the start and end of the period containing t.
+func (p QuotaPeriod) Bounds(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+
+	if p == QuotaMonthly {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// QuotaUsage is the number of emails a client created in a period. A zero
+// Limit means the period is unlimited.
+type QuotaUsage struct {
+	Period QuotaPeriod
+	Limit  int
+	Used   int
+	Start  time.Time
+	End    time.Time
+}
+
+// Remaining returns how many more emails the client may create in the
+// period, -1 when it is unlimited.
+func (u QuotaUsage) Remaining() int {
+	if u.Limit <= 0 {
+		return -1
+	}
+	return max(u.Limit-u.Used, 0)
+}
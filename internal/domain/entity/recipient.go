@@ -0,0 +1,144 @@
+package entity
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+type RecipientKind string
+
+const (
+	RecipientTo  RecipientKind = "TO"
+	RecipientCC  RecipientKind = "CC"
+	RecipientBCC RecipientKind = "BCC"
+)
+
+type RecipientStatus string
+
+const (
+	// RecipientPending has not been offered to the relay yet.
+	RecipientPending    RecipientStatus = "PENDING"
+	RecipientAccepted   RecipientStatus = "ACCEPTED"
+	RecipientRejected   RecipientStatus = "REJECTED"
+	RecipientBounced    RecipientStatus = "BOUNCED"
+	RecipientDelivered  RecipientStatus = "DELIVERED"
+	RecipientComplained RecipientStatus = "COMPLAINED"
+	// RecipientSuppressed was left out because the address is on the
+	// suppression list.
+	RecipientSuppressed RecipientStatus = "SUPPRESSED"
+)
+
+// recipientTransitions is the state machine of a recipient. Outcomes after
+// sending only apply to addresses the relay accepted.
+var recipientTransitions = map[RecipientStatus][]RecipientStatus{
+	RecipientPending:    {RecipientAccepted, RecipientRejected, RecipientSuppressed},
+	RecipientAccepted:   {RecipientDelivered, RecipientBounced, RecipientComplained},
+	RecipientDelivered:  {RecipientBounced, RecipientComplained},
+	RecipientRejected:   {},
+	RecipientBounced:    {},
+	RecipientComplained: {},
+	RecipientSuppressed: {},
+}
+
+// Recipient is the delivery state of one address of an email.
+type Recipient struct {
+	ID      uuid.UUID
+	Address string
+	Kind    RecipientKind
+	Status  RecipientStatus
+	// SMTPCode and Response are the last reply concerning the address,
+	// such as the relay's answer to RCPT TO.
+	SMTPCode  *int
+	Response  *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Domain returns the domain of the address, in lower case.
+func (r *Recipient) Domain() string {
+	address := NormalizeAddress(r.Address)
+	return address[strings.LastIndex(address, "@")+1:]
+}
+
+// NewRecipients lists the distinct addresses of an email. An address that
+// appears more than once keeps its first kind.
+func NewRecipients(to, cc, bcc []string) []Recipient {
+	now := time.Now().UTC()
+	seen := make(map[string]bool)
+
+	var recipients []Recipient
+
+	add := func(addresses []string, kind RecipientKind) {
+		for _, address := range addresses {
+			key := strings.ToLower(address)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			recipients = append(recipients, Recipient{
+				ID:        uuid.New(),
+				Address:   address,
+				Kind:      kind,
+				Status:    RecipientPending,
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+		}
+	}
+
+	add(to, RecipientTo)
+	add(cc, RecipientCC)
+	add(bcc, RecipientBCC)
+
+	return recipients
+}
+
+func (r *Recipient) MarkAsAccepted(code int, response string) error {
+	return r.transition(RecipientAccepted, code, response, time.Now().UTC())
+}
+
+func (r *Recipient) MarkAsRejected(code int, response string) error {
+	return r.transition(RecipientRejected, code, response, time.Now().UTC())
+}
+
+func (r *Recipient) MarkAsSuppressed(reason string) error {
+	return r.transition(RecipientSuppressed, 0, reason, time.Now().UTC())
+}
+
+func (r *Recipient) transition(status RecipientStatus, code int, response string, at time.Time) error {
+	if !slices.Contains(recipientTransitions[r.Status], status) {
+		return fmt.Errorf("%w: recipient %s to %s", apperrors.ErrInvalidTransition, r.Status, status)
+	}
+
+	r.Status = status
+	r.UpdatedAt = at
+
+	if code != 0 {
+		r.SMTPCode = &code
+	}
+	if response != "" {
+		r.Response = &response
+	}
+
+	return nil
+}
+
+// ParseRecipientOutcome accepts the outcomes reported after sending, in any
+// case.
+func ParseRecipientOutcome(s string) (RecipientStatus, error) {
+	status := RecipientStatus(strings.ToUpper(strings.TrimSpace(s)))
+
+	switch status {
+	case RecipientDelivered, RecipientBounced, RecipientComplained:
+		return status, nil
+	default:
+		return "", fmt.Errorf("%w: unknown delivery outcome %q", apperrors.ErrInvalidInput, s)
+	}
+}
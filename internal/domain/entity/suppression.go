@@ -0,0 +1,82 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+type SuppressionReason string
+
+const (
+	SuppressionHardBounce  SuppressionReason = "HARD_BOUNCE"
+	SuppressionComplaint   SuppressionReason = "COMPLAINT"
+	SuppressionUnsubscribe SuppressionReason = "UNSUBSCRIBE"
+	SuppressionManual      SuppressionReason = "MANUAL"
+)
+
+// SuppressionSource tells how an address ended up on the list.
+type SuppressionSource string
+
+const (
+	SuppressionSourceAPI     SuppressionSource = "API"
+	SuppressionSourceImport  SuppressionSource = "IMPORT"
+	SuppressionSourceBounce  SuppressionSource = "BOUNCE"
+	SuppressionSourceWebhook SuppressionSource = "WEBHOOK"
+	// SuppressionSourceRecipient is the recipient unsubscribing.
+	SuppressionSourceRecipient SuppressionSource = "RECIPIENT"
+)
+
+// Suppression keeps emails from being sent to an address. Addresses are
+// stored in lower case and an entry without expiry never expires. An
+// address has one entry per category; the empty category covers every
+// email.
+type Suppression struct {
+	Address  string
+	Category string
+	Reason   SuppressionReason
+	Source   SuppressionSource
+	Detail   *string
+	// EmailID is the email whose bounce, complaint or unsubscribe link
+	// added the entry.
+	EmailID   *uuid.UUID
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func NewSuppression(address string, reason SuppressionReason, source SuppressionSource) *Suppression {
+	now := time.Now().UTC()
+	return &Suppression{
+		Address:   NormalizeAddress(address),
+		Reason:    reason,
+		Source:    source,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Covers reports whether the entry applies to emails of category.
+func (s *Suppression) Covers(category string) bool {
+	return s.Category == "" || s.Category == category
+}
+
+// Active reports whether the entry still suppresses its address at t.
+func (s *Suppression) Active(t time.Time) bool {
+	return s.ExpiresAt == nil || t.Before(*s.ExpiresAt)
+}
+
+// ParseSuppressionReason accepts a reason name in any case.
+func ParseSuppressionReason(s string) (SuppressionReason, error) {
+	reason := SuppressionReason(strings.ToUpper(strings.TrimSpace(s)))
+
+	switch reason {
+	case SuppressionHardBounce, SuppressionComplaint, SuppressionUnsubscribe, SuppressionManual:
+		return reason, nil
+	default:
+		return "", fmt.Errorf("%w: unknown suppression reason %q", apperrors.ErrInvalidInput, s)
+	}
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/google/uuid"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *entity.APIKey) error
+	FindByID(ctx context.Context, id uuid.UUID) (*entity.APIKey, error)
+	// FindByHash returns the key with the given hash, revoked or not.
+	FindByHash(ctx context.Context, hash []byte) (*entity.APIKey, error)
+	// List returns all keys, oldest first.
+	List(ctx context.Context) ([]entity.APIKey, error)
+	// Revoke revokes the key at t. Revoking it again keeps the first time.
+	Revoke(ctx context.Context, id uuid.UUID, t time.Time) error
+	// Touch records that the key was used at t.
+	Touch(ctx context.Context, id uuid.UUID, t time.Time) error
+}
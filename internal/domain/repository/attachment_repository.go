@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/google/uuid"
+)
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *entity.Attachment) error
+	FindByID(ctx context.Context, id uuid.UUID) (*entity.Attachment, error)
+	FindByHash(ctx context.Context, hash string) (*entity.Attachment, error)
+	FindByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.Attachment, error)
+	// Delete removes the attachment only if no email references it,
+	// otherwise it returns errors.ErrAttachmentInUse.
+	Delete(ctx context.Context, id uuid.UUID) error
+	// Touch moves created_at forward to t, so a deduplicated upload gets
+	// the same grace period before orphan cleanup as a new one.
+	Touch(ctx context.Context, id uuid.UUID, t time.Time) error
+	// AddOwner records that the client uploaded the attachment under
+	// originalName. Adding an existing owner again updates the name.
+	AddOwner(ctx context.Context, id uuid.UUID, clientID, originalName string) error
+	// FindOwners returns the clients that uploaded the attachment.
+	FindOwners(ctx context.Context, id uuid.UUID) ([]string, error)
+	// FindOwnerName returns the name the client uploaded the attachment
+	// under, or errors.ErrNotFound if it is not an owner.
+	FindOwnerName(ctx context.Context, id uuid.UUID, clientID string) (string, error)
+	RemoveOwner(ctx context.Context, id uuid.UUID, clientID string) error
+	// StoredSize returns the total size of the attachments whose content
+	// was not purged.
+	StoredSize(ctx context.Context) (int64, error)
+	// FindOrphans returns attachments created before olderThan that are
+	// not referenced by any email.
+	FindOrphans(ctx context.Context, olderThan time.Time, limit int) ([]entity.Attachment, error)
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/google/uuid"
+)
+
+// EmailEventRepository reads the timeline of an email. Events are written
+// by EmailRepository together with the status change they record.
+type EmailEventRepository interface {
+	// FindByEmailID returns the events of an email, oldest first.
+	FindByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.EmailEvent, error)
+}
@@ -2,15 +2,45 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/an3wers/notification-serv/internal/domain/entity"
 	"github.com/google/uuid"
 )
 
 type EmailRepository interface {
+	// Create stores the email and links it to its attachments. It fails
+	// with errors.ErrInvalidInput if an attachment was deleted or purged,
+	// and keeps the attachments from being purged until it commits.
 	Create(ctx context.Context, email *entity.Email) error
+	// FindByID does not return soft deleted emails.
 	FindByID(ctx context.Context, id uuid.UUID) (*entity.Email, error)
+	// Create and Update also append the pending events of the email.
+	// Update fails with errors.ErrConflict if the email was updated since
+	// it was read.
 	Update(ctx context.Context, email *entity.Email) error
-	CreateAttachment(ctx context.Context, attachment *entity.Attachment) error
-	FindAttachmentsByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.Attachment, error)
+	SoftDelete(ctx context.Context, id uuid.UUID) error
+	// FindTombstone returns what is left of an email removed by retention.
+	FindTombstone(ctx context.Context, id uuid.UUID) (*entity.Email, error)
+	// List returns the emails matching the filter, newest first, with their
+	// recipients but without attachments. Soft deleted emails are skipped.
+	List(ctx context.Context, filter EmailFilter) ([]entity.Email, error)
+	// ListDue returns the IDs of queued emails due to be sent at now, those
+	// due the longest first.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]uuid.UUID, error)
+	// CountQueued returns how many emails are queued, due or not.
+	CountQueued(ctx context.Context) (int, error)
+}
+
+// EmailFilter selects emails to list. Zero fields do not filter.
+type EmailFilter struct {
+	Statuses []entity.EmailStatus
+	// Before and BeforeID page through the list: only emails that sort
+	// after the email created at Before with BeforeID are returned. Without
+	// BeforeID, only emails created earlier than Before are.
+	Before   *time.Time
+	BeforeID *uuid.UUID
+	// ClientID limits the list to the emails of a client.
+	ClientID *string
+	Limit    int
 }
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/google/uuid"
+)
+
+type ErasureRepository interface {
+	// EraseAddress replaces the address in every stored email that
+	// mentions it, clears their content and unlinks their attachments.
+	// It returns the affected emails and the unlinked attachments.
+	EraseAddress(ctx context.Context, address string) (emailIDs []uuid.UUID, attachmentIDs []uuid.UUID, err error)
+	SaveReport(ctx context.Context, report *entity.ErasureReport) error
+	FindReport(ctx context.Context, id uuid.UUID) (*entity.ErasureReport, error)
+}
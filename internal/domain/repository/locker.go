@@ -0,0 +1,10 @@
+package repository
+
+import "context"
+
+// Locker provides locks shared by all replicas of the service.
+type Locker interface {
+	// TryLock acquires the named lock without waiting. When acquired is
+	// true the caller must call release.
+	TryLock(ctx context.Context, name string) (release func(), acquired bool, err error)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NonceRepository remembers the nonces of signed requests so that a
+// request cannot be replayed.
+type NonceRepository interface {
+	// Use records the nonce of a key until expiresAt. It returns false if
+	// the nonce was recorded before and has not expired yet.
+	Use(ctx context.Context, keyID uuid.UUID, nonce string, expiresAt time.Time) (bool, error)
+	// DeleteExpired removes the nonces that expired before now.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+)
+
+// QuotaRepository counts the emails of clients per quota period.
+type QuotaRepository interface {
+	// Consume adds amount to the usage of a client in the period starting
+	// at start, unless the usage would exceed limit; a limit of 0 does not
+	// cap it. It returns whether the amount was added.
+	Consume(ctx context.Context, clientID string, period entity.QuotaPeriod, start time.Time, amount, limit int) (bool, error)
+	// Usage returns the usage of a client in the period starting at start.
+	Usage(ctx context.Context, clientID string, period entity.QuotaPeriod, start time.Time) (int, error)
+}
@@ -0,0 +1,1355 @@
+// Package repositorytest provides a contract test suite shared by the
+// implementations of the repository interfaces.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+// Repositories are the implementations under test. They must share one
+// backing store.
+type Repositories struct {
+	Emails       repository.EmailRepository
+	Attachments  repository.AttachmentRepository
+	Events       repository.EmailEventRepository
+	Suppressions repository.SuppressionRepository
+	APIKeys      repository.APIKeyRepository
+	Nonces       repository.NonceRepository
+	Quotas       repository.QuotaRepository
+	Transactor   repository.Transactor
+}
+
+// Run runs the contract suite. setup is called for every test and must
+// return repositories backed by an empty store.
+func Run(t *testing.T, setup func(t *testing.T) Repositories) {
+	t.Run("Email", func(t *testing.T) { testEmails(t, setup) })
+	t.Run("Attachment", func(t *testing.T) { testAttachments(t, setup) })
+	t.Run("Suppression", func(t *testing.T) { testSuppressions(t, setup) })
+	t.Run("APIKey", func(t *testing.T) { testAPIKeys(t, setup) })
+	t.Run("Nonce", func(t *testing.T) { testNonces(t, setup) })
+	t.Run("Quota", func(t *testing.T) { testQuotas(t, setup) })
+	t.Run("Transactor", func(t *testing.T) { testTransactor(t, setup) })
+}
+
+func testEmails(t *testing.T, setup func(t *testing.T) Repositories) {
+	t.Run("CreateAndFind", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		uploaded := newAttachment("terms.pdf")
+		mustCreateAttachment(t, repos, uploaded)
+
+		inline := newAttachment("photo.png")
+		mustCreateAttachment(t, repos, inline)
+		inline.Offloaded = true
+
+		linked := *uploaded
+		linked.OriginalName = "Terms of Service.pdf"
+
+		email := newEmail()
+		email.CC = []string{"cc@example.com"}
+		html := "<p>Hello</p>"
+		email.HTML = &html
+		category := "newsletter"
+		email.Category = &category
+		email.ListUnsubscribe = true
+		clientID := uuid.NewString()
+		email.ClientID = &clientID
+		email.Attachments = []entity.Attachment{*inline, linked}
+
+		if err := repos.Emails.Create(ctx, email); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		found, err := repos.Emails.FindByID(ctx, email.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+
+		if found.From != email.From || found.DisplayName != email.DisplayName || found.Subject != email.Subject ||
+			found.Body != email.Body || found.Status != email.Status {
+			t.Errorf("FindByID = %+v, want %+v", found, email)
+		}
+		if found.Category == nil || *found.Category != category || !found.ListUnsubscribe {
+			t.Errorf("category = %v, unsubscribe = %v, want newsletter with unsubscribe", found.Category, found.ListUnsubscribe)
+		}
+		if found.ClientID == nil || *found.ClientID != clientID {
+			t.Errorf("ClientID = %v, want %s", found.ClientID, clientID)
+		}
+		if !equalStrings(found.To, email.To) || !equalStrings(found.CC, email.CC) || len(found.BCC) != 0 {
+			t.Errorf("recipients = %v %v %v, want %v %v []", found.To, found.CC, found.BCC, email.To, email.CC)
+		}
+		if found.HTML == nil || *found.HTML != html {
+			t.Errorf("HTML = %v, want %q", found.HTML, html)
+		}
+		if !found.CreatedAt.Equal(email.CreatedAt) {
+			t.Errorf("CreatedAt = %v, want %v", found.CreatedAt, email.CreatedAt)
+		}
+		if found.Error != nil || found.SentAt != nil || found.DeletedAt != nil {
+			t.Errorf("unexpected error, sent or deleted time: %+v", found)
+		}
+
+		if len(found.Attachments) != 2 {
+			t.Fatalf("got %d attachments, want 2", len(found.Attachments))
+		}
+		if got := found.Attachments[0]; got.ID != inline.ID || !got.Offloaded || got.OriginalName != "photo.png" {
+			t.Errorf("first attachment = %+v, want offloaded %s", got, inline.ID)
+		}
+		if got := found.Attachments[1]; got.ID != uploaded.ID || got.Offloaded || got.OriginalName != "Terms of Service.pdf" {
+			t.Errorf("second attachment = %+v, want %s named by the email", got, uploaded.ID)
+		}
+
+		// Per-email properties do not leak into the stored attachment
+		att, err := repos.Attachments.FindByID(ctx, inline.ID)
+		if err != nil {
+			t.Fatalf("FindByID(attachment): %v", err)
+		}
+		if att.Offloaded || att.Hash != inline.Hash || att.Size != inline.Size {
+			t.Errorf("attachment = %+v, want %+v without offload", att, inline)
+		}
+
+		att, err = repos.Attachments.FindByID(ctx, uploaded.ID)
+		if err != nil {
+			t.Fatalf("FindByID(attachment): %v", err)
+		}
+		if att.OriginalName != "terms.pdf" {
+			t.Errorf("OriginalName = %q, want %q", att.OriginalName, "terms.pdf")
+		}
+
+		byEmail, err := repos.Attachments.FindByEmailID(ctx, email.ID)
+		if err != nil {
+			t.Fatalf("FindByEmailID: %v", err)
+		}
+		if len(byEmail) != 2 || byEmail[0].ID != inline.ID || byEmail[1].ID != uploaded.ID {
+			t.Errorf("FindByEmailID = %+v, want attachments in email order", byEmail)
+		}
+	})
+
+	t.Run("CreateWithMissingAttachment", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		email := newEmail()
+		email.Attachments = []entity.Attachment{*newAttachment("deleted.pdf")}
+
+		if err := repos.Emails.Create(ctx, email); !errors.Is(err, apperrors.ErrInvalidInput) {
+			t.Fatalf("Create = %v, want ErrInvalidInput", err)
+		}
+		if _, err := repos.Emails.FindByID(ctx, email.ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByID = %v, want the email not stored", err)
+		}
+		if _, err := repos.Attachments.FindByID(ctx, email.Attachments[0].ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByID(attachment) = %v, want it not recreated", err)
+		}
+	})
+
+	t.Run("Recipients", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		email := newEmail()
+		email.CC = []string{"cc@example.com"}
+		email.BCC = []string{"bcc@example.com"}
+		email.Recipients = entity.NewRecipients(email.To, email.CC, email.BCC)
+		mustCreateEmail(t, repos, email)
+
+		found := mustFindEmail(t, repos, email.ID)
+		if len(found.Recipients) != 3 {
+			t.Fatalf("got %d recipients, want 3", len(found.Recipients))
+		}
+		for i, want := range email.Recipients {
+			got := found.Recipients[i]
+			if got.ID != want.ID || got.Address != want.Address || got.Kind != want.Kind ||
+				got.Status != entity.RecipientPending || got.SMTPCode != nil || got.Response != nil {
+				t.Errorf("recipient %d = %+v, want %+v", i, got, want)
+			}
+		}
+
+		email.Recipients[0].MarkAsAccepted(250, "2.1.5 OK")
+		email.Recipients[2].MarkAsRejected(550, "5.1.1 user unknown")
+		mustTransition(t, email.MarkAsSent(testSource, "message 1"))
+		if err := repos.Emails.Update(ctx, email); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		found = mustFindEmail(t, repos, email.ID)
+		want := []struct {
+			status   entity.RecipientStatus
+			code     int
+			response string
+		}{
+			{entity.RecipientAccepted, 250, "2.1.5 OK"},
+			{entity.RecipientPending, 0, ""},
+			{entity.RecipientRejected, 550, "5.1.1 user unknown"},
+		}
+		for i, w := range want {
+			got := found.Recipients[i]
+			if got.Status != w.status {
+				t.Errorf("recipient %s status = %s, want %s", got.Address, got.Status, w.status)
+			}
+			if w.code != 0 && (got.SMTPCode == nil || *got.SMTPCode != w.code || got.Response == nil || *got.Response != w.response) {
+				t.Errorf("recipient %s reply = %v %v, want %d %q", got.Address, got.SMTPCode, got.Response, w.code, w.response)
+			}
+		}
+	})
+
+	t.Run("FindMissing", func(t *testing.T) {
+		repos := setup(t)
+
+		if _, err := repos.Emails.FindByID(context.Background(), uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByID = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		email := newEmail()
+		mustCreateEmail(t, repos, email)
+
+		mustTransition(t, email.MarkAsFailed(testSource, "connection refused"))
+		if err := repos.Emails.Update(ctx, email); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		found := mustFindEmail(t, repos, email.ID)
+		if found.Status != entity.StatusFailed || found.Error == nil || *found.Error != "connection refused" {
+			t.Errorf("after failure: status %s, error %v", found.Status, found.Error)
+		}
+
+		mustTransition(t, email.MarkAsSent(testSource, "message 1"))
+		if err := repos.Emails.Update(ctx, email); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		found = mustFindEmail(t, repos, email.ID)
+		if found.Status != entity.StatusSent || found.Error != nil || found.SentAt == nil {
+			t.Errorf("after send: status %s, error %v, sent at %v", found.Status, found.Error, found.SentAt)
+		}
+		if found.SentAt != nil && found.SentAt.Sub(*email.SentAt).Abs() > time.Millisecond {
+			t.Errorf("SentAt = %v, want %v", found.SentAt, email.SentAt)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		email := newEmail()
+		email.RecordCreated(entity.EventSource{Actor: entity.ActorAPI})
+		mustCreateEmail(t, repos, email)
+
+		if n := len(email.PendingEvents()); n != 0 {
+			t.Errorf("%d events still pending after Create", n)
+		}
+
+		mustTransition(t, email.MarkAsFailed(testSource, "421 try later"))
+		mustTransition(t, email.MarkAsQueued(entity.EventSource{Actor: entity.ActorWorker}))
+		mustTransition(t, email.MarkAsSent(testSource, "message 1"))
+		if err := repos.Emails.Update(ctx, email); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		events, err := repos.Events.FindByEmailID(ctx, email.ID)
+		if err != nil {
+			t.Fatalf("FindByEmailID: %v", err)
+		}
+
+		want := []struct {
+			from   entity.EmailStatus
+			to     entity.EmailStatus
+			actor  entity.EventActor
+			detail string
+		}{
+			{"", entity.StatusPending, entity.ActorAPI, ""},
+			{entity.StatusPending, entity.StatusFailed, entity.ActorWorker, "421 try later"},
+			{entity.StatusFailed, entity.StatusQueued, entity.ActorWorker, ""},
+			{entity.StatusQueued, entity.StatusSent, entity.ActorWorker, "message 1"},
+		}
+
+		if len(events) != len(want) {
+			t.Fatalf("got %d events, want %d", len(events), len(want))
+		}
+
+		for i, w := range want {
+			got := events[i]
+
+			var from entity.EmailStatus
+			if got.FromStatus != nil {
+				from = *got.FromStatus
+			}
+
+			var detail string
+			if got.Detail != nil {
+				detail = *got.Detail
+			}
+
+			if got.EmailID != email.ID || from != w.from || got.ToStatus != w.to || got.Actor != w.actor || detail != w.detail {
+				t.Errorf("event %d = %+v, want %s -> %s by %s with %q", i, got, w.from, w.to, w.actor, w.detail)
+			}
+		}
+
+		if events[3].Provider != testSource.Provider {
+			t.Errorf("provider = %q, want %q", events[3].Provider, testSource.Provider)
+		}
+
+		events, err = repos.Events.FindByEmailID(ctx, uuid.New())
+		if err != nil || len(events) != 0 {
+			t.Errorf("FindByEmailID of unknown email = %v, %v, want none", events, err)
+		}
+	})
+
+	t.Run("UpdateMissing", func(t *testing.T) {
+		repos := setup(t)
+
+		if err := repos.Emails.Update(context.Background(), newEmail()); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("Update = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("UpdateConflict", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		email := newEmail()
+		email.CC = []string{"cc@example.com"}
+		email.Recipients = entity.NewRecipients(email.To, email.CC, nil)
+		email.Recipients[0].MarkAsAccepted(250, "OK")
+		email.Recipients[1].MarkAsAccepted(250, "OK")
+		mustTransition(t, email.MarkAsSent(testSource, "message 1"))
+		mustCreateEmail(t, repos, email)
+
+		// Two reports for different recipients read the email concurrently
+		first := mustFindEmail(t, repos, email.ID)
+		second := mustFindEmail(t, repos, email.ID)
+
+		mustTransition(t, first.RecordRecipientOutcome(testSource, email.To[0], entity.RecipientDelivered, 250, ""))
+		if err := repos.Emails.Update(ctx, first); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		mustTransition(t, second.RecordRecipientOutcome(testSource, "cc@example.com", entity.RecipientBounced, 550, ""))
+		if err := repos.Emails.Update(ctx, second); !errors.Is(err, apperrors.ErrConflict) {
+			t.Fatalf("Update of a stale copy = %v, want ErrConflict", err)
+		}
+
+		found := mustFindEmail(t, repos, email.ID)
+		if found.Recipients[0].Status != entity.RecipientDelivered || found.Recipients[1].Status != entity.RecipientAccepted {
+			t.Errorf("recipients = %s %s, want the first update only", found.Recipients[0].Status, found.Recipients[1].Status)
+		}
+
+		// Both the updated copy and a fresh read can be saved again
+		mustTransition(t, found.RecordRecipientOutcome(testSource, "cc@example.com", entity.RecipientBounced, 550, ""))
+		if err := repos.Emails.Update(ctx, found); err != nil {
+			t.Fatalf("Update of a fresh copy: %v", err)
+		}
+		if err := repos.Emails.Update(ctx, found); err != nil {
+			t.Errorf("repeated Update: %v", err)
+		}
+		if err := repos.Emails.Update(ctx, first); !errors.Is(err, apperrors.ErrConflict) {
+			t.Errorf("Update of the first copy = %v, want ErrConflict", err)
+		}
+	})
+
+	t.Run("SoftDelete", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		email := newEmail()
+		mustCreateEmail(t, repos, email)
+
+		if err := repos.Emails.SoftDelete(ctx, email.ID); err != nil {
+			t.Fatalf("SoftDelete: %v", err)
+		}
+		if _, err := repos.Emails.FindByID(ctx, email.ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByID after delete = %v, want ErrNotFound", err)
+		}
+		if err := repos.Emails.SoftDelete(ctx, email.ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("second SoftDelete = %v, want ErrNotFound", err)
+		}
+		if err := repos.Emails.SoftDelete(ctx, uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("SoftDelete of missing email = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		// Four emails a second apart: sent, failed, sent and deleted. The
+		// first two belong to a client.
+		base := time.Now().UTC().Truncate(time.Second)
+		emails := make([]*entity.Email, 4)
+		clientID := uuid.NewString()
+
+		for i := range emails {
+			email := newEmail()
+			email.CreatedAt = base.Add(time.Duration(i) * time.Second)
+			email.UpdatedAt = email.CreatedAt
+			if i < 2 {
+				email.ClientID = &clientID
+			}
+			email.Recipients = entity.NewRecipients(email.To, nil, nil)
+			mustCreateEmail(t, repos, email)
+			emails[i] = email
+		}
+
+		for _, i := range []int{0, 2, 3} {
+			mustTransition(t, emails[i].MarkAsSent(testSource, "message"))
+		}
+		mustTransition(t, emails[1].MarkAsFailed(testSource, "550 rejected"))
+
+		for _, email := range emails {
+			if err := repos.Emails.Update(ctx, email); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+		}
+		if err := repos.Emails.SoftDelete(ctx, emails[3].ID); err != nil {
+			t.Fatalf("SoftDelete: %v", err)
+		}
+
+		before := emails[2].CreatedAt
+
+		tests := []struct {
+			name   string
+			filter repository.EmailFilter
+			want   []*entity.Email
+		}{
+			{"All", repository.EmailFilter{}, []*entity.Email{emails[2], emails[1], emails[0]}},
+			{"Status", repository.EmailFilter{Statuses: []entity.EmailStatus{entity.StatusSent}}, []*entity.Email{emails[2], emails[0]}},
+			{"Statuses", repository.EmailFilter{Statuses: []entity.EmailStatus{entity.StatusFailed, entity.StatusDelivered}}, []*entity.Email{emails[1]}},
+			{"Before", repository.EmailFilter{Before: &before}, []*entity.Email{emails[1], emails[0]}},
+			{"Limit", repository.EmailFilter{Limit: 1}, []*entity.Email{emails[2]}},
+			{"Client", repository.EmailFilter{ClientID: &clientID}, []*entity.Email{emails[1], emails[0]}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				found, err := repos.Emails.List(ctx, tt.filter)
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+
+				if len(found) != len(tt.want) {
+					t.Fatalf("got %d emails, want %d", len(found), len(tt.want))
+				}
+
+				for i, want := range tt.want {
+					if found[i].ID != want.ID || found[i].Status != want.Status {
+						t.Errorf("email %d = %s %s, want %s %s", i, found[i].ID, found[i].Status, want.ID, want.Status)
+					}
+					if len(found[i].Recipients) != 1 {
+						t.Errorf("email %d has %d recipients, want 1", i, len(found[i].Recipients))
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("ListSameCreationTime", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		createdAt := time.Now().UTC().Truncate(time.Second)
+		for range 3 {
+			email := newEmail()
+			email.CreatedAt = createdAt
+			email.UpdatedAt = createdAt
+			mustCreateEmail(t, repos, email)
+		}
+
+		// Paging one email at a time visits each exactly once
+		seen := make(map[uuid.UUID]bool)
+		filter := repository.EmailFilter{Limit: 1}
+
+		for range 4 {
+			page, err := repos.Emails.List(ctx, filter)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+
+			last := page[len(page)-1]
+			if seen[last.ID] {
+				t.Fatalf("email %s listed twice", last.ID)
+			}
+			seen[last.ID] = true
+
+			filter.Before, filter.BeforeID = &last.CreatedAt, &last.ID
+		}
+
+		if len(seen) != 3 {
+			t.Errorf("paged through %d emails, want 3", len(seen))
+		}
+	})
+
+	t.Run("FindTombstoneMissing", func(t *testing.T) {
+		repos := setup(t)
+
+		if _, err := repos.Emails.FindTombstone(context.Background(), uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindTombstone = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("ListDue", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		source := entity.EventSource{Actor: entity.ActorWorker}
+
+		queue := func(until time.Time) *entity.Email {
+			t.Helper()
+
+			email := newEmail()
+			mustCreateEmail(t, repos, email)
+
+			if err := email.Defer(source, until, "throttled"); err != nil {
+				t.Fatalf("Defer: %v", err)
+			}
+			if err := repos.Emails.Update(ctx, email); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			return email
+		}
+
+		later := queue(now.Add(-time.Second))
+		later.TraceContext = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+		if err := repos.Emails.Update(ctx, later); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		earlier := queue(now.Add(-time.Minute))
+		queue(now.Add(time.Minute))
+		mustCreateEmail(t, repos, newEmail())
+
+		cancelled := queue(now.Add(-time.Hour))
+		if err := cancelled.Cancel(source, "no longer needed"); err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+		if err := repos.Emails.Update(ctx, cancelled); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		due, err := repos.Emails.ListDue(ctx, now, 10)
+		if err != nil {
+			t.Fatalf("ListDue: %v", err)
+		}
+		if len(due) != 2 || due[0] != earlier.ID || due[1] != later.ID {
+			t.Errorf("ListDue = %v, want %s then %s", due, earlier.ID, later.ID)
+		}
+
+		if due, _ := repos.Emails.ListDue(ctx, now, 1); len(due) != 1 || due[0] != earlier.ID {
+			t.Errorf("ListDue(limit 1) = %v, want %s", due, earlier.ID)
+		}
+
+		if count, err := repos.Emails.CountQueued(ctx); err != nil || count != 3 {
+			t.Errorf("CountQueued = %d, %v, want 3", count, err)
+		}
+
+		found, err := repos.Emails.FindByID(ctx, later.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.SendAfter == nil || !found.SendAfter.Equal(*later.SendAfter) {
+			t.Errorf("SendAfter = %v, want %v", found.SendAfter, later.SendAfter)
+		}
+		if !maps.Equal(found.TraceContext, later.TraceContext) {
+			t.Errorf("TraceContext = %v, want %v", found.TraceContext, later.TraceContext)
+		}
+	})
+}
+
+func testAttachments(t *testing.T, setup func(t *testing.T) Repositories) {
+	t.Run("CreateAndFind", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		att := newAttachment("report.csv")
+		mustCreateAttachment(t, repos, att)
+
+		byID, err := repos.Attachments.FindByID(ctx, att.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		byHash, err := repos.Attachments.FindByHash(ctx, att.Hash)
+		if err != nil {
+			t.Fatalf("FindByHash: %v", err)
+		}
+
+		for _, got := range []*entity.Attachment{byID, byHash} {
+			if got.ID != att.ID || got.Filename != att.Filename || got.OriginalName != att.OriginalName ||
+				got.Mimetype != att.Mimetype || got.Size != att.Size || got.Path != att.Path ||
+				!got.CreatedAt.Equal(att.CreatedAt) || got.PurgedAt != nil {
+				t.Errorf("found %+v, want %+v", got, att)
+			}
+		}
+	})
+
+	t.Run("DuplicateHash", func(t *testing.T) {
+		repos := setup(t)
+
+		att := newAttachment("a.txt")
+		mustCreateAttachment(t, repos, att)
+
+		duplicate := newAttachment("b.txt")
+		duplicate.Hash = att.Hash
+
+		if err := repos.Attachments.Create(context.Background(), duplicate); !errors.Is(err, apperrors.ErrAlreadyExists) {
+			t.Errorf("Create = %v, want ErrAlreadyExists", err)
+		}
+	})
+
+	t.Run("FindMissing", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		if _, err := repos.Attachments.FindByID(ctx, uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByID = %v, want ErrNotFound", err)
+		}
+		if _, err := repos.Attachments.FindByHash(ctx, "missing"); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByHash = %v, want ErrNotFound", err)
+		}
+
+		attachments, err := repos.Attachments.FindByEmailID(ctx, uuid.New())
+		if err != nil || len(attachments) != 0 {
+			t.Errorf("FindByEmailID = %v, %v, want none", attachments, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		unreferenced := newAttachment("a.txt")
+		mustCreateAttachment(t, repos, unreferenced)
+
+		referenced := newAttachment("b.txt")
+		mustCreateAttachment(t, repos, referenced)
+		email := newEmail()
+		email.Attachments = []entity.Attachment{*referenced}
+		mustCreateEmail(t, repos, email)
+
+		if err := repos.Attachments.Delete(ctx, unreferenced.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repos.Attachments.FindByID(ctx, unreferenced.ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByID after delete = %v, want ErrNotFound", err)
+		}
+		if err := repos.Attachments.Delete(ctx, unreferenced.ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("second Delete = %v, want ErrNotFound", err)
+		}
+		if err := repos.Attachments.Delete(ctx, referenced.ID); !errors.Is(err, apperrors.ErrAttachmentInUse) {
+			t.Errorf("Delete of referenced attachment = %v, want ErrAttachmentInUse", err)
+		}
+	})
+
+	t.Run("FindOrphans", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		cutoff := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+
+		older := newAttachment("older.txt")
+		older.CreatedAt = cutoff.Add(-2 * time.Hour)
+		old := newAttachment("old.txt")
+		old.CreatedAt = cutoff.Add(-time.Hour)
+		recent := newAttachment("recent.txt")
+		for _, att := range []*entity.Attachment{old, older, recent} {
+			mustCreateAttachment(t, repos, att)
+		}
+
+		referenced := newAttachment("referenced.txt")
+		referenced.CreatedAt = cutoff.Add(-time.Hour)
+		mustCreateAttachment(t, repos, referenced)
+		email := newEmail()
+		email.Attachments = []entity.Attachment{*referenced}
+		mustCreateEmail(t, repos, email)
+
+		orphans, err := repos.Attachments.FindOrphans(ctx, cutoff, 10)
+		if err != nil {
+			t.Fatalf("FindOrphans: %v", err)
+		}
+		if len(orphans) != 2 || orphans[0].ID != older.ID || orphans[1].ID != old.ID {
+			t.Errorf("FindOrphans = %+v, want the old unreferenced attachments oldest first", orphans)
+		}
+
+		orphans, err = repos.Attachments.FindOrphans(ctx, cutoff, 1)
+		if err != nil {
+			t.Fatalf("FindOrphans: %v", err)
+		}
+		if len(orphans) != 1 || orphans[0].ID != older.ID {
+			t.Errorf("FindOrphans with limit = %+v, want the oldest attachment", orphans)
+		}
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		cutoff := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+
+		att := newAttachment("reused.txt")
+		att.CreatedAt = cutoff.Add(-time.Hour)
+		mustCreateAttachment(t, repos, att)
+
+		reused := cutoff.Add(time.Minute)
+		if err := repos.Attachments.Touch(ctx, att.ID, reused); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		// An older timestamp never moves created_at back
+		if err := repos.Attachments.Touch(ctx, att.ID, att.CreatedAt); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+
+		found, err := repos.Attachments.FindByID(ctx, att.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if !found.CreatedAt.Equal(reused) {
+			t.Errorf("CreatedAt = %v, want %v", found.CreatedAt, reused)
+		}
+
+		orphans, err := repos.Attachments.FindOrphans(ctx, cutoff, 10)
+		if err != nil {
+			t.Fatalf("FindOrphans: %v", err)
+		}
+		if len(orphans) != 0 {
+			t.Errorf("FindOrphans = %+v, want the touched attachment skipped", orphans)
+		}
+
+		if err := repos.Attachments.Touch(ctx, uuid.New(), reused); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("Touch(unknown) = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("StoredSize", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		for _, name := range []string{"a.txt", "b.txt"} {
+			mustCreateAttachment(t, repos, newAttachment(name))
+		}
+
+		size, err := repos.Attachments.StoredSize(ctx)
+		if err != nil {
+			t.Fatalf("StoredSize: %v", err)
+		}
+		if size != 84 {
+			t.Errorf("StoredSize = %d, want 84", size)
+		}
+	})
+
+	t.Run("Owners", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		att := newAttachment("shared.txt")
+		mustCreateAttachment(t, repos, att)
+
+		for _, owner := range []struct{ clientID, name string }{
+			{"client-a", "first.txt"}, {"client-b", "second.txt"}, {"client-a", "renamed.txt"},
+		} {
+			if err := repos.Attachments.AddOwner(ctx, att.ID, owner.clientID, owner.name); err != nil {
+				t.Fatalf("AddOwner(%s): %v", owner.clientID, err)
+			}
+		}
+
+		owners, err := repos.Attachments.FindOwners(ctx, att.ID)
+		if err != nil {
+			t.Fatalf("FindOwners: %v", err)
+		}
+		slices.Sort(owners)
+		if !slices.Equal(owners, []string{"client-a", "client-b"}) {
+			t.Errorf("FindOwners = %v, want [client-a client-b]", owners)
+		}
+
+		// Each owner keeps the name of its latest upload
+		for clientID, want := range map[string]string{"client-a": "renamed.txt", "client-b": "second.txt"} {
+			if name, err := repos.Attachments.FindOwnerName(ctx, att.ID, clientID); err != nil || name != want {
+				t.Errorf("FindOwnerName(%s) = %q, %v, want %q", clientID, name, err, want)
+			}
+		}
+		if _, err := repos.Attachments.FindOwnerName(ctx, att.ID, "client-c"); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindOwnerName(client-c) = %v, want ErrNotFound", err)
+		}
+
+		if err := repos.Attachments.RemoveOwner(ctx, att.ID, "client-a"); err != nil {
+			t.Fatalf("RemoveOwner: %v", err)
+		}
+		owners, err = repos.Attachments.FindOwners(ctx, att.ID)
+		if err != nil {
+			t.Fatalf("FindOwners: %v", err)
+		}
+		if !slices.Equal(owners, []string{"client-b"}) {
+			t.Errorf("FindOwners after RemoveOwner = %v, want [client-b]", owners)
+		}
+
+		if err := repos.Attachments.AddOwner(ctx, uuid.New(), "client-a", "other.txt"); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("AddOwner(unknown) = %v, want ErrNotFound", err)
+		}
+
+		// Deleting the attachment removes its owners
+		if err := repos.Attachments.Delete(ctx, att.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		owners, err = repos.Attachments.FindOwners(ctx, att.ID)
+		if err != nil {
+			t.Fatalf("FindOwners: %v", err)
+		}
+		if len(owners) != 0 {
+			t.Errorf("FindOwners after Delete = %v, want none", owners)
+		}
+	})
+}
+
+func testSuppressions(t *testing.T, setup func(t *testing.T) Repositories) {
+	t.Run("UpsertAndFind", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		first := newSuppression("User@Example.com", entity.SuppressionHardBounce)
+		if err := repos.Suppressions.Upsert(ctx, first); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+
+		// Replacing the entry keeps the time the address was first suppressed
+		second := newSuppression("user@example.com", entity.SuppressionComplaint)
+		second.CreatedAt = first.CreatedAt.Add(time.Hour)
+		second.UpdatedAt = second.CreatedAt
+		if err := repos.Suppressions.Upsert(ctx, second); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+
+		got, err := repos.Suppressions.Find(ctx, "USER@example.com", "")
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+
+		if got.Address != "user@example.com" || got.Reason != entity.SuppressionComplaint {
+			t.Errorf("Find = %s %s, want user@example.com COMPLAINT", got.Address, got.Reason)
+		}
+		if !got.CreatedAt.Equal(first.CreatedAt) || !got.UpdatedAt.Equal(second.UpdatedAt) {
+			t.Errorf("timestamps = %v/%v, want %v/%v", got.CreatedAt, got.UpdatedAt, first.CreatedAt, second.UpdatedAt)
+		}
+	})
+
+	t.Run("FindMissing", func(t *testing.T) {
+		repos := setup(t)
+
+		if _, err := repos.Suppressions.Find(context.Background(), "missing@example.com", ""); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("Find = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("FindActive", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+		now := time.Now().UTC().Truncate(time.Microsecond)
+
+		forever := newSuppression("forever@example.com", entity.SuppressionComplaint)
+		expired := newSuppression("expired@example.com", entity.SuppressionHardBounce)
+		expiresAt := now.Add(-time.Minute)
+		expired.ExpiresAt = &expiresAt
+		later := newSuppression("later@example.com", entity.SuppressionHardBounce)
+		laterAt := now.Add(time.Hour)
+		later.ExpiresAt = &laterAt
+		// Category entries only cover emails of their category
+		newsletter := newSuppression("news@example.com", entity.SuppressionUnsubscribe)
+		newsletter.Category = "newsletter"
+		promo := newSuppression("promo@example.com", entity.SuppressionUnsubscribe)
+		promo.Category = "promo"
+
+		for _, s := range []*entity.Suppression{forever, expired, later, newsletter, promo} {
+			if err := repos.Suppressions.Upsert(ctx, s); err != nil {
+				t.Fatalf("Upsert: %v", err)
+			}
+		}
+
+		addresses := []string{"Later@example.com", "expired@example.com", "forever@example.com", "other@example.com", "news@example.com", "promo@example.com"}
+
+		got, err := repos.Suppressions.FindActive(ctx, addresses, "newsletter", now)
+		if err != nil {
+			t.Fatalf("FindActive: %v", err)
+		}
+
+		if want := []string{"forever@example.com", "later@example.com", "news@example.com/newsletter"}; !equalStrings(suppressionAddresses(got), want) {
+			t.Errorf("FindActive = %v, want %v", suppressionAddresses(got), want)
+		}
+
+		got, err = repos.Suppressions.FindActive(ctx, addresses, "", now)
+		if err != nil {
+			t.Fatalf("FindActive: %v", err)
+		}
+
+		if want := []string{"forever@example.com", "later@example.com"}; !equalStrings(suppressionAddresses(got), want) {
+			t.Errorf("FindActive without category = %v, want %v", suppressionAddresses(got), want)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		news := newSuppression("a@example.com", entity.SuppressionUnsubscribe)
+		news.Category = "news"
+
+		for _, s := range []*entity.Suppression{
+			newSuppression("c@example.com", entity.SuppressionManual),
+			news,
+			newSuppression("a@example.com", entity.SuppressionManual),
+			newSuppression("b@example.com", entity.SuppressionHardBounce),
+			newSuppression("d@example.com", entity.SuppressionManual),
+		} {
+			if err := repos.Suppressions.Upsert(ctx, s); err != nil {
+				t.Fatalf("Upsert: %v", err)
+			}
+		}
+
+		tests := []struct {
+			name   string
+			filter repository.SuppressionFilter
+			want   []string
+		}{
+			{"All", repository.SuppressionFilter{}, []string{"a@example.com", "a@example.com/news", "b@example.com", "c@example.com", "d@example.com"}},
+			{"Reason", repository.SuppressionFilter{Reason: entity.SuppressionManual}, []string{"a@example.com", "c@example.com", "d@example.com"}},
+			{"Page", repository.SuppressionFilter{After: "a@example.com", Limit: 2}, []string{"a@example.com/news", "b@example.com"}},
+			{"PageAfterCategory", repository.SuppressionFilter{After: "a@example.com", AfterCategory: "news", Limit: 2}, []string{"b@example.com", "c@example.com"}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := repos.Suppressions.List(ctx, tt.filter)
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+
+				if !equalStrings(suppressionAddresses(got), tt.want) {
+					t.Errorf("List = %v, want %v", suppressionAddresses(got), tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		if err := repos.Suppressions.Upsert(ctx, newSuppression("user@example.com", entity.SuppressionManual)); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+
+		if err := repos.Suppressions.Delete(ctx, "USER@example.com", ""); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if err := repos.Suppressions.Delete(ctx, "user@example.com", ""); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("second Delete = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+		failure := errors.New("failure")
+
+		err := repos.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := repos.Suppressions.Upsert(ctx, newSuppression("user@example.com", entity.SuppressionManual)); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("WithinTransaction = %v, want %v", err, failure)
+		}
+
+		if _, err := repos.Suppressions.Find(ctx, "user@example.com", ""); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("Find after rollback = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func testAPIKeys(t *testing.T, setup func(t *testing.T) Repositories) {
+	t.Run("CreateAndFind", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		key, secret := newAPIKey(t, "billing", entity.ScopeEmailsSend, entity.ScopeEmailsRead)
+		key.AllowedSenders = []string{"billing@example.com", "example.org"}
+		key.AllowedTemplates = []string{"invoice"}
+		key.SealedSigningKey = []byte("sealed signing key")
+		if err := repos.APIKeys.Create(ctx, key); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		found, err := repos.APIKeys.FindByHash(ctx, entity.HashAPIKey(secret))
+		if err != nil {
+			t.Fatalf("FindByHash: %v", err)
+		}
+		if found.ID != key.ID || found.Name != "billing" || found.Prefix != key.Prefix || !found.CreatedAt.Equal(key.CreatedAt) {
+			t.Errorf("FindByHash = %+v, want %+v", found, key)
+		}
+		if len(found.Scopes) != 2 || found.Scopes[0] != entity.ScopeEmailsSend || found.Scopes[1] != entity.ScopeEmailsRead {
+			t.Errorf("Scopes = %v, want %v", found.Scopes, key.Scopes)
+		}
+		if !equalStrings(found.AllowedSenders, key.AllowedSenders) || !equalStrings(found.AllowedTemplates, key.AllowedTemplates) {
+			t.Errorf("allowed senders %v and templates %v, want %v and %v",
+				found.AllowedSenders, found.AllowedTemplates, key.AllowedSenders, key.AllowedTemplates)
+		}
+		if string(found.SealedSigningKey) != string(key.SealedSigningKey) {
+			t.Errorf("SealedSigningKey = %q, want %q", found.SealedSigningKey, key.SealedSigningKey)
+		}
+		if found.LastUsedAt != nil || found.RevokedAt != nil {
+			t.Errorf("new key used at %v, revoked at %v", found.LastUsedAt, found.RevokedAt)
+		}
+
+		if _, err := repos.APIKeys.FindByID(ctx, key.ID); err != nil {
+			t.Errorf("FindByID: %v", err)
+		}
+		if _, err := repos.APIKeys.FindByHash(ctx, entity.HashAPIKey(secret+"x")); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByHash(unknown) = %v, want ErrNotFound", err)
+		}
+		if _, err := repos.APIKeys.FindByID(ctx, uuid.New()); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("FindByID(unknown) = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		first, _ := newAPIKey(t, "first", entity.ScopeAdmin)
+		second, _ := newAPIKey(t, "second", entity.ScopeEmailsSend)
+		second.CreatedAt = first.CreatedAt.Add(time.Second)
+
+		for _, key := range []*entity.APIKey{second, first} {
+			if err := repos.APIKeys.Create(ctx, key); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		keys, err := repos.APIKeys.List(ctx)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(keys) != 2 || keys[0].ID != first.ID || keys[1].ID != second.ID {
+			t.Errorf("List = %+v, want oldest first", keys)
+		}
+	})
+
+	t.Run("RevokeAndTouch", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		key, _ := newAPIKey(t, "billing", entity.ScopeEmailsSend)
+		if err := repos.APIKeys.Create(ctx, key); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		used := key.CreatedAt.Add(time.Minute)
+		if err := repos.APIKeys.Touch(ctx, key.ID, used); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		// An older use does not move the time back
+		if err := repos.APIKeys.Touch(ctx, key.ID, key.CreatedAt); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+
+		revoked := used.Add(time.Minute)
+		if err := repos.APIKeys.Revoke(ctx, key.ID, revoked); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if err := repos.APIKeys.Revoke(ctx, key.ID, revoked.Add(time.Hour)); err != nil {
+			t.Fatalf("second Revoke: %v", err)
+		}
+
+		found, err := repos.APIKeys.FindByID(ctx, key.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if found.LastUsedAt == nil || !found.LastUsedAt.Equal(used) {
+			t.Errorf("LastUsedAt = %v, want %v", found.LastUsedAt, used)
+		}
+		if !found.Revoked() || !found.RevokedAt.Equal(revoked) {
+			t.Errorf("RevokedAt = %v, want %v", found.RevokedAt, revoked)
+		}
+
+		if err := repos.APIKeys.Revoke(ctx, uuid.New(), revoked); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("Revoke(unknown) = %v, want ErrNotFound", err)
+		}
+		if err := repos.APIKeys.Touch(ctx, uuid.New(), used); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("Touch(unknown) = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func testNonces(t *testing.T, setup func(t *testing.T) Repositories) {
+	ctx := context.Background()
+	repos := setup(t)
+
+	keyID := uuid.New()
+	now := time.Now().UTC()
+
+	use := func(keyID uuid.UUID, nonce string, expiresAt time.Time, want bool) {
+		t.Helper()
+
+		fresh, err := repos.Nonces.Use(ctx, keyID, nonce, expiresAt)
+		if err != nil {
+			t.Fatalf("Use: %v", err)
+		}
+		if fresh != want {
+			t.Errorf("Use(%s) = %v, want %v", nonce, fresh, want)
+		}
+	}
+
+	use(keyID, "first", now.Add(time.Minute), true)
+	use(keyID, "first", now.Add(time.Minute), false)
+	// Nonces are per key
+	use(uuid.New(), "first", now.Add(time.Minute), true)
+
+	// Expired nonces can be used again, and are deleted
+	use(keyID, "expired", now.Add(-time.Minute), true)
+	use(keyID, "expired", now.Add(-time.Second), true)
+
+	deleted, err := repos.Nonces.DeleteExpired(ctx, now)
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteExpired = %d, want 1", deleted)
+	}
+
+	use(keyID, "first", now.Add(time.Minute), false)
+}
+
+func testQuotas(t *testing.T, setup func(t *testing.T) Repositories) {
+	ctx := context.Background()
+	repos := setup(t)
+
+	today, tomorrow := entity.QuotaDaily.Bounds(time.Now())
+
+	consume := func(clientID string, start time.Time, amount, limit int, want bool) {
+		t.Helper()
+
+		ok, err := repos.Quotas.Consume(ctx, clientID, entity.QuotaDaily, start, amount, limit)
+		if err != nil {
+			t.Fatalf("Consume: %v", err)
+		}
+		if ok != want {
+			t.Errorf("Consume(%s, %d of %d) = %v, want %v", clientID, amount, limit, ok, want)
+		}
+	}
+
+	consume("billing", today, 2, 3, true)
+	consume("billing", today, 2, 3, false)
+	consume("billing", today, 1, 3, true)
+	consume("billing", today, 1, 3, false)
+	consume("billing", today, 5, 0, true)
+
+	// Clients and periods are counted apart
+	consume("billing", today, 4, 3, false)
+	consume("support", today, 3, 3, true)
+	consume("billing", tomorrow, 1, 3, true)
+
+	usage := map[string]int{"billing": 8, "support": 3}
+	for clientID, want := range usage {
+		used, err := repos.Quotas.Usage(ctx, clientID, entity.QuotaDaily, today)
+		if err != nil {
+			t.Fatalf("Usage: %v", err)
+		}
+		if used != want {
+			t.Errorf("Usage(%s) = %d, want %d", clientID, used, want)
+		}
+	}
+
+	if used, err := repos.Quotas.Usage(ctx, "billing", entity.QuotaMonthly, today); err != nil || used != 0 {
+		t.Errorf("Usage(monthly) = %d, %v, want 0", used, err)
+	}
+}
+
+func testTransactor(t *testing.T, setup func(t *testing.T) Repositories) {
+	t.Run("Commit", func(t *testing.T) {
+		ctx := context.Background()
+		repos := setup(t)
+
+		email := newEmail()
+		err := repos.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			return repos.Emails.Create(ctx, email)
+		})
+		if err != nil {
+			t.Fatalf("WithinTransaction: %v", err)
+		}
+
+		mustFindEmail(t, repos, email.ID)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		repos := setup(t)
+
+		att := newAttachment("a.txt")
+		email := newEmail()
+		failure := errors.New("failure")
+		var compensated []string
+
+		compensate := func(name string) func(ctx context.Context) {
+			return func(ctx context.Context) {
+				if ctx.Err() != nil {
+					t.Errorf("compensation %s got a cancelled context", name)
+				}
+				compensated = append(compensated, name)
+			}
+		}
+
+		err := repos.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			repos.Transactor.OnRollback(ctx, compensate("outer"))
+
+			if err := repos.Attachments.Create(ctx, att); err != nil {
+				return err
+			}
+
+			// A nested transaction joins the outer one
+			err := repos.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+				repos.Transactor.OnRollback(ctx, compensate("inner"))
+				return repos.Emails.Create(ctx, email)
+			})
+			if err != nil {
+				return err
+			}
+
+			// The request went away after the writes
+			cancel()
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("WithinTransaction = %v, want %v", err, failure)
+		}
+
+		ctx = context.Background()
+		if _, err := repos.Emails.FindByID(ctx, email.ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("email after rollback: %v, want ErrNotFound", err)
+		}
+		if _, err := repos.Attachments.FindByID(ctx, att.ID); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("attachment after rollback: %v, want ErrNotFound", err)
+		}
+		if !equalStrings(compensated, []string{"inner", "outer"}) {
+			t.Errorf("compensations ran as %v, want [inner outer]", compensated)
+		}
+	})
+
+	t.Run("OnRollbackOutsideTransaction", func(t *testing.T) {
+		repos := setup(t)
+
+		repos.Transactor.OnRollback(context.Background(), func(ctx context.Context) { t.Error("compensation ran outside a transaction") })
+	})
+}
+
+var testSource = entity.EventSource{Actor: entity.ActorWorker, Provider: "test"}
+
+func mustTransition(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("transition: %v", err)
+	}
+}
+
+// newEmail returns an email with timestamps at the precision Postgres keeps.
+func newEmail() *entity.Email {
+	email := entity.NewEmail("sender@example.com", []string{"to@example.com"}, "Sender", "Subject", "Body")
+	email.CreatedAt = email.CreatedAt.Truncate(time.Microsecond)
+	email.UpdatedAt = email.CreatedAt
+	return email
+}
+
+func newSuppression(address string, reason entity.SuppressionReason) *entity.Suppression {
+	s := entity.NewSuppression(address, reason, entity.SuppressionSourceAPI)
+	s.CreatedAt = s.CreatedAt.Truncate(time.Microsecond)
+	s.UpdatedAt = s.CreatedAt
+	return s
+}
+
+// suppressionAddresses lists the entries as address/category, or address
+// alone for entries covering every category.
+func suppressionAddresses(suppressions []entity.Suppression) []string {
+	addresses := []string{}
+	for _, s := range suppressions {
+		if s.Category != "" {
+			addresses = append(addresses, s.Address+"/"+s.Category)
+		} else {
+			addresses = append(addresses, s.Address)
+		}
+	}
+	return addresses
+}
+
+func newAPIKey(t *testing.T, name string, scopes ...entity.Scope) (*entity.APIKey, string) {
+	t.Helper()
+
+	key, secret, err := entity.NewAPIKey(name, scopes)
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	key.CreatedAt = key.CreatedAt.Truncate(time.Microsecond)
+
+	return key, secret
+}
+
+func newAttachment(name string) *entity.Attachment {
+	id := uuid.New()
+	att := entity.NewAttachment(id.String()+".bin", name, "text/plain", 42, id.String(), "/files/"+id.String(), nil)
+	att.CreatedAt = att.CreatedAt.Truncate(time.Microsecond)
+	return att
+}
+
+func mustCreateEmail(t *testing.T, repos Repositories, email *entity.Email) {
+	t.Helper()
+
+	if err := repos.Emails.Create(context.Background(), email); err != nil {
+		t.Fatalf("Create email: %v", err)
+	}
+}
+
+func mustCreateAttachment(t *testing.T, repos Repositories, att *entity.Attachment) {
+	t.Helper()
+
+	if err := repos.Attachments.Create(context.Background(), att); err != nil {
+		t.Fatalf("Create attachment: %v", err)
+	}
+}
+
+func mustFindEmail(t *testing.T, repos Repositories, id uuid.UUID) *entity.Email {
+	t.Helper()
+
+	email, err := repos.Emails.FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+
+	return email
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/google/uuid"
+)
+
+type RetentionRepository interface {
+	// FindExpiredAttachments returns stored attachments whose every
+	// referencing email was created before cutoff.
+	FindExpiredAttachments(ctx context.Context, cutoff time.Time, limit int) ([]entity.Attachment, error)
+	// MarkAttachmentPurged records that the content is about to be deleted.
+	// It returns false if the attachment was referenced by a newer email
+	// in the meantime, including one whose creation is still in progress.
+	MarkAttachmentPurged(ctx context.Context, id uuid.UUID, cutoff time.Time) (bool, error)
+	// RedactEmails clears the bodies of emails created before cutoff.
+	RedactEmails(ctx context.Context, cutoff time.Time, limit int) ([]uuid.UUID, error)
+	// DeleteEmails removes emails created before cutoff, leaving tombstones.
+	DeleteEmails(ctx context.Context, cutoff time.Time, limit int) ([]uuid.UUID, error)
+}
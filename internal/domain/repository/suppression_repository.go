@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+)
+
+type SuppressionRepository interface {
+	// Upsert adds the entry or replaces the one of the same address and
+	// category, keeping the time it was first suppressed.
+	Upsert(ctx context.Context, suppression *entity.Suppression) error
+	// Find returns the entry of an address for a category, expired or not.
+	Find(ctx context.Context, address, category string) (*entity.Suppression, error)
+	// FindActive returns the entries among addresses that cover emails of
+	// category and have not expired at now.
+	FindActive(ctx context.Context, addresses []string, category string, now time.Time) ([]entity.Suppression, error)
+	// List returns the entries matching the filter ordered by address and
+	// category.
+	List(ctx context.Context, filter SuppressionFilter) ([]entity.Suppression, error)
+	Delete(ctx context.Context, address, category string) error
+}
+
+// SuppressionFilter selects entries to list. Zero fields do not filter.
+type SuppressionFilter struct {
+	Reason entity.SuppressionReason
+	// After and AfterCategory page through the list: only entries sorting
+	// later are returned.
+	After         string
+	AfterCategory string
+	Limit         int
+}
@@ -0,0 +1,18 @@
+package repository
+
+import "context"
+
+// Transactor groups repository calls into a single database transaction.
+type Transactor interface {
+	// WithinTransaction runs fn in a transaction carried by the context
+	// passed to it; repositories called with that context take part in it.
+	// The transaction commits if fn returns nil and rolls back otherwise.
+	// Nested calls join the outer transaction.
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// OnRollback registers a compensation, such as deleting a stored file,
+	// to run if the transaction carried by ctx rolls back. Outside of a
+	// transaction it does nothing. fn gets a context that is not cancelled
+	// with the caller's, since a cancelled request is a common cause of the
+	// rollback.
+	OnRollback(ctx context.Context, fn func(ctx context.Context))
+}
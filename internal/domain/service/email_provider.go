@@ -10,8 +10,32 @@ type SendEmailResult struct {
 	Success   bool
 	MessageID string
 	Error     error
+	// Recipients holds the relay's answer for each address it was offered.
+	// Success is true when the message was accepted for at least one.
+	Recipients []RecipientResult
+}
+
+// RecipientResult is the relay's reply to RCPT TO for an address. The
+// address received the message only if it was accepted and the send
+// succeeded, or if Sent is set.
+type RecipientResult struct {
+	Address  string
+	Accepted bool
+	// Sent is set once the relay took the message for the address. Copies
+	// sent per recipient are, even if the send fails at a later one.
+	Sent     bool
+	Code     int
+	Response string
 }
 
 type EmailProvider interface {
+	// Name identifies the provider in the email timeline.
+	Name() string
 	Send(ctx context.Context, email *entity.Email) (*SendEmailResult, error)
 }
+
+// UnsubscribeLinks builds the one-click unsubscribe URL providers put in
+// the List-Unsubscribe header of a copy sent to address.
+type UnsubscribeLinks interface {
+	URL(email *entity.Email, address string) string
+}
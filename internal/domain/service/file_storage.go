@@ -0,0 +1,14 @@
+package service
+
+import (
+	"context"
+	"io"
+)
+
+// FileStorage stores attachment content. Path returned by Save is an opaque
+// backend-specific locator that must be passed back to Open and Delete.
+type FileStorage interface {
+	Save(ctx context.Context, name string, r io.Reader) (path string, size int64, err error)
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	Delete(ctx context.Context, path string) error
+}
@@ -0,0 +1,18 @@
+package service
+
+import "context"
+
+// InboundMessage is a raw message read from a mailbox. ID is an opaque
+// mailbox-specific locator passed back to MarkProcessed.
+type InboundMessage struct {
+	ID   string
+	Data []byte
+}
+
+// Mailbox is a mailbox the service reads, such as the one bounces are
+// returned to. Messages stay unread until marked as processed, so a message
+// that failed to process is read again on the next run.
+type Mailbox interface {
+	Unread(ctx context.Context, limit int) ([]InboundMessage, error)
+	MarkProcessed(ctx context.Context, ids ...string) error
+}
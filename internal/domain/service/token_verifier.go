@@ -0,0 +1,13 @@
+package service
+
+import (
+	"context"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+)
+
+// TokenVerifier authenticates bearer tokens issued to client services,
+// returning the client a token was issued to.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*entity.Client, error)
+}
@@ -3,43 +3,96 @@ package email
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/an3wers/notification-serv/internal/domain/entity"
 	"github.com/an3wers/notification-serv/internal/domain/service"
 	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/tracing"
+	"github.com/an3wers/notification-serv/internal/pkg/verp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/gomail.v2"
 )
 
 type smtpProvider struct {
-	cfg    config.SMTPConfig
-	dialer *gomail.Dialer
+	cfg         config.SMTPConfig
+	tlsConfig   *tls.Config
+	storage     service.FileStorage
+	returnPath  *verp.Encoder
+	unsubscribe service.UnsubscribeLinks
+	metrics     *metrics.Metrics
 }
 
-func NewSMTPProvider(cfg config.SMTPConfig) service.EmailProvider {
-	dialer := gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)
+// NewSMTPProvider returns a provider sending through the configured relay.
+// A returnPath encoder enables VERP; it may be nil. unsubscribe builds the
+// links of emails asking for List-Unsubscribe headers; without it they are
+// sent without. Every send is timed in metrics.
+func NewSMTPProvider(
+	cfg config.SMTPConfig,
+	storage service.FileStorage,
+	returnPath *verp.Encoder,
+	unsubscribe service.UnsubscribeLinks,
+	metrics *metrics.Metrics,
+) service.EmailProvider {
+	var tlsConfig *tls.Config
 
 	if cfg.TLS {
-		dialer.TLSConfig = &tls.Config{
+		tlsConfig = &tls.Config{
 			InsecureSkipVerify: false,
 			ServerName:         cfg.Host,
 			MinVersion:         tls.VersionTLS12,
 		}
 
 	} else {
-		dialer.TLSConfig = &tls.Config{
+		tlsConfig = &tls.Config{
 			InsecureSkipVerify: true,
 		}
 	}
 
 	return &smtpProvider{
-		cfg:    cfg,
-		dialer: dialer,
+		cfg:         cfg,
+		tlsConfig:   tlsConfig,
+		storage:     storage,
+		returnPath:  returnPath,
+		unsubscribe: unsubscribe,
+		metrics:     metrics,
 	}
 }
 
+func (p *smtpProvider) Name() string {
+	return "smtp"
+}
+
 func (p *smtpProvider) Send(ctx context.Context, email *entity.Email) (*service.SendEmailResult, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "smtp.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(p.cfg.Host), semconv.ServerPort(p.cfg.Port)),
+	)
+
+	start := time.Now()
+	result, err := p.send(ctx, email)
+	p.metrics.ObserveSend(p.Name(), err == nil && result.Success, time.Since(start))
+
+	if err == nil && !result.Success {
+		tracing.End(span, result.Error)
+	} else {
+		tracing.End(span, err)
+	}
+
+	return result, err
+}
+
+func (p *smtpProvider) send(ctx context.Context, email *entity.Email) (*service.SendEmailResult, error) {
 	m := gomail.NewMessage()
 
 	m.SetAddressHeader("From", email.From, email.DisplayName)
@@ -54,48 +107,341 @@ func (p *smtpProvider) Send(ctx context.Context, email *entity.Email) (*service.
 	}
 
 	m.SetHeader("Subject", email.Subject)
+	m.SetHeader("Message-ID", email.MessageID())
 	m.SetBody("text/plain", email.Body)
 
 	if email.HTML != nil {
 		m.AddAlternative("text/html", *email.HTML)
 	}
 
-	// Attach files
+	// Attach files, streaming content from storage
 	for _, att := range email.Attachments {
-		m.Attach(att.Path, gomail.Rename(att.OriginalName)) // att.Path - ./uploads/...
+		m.Attach(att.OriginalName, gomail.SetCopyFunc(p.copyAttachment(ctx, att.Path)))
+	}
+
+	// The connection deadlines bound the transaction, so the replies
+	// gathered so far are kept whatever stops it
+	recipients, err := p.deliver(ctx, email, m)
+	if err != nil {
+		return &service.SendEmailResult{
+			Success:    false,
+			Error:      err,
+			Recipients: recipients,
+		}, nil
+	}
+
+	return &service.SendEmailResult{
+		Success:    true,
+		MessageID:  email.MessageID(),
+		Recipients: recipients,
+	}, nil
+}
+
+// deliver runs the SMTP transaction, offering every recipient separately so
+// that a rejected address does not fail the others. The message is sent
+// if at least one recipient was accepted, or only if all were when
+// RequireAllRecipients is set. Recipients that got the message on an
+// earlier attempt are not offered again.
+func (p *smtpProvider) deliver(ctx context.Context, email *entity.Email, m *gomail.Message) ([]service.RecipientResult, error) {
+	c, conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	// Cancelling ctx fails the next read or write on the connection
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := p.authenticate(ctx, c); err != nil {
+		return nil, err
 	}
 
-	// Create a channel for timeout
-	done := make(chan error, 1)
+	if p.returnPath != nil || p.listUnsubscribe(email) {
+		return p.deliverEach(ctx, c, conn, email, m)
+	}
+
+	if err := c.Mail(email.From); err != nil {
+		return nil, fmt.Errorf("sender rejected: %w", err)
+	}
 
-	go func() {
-		done <- p.dialer.DialAndSend(m)
-	}()
+	var results []service.RecipientResult
+	var rejected []string
 
-	// Wait with timeout
-	timeout := time.Duration(p.cfg.Timeout) * time.Second
+	for _, recipient := range entity.NewRecipients(email.To, email.CC, email.BCC) {
+		if !pending(email, recipient.Address) {
+			continue
+		}
 
-	select {
-	case err := <-done:
+		result, err := offer(c, recipient.Address)
 		if err != nil {
-			return &service.SendEmailResult{
-				Success: false,
-				Error:   err,
-			}, nil
+			return results, err
 		}
-		return &service.SendEmailResult{
-			Success:   true,
-			MessageID: email.ID.String(),
-		}, nil
-	case <-time.After(timeout):
-		return &service.SendEmailResult{
-			Success: false,
-			Error:   fmt.Errorf("smtp timeout after %v", timeout),
-		}, nil
-	case <-ctx.Done():
-		return &service.SendEmailResult{
-			Success: false,
-			Error:   ctx.Err(),
-		}, nil
+
+		results = append(results, result)
+
+		if !result.Accepted {
+			rejected = append(rejected, describe(result))
+		}
+	}
+
+	if len(rejected) == len(results) || (len(rejected) > 0 && p.cfg.RequireAllRecipients) {
+		c.Reset()
+		return results, fmt.Errorf("recipients rejected: %s", strings.Join(rejected, "; "))
+	}
+
+	if err := data(ctx, c, m); err != nil {
+		return results, err
+	}
+
+	for i := range results {
+		results[i].Sent = results[i].Accepted
+	}
+
+	c.Quit()
+
+	return results, nil
+}
+
+// deliverEach sends the message once per recipient, for copies that differ
+// by recipient: the VERP return path and the List-Unsubscribe link identify
+// it. A recipient whose copy is refused counts as rejected.
+// RequireAllRecipients does not apply. Every copy has the full timeout, and
+// when the connection fails the results still tell which copies were sent.
+func (p *smtpProvider) deliverEach(ctx context.Context, c *smtp.Client, conn net.Conn, email *entity.Email, m *gomail.Message) ([]service.RecipientResult, error) {
+	var results []service.RecipientResult
+	var rejected []string
+
+	for position, recipient := range entity.NewRecipients(email.To, email.CC, email.BCC) {
+		if !pending(email, recipient.Address) {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		conn.SetDeadline(time.Now().Add(p.timeout()))
+
+		sender := email.From
+		if p.returnPath != nil {
+			sender = p.returnPath.Address(email.ID, position)
+		}
+
+		if err := c.Mail(sender); err != nil {
+			return results, fmt.Errorf("sender rejected: %w", err)
+		}
+
+		// RFC 8058 one-click unsubscribe, the relay is expected to sign the
+		// headers with DKIM
+		if p.listUnsubscribe(email) {
+			m.SetHeader("List-Unsubscribe", "<"+p.unsubscribe.URL(email, recipient.Address)+">")
+			m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+		}
+
+		result, err := offer(c, recipient.Address)
+		if err != nil {
+			return results, err
+		}
+
+		if result.Accepted {
+			err := data(ctx, c, m)
+
+			var smtpErr *textproto.Error
+			switch {
+			case errors.As(err, &smtpErr):
+				result.Accepted = false
+				result.Code = smtpErr.Code
+				result.Response = smtpErr.Msg
+
+				// A refused DATA leaves the transaction open
+				if err := c.Reset(); err != nil {
+					return append(results, result), err
+				}
+			case err != nil:
+				return results, err
+			default:
+				result.Sent = true
+			}
+		} else if err := c.Reset(); err != nil {
+			return append(results, result), err
+		}
+
+		results = append(results, result)
+
+		if !result.Accepted {
+			rejected = append(rejected, describe(result))
+		}
+	}
+
+	if len(rejected) == len(results) {
+		return results, fmt.Errorf("recipients rejected: %s", strings.Join(rejected, "; "))
+	}
+
+	c.Quit()
+
+	return results, nil
+}
+
+func (p *smtpProvider) listUnsubscribe(email *entity.Email) bool {
+	return email.ListUnsubscribe && p.unsubscribe != nil
+}
+
+// pending reports whether the address is still to be offered: it is not on
+// the suppression list and was not offered by an earlier attempt.
+func pending(email *entity.Email, address string) bool {
+	recipient := email.Recipient(address)
+	return recipient == nil || recipient.Status == entity.RecipientPending
+}
+
+// offer sends RCPT TO for one recipient. Only a failure of the connection is
+// returned as an error, a rejection is part of the result.
+func offer(c *smtp.Client, address string) (service.RecipientResult, error) {
+	code, msg, err := rcpt(c, address)
+
+	var smtpErr *textproto.Error
+	if err != nil && !errors.As(err, &smtpErr) {
+		return service.RecipientResult{}, fmt.Errorf("failed to add recipient %s: %w", address, err)
+	}
+
+	return service.RecipientResult{
+		Address:  address,
+		Accepted: err == nil,
+		Code:     code,
+		Response: msg,
+	}, nil
+}
+
+// data transfers the message. A refusal by the relay is returned as a
+// wrapped *textproto.Error. When writing fails the message is left
+// unterminated, so the relay drops it once the connection is closed
+// rather than delivering part of it.
+func data(ctx context.Context, c *smtp.Client, m *gomail.Message) (err error) {
+	_, span := tracing.Tracer().Start(ctx, "smtp.data")
+	defer func() { tracing.End(span, err) }()
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("message refused: %w", err)
+	}
+
+	if _, err := m.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+
+	return nil
+}
+
+func describe(result service.RecipientResult) string {
+	return fmt.Sprintf("%s: %d %s", result.Address, result.Code, result.Response)
+}
+
+// dial connects to the relay and upgrades the connection to TLS. The
+// underlying connection is returned to move its deadline.
+func (p *smtpProvider) dial(ctx context.Context) (_ *smtp.Client, _ net.Conn, err error) {
+	_, span := tracing.Tracer().Start(ctx, "smtp.dial")
+	defer func() { tracing.End(span, err) }()
+
+	addr := net.JoinHostPort(p.cfg.Host, strconv.Itoa(p.cfg.Port))
+
+	raw, err := net.DialTimeout("tcp", addr, p.timeout())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Bounds the transaction so a stalled relay cannot leak it
+	raw.SetDeadline(time.Now().Add(p.timeout()))
+
+	conn := raw
+
+	// Port 465 expects TLS from the start, others upgrade with STARTTLS
+	implicitTLS := p.cfg.Port == 465
+	if implicitTLS {
+		conn = tls.Client(conn, p.tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, p.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	if !implicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(p.tlsConfig); err != nil {
+				c.Close()
+				return nil, nil, err
+			}
+		}
+	}
+
+	return c, raw, nil
+}
+
+// authenticate logs in when credentials are configured and the relay
+// offers AUTH.
+func (p *smtpProvider) authenticate(ctx context.Context, c *smtp.Client) (err error) {
+	if p.cfg.Username == "" {
+		return nil
+	}
+
+	ok, mechanisms := c.Extension("AUTH")
+	if !ok {
+		return nil
+	}
+
+	_, span := tracing.Tracer().Start(ctx, "smtp.auth")
+	defer func() { tracing.End(span, err) }()
+
+	return c.Auth(p.auth(mechanisms))
+}
+
+// auth picks the mechanism the same way gomail does.
+func (p *smtpProvider) auth(mechanisms string) smtp.Auth {
+	switch {
+	case strings.Contains(mechanisms, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(p.cfg.Username, p.cfg.Password)
+	case strings.Contains(mechanisms, "LOGIN") && !strings.Contains(mechanisms, "PLAIN"):
+		return &loginAuth{username: p.cfg.Username, password: p.cfg.Password, host: p.cfg.Host}
+	default:
+		return smtp.PlainAuth("", p.cfg.Username, p.cfg.Password, p.cfg.Host)
+	}
+}
+
+func (p *smtpProvider) timeout() time.Duration {
+	return time.Duration(p.cfg.Timeout) * time.Second
+}
+
+// rcpt sends RCPT TO and returns the reply, which smtp.Client.Rcpt discards.
+// A rejection is returned as a *textproto.Error.
+func rcpt(c *smtp.Client, address string) (int, string, error) {
+	if strings.ContainsAny(address, "\r\n") {
+		return 0, "", errors.New("smtp: address contains CR or LF")
+	}
+
+	id, err := c.Text.Cmd("RCPT TO:<%s>", address)
+	if err != nil {
+		return 0, "", err
+	}
+
+	c.Text.StartResponse(id)
+	defer c.Text.EndResponse(id)
+
+	return c.Text.ReadResponse(25)
+}
+
+func (p *smtpProvider) copyAttachment(ctx context.Context, path string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		file, err := p.storage.Open(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(w, file)
+		return err
 	}
 }
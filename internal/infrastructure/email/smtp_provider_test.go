@@ -0,0 +1,489 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/infrastructure/email/smtptest"
+	"github.com/an3wers/notification-serv/internal/infrastructure/storage"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/verp"
+)
+
+func newTestProvider(t *testing.T, server *smtptest.Server, username, password string) (service.EmailProvider, service.FileStorage) {
+	return newTestProviderWithConfig(t, server, config.SMTPConfig{Username: username, Password: password})
+}
+
+func newTestProviderWithConfig(t *testing.T, server *smtptest.Server, cfg config.SMTPConfig) (service.EmailProvider, service.FileStorage) {
+	t.Helper()
+
+	fileStorage := storage.NewLocalStorage(config.StorageConfig{LocalPath: t.TempDir()})
+
+	cfg.Host = server.Host
+	cfg.Port = server.Port
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5
+	}
+
+	var returnPath *verp.Encoder
+
+	if cfg.VERPAddress != "" {
+		var err error
+		if returnPath, err = verp.New(cfg.VERPAddress, cfg.VERPSigningKey); err != nil {
+			t.Fatalf("verp.New: %v", err)
+		}
+	}
+
+	provider := NewSMTPProvider(cfg, fileStorage, returnPath, testUnsubscribeLinks{}, metrics.New())
+
+	return provider, fileStorage
+}
+
+// testUnsubscribeLinks builds links naming the recipient in clear.
+type testUnsubscribeLinks struct{}
+
+func (testUnsubscribeLinks) URL(email *entity.Email, address string) string {
+	return "https://notifications.test/unsubscribe?email=" + email.ID.String() + "&address=" + address
+}
+
+func newTestEmail() *entity.Email {
+	email := entity.NewEmail("sender@example.com", []string{"to@example.com"}, "Sender", "Greetings", "Plain body")
+	email.CC = []string{"cc@example.com"}
+	email.BCC = []string{"bcc@example.com"}
+	return email
+}
+
+func TestSMTPProvider_Send(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.Options{
+		STARTTLS:       true,
+		AuthMechanisms: []string{"PLAIN"},
+		Username:       "user",
+		Password:       "secret",
+	})
+	provider, fileStorage := newTestProvider(t, server, "user", "secret")
+
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("attachment content "), 100)
+
+	path, size, err := fileStorage.Save(ctx, "stored.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	email := newTestEmail()
+	html := "<p>HTML body</p>"
+	email.HTML = &html
+	email.Attachments = []entity.Attachment{
+		*entity.NewAttachment("stored.txt", "report.txt", "text/plain", size, "hash", path, nil),
+	}
+
+	result, err := provider.Send(ctx, email)
+	if err != nil || !result.Success {
+		t.Fatalf("Send = %+v, %v", result, err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+
+	if !msg.TLS {
+		t.Error("message was sent without STARTTLS")
+	}
+	if msg.Auth == nil || msg.Auth.Mechanism != "PLAIN" || msg.Auth.Username != "user" || msg.Auth.Password != "secret" {
+		t.Errorf("auth = %+v, want PLAIN user/secret", msg.Auth)
+	}
+
+	// Envelope
+	if msg.From != "sender@example.com" {
+		t.Errorf("MAIL FROM = %q", msg.From)
+	}
+	if want := []string{"to@example.com", "cc@example.com", "bcc@example.com"}; strings.Join(msg.To, ",") != strings.Join(want, ",") {
+		t.Errorf("RCPT TO = %v, want %v", msg.To, want)
+	}
+
+	// Headers
+	parsed, err := msg.Parse()
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	headers := map[string]string{
+		"From":       `"Sender" <sender@example.com>`,
+		"To":         "to@example.com",
+		"Cc":         "cc@example.com",
+		"Subject":    "Greetings",
+		"Message-Id": email.MessageID(),
+	}
+	for name, want := range headers {
+		if got := parsed.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := parsed.Header.Get("Bcc"); got != "" {
+		t.Errorf("Bcc header leaked: %q", got)
+	}
+
+	// MIME structure
+	parts, containers, err := msg.Parts()
+	if err != nil {
+		t.Fatalf("Parts: %v", err)
+	}
+
+	if strings.Join(containers, ",") != "multipart/mixed,multipart/alternative" {
+		t.Errorf("containers = %v, want mixed with an alternative", containers)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3", len(parts))
+	}
+	if parts[0].MediaType != "text/plain" || string(parts[0].Body) != "Plain body" {
+		t.Errorf("text part = %s %q", parts[0].MediaType, parts[0].Body)
+	}
+	if parts[1].MediaType != "text/html" || string(parts[1].Body) != html {
+		t.Errorf("html part = %s %q", parts[1].MediaType, parts[1].Body)
+	}
+	if parts[2].Filename != "report.txt" || !bytes.Equal(parts[2].Body, content) {
+		t.Errorf("attachment = %q with %d bytes, want report.txt with %d bytes", parts[2].Filename, len(parts[2].Body), len(content))
+	}
+}
+
+func TestSMTPProvider_AuthLogin(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.Options{
+		STARTTLS:       true,
+		AuthMechanisms: []string{"LOGIN"},
+		Username:       "user",
+		Password:       "secret",
+	})
+	provider, _ := newTestProvider(t, server, "user", "secret")
+
+	result, err := provider.Send(context.Background(), newTestEmail())
+	if err != nil || !result.Success {
+		t.Fatalf("Send = %+v, %v", result, err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].Auth == nil || messages[0].Auth.Mechanism != "LOGIN" {
+		t.Fatalf("messages = %+v, want one sent with AUTH LOGIN", messages)
+	}
+}
+
+func TestSMTPProvider_Rejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		code     int
+		text     string
+		password string
+	}{
+		{name: "wrong password", password: "wrong", code: 535},
+		{name: "sender rejected", command: "MAIL", code: 550, text: "sender blocked"},
+		{name: "data refused", command: "DATA", code: 554, text: "transaction failed"},
+		{name: "message rejected", command: smtptest.EOM, code: 552, text: "message too large"},
+		{name: "message deferred", command: smtptest.EOM, code: 451, text: "local error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := smtptest.NewServer(t, smtptest.Options{
+				AuthMechanisms: []string{"PLAIN"},
+				Username:       "user",
+				Password:       "secret",
+			})
+			if tt.command != "" {
+				server.Reply(tt.command, tt.code, tt.text)
+			}
+
+			password := tt.password
+			if password == "" {
+				password = "secret"
+			}
+			provider, _ := newTestProvider(t, server, "user", password)
+
+			result, err := provider.Send(context.Background(), newTestEmail())
+			if err != nil {
+				t.Fatalf("Send returned error %v, want a failed result", err)
+			}
+
+			if result.Success || result.Error == nil {
+				t.Fatalf("Send = %+v, want failure", result)
+			}
+			if !strings.Contains(result.Error.Error(), strconv.Itoa(tt.code)) {
+				t.Errorf("error = %q, want SMTP code %d", result.Error, tt.code)
+			}
+
+			if n := len(server.Messages()); n != 0 {
+				t.Errorf("server accepted %d messages, want 0", n)
+			}
+		})
+	}
+}
+
+func TestSMTPProvider_Recipients(t *testing.T) {
+	tests := []struct {
+		name        string
+		requireAll  bool
+		replies     []int
+		wantSuccess bool
+		wantSent    []string
+	}{
+		{
+			name:        "all accepted",
+			wantSuccess: true,
+			wantSent:    []string{"to@example.com", "cc@example.com", "bcc@example.com"},
+		},
+		{
+			name:        "partial",
+			replies:     []int{550, 250, 450},
+			wantSuccess: true,
+			wantSent:    []string{"cc@example.com"},
+		},
+		{
+			name:       "partial with all required",
+			requireAll: true,
+			replies:    []int{250, 550, 250},
+		},
+		{
+			name:    "all rejected",
+			replies: []int{550, 551, 450},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := smtptest.NewServer(t, smtptest.Options{})
+			for _, code := range tt.replies {
+				server.Reply("RCPT", code, "reply "+strconv.Itoa(code))
+			}
+
+			provider, _ := newTestProviderWithConfig(t, server, config.SMTPConfig{RequireAllRecipients: tt.requireAll})
+
+			result, err := provider.Send(context.Background(), newTestEmail())
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			if result.Success != tt.wantSuccess {
+				t.Fatalf("Send = %+v, want success %v", result, tt.wantSuccess)
+			}
+
+			if len(result.Recipients) != 3 {
+				t.Fatalf("got %d recipient results, want 3", len(result.Recipients))
+			}
+
+			for i, r := range result.Recipients {
+				wantCode := 250
+				if len(tt.replies) > 0 {
+					wantCode = tt.replies[i]
+				}
+
+				if r.Code != wantCode || r.Accepted != (wantCode == 250) {
+					t.Errorf("recipient %s = %+v, want code %d", r.Address, r, wantCode)
+				}
+				if wantCode != 250 && r.Response != "reply "+strconv.Itoa(wantCode) {
+					t.Errorf("recipient %s response = %q", r.Address, r.Response)
+				}
+			}
+
+			messages := server.Messages()
+			if len(tt.wantSent) == 0 {
+				if len(messages) != 0 {
+					t.Errorf("server accepted %d messages, want 0", len(messages))
+				}
+				return
+			}
+
+			if len(messages) != 1 || strings.Join(messages[0].To, ",") != strings.Join(tt.wantSent, ",") {
+				t.Errorf("messages = %+v, want one sent to %v", messages, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestSMTPProvider_VERP(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.Options{})
+	server.Reply("RCPT", 250, "2.1.5 OK")
+	server.Reply("RCPT", 550, "5.1.1 user unknown")
+	server.Reply("RCPT", 250, "2.1.5 OK")
+	server.Reply(smtptest.EOM, 250, "2.0.0 queued")
+	server.Reply(smtptest.EOM, 552, "5.3.4 message too big")
+
+	provider, _ := newTestProviderWithConfig(t, server, config.SMTPConfig{
+		VERPAddress:    "bounces@example.com",
+		VERPSigningKey: "verp-key",
+	})
+
+	email := newTestEmail()
+
+	result, err := provider.Send(context.Background(), email)
+	if err != nil || !result.Success {
+		t.Fatalf("Send = %+v, %v", result, err)
+	}
+
+	want := []struct {
+		accepted bool
+		code     int
+	}{{true, 250}, {false, 550}, {false, 552}}
+
+	for i, r := range result.Recipients {
+		if r.Accepted != want[i].accepted || r.Code != want[i].code {
+			t.Errorf("recipient %s = %+v, want accepted %v with %d", r.Address, r, want[i].accepted, want[i].code)
+		}
+	}
+
+	// Only the first recipient got a copy, sent with its own return path
+	messages := server.Messages()
+	if len(messages) != 1 || strings.Join(messages[0].To, ",") != "to@example.com" {
+		t.Fatalf("messages = %+v, want one for to@example.com", messages)
+	}
+
+	decoder, _ := verp.New("bounces@example.com", "verp-key")
+
+	emailID, position, err := decoder.Decode(messages[0].From)
+	if err != nil || emailID != email.ID || position != 0 {
+		t.Errorf("MAIL FROM %q decodes to %s, %d, %v", messages[0].From, emailID, position, err)
+	}
+}
+
+func TestSMTPProvider_VERPFailures(t *testing.T) {
+	verpConfig := config.SMTPConfig{VERPAddress: "bounces@example.com", VERPSigningKey: "verp-key"}
+
+	sentTo := func(messages []smtptest.Message) []string {
+		var to []string
+		for _, message := range messages {
+			to = append(to, message.To...)
+		}
+		return to
+	}
+
+	t.Run("data refused", func(t *testing.T) {
+		server := smtptest.NewServer(t, smtptest.Options{})
+		server.Reply("DATA", 554, "5.7.1 refused")
+
+		provider, _ := newTestProviderWithConfig(t, server, verpConfig)
+
+		result, err := provider.Send(context.Background(), newTestEmail())
+		if err != nil || !result.Success {
+			t.Fatalf("Send = %+v, %v", result, err)
+		}
+
+		// The transaction is reset, so the next copies go out
+		if r := result.Recipients[0]; r.Accepted || r.Sent || r.Code != 554 {
+			t.Errorf("refused recipient = %+v", r)
+		}
+		if got := sentTo(server.Messages()); strings.Join(got, ",") != "cc@example.com,bcc@example.com" {
+			t.Errorf("copies went to %v, want cc@example.com and bcc@example.com", got)
+		}
+	})
+
+	t.Run("connection lost", func(t *testing.T) {
+		server := smtptest.NewServer(t, smtptest.Options{})
+		server.Reply("MAIL", 250, "2.1.0 OK")
+		server.Reply("MAIL", 421, "4.3.2 shutting down")
+
+		provider, _ := newTestProviderWithConfig(t, server, verpConfig)
+
+		result, err := provider.Send(context.Background(), newTestEmail())
+		if err != nil || result.Success {
+			t.Fatalf("Send = %+v, %v, want failure", result, err)
+		}
+
+		// The copy sent before the failure is reported
+		if len(result.Recipients) != 1 || !result.Recipients[0].Sent || result.Recipients[0].Address != "to@example.com" {
+			t.Errorf("recipients = %+v, want to@example.com sent", result.Recipients)
+		}
+		if got := sentTo(server.Messages()); strings.Join(got, ",") != "to@example.com" {
+			t.Errorf("copies went to %v, want to@example.com", got)
+		}
+	})
+
+	t.Run("slow relay", func(t *testing.T) {
+		server := smtptest.NewServer(t, smtptest.Options{ReplyDelay: 150 * time.Millisecond})
+
+		cfg := verpConfig
+		cfg.Timeout = 1
+		provider, _ := newTestProviderWithConfig(t, server, cfg)
+
+		// Each copy fits in the timeout, all of them do not
+		result, err := provider.Send(context.Background(), newTestEmail())
+		if err != nil || !result.Success {
+			t.Fatalf("Send = %+v, %v", result, err)
+		}
+		if n := len(server.Messages()); n != 3 {
+			t.Errorf("got %d copies, want 3", n)
+		}
+	})
+
+	t.Run("sent earlier", func(t *testing.T) {
+		server := smtptest.NewServer(t, smtptest.Options{})
+		provider, _ := newTestProviderWithConfig(t, server, verpConfig)
+
+		email := newTestEmail()
+		email.Recipients = entity.NewRecipients(email.To, email.CC, email.BCC)
+		if err := email.Recipient("to@example.com").MarkAsAccepted(250, "OK"); err != nil {
+			t.Fatalf("MarkAsAccepted: %v", err)
+		}
+
+		result, err := provider.Send(context.Background(), email)
+		if err != nil || !result.Success {
+			t.Fatalf("Send = %+v, %v", result, err)
+		}
+		if got := sentTo(server.Messages()); strings.Join(got, ",") != "cc@example.com,bcc@example.com" {
+			t.Errorf("copies went to %v, want cc@example.com and bcc@example.com", got)
+		}
+	})
+}
+
+func TestSMTPProvider_ListUnsubscribe(t *testing.T) {
+	server := smtptest.NewServer(t, smtptest.Options{})
+	provider, _ := newTestProvider(t, server, "", "")
+
+	email := newTestEmail()
+	email.ListUnsubscribe = true
+	email.Recipients = entity.NewRecipients(email.To, email.CC, email.BCC)
+
+	// Suppressed recipients get no copy
+	if err := email.Recipient("cc@example.com").MarkAsSuppressed("suppressed: unsubscribe"); err != nil {
+		t.Fatalf("MarkAsSuppressed: %v", err)
+	}
+
+	result, err := provider.Send(context.Background(), email)
+	if err != nil || !result.Success {
+		t.Fatalf("Send = %+v, %v", result, err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want one per unsuppressed recipient", len(messages))
+	}
+
+	for _, message := range messages {
+		if len(message.To) != 1 || message.From != "sender@example.com" {
+			t.Fatalf("envelope = %s to %v, want one recipient from the sender", message.From, message.To)
+		}
+
+		parsed, err := message.Parse()
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+
+		want := "<" + testUnsubscribeLinks{}.URL(email, message.To[0]) + ">"
+		if got := parsed.Header.Get("List-Unsubscribe"); got != want {
+			t.Errorf("List-Unsubscribe for %s = %q, want %q", message.To[0], got, want)
+		}
+		if got := parsed.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+			t.Errorf("List-Unsubscribe-Post = %q", got)
+		}
+	}
+
+	if strings.Join(messages[0].To, ",") != "to@example.com" || strings.Join(messages[1].To, ",") != "bcc@example.com" {
+		t.Errorf("copies went to %v and %v, want to@example.com and bcc@example.com", messages[0].To, messages[1].To)
+	}
+}
@@ -0,0 +1,94 @@
+package smtptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// Part is a leaf of the MIME tree of a message with its content decoded.
+type Part struct {
+	Header textproto.MIMEHeader
+	// MediaType is the content type without parameters.
+	MediaType string
+	// Filename is set for attachments.
+	Filename string
+	Body     []byte
+}
+
+// Parts flattens the MIME tree of the message into its leaves in order.
+// containers lists the multipart media types that were traversed.
+func (m Message) Parts() (parts []Part, containers []string, err error) {
+	msg, err := m.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := textproto.MIMEHeader(msg.Header)
+	err = walkPart(header, msg.Body, &parts, &containers)
+
+	return parts, containers, err
+}
+
+func walkPart(header textproto.MIMEHeader, body io.Reader, parts *[]Part, containers *[]string) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		*containers = append(*containers, mediaType)
+
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s part: %w", mediaType, err)
+			}
+
+			if err := walkPart(part.Header, part, parts, containers); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := decodeBody(header.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return err
+	}
+
+	part := Part{Header: header, MediaType: mediaType, Body: content}
+
+	if _, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		part.Filename = dispParams["filename"]
+	}
+
+	*parts = append(*parts, part)
+	return nil
+}
+
+func decodeBody(encoding string, body io.Reader) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		// Line breaks are not part of the encoded content
+		raw = bytes.ReplaceAll(raw, []byte("\r\n"), nil)
+		return base64.StdEncoding.DecodeString(string(raw))
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(body))
+	default:
+		return io.ReadAll(body)
+	}
+}
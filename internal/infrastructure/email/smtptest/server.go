@@ -0,0 +1,509 @@
+// Package smtptest provides an in-process SMTP server for tests. It records
+// the messages it accepts and can be scripted to reply with errors.
+package smtptest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// EOM scripts the reply to the message content sent after DATA, as opposed
+// to the reply to the DATA command itself.
+const EOM = "EOM"
+
+type Options struct {
+	// STARTTLS advertises the extension, using a self-signed certificate
+	// for 127.0.0.1 and localhost.
+	STARTTLS bool
+	// AuthMechanisms are the advertised AUTH mechanisms; PLAIN and LOGIN
+	// are supported.
+	AuthMechanisms []string
+	// Username and Password, when set, must be presented before MAIL.
+	Username string
+	Password string
+	// ReplyDelay holds back the reply to every command, as a slow relay
+	// does.
+	ReplyDelay time.Duration
+}
+
+// Auth is what the client authenticated with.
+type Auth struct {
+	Mechanism string
+	Identity  string
+	Username  string
+	Password  string
+}
+
+// Message is a message the server accepted.
+type Message struct {
+	From string
+	To   []string
+	Data []byte
+	// TLS is set when the message was sent after STARTTLS.
+	TLS  bool
+	Auth *Auth
+}
+
+// Parse parses the message headers; the body is left to the caller.
+func (m Message) Parse() (*mail.Message, error) {
+	return mail.ReadMessage(bytes.NewReader(m.Data))
+}
+
+type reply struct {
+	code int
+	text string
+}
+
+type Server struct {
+	// Host and Port are where the server listens.
+	Host string
+	Port int
+
+	opts      Options
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	messages []Message
+	scripted map[string][]reply
+	closed   bool
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a server on a random local port. It is stopped when the
+// test finishes.
+func NewServer(t testing.TB, opts Options) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("smtptest: failed to listen: %v", err)
+	}
+
+	s := &Server{
+		Host:     "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		opts:     opts,
+		listener: listener,
+		scripted: make(map[string][]reply),
+	}
+
+	if opts.STARTTLS {
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			listener.Close()
+			t.Fatalf("smtptest: failed to create certificate: %v", err)
+		}
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Reply makes the server answer the next occurrence of command, such as
+// "RCPT" or EOM, with code and text. Error codes reject the command; other
+// codes perform it with the given reply, and 421 also closes the
+// connection. Replies queued for the same command are used in order.
+func (s *Server) Reply(command string, code int, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	command = strings.ToUpper(command)
+	s.scripted[command] = append(s.scripted[command], reply{code: code, text: text})
+}
+
+// Messages returns the accepted messages in the order they were received.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+
+			conn.SetDeadline(time.Now().Add(time.Minute))
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) scriptedReply(command string) (reply, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue := s.scripted[command]
+	if len(queue) == 0 {
+		return reply{}, false
+	}
+
+	s.scripted[command] = queue[1:]
+	return queue[0], true
+}
+
+// session is the state of a single client connection.
+type session struct {
+	conn *textproto.Conn
+	tls  bool
+	auth *Auth
+	from string
+	to   []string
+	mail bool
+	// override replaces the next reply, as scripted with Reply.
+	override *reply
+}
+
+func (s *Server) handle(conn net.Conn) {
+	sess := &session{conn: textproto.NewConn(conn)}
+	sess.reply(220, "smtptest ready")
+
+	for {
+		line, err := sess.conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		time.Sleep(s.opts.ReplyDelay)
+
+		if r, ok := s.scriptedReply(verb); ok {
+			if r.code == 421 {
+				sess.reply(r.code, r.text)
+				return
+			}
+			if r.code >= 400 {
+				sess.reply(r.code, r.text)
+				continue
+			}
+			sess.override = &r
+		}
+
+		switch verb {
+		case "EHLO", "HELO":
+			sess.reset()
+			sess.replyLines(250, s.extensions(sess))
+		case "STARTTLS":
+			if s.tlsConfig == nil || sess.tls {
+				sess.reply(502, "STARTTLS not available")
+				continue
+			}
+
+			sess.reply(220, "ready to start TLS")
+
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+
+			conn = tlsConn
+			sess = &session{conn: textproto.NewConn(tlsConn), tls: true}
+		case "AUTH":
+			s.authenticate(sess, arg)
+		case "MAIL":
+			if s.opts.Username != "" && sess.auth == nil {
+				sess.reply(530, "authentication required")
+				continue
+			}
+			if sess.mail {
+				sess.reply(503, "nested MAIL command")
+				continue
+			}
+
+			sess.reset()
+			sess.from = parsePath(arg, "FROM:")
+			sess.mail = true
+			sess.reply(250, "OK")
+		case "RCPT":
+			if !sess.mail {
+				sess.reply(503, "need MAIL first")
+				continue
+			}
+
+			sess.to = append(sess.to, parsePath(arg, "TO:"))
+			sess.reply(250, "OK")
+		case "DATA":
+			if len(sess.to) == 0 {
+				sess.reply(503, "need RCPT first")
+				continue
+			}
+
+			sess.reply(354, "end data with <CR><LF>.<CR><LF>")
+
+			data, err := io.ReadAll(sess.conn.DotReader())
+			if err != nil {
+				return
+			}
+
+			if r, ok := s.scriptedReply(EOM); ok {
+				if r.code >= 400 {
+					sess.reply(r.code, r.text)
+					sess.reset()
+					continue
+				}
+				sess.override = &r
+			}
+
+			s.mu.Lock()
+			s.messages = append(s.messages, Message{
+				From: sess.from,
+				To:   sess.to,
+				Data: data,
+				TLS:  sess.tls,
+				Auth: sess.auth,
+			})
+			s.mu.Unlock()
+
+			sess.reset()
+			sess.reply(250, "OK: queued")
+		case "RSET":
+			sess.reset()
+			sess.reply(250, "OK")
+		case "NOOP":
+			sess.reply(250, "OK")
+		case "QUIT":
+			sess.reply(221, "bye")
+			return
+		default:
+			sess.reply(502, "command not implemented")
+		}
+	}
+}
+
+func (s *Server) extensions(sess *session) []string {
+	lines := []string{"smtptest", "8BITMIME"}
+
+	if s.tlsConfig != nil && !sess.tls {
+		lines = append(lines, "STARTTLS")
+	}
+
+	if len(s.opts.AuthMechanisms) > 0 {
+		lines = append(lines, "AUTH "+strings.Join(s.opts.AuthMechanisms, " "))
+	}
+
+	return lines
+}
+
+func (s *Server) authenticate(sess *session, arg string) {
+	if sess.auth != nil {
+		sess.reply(503, "already authenticated")
+		return
+	}
+
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	mechanism = strings.ToUpper(mechanism)
+
+	if !s.advertises(mechanism) {
+		sess.reply(504, "unrecognized authentication type")
+		return
+	}
+
+	var auth *Auth
+	var err error
+
+	switch mechanism {
+	case "PLAIN":
+		auth, err = sess.authPlain(initial)
+	case "LOGIN":
+		auth, err = sess.authLogin(initial)
+	default:
+		sess.reply(504, "unrecognized authentication type")
+		return
+	}
+
+	if err != nil {
+		sess.reply(501, err.Error())
+		return
+	}
+
+	if s.opts.Username != "" && (auth.Username != s.opts.Username || auth.Password != s.opts.Password) {
+		sess.reply(535, "authentication credentials invalid")
+		return
+	}
+
+	sess.auth = auth
+	sess.reply(235, "authentication successful")
+}
+
+func (s *Server) advertises(mechanism string) bool {
+	for _, m := range s.opts.AuthMechanisms {
+		if strings.EqualFold(m, mechanism) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sess *session) authPlain(initial string) (*Auth, error) {
+	if initial == "" {
+		var err error
+		if initial, err = sess.challenge(""); err != nil {
+			return nil, err
+		}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		return nil, errors.New("invalid base64")
+	}
+
+	parts := strings.Split(string(decoded), "\x00")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid PLAIN response")
+	}
+
+	return &Auth{Mechanism: "PLAIN", Identity: parts[0], Username: parts[1], Password: parts[2]}, nil
+}
+
+func (sess *session) authLogin(initial string) (*Auth, error) {
+	username := initial
+
+	if username == "" {
+		var err error
+		if username, err = sess.challenge("Username:"); err != nil {
+			return nil, err
+		}
+	}
+
+	password, err := sess.challenge("Password:")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := base64.StdEncoding.DecodeString(username)
+	if err != nil {
+		return nil, errors.New("invalid base64")
+	}
+
+	pass, err := base64.StdEncoding.DecodeString(password)
+	if err != nil {
+		return nil, errors.New("invalid base64")
+	}
+
+	return &Auth{Mechanism: "LOGIN", Username: string(user), Password: string(pass)}, nil
+}
+
+func (sess *session) challenge(prompt string) (string, error) {
+	sess.reply(334, base64.StdEncoding.EncodeToString([]byte(prompt)))
+
+	line, err := sess.conn.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	if line == "*" {
+		return "", errors.New("authentication cancelled")
+	}
+
+	return line, nil
+}
+
+func (sess *session) reset() {
+	sess.from = ""
+	sess.to = nil
+	sess.mail = false
+}
+
+func (sess *session) reply(code int, text string) {
+	if sess.override != nil {
+		code, text = sess.override.code, sess.override.text
+		sess.override = nil
+	}
+
+	sess.conn.PrintfLine("%d %s", code, text)
+}
+
+func (sess *session) replyLines(code int, lines []string) {
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		sess.conn.PrintfLine("%d%s%s", code, sep, line)
+	}
+}
+
+// parsePath extracts the address from "FROM:<addr> PARAMS".
+func parsePath(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+
+	path, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	return strings.TrimSuffix(strings.TrimPrefix(path, "<"), ">")
+}
+
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtptest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
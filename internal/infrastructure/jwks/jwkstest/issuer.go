@@ -0,0 +1,97 @@
+// Package jwkstest provides a token issuer for tests: it signs JWTs and
+// publishes its key set as a file or over HTTP.
+package jwkstest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+type Issuer struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewIssuer generates a signing key with the given key ID.
+func NewIssuer(t *testing.T, keyID string) *Issuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	return &Issuer{key: key, keyID: keyID}
+}
+
+// KeySet returns the public key set as JSON.
+func (i *Issuer) KeySet(t *testing.T) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       i.key.Public(),
+		KeyID:     i.keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+	if err != nil {
+		t.Fatalf("failed to encode key set: %v", err)
+	}
+
+	return data
+}
+
+// WriteFile writes the key set to a temporary file and returns its path.
+func (i *Issuer) WriteFile(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, i.KeySet(t), 0o600); err != nil {
+		t.Fatalf("failed to write key set: %v", err)
+	}
+
+	return path
+}
+
+// Handler serves the key set.
+func (i *Issuer) Handler(t *testing.T) http.Handler {
+	data := i.KeySet(t)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
+
+// Token signs claims. Without exp, the token expires in an hour.
+func (i *Issuer) Token(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: i.key, KeyID: i.keyID},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return token
+}
@@ -0,0 +1,183 @@
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// minRefetch limits how often an unknown key ID fetches the key set again,
+// so tokens with made up key IDs cannot flood the issuer.
+const minRefetch = time.Minute
+
+// maxKeySetSize limits the key set document read from the URL.
+const maxKeySetSize = 1 << 20
+
+func parseKeySet(data []byte) (*jose.JSONWebKeySet, error) {
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no keys")
+	}
+
+	return &set, nil
+}
+
+// find returns the keys with the ID, or all keys for an empty ID.
+func find(set *jose.JSONWebKeySet, keyID string) []jose.JSONWebKey {
+	if keyID == "" {
+		return set.Keys
+	}
+	return set.Key(keyID)
+}
+
+// fileSource serves a key set read once from a file.
+type fileSource struct {
+	set *jose.JSONWebKeySet
+}
+
+func newFileSource(path string) (*fileSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	set, err := parseKeySet(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSource{set: set}, nil
+}
+
+func (s *fileSource) keys(ctx context.Context, keyID string) ([]jose.JSONWebKey, error) {
+	return find(s.set, keyID), nil
+}
+
+// urlSource serves a key set fetched from a URL and cached for the refresh
+// interval. A failed fetch keeps the cached keys and is not retried for
+// minRefetch. Concurrent lookups share one fetch, made without holding the
+// lock so cached keys stay available meanwhile.
+type urlSource struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	mu        sync.Mutex
+	set       *jose.JSONWebKeySet
+	fetchedAt time.Time
+	failedAt  time.Time
+	err       error
+	inflight  *fetchCall
+}
+
+// fetchCall is a fetch in progress; done is closed when it finishes.
+type fetchCall struct {
+	done chan struct{}
+}
+
+func newURLSource(url string, interval time.Duration) *urlSource {
+	return &urlSource{
+		url:      url,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *urlSource) keys(ctx context.Context, keyID string) ([]jose.JSONWebKey, error) {
+	s.mu.Lock()
+
+	var keys []jose.JSONWebKey
+	if s.set != nil {
+		keys = find(s.set, keyID)
+	}
+
+	// Issuers rotate keys by publishing new ones first
+	age := time.Since(s.fetchedAt)
+	stale := s.set == nil || age >= s.interval || (len(keys) == 0 && age >= minRefetch)
+	if !stale || time.Since(s.failedAt) < minRefetch {
+		defer s.mu.Unlock()
+		if s.set == nil {
+			return nil, s.err
+		}
+		return keys, nil
+	}
+
+	call := s.inflight
+	if call == nil {
+		call = &fetchCall{done: make(chan struct{})}
+		s.inflight = call
+
+		// The fetch outlives a caller that gives up waiting for it
+		go s.refresh(context.WithoutCancel(ctx), call)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.set == nil {
+		return nil, s.err
+	}
+
+	return find(s.set, keyID), nil
+}
+
+// refresh fetches the key set and records the outcome of the attempt.
+func (s *urlSource) refresh(ctx context.Context, call *fetchCall) {
+	set, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.failedAt = time.Now()
+		s.err = err
+	} else {
+		s.set = set
+		s.fetchedAt = time.Now()
+		s.err = nil
+	}
+
+	s.inflight = nil
+	close(call.done)
+}
+
+func (s *urlSource) fetch(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	return parseKeySet(data)
+}
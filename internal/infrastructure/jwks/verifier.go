@@ -0,0 +1,151 @@
+// Package jwks verifies JWT bearer tokens with the keys of a JSON Web Key
+// Set read from a file or URL.
+package jwks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// algorithms are the accepted signature algorithms. Symmetric ones are
+// left out: the key set is public.
+var algorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// keySource returns the verification keys with an ID, or all keys for an
+// empty ID.
+type keySource interface {
+	keys(ctx context.Context, keyID string) ([]jose.JSONWebKey, error)
+}
+
+type Verifier struct {
+	source keySource
+	cfg    config.JWTConfig
+}
+
+// New returns a verifier using the key set in cfg.JWKSFile, or else the one
+// served at cfg.JWKSURL.
+func New(cfg config.JWTConfig) (*Verifier, error) {
+	var source keySource
+	var err error
+
+	switch {
+	case cfg.JWKSFile != "":
+		source, err = newFileSource(cfg.JWKSFile)
+	case cfg.JWKSURL != "":
+		source = newURLSource(cfg.JWKSURL, time.Duration(cfg.RefreshInterval)*time.Minute)
+	default:
+		err = errors.New("no JWKS file or URL configured")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{source: source, cfg: cfg}, nil
+}
+
+// Verify checks the signature and time, issuer and audience claims of a
+// token and maps its claims to a client. Invalid tokens return
+// ErrUnauthorized.
+func (v *Verifier) Verify(ctx context.Context, raw string) (*entity.Client, error) {
+	token, err := jwt.ParseSigned(raw, algorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token: %v", apperrors.ErrUnauthorized, err)
+	}
+
+	keys, err := v.source.keys(ctx, token.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.Claims
+	var extra map[string]any
+
+	verified := false
+	for _, key := range keys {
+		if key.Use == "enc" {
+			continue
+		}
+		if err := token.Claims(key.Key, &claims, &extra); err == nil {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, fmt.Errorf("%w: token signature does not match any known key", apperrors.ErrUnauthorized)
+	}
+
+	if claims.Expiry == nil {
+		return nil, fmt.Errorf("%w: token has no expiry", apperrors.ErrUnauthorized)
+	}
+
+	expected := jwt.Expected{Issuer: v.cfg.Issuer, Time: time.Now()}
+	if v.cfg.Audience != "" {
+		expected.AnyAudience = jwt.Audience{v.cfg.Audience}
+	}
+
+	if err := claims.ValidateWithLeeway(expected, time.Duration(v.cfg.Leeway)*time.Second); err != nil {
+		return nil, fmt.Errorf("%w: %v", apperrors.ErrUnauthorized, err)
+	}
+
+	return v.client(extra)
+}
+
+// client maps the claims of a verified token to the client.
+func (v *Verifier) client(claims map[string]any) (*entity.Client, error) {
+	id, _ := claims[v.cfg.ClientClaim].(string)
+	if id == "" {
+		return nil, fmt.Errorf("%w: token has no %s claim", apperrors.ErrUnauthorized, v.cfg.ClientClaim)
+	}
+
+	name, _ := claims[v.cfg.NameClaim].(string)
+	if name == "" {
+		name = id
+	}
+
+	senders, err := entity.ParseSenders(stringList(claims[v.cfg.SendersClaim]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s claim: %v", apperrors.ErrUnauthorized, v.cfg.SendersClaim, err)
+	}
+
+	return &entity.Client{
+		ID:             id,
+		Name:           name,
+		Scopes:         entity.FilterScopes(stringList(claims[v.cfg.ScopeClaim])),
+		AllowedSenders: senders,
+	}, nil
+}
+
+// stringList reads a claim holding a space separated string, as OAuth
+// scopes are, or an array of strings.
+func stringList(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,189 @@
+package jwks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/infrastructure/jwks/jwkstest"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+func testConfig() config.JWTConfig {
+	return config.JWTConfig{
+		Issuer:          "https://auth.example.com",
+		Audience:        "notifications",
+		RefreshInterval: 60,
+		Leeway:          60,
+		ClientClaim:     "sub",
+		NameClaim:       "client_name",
+		ScopeClaim:      "scope",
+		SendersClaim:    "allowed_senders",
+	}
+}
+
+func claims(extra map[string]any) map[string]any {
+	c := map[string]any{
+		"iss": "https://auth.example.com",
+		"aud": []string{"notifications", "audit"},
+		"sub": "orders-service",
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+func TestVerify(t *testing.T) {
+	issuer := jwkstest.NewIssuer(t, "key-1")
+
+	cfg := testConfig()
+	cfg.JWKSFile = issuer.WriteFile(t)
+
+	verifier, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	t.Run("Claims", func(t *testing.T) {
+		client, err := verifier.Verify(context.Background(), issuer.Token(t, claims(map[string]any{
+			"client_name":     "Orders",
+			"scope":           "emails:send profile",
+			"allowed_senders": []string{"orders@example.com"},
+		})))
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+
+		if client.ID != "orders-service" || client.Name != "Orders" {
+			t.Errorf("client = %+v", client)
+		}
+		if !slices.Equal(client.Scopes, []entity.Scope{entity.ScopeEmailsSend}) {
+			t.Errorf("Scopes = %v, want unknown scopes dropped", client.Scopes)
+		}
+		if !client.CanSendAs("orders@example.com") || client.CanSendAs("billing@example.com") {
+			t.Errorf("AllowedSenders = %v", client.AllowedSenders)
+		}
+	})
+
+	t.Run("ScopeArray", func(t *testing.T) {
+		client, err := verifier.Verify(context.Background(), issuer.Token(t, claims(map[string]any{
+			"scope": []string{"emails:read", "templates:write"},
+		})))
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+
+		if client.Name != "orders-service" || !client.HasScope(entity.ScopeEmailsRead) || !client.HasScope(entity.ScopeTemplatesWrite) {
+			t.Errorf("client = %+v", client)
+		}
+	})
+
+	invalid := map[string]string{
+		"Expired":       issuer.Token(t, claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"NotYetValid":   issuer.Token(t, claims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"WrongIssuer":   issuer.Token(t, claims(map[string]any{"iss": "https://evil.example.com"})),
+		"WrongAudience": issuer.Token(t, claims(map[string]any{"aud": "billing"})),
+		"NoSubject":     issuer.Token(t, claims(map[string]any{"sub": ""})),
+		"UnknownKey":    jwkstest.NewIssuer(t, "key-2").Token(t, claims(nil)),
+		"ForgedKey":     jwkstest.NewIssuer(t, "key-1").Token(t, claims(nil)),
+		"Malformed":     "not.a.token",
+	}
+
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, apperrors.ErrUnauthorized) {
+				t.Errorf("Verify = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestVerify_URL(t *testing.T) {
+	issuer := jwkstest.NewIssuer(t, "key-1")
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		issuer.Handler(t).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.JWKSURL = server.URL
+
+	verifier, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for range 3 {
+		if _, err := verifier.Verify(context.Background(), issuer.Token(t, claims(nil))); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+	}
+
+	// Unknown key IDs fetch the key set again at most once a minute
+	rotated := jwkstest.NewIssuer(t, "key-2")
+	if _, err := verifier.Verify(context.Background(), rotated.Token(t, claims(nil))); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Errorf("Verify = %v, want ErrUnauthorized", err)
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched the key set %d times, want once", n)
+	}
+}
+
+func TestVerify_URLUnavailable(t *testing.T) {
+	issuer := jwkstest.NewIssuer(t, "key-1")
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.JWKSURL = server.URL
+
+	verifier, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Concurrent requests share one fetch, and a failed fetch is not
+	// retried for a minute
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if _, err := verifier.Verify(context.Background(), issuer.Token(t, claims(nil))); err == nil {
+				t.Error("Verify succeeded without a key set")
+			}
+		})
+	}
+	wg.Wait()
+
+	if _, err := verifier.Verify(context.Background(), issuer.Token(t, claims(nil))); err == nil {
+		t.Error("Verify succeeded without a key set")
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched the key set %d times, want once", n)
+	}
+}
+
+func TestNew_NoKeySet(t *testing.T) {
+	if _, err := New(testConfig()); err == nil {
+		t.Error("New without a JWKS file or URL succeeded")
+	}
+}
@@ -0,0 +1,161 @@
+package mailbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+const imapTimeout = 30 * time.Second
+
+// imapMailbox reads a folder over IMAP: unread messages are those without
+// the \Seen flag, which is set once they are processed. Messages are
+// identified by UID and each call uses its own connection.
+type imapMailbox struct {
+	cfg config.BounceConfig
+}
+
+func NewIMAPMailbox(cfg config.BounceConfig) service.Mailbox {
+	return &imapMailbox{cfg: cfg}
+}
+
+func (m *imapMailbox) Unread(ctx context.Context, limit int) ([]service.InboundMessage, error) {
+	c, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search mailbox: %w", err)
+	}
+
+	if limit > 0 && len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	// Peek so that reading does not set \Seen
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, section.FetchItem()}
+
+	fetched := make(chan *imap.Message, len(uids))
+	if err := c.UidFetch(seqset, items, fetched); err != nil {
+		return nil, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+
+	messages := make([]service.InboundMessage, 0, len(uids))
+
+	for msg := range fetched {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message %d: %w", msg.Uid, err)
+		}
+
+		messages = append(messages, service.InboundMessage{
+			ID:   strconv.FormatUint(uint64(msg.Uid), 10),
+			Data: data,
+		})
+	}
+
+	return messages, nil
+}
+
+func (m *imapMailbox) MarkProcessed(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+
+	for _, id := range ids {
+		uid, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid message ID %q", id)
+		}
+		seqset.AddNum(uint32(uid))
+	}
+
+	c, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.UidStore(seqset, item, []any{imap.SeenFlag}, nil); err != nil {
+		return fmt.Errorf("failed to flag messages: %w", err)
+	}
+
+	return nil
+}
+
+// connect logs in and selects the folder.
+func (m *imapMailbox) connect(ctx context.Context) (*client.Client, error) {
+	addr := net.JoinHostPort(m.cfg.IMAPHost, strconv.Itoa(m.cfg.IMAPPort))
+	dialer := &net.Dialer{Timeout: imapTimeout}
+
+	var c *client.Client
+	var err error
+
+	if m.cfg.IMAPTLS {
+		c, err = client.DialWithDialerTLS(dialer, addr, nil)
+	} else {
+		c, err = client.DialWithDialer(dialer, addr)
+		if err == nil {
+			err = c.StartTLS(nil)
+		}
+	}
+
+	if err != nil {
+		if c != nil {
+			c.Logout()
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	c.Timeout = imapTimeout
+
+	// Unblock commands when the caller gives up
+	stop := context.AfterFunc(ctx, func() { c.Terminate() })
+
+	go func() {
+		<-c.LoggedOut()
+		stop()
+	}()
+
+	if err := c.Login(m.cfg.IMAPUser, m.cfg.IMAPPass); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("failed to log in: %w", err)
+	}
+
+	if _, err := c.Select(m.cfg.IMAPFolder, false); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("failed to select %s: %w", m.cfg.IMAPFolder, err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,20 @@
+package mailbox
+
+import (
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+)
+
+// New returns the mailbox selected by cfg.Mailbox.
+func New(cfg config.BounceConfig) (service.Mailbox, error) {
+	switch cfg.Mailbox {
+	case "maildir":
+		return NewMaildir(cfg.MaildirPath)
+	case "imap":
+		return NewIMAPMailbox(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown mailbox: %s", cfg.Mailbox)
+	}
+}
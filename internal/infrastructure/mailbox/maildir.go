@@ -0,0 +1,81 @@
+package mailbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/an3wers/notification-serv/internal/domain/service"
+)
+
+// maildir reads a Maildir: unread messages are the files in new/, and
+// processed ones are moved to cur/ with the Seen flag, as a mail client
+// would.
+type maildir struct {
+	path string
+}
+
+func NewMaildir(path string) (service.Mailbox, error) {
+	for _, dir := range []string{"new", "cur", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+
+	return &maildir{path: path}, nil
+}
+
+func (m *maildir) Unread(ctx context.Context, limit int) ([]service.InboundMessage, error) {
+	entries, err := os.ReadDir(filepath.Join(m.path, "new"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list maildir: %w", err)
+	}
+
+	// Names start with the delivery time, so this is roughly arrival order
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+
+	if limit > 0 && len(names) > limit {
+		names = names[:limit]
+	}
+
+	messages := make([]service.InboundMessage, 0, len(names))
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		data, err := os.ReadFile(filepath.Join(m.path, "new", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message %s: %w", name, err)
+		}
+
+		messages = append(messages, service.InboundMessage{ID: name, Data: data})
+	}
+
+	return messages, nil
+}
+
+func (m *maildir) MarkProcessed(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		if id == "" || id != filepath.Base(id) {
+			return fmt.Errorf("invalid message ID %q", id)
+		}
+
+		err := os.Rename(filepath.Join(m.path, "new", id), filepath.Join(m.path, "cur", id+":2,S"))
+		if err != nil {
+			return fmt.Errorf("failed to mark message %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
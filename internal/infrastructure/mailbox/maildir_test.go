@@ -0,0 +1,51 @@
+package mailbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaildir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	box, err := NewMaildir(dir)
+	if err != nil {
+		t.Fatalf("NewMaildir: %v", err)
+	}
+
+	for _, name := range []string{"1760264102.M2.host", "1760264101.M1.host", ".hidden"} {
+		if err := os.WriteFile(filepath.Join(dir, "new", name), []byte("Subject: "+name+"\r\n\r\n"), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	messages, err := box.Unread(ctx, 1)
+	if err != nil {
+		t.Fatalf("Unread: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != "1760264101.M1.host" || string(messages[0].Data) != "Subject: 1760264101.M1.host\r\n\r\n" {
+		t.Fatalf("Unread(1) = %+v, want the oldest message", messages)
+	}
+
+	if err := box.MarkProcessed(ctx, messages[0].ID); err != nil {
+		t.Fatalf("MarkProcessed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cur", "1760264101.M1.host:2,S")); err != nil {
+		t.Errorf("processed message not in cur: %v", err)
+	}
+
+	messages, err = box.Unread(ctx, 0)
+	if err != nil {
+		t.Fatalf("Unread: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != "1760264102.M2.host" {
+		t.Errorf("Unread = %+v, want the remaining message", messages)
+	}
+
+	if err := box.MarkProcessed(ctx, "../cur/x"); err == nil {
+		t.Error("MarkProcessed accepted a path")
+	}
+}
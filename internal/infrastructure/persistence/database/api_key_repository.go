@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyColumns = `id, name, prefix, key_hash, sealed_signing_key, scopes, allowed_senders, allowed_templates, created_at, last_used_at, revoked_at`
+
+type apiKeyRepository struct {
+	db *DB
+}
+
+func NewAPIKeyRepository(db *DB) repository.APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *entity.APIKey) error {
+	query := `INSERT INTO api_keys (` + apiKeyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	_, err := r.db.conn(ctx).Exec(ctx, query,
+		key.ID,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		key.SealedSigningKey,
+		scopes,
+		nonNil(key.AllowedSenders),
+		nonNil(key.AllowedTemplates),
+		key.CreatedAt,
+		key.LastUsedAt,
+		key.RevokedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.APIKey, error) {
+	return r.findOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id)
+}
+
+func (r *apiKeyRepository) FindByHash(ctx context.Context, hash []byte) (*entity.APIKey, error) {
+	return r.findOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, hash)
+}
+
+func (r *apiKeyRepository) List(ctx context.Context) ([]entity.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at, id`
+
+	rows, err := r.db.conn(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	keys, err := pgx.CollectRows(rows, scanAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id uuid.UUID, t time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, id, t)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperrors.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, id uuid.UUID, t time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = GREATEST(last_used_at, $2) WHERE id = $1`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, id, t)
+	if err != nil {
+		return fmt.Errorf("failed to touch API key: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperrors.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) findOne(ctx context.Context, query string, arg any) (*entity.APIKey, error) {
+	rows, err := r.db.conn(ctx).Query(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+
+	key, err := pgx.CollectExactlyOneRow(rows, scanAPIKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func scanAPIKey(row pgx.CollectableRow) (entity.APIKey, error) {
+	var key entity.APIKey
+	var scopes []string
+
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		&key.SealedSigningKey,
+		&scopes,
+		&key.AllowedSenders,
+		&key.AllowedTemplates,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+
+	key.Scopes = make([]entity.Scope, len(scopes))
+	for i, scope := range scopes {
+		key.Scopes[i] = entity.Scope(scope)
+	}
+
+	return key, err
+}
+
+// nonNil keeps nil slices from being stored as NULL in NOT NULL arrays.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Offloaded is a property of the email link, so it is always false
+// when an attachment is read on its own.
+const attachmentColumns = `
+	a.id, a.filename, a.original_name, a.mimetype,
+	a.size, COALESCE(a.content_hash, ''), a.path, a.url, a.created_at, a.purged_at, FALSE
+`
+
+type attachmentRepository struct {
+	db *DB
+}
+
+func NewAttachmentRepository(db *DB) repository.AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+func (r *attachmentRepository) Create(ctx context.Context, attachment *entity.Attachment) error {
+	query := `
+		INSERT INTO attachments (
+			id, filename, original_name, mimetype,
+			size, content_hash, path, url, created_at
+		) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9)
+	`
+
+	_, err := r.db.conn(ctx).Exec(ctx, query,
+		attachment.ID,
+		attachment.Filename,
+		attachment.OriginalName,
+		attachment.Mimetype,
+		attachment.Size,
+		attachment.Hash,
+		attachment.Path,
+		attachment.URL,
+		attachment.CreatedAt,
+	)
+
+	if err != nil {
+		if isUniqueViolation(err) {
+			return apperrors.ErrAlreadyExists
+		}
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments a WHERE a.id = $1`
+
+	return r.findOne(ctx, query, id)
+}
+
+func (r *attachmentRepository) FindByHash(ctx context.Context, hash string) (*entity.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments a WHERE a.content_hash = $1`
+
+	return r.findOne(ctx, query, hash)
+}
+
+func (r *attachmentRepository) FindByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.Attachment, error) {
+	// The name an email sends the file under may differ from the uploaded one
+	query := `
+		SELECT
+			a.id, a.filename, COALESCE(ea.filename, a.original_name), a.mimetype,
+			a.size, COALESCE(a.content_hash, ''), a.path, a.url, a.created_at, a.purged_at, ea.offloaded
+		FROM attachments a
+		JOIN email_attachments ea ON ea.attachment_id = a.id
+		WHERE ea.email_id = $1
+		ORDER BY ea.position, a.created_at
+	`
+
+	return r.findMany(ctx, query, emailID)
+}
+
+func (r *attachmentRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		DELETE FROM attachments a
+		WHERE a.id = $1
+		AND NOT EXISTS (SELECT 1 FROM email_attachments ea WHERE ea.attachment_id = a.id)
+	`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, id)
+	if err != nil {
+		// Referenced by an email committed while the delete waited for it
+		if isForeignKeyViolation(err) {
+			return apperrors.ErrAttachmentInUse
+		}
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		// Distinguish a missing attachment from a referenced one
+		if _, err := r.FindByID(ctx, id); err != nil {
+			return err
+		}
+		return apperrors.ErrAttachmentInUse
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) Touch(ctx context.Context, id uuid.UUID, t time.Time) error {
+	query := `UPDATE attachments SET created_at = GREATEST(created_at, $2) WHERE id = $1`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, id, t)
+	if err != nil {
+		return fmt.Errorf("failed to touch attachment: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperrors.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) AddOwner(ctx context.Context, id uuid.UUID, clientID, originalName string) error {
+	query := `
+		INSERT INTO attachment_owners (attachment_id, client_id, original_name)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (attachment_id, client_id) DO UPDATE SET original_name = EXCLUDED.original_name
+	`
+
+	if _, err := r.db.conn(ctx).Exec(ctx, query, id, clientID, originalName); err != nil {
+		if isForeignKeyViolation(err) {
+			return apperrors.ErrNotFound
+		}
+		return fmt.Errorf("failed to add attachment owner: %w", err)
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) FindOwners(ctx context.Context, id uuid.UUID) ([]string, error) {
+	query := `SELECT client_id FROM attachment_owners WHERE attachment_id = $1 ORDER BY created_at, client_id`
+
+	rows, err := r.db.conn(ctx).Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find attachment owners: %w", err)
+	}
+
+	owners, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to find attachment owners: %w", err)
+	}
+
+	return owners, nil
+}
+
+func (r *attachmentRepository) FindOwnerName(ctx context.Context, id uuid.UUID, clientID string) (string, error) {
+	query := `SELECT original_name FROM attachment_owners WHERE attachment_id = $1 AND client_id = $2`
+
+	var name string
+	if err := r.db.conn(ctx).QueryRow(ctx, query, id, clientID).Scan(&name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", apperrors.ErrNotFound
+		}
+		return "", fmt.Errorf("failed to find attachment owner: %w", err)
+	}
+
+	return name, nil
+}
+
+func (r *attachmentRepository) RemoveOwner(ctx context.Context, id uuid.UUID, clientID string) error {
+	query := `DELETE FROM attachment_owners WHERE attachment_id = $1 AND client_id = $2`
+
+	if _, err := r.db.conn(ctx).Exec(ctx, query, id, clientID); err != nil {
+		return fmt.Errorf("failed to remove attachment owner: %w", err)
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) StoredSize(ctx context.Context) (int64, error) {
+	query := `SELECT COALESCE(SUM(size), 0) FROM attachments WHERE purged_at IS NULL`
+
+	var size int64
+	if err := r.db.conn(ctx).QueryRow(ctx, query).Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to sum attachment sizes: %w", err)
+	}
+
+	return size, nil
+}
+
+func (r *attachmentRepository) FindOrphans(ctx context.Context, olderThan time.Time, limit int) ([]entity.Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments a
+		WHERE a.created_at < $1
+		AND NOT EXISTS (SELECT 1 FROM email_attachments ea WHERE ea.attachment_id = a.id)
+		ORDER BY a.created_at
+		LIMIT $2
+	`
+
+	return r.findMany(ctx, query, olderThan, limit)
+}
+
+func (r *attachmentRepository) findOne(ctx context.Context, query string, args ...any) (*entity.Attachment, error) {
+	att, err := scanAttachment(r.db.conn(ctx).QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find attachment: %w", err)
+	}
+
+	return att, nil
+}
+
+func (r *attachmentRepository) findMany(ctx context.Context, query string, args ...any) ([]entity.Attachment, error) {
+	rows, err := r.db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find attachments: %w", err)
+	}
+
+	defer rows.Close()
+
+	var attachments []entity.Attachment
+
+	for rows.Next() {
+		att, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+
+		attachments = append(attachments, *att)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+func scanAttachment(row pgx.Row) (*entity.Attachment, error) {
+	var att entity.Attachment
+
+	err := row.Scan(
+		&att.ID,
+		&att.Filename,
+		&att.OriginalName,
+		&att.Mimetype,
+		&att.Size,
+		&att.Hash,
+		&att.Path,
+		&att.URL,
+		&att.CreatedAt,
+		&att.PurgedAt,
+		&att.Offloaded,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &att, nil
+}
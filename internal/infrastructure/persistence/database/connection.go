@@ -27,6 +27,7 @@ func NewDB(cfg config.DatabaseConfig) (*DB, error) {
 	poolConfig.MaxConns = int32(cfg.MaxOpenConns)
 	poolConfig.MinConns = int32(cfg.MaxIdleConns)
 	poolConfig.MaxConnLifetime = time.Duration(cfg.ConnMaxLifetime) * time.Minute
+	poolConfig.ConnConfig.Tracer = queryTracer{}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type emailEventRepository struct {
+	db *DB
+}
+
+func NewEmailEventRepository(db *DB) repository.EmailEventRepository {
+	return &emailEventRepository{db: db}
+}
+
+func (r *emailEventRepository) FindByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.EmailEvent, error) {
+	query := `
+		SELECT id, email_id, from_status, to_status, actor, provider, detail, created_at
+		FROM email_events
+		WHERE email_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.conn(ctx).Query(ctx, query, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find email events: %w", err)
+	}
+
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.EmailEvent, error) {
+		var event entity.EmailEvent
+
+		err := row.Scan(
+			&event.ID,
+			&event.EmailID,
+			&event.FromStatus,
+			&event.ToStatus,
+			&event.Actor,
+			&event.Provider,
+			&event.Detail,
+			&event.CreatedAt,
+		)
+
+		return event, err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan email events: %w", err)
+	}
+
+	return events, nil
+}
+
+// appendEvents stores the pending events of an email.
+func (r *emailEventRepository) appendEvents(ctx context.Context, events []entity.EmailEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO email_events (id, email_id, from_status, to_status, actor, provider, detail, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	batch := &pgx.Batch{}
+
+	for _, event := range events {
+		batch.Queue(query,
+			event.ID,
+			event.EmailID,
+			event.FromStatus,
+			event.ToStatus,
+			event.Actor,
+			event.Provider,
+			event.Detail,
+			event.CreatedAt,
+		)
+	}
+
+	if err := r.db.conn(ctx).SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to append email events: %w", err)
+	}
+
+	return nil
+}
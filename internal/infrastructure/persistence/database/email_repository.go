@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/an3wers/notification-serv/internal/domain/entity"
 	"github.com/an3wers/notification-serv/internal/domain/repository"
@@ -13,22 +15,44 @@ import (
 )
 
 type emailRepository struct {
-	db *DB
+	db          *DB
+	attachments *attachmentRepository
+	events      *emailEventRepository
 }
 
 func NewEmailRepository(db *DB) repository.EmailRepository {
-	return &emailRepository{db: db}
+	return &emailRepository{
+		db:          db,
+		attachments: &attachmentRepository{db: db},
+		events:      &emailEventRepository{db: db},
+	}
 }
 
 func (r *emailRepository) Create(ctx context.Context, email *entity.Email) error {
+	err := r.db.withTx(ctx, func(ctx context.Context) error {
+		if err := r.create(ctx, email); err != nil {
+			return err
+		}
+		return r.events.appendEvents(ctx, email.PendingEvents())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	email.ClearEvents()
+	return nil
+}
+
+func (r *emailRepository) create(ctx context.Context, email *entity.Email) error {
 	query := `
 		INSERT INTO emails (
 			id, "from", "display_name", "to", cc, bcc, subject, body, html,
-			status, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			category, list_unsubscribe, client_id, status, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query,
+	_, err := r.db.conn(ctx).Exec(ctx, query,
 		email.ID,
 		email.From,
 		email.DisplayName,
@@ -38,6 +62,9 @@ func (r *emailRepository) Create(ctx context.Context, email *entity.Email) error
 		email.Subject,
 		email.Body,
 		email.HTML,
+		email.Category,
+		email.ListUnsubscribe,
+		email.ClientID,
 		email.Status,
 		email.CreatedAt,
 		email.UpdatedAt,
@@ -47,9 +74,13 @@ func (r *emailRepository) Create(ctx context.Context, email *entity.Email) error
 		return fmt.Errorf("failed to create email: %w", err)
 	}
 
-	// Create attachments
-	for _, att := range email.Attachments {
-		if err := r.CreateAttachment(ctx, &att); err != nil {
+	if err := r.createRecipients(ctx, email.ID, email.Recipients); err != nil {
+		return err
+	}
+
+	// Link the stored attachments
+	for i, att := range email.Attachments {
+		if err := r.linkAttachment(ctx, email.ID, &att, i); err != nil {
 			return err
 		}
 	}
@@ -57,19 +88,73 @@ func (r *emailRepository) Create(ctx context.Context, email *entity.Email) error
 	return nil
 }
 
+func (r *emailRepository) linkAttachment(ctx context.Context, emailID uuid.UUID, attachment *entity.Attachment, position int) error {
+	// The share lock makes retention wait for this transaction, so it sees
+	// the new reference instead of purging the file being sent
+	var purgedAt *time.Time
+
+	err := r.db.conn(ctx).QueryRow(ctx,
+		`SELECT purged_at FROM attachments WHERE id = $1 FOR SHARE`, attachment.ID,
+	).Scan(&purgedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: attachment %s not found", apperrors.ErrInvalidInput, attachment.ID)
+		}
+		return fmt.Errorf("failed to lock attachment: %w", err)
+	}
+
+	if purgedAt != nil {
+		return fmt.Errorf("%w: attachment %s content was deleted", apperrors.ErrInvalidInput, attachment.ID)
+	}
+
+	query := `
+		INSERT INTO email_attachments (email_id, attachment_id, position, filename, offloaded)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err = r.db.conn(ctx).Exec(ctx, query, emailID, attachment.ID, position, attachment.OriginalName, attachment.Offloaded)
+	if err != nil {
+		return fmt.Errorf("failed to link attachment: %w", err)
+	}
+
+	return nil
+}
+
 func (r *emailRepository) Update(ctx context.Context, email *entity.Email) error {
+	err := r.db.withTx(ctx, func(ctx context.Context) error {
+		if err := r.update(ctx, email); err != nil {
+			return err
+		}
+		return r.events.appendEvents(ctx, email.PendingEvents())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	email.ClearEvents()
+	email.Version++
+	return nil
+}
+
+func (r *emailRepository) update(ctx context.Context, email *entity.Email) error {
 	query := `
 		UPDATE emails
-		SET status = $2, error = $3, sent_at = $4, updated_at = $5
-		WHERE id = $1
+		SET status = $2, error = $3, sent_at = $4, updated_at = $5, send_after = $6, trace_context = $7,
+			version = version + 1
+		WHERE id = $1 AND version = $8
 	`
 
-	result, err := r.db.Pool.Exec(ctx, query,
+	result, err := r.db.conn(ctx).Exec(ctx, query,
 		email.ID,
 		email.Status,
 		email.Error,
 		email.SentAt,
 		email.UpdatedAt,
+		email.SendAfter,
+		email.TraceContext,
+		email.Version,
 	)
 
 	if err != nil {
@@ -77,50 +162,33 @@ func (r *emailRepository) Update(ctx context.Context, email *entity.Email) error
 	}
 
 	if result.RowsAffected() == 0 {
+		var exists bool
+		if err := r.db.conn(ctx).QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM emails WHERE id = $1)`, email.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to update email: %w", err)
+		}
+		if exists {
+			return fmt.Errorf("%w: email %s", apperrors.ErrConflict, email.ID)
+		}
 		return apperrors.ErrNotFound
 	}
 
-	return nil
-}
-
-func (r *emailRepository) CreateAttachment(ctx context.Context, attachment *entity.Attachment) error {
-	query := `
-		INSERT INTO attachments (
-			id, email_id, filename, original_name, mimetype,
-			size, path, url, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`
-
-	_, err := r.db.Pool.Exec(ctx, query,
-		attachment.ID,
-		attachment.EmailID,
-		attachment.Filename,
-		attachment.OriginalName,
-		attachment.Mimetype,
-		attachment.Size,
-		attachment.Path,
-		attachment.URL,
-		attachment.CreatedAt,
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to create attachment: %w", err)
-	}
-
-	return nil
+	// The row stays locked until the transaction ends, so recipients are
+	// not overwritten by a concurrent update either
+	return r.updateRecipients(ctx, email.ID, email.Recipients)
 }
 
 func (r *emailRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.Email, error) {
 	query := `
 		SELECT
 			id, "from", "display_name", "to", cc, bcc, subject, body, html,
-			status, error, sent_at, created_at, updated_at, deleted_at
+			category, list_unsubscribe, client_id, status, error, sent_at, send_after, trace_context,
+			created_at, updated_at, deleted_at, redacted_at, version
 		FROM emails
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var email entity.Email
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.conn(ctx).QueryRow(ctx, query, id).Scan(
 		&email.ID,
 		&email.From,
 		&email.DisplayName,
@@ -130,12 +198,19 @@ func (r *emailRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.E
 		&email.Subject,
 		&email.Body,
 		&email.HTML,
+		&email.Category,
+		&email.ListUnsubscribe,
+		&email.ClientID,
 		&email.Status,
 		&email.Error,
 		&email.SentAt,
+		&email.SendAfter,
+		&email.TraceContext,
 		&email.CreatedAt,
 		&email.UpdatedAt,
 		&email.DeletedAt,
+		&email.RedactedAt,
+		&email.Version,
 	)
 
 	if err != nil {
@@ -146,59 +221,176 @@ func (r *emailRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.E
 	}
 
 	// Load attachments
-	attachments, err := r.FindAttachmentsByEmailID(ctx, email.ID)
+	attachments, err := r.attachments.FindByEmailID(ctx, email.ID)
 	if err != nil {
 		return nil, err
 	}
 	email.Attachments = attachments
 
+	recipients, err := r.findRecipients(ctx, email.ID)
+	if err != nil {
+		return nil, err
+	}
+	email.Recipients = recipients
+
 	return &email, nil
 }
 
-func (r *emailRepository) FindAttachmentsByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.Attachment, error) {
+func (r *emailRepository) List(ctx context.Context, filter repository.EmailFilter) ([]entity.Email, error) {
 	query := `
 		SELECT
-			id, email_id, filename, original_name, mimetype,
-			size, path, url, created_at
-		FROM attachments
-		WHERE email_id = $1
-		ORDER BY created_at
+			id, "from", "display_name", "to", cc, bcc, subject, body, html,
+			category, list_unsubscribe, client_id, status, error, sent_at, send_after, created_at, updated_at, deleted_at, redacted_at
+		FROM emails
+		WHERE deleted_at IS NULL
+		AND (cardinality($1::text[]) = 0 OR status = ANY($1))
+		AND ($2::timestamptz IS NULL OR ($5::uuid IS NULL AND created_at < $2) OR (created_at, id) < ($2, $5))
+		AND ($4::text IS NULL OR client_id = $4)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, emailID)
+	statuses := make([]string, 0, len(filter.Statuses))
+	for _, status := range filter.Statuses {
+		statuses = append(statuses, string(status))
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
 
+	rows, err := r.db.conn(ctx).Query(ctx, query, statuses, filter.Before, limit, filter.ClientID, filter.BeforeID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find attachments: %w", err)
+		return nil, fmt.Errorf("failed to list emails: %w", err)
 	}
 
-	defer rows.Close()
+	emails, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Email, error) {
+		var email entity.Email
+
+		err := row.Scan(
+			&email.ID,
+			&email.From,
+			&email.DisplayName,
+			&email.To,
+			&email.CC,
+			&email.BCC,
+			&email.Subject,
+			&email.Body,
+			&email.HTML,
+			&email.Category,
+			&email.ListUnsubscribe,
+			&email.ClientID,
+			&email.Status,
+			&email.Error,
+			&email.SentAt,
+			&email.SendAfter,
+			&email.CreatedAt,
+			&email.UpdatedAt,
+			&email.DeletedAt,
+			&email.RedactedAt,
+		)
 
-	var attachments []entity.Attachment
+		return email, err
+	})
 
-	for rows.Next() {
-		var att entity.Attachment
-		err := rows.Scan(
-			&att.ID,
-			&att.EmailID,
-			&att.Filename,
-			&att.OriginalName,
-			&att.Mimetype,
-			&att.Size,
-			&att.Path,
-			&att.URL,
-			&att.CreatedAt,
-		)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan emails: %w", err)
+	}
 
+	for i := range emails {
+		recipients, err := r.findRecipients(ctx, emails[i].ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+			return nil, err
 		}
+		emails[i].Recipients = recipients
+	}
+
+	return emails, nil
+}
 
-		attachments = append(attachments, att)
+func (r *emailRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]uuid.UUID, error) {
+	query := `
+		SELECT id FROM emails
+		WHERE status = 'QUEUED' AND send_after <= $1 AND deleted_at IS NULL
+		ORDER BY send_after, id
+		LIMIT $2
+	`
+
+	rows, err := r.db.conn(ctx).Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due emails: %w", err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating attachments: %w", err)
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan due emails: %w", err)
 	}
 
-	return attachments, nil
+	return ids, nil
+}
+
+func (r *emailRepository) CountQueued(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM emails WHERE status = 'QUEUED' AND deleted_at IS NULL`
+
+	var count int
+	if err := r.db.conn(ctx).QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count queued emails: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *emailRepository) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE emails
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete email: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperrors.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *emailRepository) FindTombstone(ctx context.Context, id uuid.UUID) (*entity.Email, error) {
+	query := `
+		SELECT id, client_id, status, error, sent_at, created_at, updated_at, purged_at
+		FROM email_tombstones
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	email := entity.Email{
+		To:          []string{},
+		CC:          []string{},
+		BCC:         []string{},
+		Attachments: []entity.Attachment{},
+	}
+
+	err := r.db.conn(ctx).QueryRow(ctx, query, id).Scan(
+		&email.ID,
+		&email.ClientID,
+		&email.Status,
+		&email.Error,
+		&email.SentAt,
+		&email.CreatedAt,
+		&email.UpdatedAt,
+		&email.PurgedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find email tombstone: %w", err)
+	}
+
+	return &email, nil
 }
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type erasureRepository struct {
+	db *DB
+}
+
+func NewErasureRepository(db *DB) repository.ErasureRepository {
+	return &erasureRepository{db: db}
+}
+
+func (r *erasureRepository) EraseAddress(ctx context.Context, address string) ([]uuid.UUID, []uuid.UUID, error) {
+	address = entity.NormalizeAddress(address)
+
+	var emailIDs, attachmentIDs []uuid.UUID
+
+	err := r.db.withTx(ctx, func(ctx context.Context) error {
+		// Status, timestamps and recipient counts are kept for statistics.
+		// Provider errors may quote the address, so it is removed there too.
+		query := `
+			UPDATE emails SET
+				"from" = CASE WHEN lower("from") = $1 THEN $2 ELSE "from" END,
+				"to" = ARRAY(SELECT CASE WHEN lower(x) = $1 THEN $2 ELSE x END FROM unnest("to") x),
+				cc = ARRAY(SELECT CASE WHEN lower(x) = $1 THEN $2 ELSE x END FROM unnest(cc) x),
+				bcc = ARRAY(SELECT CASE WHEN lower(x) = $1 THEN $2 ELSE x END FROM unnest(bcc) x),
+				display_name = '',
+				subject = '',
+				body = '',
+				html = NULL,
+				error = regexp_replace(error, $3, $2, 'gi'),
+				redacted_at = COALESCE(redacted_at, NOW()),
+				updated_at = NOW()
+			WHERE lower("from") = $1
+			OR EXISTS (SELECT 1 FROM unnest("to" || cc || bcc) x WHERE lower(x) = $1)
+			RETURNING id
+		`
+
+		rows, err := r.db.conn(ctx).Query(ctx, query, address, entity.ErasedAddress, regexp.QuoteMeta(address))
+		if err != nil {
+			return fmt.Errorf("failed to erase address: %w", err)
+		}
+
+		emailIDs, err = pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return fmt.Errorf("failed to erase address: %w", err)
+		}
+
+		query = `
+			UPDATE email_recipients SET
+				address = CASE WHEN lower(address) = $2 THEN $3 ELSE address END,
+				response = regexp_replace(response, $4, $3, 'gi'),
+				updated_at = NOW()
+			WHERE email_id = ANY($1)
+		`
+
+		_, err = r.db.conn(ctx).Exec(ctx, query, emailIDs, address, entity.ErasedAddress, regexp.QuoteMeta(address))
+		if err != nil {
+			return fmt.Errorf("failed to erase recipients: %w", err)
+		}
+
+		query = `
+			UPDATE email_events
+			SET detail = regexp_replace(detail, $2, $3, 'gi')
+			WHERE email_id = ANY($1) AND detail IS NOT NULL
+		`
+
+		_, err = r.db.conn(ctx).Exec(ctx, query, emailIDs, regexp.QuoteMeta(address), entity.ErasedAddress)
+		if err != nil {
+			return fmt.Errorf("failed to erase email events: %w", err)
+		}
+
+		query = `
+			DELETE FROM email_attachments
+			WHERE email_id = ANY($1)
+			RETURNING attachment_id
+		`
+
+		rows, err = r.db.conn(ctx).Query(ctx, query, emailIDs)
+		if err != nil {
+			return fmt.Errorf("failed to unlink attachments: %w", err)
+		}
+
+		attachmentIDs, err = pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return fmt.Errorf("failed to unlink attachments: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return emailIDs, uniqueIDs(attachmentIDs), nil
+}
+
+func (r *erasureRepository) SaveReport(ctx context.Context, report *entity.ErasureReport) error {
+	query := `
+		INSERT INTO erasure_requests (id, address_hash, email_ids, attachment_ids, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := r.db.conn(ctx).Exec(ctx, query,
+		report.ID,
+		report.AddressHash,
+		report.EmailIDs,
+		report.AttachmentIDs,
+		report.CreatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save erasure report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *erasureRepository) FindReport(ctx context.Context, id uuid.UUID) (*entity.ErasureReport, error) {
+	query := `
+		SELECT id, address_hash, email_ids, attachment_ids, created_at
+		FROM erasure_requests
+		WHERE id = $1
+	`
+
+	var report entity.ErasureReport
+	err := r.db.conn(ctx).QueryRow(ctx, query, id).Scan(
+		&report.ID,
+		&report.AddressHash,
+		&report.EmailIDs,
+		&report.AttachmentIDs,
+		&report.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find erasure report: %w", err)
+	}
+
+	return &report, nil
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	result := make([]uuid.UUID, 0, len(ids))
+
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
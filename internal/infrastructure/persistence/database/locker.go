@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+)
+
+type advisoryLocker struct {
+	db *DB
+}
+
+// NewLocker returns a Locker backed by Postgres session advisory locks.
+func NewLocker(db *DB) repository.Locker {
+	return &advisoryLocker{db: db}
+}
+
+func (l *advisoryLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	// Session locks belong to a connection, so hold one until release
+	conn, err := l.db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+
+	if !acquired {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	release := func() {
+		conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name)
+		conn.Release()
+	}
+
+	return release, true, nil
+}
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS emails (
+    id           UUID PRIMARY KEY,
+    "from"       TEXT NOT NULL,
+    display_name TEXT NOT NULL DEFAULT '',
+    "to"         TEXT[] NOT NULL,
+    cc           TEXT[] NOT NULL DEFAULT '{}',
+    bcc          TEXT[] NOT NULL DEFAULT '{}',
+    subject      TEXT NOT NULL DEFAULT '',
+    body         TEXT NOT NULL DEFAULT '',
+    html         TEXT,
+    status       VARCHAR(32) NOT NULL,
+    error        TEXT,
+    sent_at      TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_emails_status ON emails (status);
+CREATE INDEX IF NOT EXISTS idx_emails_created_at ON emails (created_at);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id            UUID PRIMARY KEY,
+    email_id      UUID NOT NULL REFERENCES emails (id) ON DELETE CASCADE,
+    filename      TEXT NOT NULL,
+    original_name TEXT NOT NULL,
+    mimetype      TEXT NOT NULL DEFAULT '',
+    size          BIGINT NOT NULL DEFAULT 0,
+    path          TEXT NOT NULL,
+    url           TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_email_id ON attachments (email_id);
@@ -0,0 +1,24 @@
+-- Attachments become standalone objects that can be shared by many emails.
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attachments_content_hash
+    ON attachments (content_hash)
+    WHERE content_hash IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS email_attachments (
+    email_id      UUID NOT NULL REFERENCES emails (id) ON DELETE CASCADE,
+    attachment_id UUID NOT NULL REFERENCES attachments (id) ON DELETE RESTRICT,
+    position      INT NOT NULL DEFAULT 0,
+    -- Name the file is sent under when it differs from the uploaded one
+    filename      TEXT,
+    PRIMARY KEY (email_id, attachment_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_attachments_attachment_id ON email_attachments (attachment_id);
+
+INSERT INTO email_attachments (email_id, attachment_id)
+SELECT email_id, id FROM attachments
+ON CONFLICT DO NOTHING;
+
+DROP INDEX IF EXISTS idx_attachments_email_id;
+ALTER TABLE attachments DROP COLUMN IF EXISTS email_id;
@@ -0,0 +1,2 @@
+-- Attachments sent as download links instead of being embedded
+ALTER TABLE email_attachments ADD COLUMN IF NOT EXISTS offloaded BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,13 @@
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS redacted_at TIMESTAMPTZ;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS purged_at TIMESTAMPTZ;
+
+-- Minimal record of emails removed by retention so status stays queryable
+CREATE TABLE IF NOT EXISTS email_tombstones (
+    id         UUID PRIMARY KEY,
+    status     VARCHAR(32) NOT NULL,
+    error      TEXT,
+    sent_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    purged_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,15 @@
+CREATE INDEX IF NOT EXISTS idx_emails_deleted_at ON emails (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Soft deleted emails stay hidden after retention removes them
+ALTER TABLE email_tombstones ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Audit trail of erasure requests. The address itself is not kept.
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    id                  UUID PRIMARY KEY,
+    address_hash        VARCHAR(64) NOT NULL,
+    email_ids           UUID[] NOT NULL DEFAULT '{}',
+    attachment_ids      UUID[] NOT NULL DEFAULT '{}',
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_address_hash ON erasure_requests (address_hash);
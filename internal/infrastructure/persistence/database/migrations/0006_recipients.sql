@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS email_recipients (
+    id         UUID PRIMARY KEY,
+    email_id   UUID NOT NULL REFERENCES emails (id) ON DELETE CASCADE,
+    position   INT NOT NULL,
+    address    TEXT NOT NULL,
+    kind       VARCHAR(8) NOT NULL,
+    status     VARCHAR(32) NOT NULL,
+    smtp_code  INT,
+    response   TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_recipients_email_id ON email_recipients (email_id);
+CREATE INDEX IF NOT EXISTS idx_email_recipients_address ON email_recipients (lower(address));
+
+-- Emails sent before per-recipient tracking have a single known outcome
+INSERT INTO email_recipients (id, email_id, position, address, kind, status, created_at, updated_at)
+SELECT
+    gen_random_uuid(), e.id, r.position, r.address, r.kind,
+    CASE e.status WHEN 'SENT' THEN 'ACCEPTED' WHEN 'FAILED' THEN 'REJECTED' ELSE 'PENDING' END,
+    e.created_at, e.updated_at
+FROM emails e
+CROSS JOIN LATERAL (
+    SELECT DISTINCT ON (lower(x.address)) x.address, x.kind, x.position
+    FROM (
+        SELECT address, 'TO' AS kind, ord AS position FROM unnest(e."to") WITH ORDINALITY AS t (address, ord)
+        UNION ALL
+        SELECT address, 'CC', 10000 + ord FROM unnest(e.cc) WITH ORDINALITY AS t (address, ord)
+        UNION ALL
+        SELECT address, 'BCC', 20000 + ord FROM unnest(e.bcc) WITH ORDINALITY AS t (address, ord)
+    ) x
+    ORDER BY lower(x.address), x.position
+) r
+WHERE NOT EXISTS (SELECT 1 FROM email_recipients er WHERE er.email_id = e.id);
@@ -0,0 +1,20 @@
+-- Append-only timeline of status changes. Rows outlive their email so the
+-- history stays available next to its tombstone.
+CREATE TABLE IF NOT EXISTS email_events (
+    id          UUID PRIMARY KEY,
+    email_id    UUID NOT NULL,
+    from_status VARCHAR(32),
+    to_status   VARCHAR(32) NOT NULL,
+    actor       VARCHAR(32) NOT NULL,
+    provider    TEXT NOT NULL DEFAULT '',
+    detail      TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_events_email_id ON email_events (email_id, created_at);
+
+-- Earlier history is unknown, only the current status is recorded
+INSERT INTO email_events (id, email_id, from_status, to_status, actor, detail, created_at)
+SELECT gen_random_uuid(), id, NULL, status, 'SYSTEM', 'recorded before event tracking', updated_at
+FROM emails
+WHERE NOT EXISTS (SELECT 1 FROM email_events ev WHERE ev.email_id = emails.id);
@@ -0,0 +1,14 @@
+-- Addresses that must not receive email. Addresses are stored lower-cased;
+-- an entry without expires_at never expires.
+CREATE TABLE IF NOT EXISTS suppressions (
+    address    TEXT PRIMARY KEY,
+    reason     VARCHAR(32) NOT NULL,
+    source     VARCHAR(32) NOT NULL,
+    detail     TEXT,
+    email_id   UUID,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_suppressions_reason ON suppressions (reason, address);
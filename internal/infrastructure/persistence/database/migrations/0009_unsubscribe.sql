@@ -0,0 +1,7 @@
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS category TEXT;
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS list_unsubscribe BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Unsubscribes are kept per category, the empty category covers every email
+ALTER TABLE suppressions ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+ALTER TABLE suppressions DROP CONSTRAINT IF EXISTS suppressions_pkey;
+ALTER TABLE suppressions ADD PRIMARY KEY (address, category);
@@ -0,0 +1,14 @@
+-- Credentials of client services. Keys are stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           UUID PRIMARY KEY,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    key_hash     BYTEA NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+-- The client that created the email; NULL for the legacy shared secret
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS client_id TEXT;
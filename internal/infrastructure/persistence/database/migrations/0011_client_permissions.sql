@@ -0,0 +1,8 @@
+-- Senders and templates a client is limited to; empty arrays allow any
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS allowed_senders TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS allowed_templates TEXT[] NOT NULL DEFAULT '{}';
+
+-- Clients only see their own emails, including removed ones
+ALTER TABLE email_tombstones ADD COLUMN IF NOT EXISTS client_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_emails_client_created ON emails (client_id, created_at DESC);
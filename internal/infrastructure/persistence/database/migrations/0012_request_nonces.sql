@@ -0,0 +1,9 @@
+-- Nonces of signed requests, kept while their timestamp is still accepted
+CREATE TABLE IF NOT EXISTS request_nonces (
+    key_id     UUID NOT NULL,
+    nonce      TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (key_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS idx_request_nonces_expires ON request_nonces (expires_at);
@@ -0,0 +1,8 @@
+-- Emails created per client and quota period, shared by all replicas
+CREATE TABLE IF NOT EXISTS quota_usage (
+    client_id    TEXT NOT NULL,
+    period       TEXT NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    used         INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (client_id, period, period_start)
+);
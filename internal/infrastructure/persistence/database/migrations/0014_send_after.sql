@@ -0,0 +1,4 @@
+-- Emails deferred by the per-domain throttle wait in QUEUED until send_after
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS send_after TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_emails_queued_send_after ON emails (send_after) WHERE status = 'QUEUED';
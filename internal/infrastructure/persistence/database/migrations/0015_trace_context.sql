@@ -0,0 +1,2 @@
+-- Trace context of the request that queued an email, continued by the worker
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS trace_context JSONB;
@@ -0,0 +1,3 @@
+-- Incremented by every update, so a stale copy of an email is not saved
+-- over a concurrent change
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+-- Clients that uploaded an attachment. Uploads of the same content share
+-- one attachment, so it can have several owners.
+CREATE TABLE IF NOT EXISTS attachment_owners (
+    attachment_id UUID NOT NULL REFERENCES attachments (id) ON DELETE CASCADE,
+    client_id     TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (attachment_id, client_id)
+);
+
+-- Clients keep access to the attachments of their existing emails
+INSERT INTO attachment_owners (attachment_id, client_id)
+SELECT DISTINCT ea.attachment_id, e.client_id
+FROM email_attachments ea
+JOIN emails e ON e.id = ea.email_id
+WHERE e.client_id IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- Request signing keys, encrypted under a server secret. Keys created
+-- before have none and cannot sign requests: their signing key was the
+-- stored key hash.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS sealed_signing_key BYTEA;
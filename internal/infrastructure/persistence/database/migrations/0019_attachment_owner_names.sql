@@ -0,0 +1,10 @@
+-- The name each client uploaded an attachment under. Uploads of the same
+-- content share one attachment but keep their own filename.
+ALTER TABLE attachment_owners ADD COLUMN IF NOT EXISTS original_name TEXT;
+
+UPDATE attachment_owners o
+SET original_name = a.original_name
+FROM attachments a
+WHERE a.id = o.attachment_id AND o.original_name IS NULL;
+
+ALTER TABLE attachment_owners ALTER COLUMN original_name SET NOT NULL;
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/google/uuid"
+)
+
+type nonceRepository struct {
+	db *DB
+}
+
+func NewNonceRepository(db *DB) repository.NonceRepository {
+	return &nonceRepository{db: db}
+}
+
+func (r *nonceRepository) Use(ctx context.Context, keyID uuid.UUID, nonce string, expiresAt time.Time) (bool, error) {
+	// An expired nonce that was not deleted yet is taken over
+	query := `
+		INSERT INTO request_nonces (key_id, nonce, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key_id, nonce) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE request_nonces.expires_at < NOW()
+	`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, keyID, nonce, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record nonce: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *nonceRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.conn(ctx).Exec(ctx, `DELETE FROM request_nonces WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired nonces: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector reports the statistics of the connection pool at each
+// scrape.
+type poolCollector struct {
+	db *DB
+
+	acquired      *prometheus.Desc
+	idle          *prometheus.Desc
+	constructing  *prometheus.Desc
+	total         *prometheus.Desc
+	max           *prometheus.Desc
+	acquires      *prometheus.Desc
+	emptyAcquires *prometheus.Desc
+	canceled      *prometheus.Desc
+	acquireTime   *prometheus.Desc
+	newConns      *prometheus.Desc
+}
+
+// NewPoolCollector returns a Prometheus collector for the pool statistics of
+// the database.
+func NewPoolCollector(db *DB) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("notification", "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		db:            db,
+		acquired:      desc("acquired_connections", "Connections currently in use."),
+		idle:          desc("idle_connections", "Connections currently idle."),
+		constructing:  desc("constructing_connections", "Connections being opened."),
+		total:         desc("total_connections", "Connections open or being opened."),
+		max:           desc("max_connections", "Maximum size of the pool."),
+		acquires:      desc("acquires_total", "Connections acquired from the pool."),
+		emptyAcquires: desc("empty_acquires_total", "Acquires that waited for a connection as none was idle."),
+		canceled:      desc("canceled_acquires_total", "Acquires canceled by their context."),
+		acquireTime:   desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		newConns:      desc("new_connections_total", "Connections opened."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.constructing
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.emptyAcquires
+	ch <- c.canceled
+	ch <- c.acquireTime
+	ch <- c.newConns
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.db.Pool.Stat()
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value)
+	}
+
+	gauge(c.acquired, float64(stat.AcquiredConns()))
+	gauge(c.idle, float64(stat.IdleConns()))
+	gauge(c.constructing, float64(stat.ConstructingConns()))
+	gauge(c.total, float64(stat.TotalConns()))
+	gauge(c.max, float64(stat.MaxConns()))
+	counter(c.acquires, float64(stat.AcquireCount()))
+	counter(c.emptyAcquires, float64(stat.EmptyAcquireCount()))
+	counter(c.canceled, float64(stat.CanceledAcquireCount()))
+	counter(c.acquireTime, stat.AcquireDuration().Seconds())
+	counter(c.newConns, float64(stat.NewConnsCount()))
+}
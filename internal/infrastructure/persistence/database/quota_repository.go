@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+type quotaRepository struct {
+	db *DB
+}
+
+func NewQuotaRepository(db *DB) repository.QuotaRepository {
+	return &quotaRepository{db: db}
+}
+
+func (r *quotaRepository) Consume(ctx context.Context, clientID string, period entity.QuotaPeriod, start time.Time, amount, limit int) (bool, error) {
+	if limit > 0 && amount > limit {
+		return false, nil
+	}
+
+	// The row lock taken by the upsert orders concurrent sends of a client
+	query := `
+		INSERT INTO quota_usage (client_id, period, period_start, used) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (client_id, period, period_start) DO UPDATE SET used = quota_usage.used + EXCLUDED.used
+		WHERE $5::INTEGER <= 0 OR quota_usage.used + EXCLUDED.used <= $5::INTEGER
+	`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, clientID, string(period), start, amount, limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume quota: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *quotaRepository) Usage(ctx context.Context, clientID string, period entity.QuotaPeriod, start time.Time) (int, error) {
+	query := `SELECT used FROM quota_usage WHERE client_id = $1 AND period = $2 AND period_start = $3`
+
+	var used int
+	err := r.db.conn(ctx).QueryRow(ctx, query, clientID, string(period), start).Scan(&used)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+
+	return used, nil
+}
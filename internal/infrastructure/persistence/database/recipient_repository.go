@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Recipients are stored with their email, so the email repository manages
+// them through these helpers.
+
+func (r *emailRepository) createRecipients(ctx context.Context, emailID uuid.UUID, recipients []entity.Recipient) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO email_recipients (
+			id, email_id, position, address, kind, status,
+			smtp_code, response, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	batch := &pgx.Batch{}
+
+	for i, rcpt := range recipients {
+		batch.Queue(query,
+			rcpt.ID,
+			emailID,
+			i,
+			rcpt.Address,
+			rcpt.Kind,
+			rcpt.Status,
+			rcpt.SMTPCode,
+			rcpt.Response,
+			rcpt.CreatedAt,
+			rcpt.UpdatedAt,
+		)
+	}
+
+	if err := r.db.conn(ctx).SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to create recipients: %w", err)
+	}
+
+	return nil
+}
+
+func (r *emailRepository) updateRecipients(ctx context.Context, emailID uuid.UUID, recipients []entity.Recipient) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE email_recipients
+		SET status = $3, smtp_code = $4, response = $5, updated_at = $6
+		WHERE id = $1 AND email_id = $2
+	`
+
+	batch := &pgx.Batch{}
+
+	for _, rcpt := range recipients {
+		batch.Queue(query,
+			rcpt.ID,
+			emailID,
+			rcpt.Status,
+			rcpt.SMTPCode,
+			rcpt.Response,
+			rcpt.UpdatedAt,
+		)
+	}
+
+	if err := r.db.conn(ctx).SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to update recipients: %w", err)
+	}
+
+	return nil
+}
+
+func (r *emailRepository) findRecipients(ctx context.Context, emailID uuid.UUID) ([]entity.Recipient, error) {
+	query := `
+		SELECT id, address, kind, status, smtp_code, response, created_at, updated_at
+		FROM email_recipients
+		WHERE email_id = $1
+		ORDER BY position
+	`
+
+	rows, err := r.db.conn(ctx).Query(ctx, query, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find recipients: %w", err)
+	}
+
+	recipients, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Recipient, error) {
+		var rcpt entity.Recipient
+
+		err := row.Scan(
+			&rcpt.ID,
+			&rcpt.Address,
+			&rcpt.Kind,
+			&rcpt.Status,
+			&rcpt.SMTPCode,
+			&rcpt.Response,
+			&rcpt.CreatedAt,
+			&rcpt.UpdatedAt,
+		)
+
+		return rcpt, err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan recipients: %w", err)
+	}
+
+	return recipients, nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository/repositorytest"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestRepositories runs against the database in TEST_DATABASE_URL, which is
+// migrated and emptied by the test; see `make test-postgres`.
+func TestRepositories(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	db := &DB{Pool: pool}
+
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		_, err := pool.Exec(ctx, `
+			TRUNCATE emails, email_recipients, email_events, attachments, attachment_owners, email_attachments, email_tombstones, erasure_requests, suppressions, api_keys, request_nonces, quota_usage
+		`)
+		if err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+
+		return repositorytest.Repositories{
+			Emails:       NewEmailRepository(db),
+			Attachments:  NewAttachmentRepository(db),
+			Events:       NewEmailEventRepository(db),
+			Suppressions: NewSuppressionRepository(db),
+			APIKeys:      NewAPIKeyRepository(db),
+			Nonces:       NewNonceRepository(db),
+			Quotas:       NewQuotaRepository(db),
+			Transactor:   NewTransactor(db),
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type retentionRepository struct {
+	db          *DB
+	attachments *attachmentRepository
+}
+
+func NewRetentionRepository(db *DB) repository.RetentionRepository {
+	return &retentionRepository{
+		db:          db,
+		attachments: &attachmentRepository{db: db},
+	}
+}
+
+func (r *retentionRepository) FindExpiredAttachments(ctx context.Context, cutoff time.Time, limit int) ([]entity.Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments a
+		WHERE a.purged_at IS NULL
+		AND EXISTS (SELECT 1 FROM email_attachments ea WHERE ea.attachment_id = a.id)
+		AND NOT EXISTS (
+			SELECT 1 FROM email_attachments ea
+			JOIN emails e ON e.id = ea.email_id
+			WHERE ea.attachment_id = a.id AND e.created_at >= $1
+		)
+		ORDER BY a.created_at
+		LIMIT $2
+	`
+
+	return r.attachments.findMany(ctx, query, cutoff, limit)
+}
+
+func (r *retentionRepository) MarkAttachmentPurged(ctx context.Context, id uuid.UUID, cutoff time.Time) (bool, error) {
+	// Clearing the hash keeps new uploads of the same content from being
+	// deduplicated against a file that no longer exists
+	query := `
+		UPDATE attachments a
+		SET purged_at = NOW(), content_hash = NULL
+		WHERE a.id = $1 AND a.purged_at IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM email_attachments ea
+			JOIN emails e ON e.id = ea.email_id
+			WHERE ea.attachment_id = a.id AND e.created_at >= $2
+		)
+	`
+
+	purged := false
+
+	err := r.db.withTx(ctx, func(ctx context.Context) error {
+		// Waits for emails being created with the attachment, which hold a
+		// share lock on it. The update then sees their references.
+		_, err := r.db.conn(ctx).Exec(ctx, `SELECT 1 FROM attachments WHERE id = $1 FOR UPDATE`, id)
+		if err != nil {
+			return err
+		}
+
+		result, err := r.db.conn(ctx).Exec(ctx, query, id, cutoff)
+		if err != nil {
+			return err
+		}
+
+		purged = result.RowsAffected() > 0
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to mark attachment purged: %w", err)
+	}
+
+	return purged, nil
+}
+
+func (r *retentionRepository) RedactEmails(ctx context.Context, cutoff time.Time, limit int) ([]uuid.UUID, error) {
+	query := `
+		UPDATE emails
+		SET body = '', html = NULL, redacted_at = NOW()
+		WHERE id IN (
+			SELECT id FROM emails
+			WHERE created_at < $1 AND redacted_at IS NULL
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`
+
+	return r.collectIDs(ctx, "redact emails", query, cutoff, limit)
+}
+
+func (r *retentionRepository) DeleteEmails(ctx context.Context, cutoff time.Time, limit int) ([]uuid.UUID, error) {
+	query := `
+		WITH deleted AS (
+			DELETE FROM emails
+			WHERE id IN (
+				SELECT id FROM emails
+				WHERE created_at < $1
+				ORDER BY created_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, client_id, status, error, sent_at, created_at, updated_at, deleted_at
+		)
+		INSERT INTO email_tombstones (id, client_id, status, error, sent_at, created_at, updated_at, deleted_at)
+		SELECT id, client_id, status, error, sent_at, created_at, updated_at, deleted_at FROM deleted
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id
+	`
+
+	return r.collectIDs(ctx, "delete emails", query, cutoff, limit)
+}
+
+func (r *retentionRepository) collectIDs(ctx context.Context, operation, query string, args ...any) ([]uuid.UUID, error) {
+	rows, err := r.db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", operation, err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", operation, err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/jackc/pgx/v5"
+)
+
+const suppressionColumns = `address, category, reason, source, detail, email_id, expires_at, created_at, updated_at`
+
+type suppressionRepository struct {
+	db *DB
+}
+
+func NewSuppressionRepository(db *DB) repository.SuppressionRepository {
+	return &suppressionRepository{db: db}
+}
+
+func (r *suppressionRepository) Upsert(ctx context.Context, s *entity.Suppression) error {
+	query := `
+		INSERT INTO suppressions (` + suppressionColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (address, category) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			source = EXCLUDED.source,
+			detail = EXCLUDED.detail,
+			email_id = EXCLUDED.email_id,
+			expires_at = EXCLUDED.expires_at,
+			updated_at = EXCLUDED.updated_at
+		RETURNING created_at
+	`
+
+	err := r.db.conn(ctx).QueryRow(ctx, query,
+		entity.NormalizeAddress(s.Address),
+		s.Category,
+		s.Reason,
+		s.Source,
+		s.Detail,
+		s.EmailID,
+		s.ExpiresAt,
+		s.CreatedAt,
+		s.UpdatedAt,
+	).Scan(&s.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save suppression: %w", err)
+	}
+
+	return nil
+}
+
+func (r *suppressionRepository) Find(ctx context.Context, address, category string) (*entity.Suppression, error) {
+	query := `SELECT ` + suppressionColumns + ` FROM suppressions WHERE address = $1 AND category = $2`
+
+	rows, err := r.db.conn(ctx).Query(ctx, query, entity.NormalizeAddress(address), category)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find suppression: %w", err)
+	}
+
+	s, err := pgx.CollectExactlyOneRow(rows, scanSuppression)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find suppression: %w", err)
+	}
+
+	return &s, nil
+}
+
+func (r *suppressionRepository) FindActive(ctx context.Context, addresses []string, category string, now time.Time) ([]entity.Suppression, error) {
+	normalized := make([]string, len(addresses))
+	for i, address := range addresses {
+		normalized[i] = entity.NormalizeAddress(address)
+	}
+
+	query := `
+		SELECT ` + suppressionColumns + `
+		FROM suppressions
+		WHERE address = ANY($1) AND category IN ('', $2) AND (expires_at IS NULL OR expires_at > $3)
+		ORDER BY address, category
+	`
+
+	return r.findMany(ctx, query, normalized, category, now)
+}
+
+func (r *suppressionRepository) List(ctx context.Context, filter repository.SuppressionFilter) ([]entity.Suppression, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+
+	query := `
+		SELECT ` + suppressionColumns + `
+		FROM suppressions
+		WHERE ($1 = '' OR reason = $1) AND (address, category) > ($2, $3)
+		ORDER BY address, category
+		LIMIT $4
+	`
+
+	return r.findMany(ctx, query, string(filter.Reason), entity.NormalizeAddress(filter.After), filter.AfterCategory, limit)
+}
+
+func (r *suppressionRepository) Delete(ctx context.Context, address, category string) error {
+	query := `DELETE FROM suppressions WHERE address = $1 AND category = $2`
+
+	result, err := r.db.conn(ctx).Exec(ctx, query, entity.NormalizeAddress(address), category)
+	if err != nil {
+		return fmt.Errorf("failed to delete suppression: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return apperrors.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *suppressionRepository) findMany(ctx context.Context, query string, args ...any) ([]entity.Suppression, error) {
+	rows, err := r.db.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find suppressions: %w", err)
+	}
+
+	suppressions, err := pgx.CollectRows(rows, scanSuppression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan suppressions: %w", err)
+	}
+
+	return suppressions, nil
+}
+
+func scanSuppression(row pgx.CollectableRow) (entity.Suppression, error) {
+	var s entity.Suppression
+
+	err := row.Scan(
+		&s.Address,
+		&s.Category,
+		&s.Reason,
+		&s.Source,
+		&s.Detail,
+		&s.EmailID,
+		&s.ExpiresAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+
+	return s, err
+}
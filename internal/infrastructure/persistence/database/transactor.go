@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// querier is implemented by both the pool and a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+type txKey struct{}
+
+type txState struct {
+	tx         pgx.Tx
+	onRollback []func(ctx context.Context)
+}
+
+// conn returns the transaction carried by ctx, or the pool.
+func (db *DB) conn(ctx context.Context) querier {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+
+	return db.Pool
+}
+
+// withTx runs fn in the transaction carried by ctx, or in a new one.
+func (db *DB) withTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	state := &txState{tx: tx}
+	committed := false
+
+	defer func() {
+		if committed {
+			return
+		}
+
+		detached := context.WithoutCancel(ctx)
+		tx.Rollback(detached)
+
+		// Compensations run in reverse order of registration
+		for i := len(state.onRollback) - 1; i >= 0; i-- {
+			state.onRollback[i](detached)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	committed = true
+	return nil
+}
+
+type transactor struct {
+	db *DB
+}
+
+func NewTransactor(db *DB) repository.Transactor {
+	return &transactor{db: db}
+}
+
+func (t *transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return t.db.withTx(ctx, fn)
+}
+
+func (t *transactor) OnRollback(ctx context.Context, fn func(ctx context.Context)) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.onRollback = append(state.onRollback, fn)
+	}
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+type apiKeyRepository struct {
+	store *Store
+}
+
+func NewAPIKeyRepository(store *Store) repository.APIKeyRepository {
+	return &apiKeyRepository{store: store}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *entity.APIKey) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, stored := range r.store.apiKeys {
+		if stored.ID == key.ID || bytes.Equal(stored.Hash, key.Hash) {
+			return apperrors.ErrAlreadyExists
+		}
+	}
+
+	r.store.apiKeys[key.ID] = cloneAPIKey(*key)
+
+	return nil
+}
+
+func (r *apiKeyRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	stored, ok := r.store.apiKeys[id]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+
+	key := cloneAPIKey(stored)
+	return &key, nil
+}
+
+func (r *apiKeyRepository) FindByHash(ctx context.Context, hash []byte) (*entity.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, stored := range r.store.apiKeys {
+		if bytes.Equal(stored.Hash, hash) {
+			key := cloneAPIKey(stored)
+			return &key, nil
+		}
+	}
+
+	return nil, apperrors.ErrNotFound
+}
+
+func (r *apiKeyRepository) List(ctx context.Context) ([]entity.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	keys := make([]entity.APIKey, 0, len(r.store.apiKeys))
+	for _, stored := range r.store.apiKeys {
+		keys = append(keys, cloneAPIKey(stored))
+	}
+
+	slices.SortFunc(keys, func(a, b entity.APIKey) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), bytes.Compare(a.ID[:], b.ID[:]))
+	})
+
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id uuid.UUID, t time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.apiKeys[id]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+
+	if stored.RevokedAt == nil {
+		stored.RevokedAt = &t
+		r.store.apiKeys[id] = stored
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, id uuid.UUID, t time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.apiKeys[id]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+
+	if stored.LastUsedAt == nil || t.After(*stored.LastUsedAt) {
+		stored.LastUsedAt = &t
+		r.store.apiKeys[id] = stored
+	}
+
+	return nil
+}
+
+func cloneAPIKey(key entity.APIKey) entity.APIKey {
+	key.Hash = slices.Clone(key.Hash)
+	key.Scopes = slices.Clone(key.Scopes)
+	return key
+}
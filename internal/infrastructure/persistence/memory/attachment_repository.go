@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+type attachmentRepository struct {
+	store *Store
+}
+
+func NewAttachmentRepository(store *Store) repository.AttachmentRepository {
+	return &attachmentRepository{store: store}
+}
+
+func (r *attachmentRepository) Create(ctx context.Context, attachment *entity.Attachment) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.attachments[attachment.ID]; ok {
+		return apperrors.ErrAlreadyExists
+	}
+
+	if attachment.Hash != "" {
+		if _, ok := r.store.findByHash(attachment.Hash); ok {
+			return apperrors.ErrAlreadyExists
+		}
+	}
+
+	stored := *attachment
+	stored.Offloaded = false
+	r.store.attachments[attachment.ID] = stored
+
+	return nil
+}
+
+func (r *attachmentRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.Attachment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	att, ok := r.store.attachments[id]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+
+	return &att, nil
+}
+
+func (r *attachmentRepository) FindByHash(ctx context.Context, hash string) (*entity.Attachment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	att, ok := r.store.findByHash(hash)
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+
+	return &att, nil
+}
+
+func (r *attachmentRepository) FindByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.Attachment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.emailAttachments(emailID), nil
+}
+
+func (r *attachmentRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.attachments[id]; !ok {
+		return apperrors.ErrNotFound
+	}
+
+	if r.store.isReferenced(id) {
+		return apperrors.ErrAttachmentInUse
+	}
+
+	delete(r.store.attachments, id)
+	delete(r.store.owners, id)
+
+	return nil
+}
+
+func (r *attachmentRepository) Touch(ctx context.Context, id uuid.UUID, t time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.attachments[id]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+
+	if t.After(stored.CreatedAt) {
+		stored.CreatedAt = t
+		r.store.attachments[id] = stored
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) AddOwner(ctx context.Context, id uuid.UUID, clientID, originalName string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.attachments[id]; !ok {
+		return apperrors.ErrNotFound
+	}
+
+	owners := r.store.owners[id]
+	if i := slices.IndexFunc(owners, func(o attachmentOwner) bool { return o.clientID == clientID }); i >= 0 {
+		owners[i].originalName = originalName
+		return nil
+	}
+
+	r.store.owners[id] = append(owners, attachmentOwner{clientID: clientID, originalName: originalName})
+
+	return nil
+}
+
+func (r *attachmentRepository) FindOwners(ctx context.Context, id uuid.UUID) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var owners []string
+	for _, o := range r.store.owners[id] {
+		owners = append(owners, o.clientID)
+	}
+
+	return owners, nil
+}
+
+func (r *attachmentRepository) FindOwnerName(ctx context.Context, id uuid.UUID, clientID string) (string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, o := range r.store.owners[id] {
+		if o.clientID == clientID {
+			return o.originalName, nil
+		}
+	}
+
+	return "", apperrors.ErrNotFound
+}
+
+func (r *attachmentRepository) RemoveOwner(ctx context.Context, id uuid.UUID, clientID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.owners[id] = slices.DeleteFunc(r.store.owners[id], func(o attachmentOwner) bool { return o.clientID == clientID })
+
+	return nil
+}
+
+func (r *attachmentRepository) StoredSize(ctx context.Context) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var size int64
+
+	for _, att := range r.store.attachments {
+		if att.PurgedAt == nil {
+			size += att.Size
+		}
+	}
+
+	return size, nil
+}
+
+func (r *attachmentRepository) FindOrphans(ctx context.Context, olderThan time.Time, limit int) ([]entity.Attachment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var orphans []entity.Attachment
+
+	for id, att := range r.store.attachments {
+		if att.CreatedAt.Before(olderThan) && !r.store.isReferenced(id) {
+			orphans = append(orphans, att)
+		}
+	}
+
+	slices.SortFunc(orphans, func(a, b entity.Attachment) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	if len(orphans) > limit {
+		orphans = orphans[:limit]
+	}
+
+	return orphans, nil
+}
@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/google/uuid"
+)
+
+type emailEventRepository struct {
+	store *Store
+}
+
+func NewEmailEventRepository(store *Store) repository.EmailEventRepository {
+	return &emailEventRepository{store: store}
+}
+
+func (r *emailEventRepository) FindByEmailID(ctx context.Context, emailID uuid.UUID) ([]entity.EmailEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return slices.Clone(r.store.events[emailID]), nil
+}
@@ -0,0 +1,234 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/google/uuid"
+)
+
+type emailRepository struct {
+	store *Store
+}
+
+func NewEmailRepository(store *Store) repository.EmailRepository {
+	return &emailRepository{store: store}
+}
+
+func (r *emailRepository) Create(ctx context.Context, email *entity.Email) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.emails[email.ID]; ok {
+		return fmt.Errorf("failed to create email: %w", apperrors.ErrAlreadyExists)
+	}
+
+	var links []emailAttachment
+
+	for _, att := range email.Attachments {
+		stored, ok := r.store.attachments[att.ID]
+		if !ok {
+			return fmt.Errorf("%w: attachment %s not found", apperrors.ErrInvalidInput, att.ID)
+		}
+		if stored.PurgedAt != nil {
+			return fmt.Errorf("%w: attachment %s content was deleted", apperrors.ErrInvalidInput, att.ID)
+		}
+
+		links = append(links, emailAttachment{
+			attachmentID: att.ID,
+			filename:     att.OriginalName,
+			offloaded:    att.Offloaded,
+		})
+	}
+
+	stored := cloneEmail(*email)
+	stored.Attachments = nil
+	r.store.emails[email.ID] = stored
+
+	r.store.links[email.ID] = links
+	r.store.appendEvents(email)
+	email.ClearEvents()
+
+	return nil
+}
+
+func (r *emailRepository) FindByID(ctx context.Context, id uuid.UUID) (*entity.Email, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	stored, ok := r.store.emails[id]
+	if !ok || stored.DeletedAt != nil {
+		return nil, apperrors.ErrNotFound
+	}
+
+	email := cloneEmail(stored)
+	email.Attachments = r.store.emailAttachments(id)
+
+	return &email, nil
+}
+
+func (r *emailRepository) Update(ctx context.Context, email *entity.Email) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.emails[email.ID]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+
+	if stored.Version != email.Version {
+		return fmt.Errorf("%w: email %s", apperrors.ErrConflict, email.ID)
+	}
+
+	stored.Version++
+	stored.Status = email.Status
+	stored.Error = email.Error
+	stored.SentAt = email.SentAt
+	stored.SendAfter = email.SendAfter
+	stored.TraceContext = maps.Clone(email.TraceContext)
+	stored.UpdatedAt = email.UpdatedAt
+
+	for _, rcpt := range email.Recipients {
+		for i := range stored.Recipients {
+			if stored.Recipients[i].ID == rcpt.ID {
+				stored.Recipients[i] = rcpt
+			}
+		}
+	}
+
+	r.store.emails[email.ID] = stored
+	r.store.appendEvents(email)
+	email.ClearEvents()
+	email.Version = stored.Version
+
+	return nil
+}
+
+func (r *emailRepository) List(ctx context.Context, filter repository.EmailFilter) ([]entity.Email, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var emails []entity.Email
+
+	for _, stored := range r.store.emails {
+		if stored.DeletedAt != nil {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, stored.Status) {
+			continue
+		}
+		if filter.Before != nil && !listedBefore(stored, *filter.Before, filter.BeforeID) {
+			continue
+		}
+		if filter.ClientID != nil && (stored.ClientID == nil || *stored.ClientID != *filter.ClientID) {
+			continue
+		}
+
+		email := cloneEmail(stored)
+		email.Attachments = nil
+		emails = append(emails, email)
+	}
+
+	slices.SortFunc(emails, func(a, b entity.Email) int {
+		return compareListed(b, a)
+	})
+
+	if filter.Limit > 0 && len(emails) > filter.Limit {
+		emails = emails[:filter.Limit]
+	}
+
+	return emails, nil
+}
+
+// compareListed orders emails by creation time, then by ID.
+func compareListed(a, b entity.Email) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID.String(), b.ID.String())
+}
+
+// listedBefore reports whether the email comes after the cursor in a
+// newest first listing.
+func listedBefore(email entity.Email, before time.Time, beforeID *uuid.UUID) bool {
+	if beforeID == nil {
+		return email.CreatedAt.Before(before)
+	}
+
+	return compareListed(email, entity.Email{CreatedAt: before, ID: *beforeID}) < 0
+}
+
+func (r *emailRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]uuid.UUID, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var due []entity.Email
+
+	for _, stored := range r.store.emails {
+		if stored.DeletedAt == nil && stored.Status == entity.StatusQueued && stored.SendAfter != nil && !stored.SendAfter.After(now) {
+			due = append(due, stored)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b entity.Email) int {
+		if c := a.SendAfter.Compare(*b.SendAfter); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+
+	ids := make([]uuid.UUID, 0, min(len(due), limit))
+	for _, email := range due {
+		if len(ids) == limit {
+			break
+		}
+		ids = append(ids, email.ID)
+	}
+
+	return ids, nil
+}
+
+func (r *emailRepository) CountQueued(ctx context.Context) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	count := 0
+
+	for _, stored := range r.store.emails {
+		if stored.DeletedAt == nil && stored.Status == entity.StatusQueued {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *emailRepository) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.emails[id]
+	if !ok || stored.DeletedAt != nil {
+		return apperrors.ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	stored.DeletedAt = &now
+	stored.UpdatedAt = now
+	r.store.emails[id] = stored
+
+	return nil
+}
+
+// FindTombstone finds nothing: retention does not run against this store,
+// so no email is ever reduced to a tombstone.
+func (r *emailRepository) FindTombstone(ctx context.Context, id uuid.UUID) (*entity.Email, error) {
+	return nil, apperrors.ErrNotFound
+}
@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+)
+
+// locker holds locks within the process, which is all there is to share
+// them with when running on this store.
+type locker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func NewLocker() repository.Locker {
+	return &locker{held: make(map[string]bool)}
+}
+
+func (l *locker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held[name] {
+		return nil, false, nil
+	}
+
+	l.held[name] = true
+
+	release := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, name)
+	}
+
+	return release, true, nil
+}
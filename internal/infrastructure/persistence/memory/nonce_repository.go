@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	"github.com/google/uuid"
+)
+
+type nonceRepository struct {
+	store *Store
+}
+
+func NewNonceRepository(store *Store) repository.NonceRepository {
+	return &nonceRepository{store: store}
+}
+
+func (r *nonceRepository) Use(ctx context.Context, keyID uuid.UUID, nonce string, expiresAt time.Time) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := nonceKey{keyID: keyID, nonce: nonce}
+	if stored, ok := r.store.nonces[key]; ok && !stored.Before(time.Now()) {
+		return false, nil
+	}
+
+	r.store.nonces[key] = expiresAt
+
+	return true, nil
+}
+
+func (r *nonceRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var deleted int64
+	for key, expiresAt := range r.store.nonces {
+		if expiresAt.Before(now) {
+			delete(r.store.nonces, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+)
+
+type quotaRepository struct {
+	store *Store
+}
+
+func NewQuotaRepository(store *Store) repository.QuotaRepository {
+	return &quotaRepository{store: store}
+}
+
+func (r *quotaRepository) Consume(ctx context.Context, clientID string, period entity.QuotaPeriod, start time.Time, amount, limit int) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := quotaKey{clientID: clientID, period: period, start: start.UTC()}
+
+	used := r.store.quotas[key] + amount
+	if limit > 0 && used > limit {
+		return false, nil
+	}
+
+	r.store.quotas[key] = used
+
+	return true, nil
+}
+
+func (r *quotaRepository) Usage(ctx context.Context, clientID string, period entity.QuotaPeriod, start time.Time) (int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.quotas[quotaKey{clientID: clientID, period: period, start: start.UTC()}], nil
+}
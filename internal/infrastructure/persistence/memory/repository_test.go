@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository/repositorytest"
+)
+
+func TestRepositories(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		store := NewStore()
+
+		return repositorytest.Repositories{
+			Emails:       NewEmailRepository(store),
+			Attachments:  NewAttachmentRepository(store),
+			Events:       NewEmailEventRepository(store),
+			Suppressions: NewSuppressionRepository(store),
+			APIKeys:      NewAPIKeyRepository(store),
+			Nonces:       NewNonceRepository(store),
+			Quotas:       NewQuotaRepository(store),
+			Transactor:   NewTransactor(store),
+		}
+	})
+}
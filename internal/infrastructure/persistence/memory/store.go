@@ -0,0 +1,193 @@
+// Package memory implements the repositories in process memory. It backs
+// tests, which run against it without Postgres; the service itself always
+// uses the database.
+package memory
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/google/uuid"
+)
+
+// Store holds the data shared by the repositories of this package.
+type Store struct {
+	mu           sync.RWMutex
+	emails       map[uuid.UUID]entity.Email
+	attachments  map[uuid.UUID]entity.Attachment
+	owners       map[uuid.UUID][]attachmentOwner
+	links        map[uuid.UUID][]emailAttachment
+	events       map[uuid.UUID][]entity.EmailEvent
+	suppressions map[suppressionKey]entity.Suppression
+	apiKeys      map[uuid.UUID]entity.APIKey
+	nonces       map[nonceKey]time.Time
+	quotas       map[quotaKey]int
+}
+
+// emailAttachment links an email to an attachment, like the
+// email_attachments table.
+type emailAttachment struct {
+	attachmentID uuid.UUID
+	filename     string
+	offloaded    bool
+}
+
+// attachmentOwner is a client that uploaded an attachment and the name it
+// gave it, like a row of the attachment_owners table.
+type attachmentOwner struct {
+	clientID     string
+	originalName string
+}
+
+// suppressionKey identifies a suppression entry, like the primary key of
+// the suppressions table. Addresses are normalized.
+type suppressionKey struct {
+	address  string
+	category string
+}
+
+// nonceKey identifies a nonce of a signed request, like
+// the primary key of the request_nonces table.
+type nonceKey struct {
+	keyID uuid.UUID
+	nonce string
+}
+
+// quotaKey identifies the usage of a client in a quota period, like the
+// primary key of the quota_usage table.
+type quotaKey struct {
+	clientID string
+	period   entity.QuotaPeriod
+	start    time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		emails:       make(map[uuid.UUID]entity.Email),
+		attachments:  make(map[uuid.UUID]entity.Attachment),
+		owners:       make(map[uuid.UUID][]attachmentOwner),
+		links:        make(map[uuid.UUID][]emailAttachment),
+		events:       make(map[uuid.UUID][]entity.EmailEvent),
+		suppressions: make(map[suppressionKey]entity.Suppression),
+		apiKeys:      make(map[uuid.UUID]entity.APIKey),
+		nonces:       make(map[nonceKey]time.Time),
+		quotas:       make(map[quotaKey]int),
+	}
+}
+
+// snapshot copies the store so a transaction can be rolled back. Callers
+// must hold the lock.
+func (s *Store) snapshot() *Store {
+	emails := make(map[uuid.UUID]entity.Email, len(s.emails))
+	for id, email := range s.emails {
+		emails[id] = cloneEmail(email)
+	}
+
+	owners := make(map[uuid.UUID][]attachmentOwner, len(s.owners))
+	for id, o := range s.owners {
+		owners[id] = slices.Clone(o)
+	}
+
+	links := make(map[uuid.UUID][]emailAttachment, len(s.links))
+	for id, l := range s.links {
+		links[id] = slices.Clone(l)
+	}
+
+	events := make(map[uuid.UUID][]entity.EmailEvent, len(s.events))
+	for id, e := range s.events {
+		events[id] = slices.Clone(e)
+	}
+
+	return &Store{
+		emails:       emails,
+		attachments:  maps.Clone(s.attachments),
+		owners:       owners,
+		links:        links,
+		events:       events,
+		suppressions: maps.Clone(s.suppressions),
+		apiKeys:      maps.Clone(s.apiKeys),
+		nonces:       maps.Clone(s.nonces),
+		quotas:       maps.Clone(s.quotas),
+	}
+}
+
+// restore replaces the data with a snapshot. Callers must hold the lock.
+func (s *Store) restore(snapshot *Store) {
+	s.emails = snapshot.emails
+	s.attachments = snapshot.attachments
+	s.owners = snapshot.owners
+	s.links = snapshot.links
+	s.events = snapshot.events
+	s.suppressions = snapshot.suppressions
+	s.apiKeys = snapshot.apiKeys
+	s.nonces = snapshot.nonces
+	s.quotas = snapshot.quotas
+}
+
+// isReferenced reports whether any email links the attachment. Callers
+// must hold the lock.
+func (s *Store) isReferenced(attachmentID uuid.UUID) bool {
+	for _, links := range s.links {
+		for _, l := range links {
+			if l.attachmentID == attachmentID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// cloneEmail copies the slices of an email so stored data is not shared
+// with callers. Pending events are not part of the copy.
+func cloneEmail(email entity.Email) entity.Email {
+	email.To = slices.Clone(email.To)
+	email.CC = slices.Clone(email.CC)
+	email.BCC = slices.Clone(email.BCC)
+	email.Attachments = slices.Clone(email.Attachments)
+	email.Recipients = slices.Clone(email.Recipients)
+	email.ClearEvents()
+	return email
+}
+
+// findByHash returns the attachment with the given content hash. Callers
+// must hold the lock.
+func (s *Store) findByHash(hash string) (entity.Attachment, bool) {
+	for _, att := range s.attachments {
+		if att.Hash == hash {
+			return att, true
+		}
+	}
+
+	return entity.Attachment{}, false
+}
+
+// emailAttachments returns the attachments linked to an email in link
+// order, named as the email sends them. Callers must hold the lock.
+func (s *Store) emailAttachments(emailID uuid.UUID) []entity.Attachment {
+	var attachments []entity.Attachment
+
+	for _, l := range s.links[emailID] {
+		att, ok := s.attachments[l.attachmentID]
+		if !ok {
+			continue
+		}
+
+		att.OriginalName = l.filename
+		att.Offloaded = l.offloaded
+		attachments = append(attachments, att)
+	}
+
+	return attachments
+}
+
+// appendEvents stores the pending events of an email. Callers must hold the
+// lock.
+func (s *Store) appendEvents(email *entity.Email) {
+	for _, event := range email.PendingEvents() {
+		s.events[event.EmailID] = append(s.events[event.EmailID], event)
+	}
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+type suppressionRepository struct {
+	store *Store
+}
+
+func NewSuppressionRepository(store *Store) repository.SuppressionRepository {
+	return &suppressionRepository{store: store}
+}
+
+func (r *suppressionRepository) Upsert(ctx context.Context, s *entity.Suppression) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := suppressionKey{address: entity.NormalizeAddress(s.Address), category: s.Category}
+
+	if stored, ok := r.store.suppressions[key]; ok {
+		s.CreatedAt = stored.CreatedAt
+	}
+
+	stored := *s
+	stored.Address = key.address
+	r.store.suppressions[key] = stored
+
+	return nil
+}
+
+func (r *suppressionRepository) Find(ctx context.Context, address, category string) (*entity.Suppression, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	stored, ok := r.store.suppressions[suppressionKey{address: entity.NormalizeAddress(address), category: category}]
+	if !ok {
+		return nil, apperrors.ErrNotFound
+	}
+
+	return &stored, nil
+}
+
+func (r *suppressionRepository) FindActive(ctx context.Context, addresses []string, category string, now time.Time) ([]entity.Suppression, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		wanted[entity.NormalizeAddress(address)] = true
+	}
+
+	var suppressions []entity.Suppression
+
+	for key, stored := range r.store.suppressions {
+		if wanted[key.address] && stored.Covers(category) && stored.Active(now) {
+			suppressions = append(suppressions, stored)
+		}
+	}
+
+	slices.SortFunc(suppressions, compareSuppressions)
+
+	return suppressions, nil
+}
+
+func (r *suppressionRepository) List(ctx context.Context, filter repository.SuppressionFilter) ([]entity.Suppression, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	after := entity.Suppression{Address: entity.NormalizeAddress(filter.After), Category: filter.AfterCategory}
+
+	var suppressions []entity.Suppression
+
+	for _, stored := range r.store.suppressions {
+		if filter.Reason != "" && stored.Reason != filter.Reason {
+			continue
+		}
+		if compareSuppressions(stored, after) <= 0 {
+			continue
+		}
+
+		suppressions = append(suppressions, stored)
+	}
+
+	slices.SortFunc(suppressions, compareSuppressions)
+
+	if filter.Limit > 0 && len(suppressions) > filter.Limit {
+		suppressions = suppressions[:filter.Limit]
+	}
+
+	return suppressions, nil
+}
+
+func (r *suppressionRepository) Delete(ctx context.Context, address, category string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := suppressionKey{address: entity.NormalizeAddress(address), category: category}
+
+	if _, ok := r.store.suppressions[key]; !ok {
+		return apperrors.ErrNotFound
+	}
+
+	delete(r.store.suppressions, key)
+
+	return nil
+}
+
+// compareSuppressions orders entries by address, then category.
+func compareSuppressions(a, b entity.Suppression) int {
+	return cmp.Or(cmp.Compare(a.Address, b.Address), cmp.Compare(a.Category, b.Category))
+}
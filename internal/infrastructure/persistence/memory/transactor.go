@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+)
+
+type txKey struct{}
+
+type txState struct {
+	onRollback []func(ctx context.Context)
+}
+
+type transactor struct {
+	store *Store
+}
+
+// NewTransactor returns a Transactor that restores the store to its state at
+// the start of the transaction on rollback. Transactions are not isolated
+// from concurrent writers.
+func NewTransactor(store *Store) repository.Transactor {
+	return &transactor{store: store}
+}
+
+func (t *transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	t.store.mu.RLock()
+	snapshot := t.store.snapshot()
+	t.store.mu.RUnlock()
+
+	state := &txState{}
+
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		t.store.mu.Lock()
+		t.store.restore(snapshot)
+		t.store.mu.Unlock()
+
+		detached := context.WithoutCancel(ctx)
+		for i := len(state.onRollback) - 1; i >= 0; i-- {
+			state.onRollback[i](detached)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (t *transactor) OnRollback(ctx context.Context, fn func(ctx context.Context)) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.onRollback = append(state.onRollback, fn)
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+type localStorage struct {
+	basePath string
+}
+
+func NewLocalStorage(cfg config.StorageConfig) service.FileStorage {
+	return &localStorage{basePath: cfg.LocalPath}
+}
+
+func (s *localStorage) Save(ctx context.Context, name string, r io.Reader) (string, int64, error) {
+	// Ensure upload directory exists
+	if err := os.MkdirAll(s.basePath, 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	path := filepath.Join(s.basePath, name)
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	size, err := io.Copy(dst, r)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path)
+		return "", 0, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return path, size, nil
+}
+
+func (s *localStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return file, nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
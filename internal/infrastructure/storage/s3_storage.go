@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize bounds the memory used per upload: objects of unknown size are
+// sent as multipart uploads with parts of this size.
+const s3PartSize = 5 * 1024 * 1024
+
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Storage(cfg config.StorageConfig) (service.FileStorage, error) {
+	endpoint := cfg.S3Endpoint
+	secure := true
+
+	// Endpoint may be given as a URL to choose the scheme
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		endpoint = u.Host
+		secure = u.Scheme != "http"
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: secure,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &s3Storage{
+		client: client,
+		bucket: cfg.S3Bucket,
+	}, nil
+}
+
+func (s *s3Storage) Save(ctx context.Context, name string, r io.Reader) (string, int64, error) {
+	info, err := s.client.PutObject(ctx, s.bucket, name, r, -1, minio.PutObjectOptions{
+		PartSize: s3PartSize,
+	})
+	if err != nil {
+		// Failed multipart uploads are aborted by the client, but a
+		// single-part object may already exist
+		s.client.RemoveObject(context.Background(), s.bucket, name, minio.RemoveObjectOptions{})
+		return "", 0, fmt.Errorf("failed to save object: %w", err)
+	}
+
+	return name, info.Size, nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object: %w", err)
+	}
+
+	// GetObject is lazy; Stat surfaces a missing object right away
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, apperrors.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open object: %w", err)
+	}
+
+	return obj, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, path string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, path, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+)
+
+// New returns the storage backend selected by cfg.Provider.
+func New(cfg config.StorageConfig) (service.FileStorage, error) {
+	switch cfg.Provider {
+	case "", "local":
+		return NewLocalStorage(cfg), nil
+	case "s3":
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage provider: %s", cfg.Provider)
+	}
+}
@@ -12,9 +12,19 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server_config"`
 	Database DatabaseConfig `yaml:"database_config"`
 	// RabbitMQ RabbitMQConfig
-	SMTP    SMTPConfig    `yaml:"smtp_config"`
-	Storage StorageConfig `yaml:"storage_config"`
-	Logger  LoggerConfig  `yaml:"logger_config"`
+	SMTP        SMTPConfig             `yaml:"smtp_config"`
+	Storage     StorageConfig          `yaml:"storage_config"`
+	Attachments AttachmentPolicyConfig `yaml:"attachment_policy"`
+	Links       LinksConfig            `yaml:"links_config"`
+	Retention   RetentionConfig        `yaml:"retention_config"`
+	Bounces     BounceConfig           `yaml:"bounce_config"`
+	Suppression SuppressionConfig      `yaml:"suppression_config"`
+	JWT         JWTConfig              `yaml:"jwt_config"`
+	RateLimit   RateLimitConfig        `yaml:"rate_limit_config"`
+	Throttle    ThrottleConfig         `yaml:"throttle_config"`
+	Metrics     MetricsConfig          `yaml:"metrics_config"`
+	Tracing     TracingConfig          `yaml:"tracing_config"`
+	Logger      LoggerConfig           `yaml:"logger_config"`
 }
 
 type ServerConfig struct {
@@ -24,7 +34,21 @@ type ServerConfig struct {
 	WriteTimeout    int    `yaml:"write_timeout" env:"WRITE_TIMEOUT" env-default:"20"`
 	ShutdownTimeout int    `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"10"`
 	IdleTimeout     int    `yaml:"idle_timeout" env:"IDLE_TIMEOUT" env-default:"60"`
+	// SecretKey is the secret shared by all clients in the ssy header,
+	// accepted while LegacySecretKey is on. Clients should move to their
+	// own API keys.
 	SecretKey       string `env:"SECRET_KEY" env-default:""`
+	LegacySecretKey bool   `yaml:"legacy_secret_key" env:"LEGACY_SECRET_KEY" env-default:"true"`
+	// SignatureMaxSkew is how far, in seconds, the timestamp of a signed
+	// request may be from the server clock.
+	SignatureMaxSkew int `yaml:"signature_max_skew" env-default:"300"`
+	// SigningKeyEncryptionKey encrypts the signing keys of API keys in the
+	// database. Without it API keys cannot sign requests.
+	SigningKeyEncryptionKey string `env:"SIGNING_KEY_ENCRYPTION_KEY" env-default:""`
+	// TrustedProxies are the addresses and CIDR ranges of the reverse
+	// proxies in front of the service. Only requests from them may set the
+	// client address with X-Forwarded-For or X-Real-IP.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
 }
 
 type DatabaseConfig struct {
@@ -48,6 +72,15 @@ type SMTPConfig struct {
 	FromDisplayName string `env:"SMTP_FROM_DISPLAY_NAME" env-default:""`
 	TLS             bool   `env:"SMTP_SECURE" env-default:"false"`
 	Timeout         int    `env:"SMTP_TIMEOUT" env-default:"30"`
+	// RequireAllRecipients aborts the message when the relay rejects any
+	// recipient instead of sending it to the accepted ones.
+	RequireAllRecipients bool `env:"SMTP_REQUIRE_ALL_RECIPIENTS" env-default:"false"`
+	// VERPAddress enables VERP: every recipient is sent in its own
+	// transaction with a signed return path built from this address, like
+	// bounces+<token>@example.com, so bounces name the email and recipient.
+	// RequireAllRecipients does not apply in this mode.
+	VERPAddress    string `env:"SMTP_VERP_ADDRESS" env-default:""`
+	VERPSigningKey string `env:"SMTP_VERP_SIGNING_KEY" env-default:""`
 }
 
 type StorageConfig struct {
@@ -56,7 +89,162 @@ type StorageConfig struct {
 	S3Bucket    string `yaml:"s3_bucket" env-default:""`
 	S3Region    string `yaml:"s3_region" env-default:""`
 	S3Endpoint  string `yaml:"s3_endpoint" env-default:""`
-	MaxFileSize int64  `yaml:"max_file_size" env-default:"62914560"`
+	S3AccessKey string `env:"S3_ACCESS_KEY" env-default:""`
+	S3SecretKey string `env:"S3_SECRET_KEY" env-default:""`
+	// MaxFileSize limits a single uploaded file, MaxRequestSize the whole
+	// multipart request including form fields.
+	MaxFileSize    int64 `yaml:"max_file_size" env-default:"62914560"`
+	MaxRequestSize int64 `yaml:"max_request_size" env-default:"62914560"`
+	// Unreferenced attachments older than OrphanTTL hours are removed
+	// every OrphanInterval minutes. 0 disables either.
+	OrphanTTL      int `yaml:"orphan_ttl" env-default:"24"`
+	OrphanInterval int `yaml:"orphan_interval" env-default:"60"`
+}
+
+// AttachmentPolicyConfig restricts what can be attached to an email.
+// Empty allow lists permit everything that is not blocked. MIME types may
+// use a "type/*" wildcard.
+type AttachmentPolicyConfig struct {
+	AllowedExtensions []string `yaml:"allowed_extensions"`
+	BlockedExtensions []string `yaml:"blocked_extensions" env-default:".exe,.com,.bat,.cmd,.scr,.pif,.msi,.js,.vbs,.ps1,.jar"`
+	AllowedMimeTypes  []string `yaml:"allowed_mime_types"`
+	BlockedMimeTypes  []string `yaml:"blocked_mime_types" env-default:"application/x-msdownload,application/vnd.microsoft.portable-executable,application/x-dosexec,application/x-elf,application/x-mach-binary"`
+	MaxFiles          int      `yaml:"max_files" env-default:"10"`
+	MaxTotalSize      int64    `yaml:"max_total_size" env-default:"62914560"`
+	MaxFilenameLength int      `yaml:"max_filename_length" env-default:"255"`
+	// When the attachments of an email exceed OffloadThreshold bytes in
+	// total, the largest are sent as download links instead of being
+	// embedded until the rest fits. 0 disables offloading.
+	OffloadThreshold int64 `yaml:"offload_threshold" env-default:"18874368"`
+}
+
+// LinksConfig configures signed URLs that give access to stored content
+// without the API secret.
+type LinksConfig struct {
+	BaseURL    string `yaml:"base_url" env:"PUBLIC_URL" env-default:"http://localhost:3020"`
+	SigningKey string `env:"LINK_SIGNING_KEY" env-default:""`
+	TTL        int    `yaml:"ttl" env:"LINK_TTL" env-default:"10080"`
+}
+
+// RetentionConfig sets how long stored content is kept. A period of 0
+// keeps the content forever.
+type RetentionConfig struct {
+	Interval       int `yaml:"interval" env-default:"60"`
+	AttachmentDays int `yaml:"attachment_days" env-default:"30"`
+	BodyDays       int `yaml:"body_days" env-default:"90"`
+	EmailDays      int `yaml:"email_days" env-default:"365"`
+	BatchSize      int `yaml:"batch_size" env-default:"100"`
+}
+
+// BounceConfig selects the mailbox delivery status notifications are read
+// from. An empty mailbox disables bounce processing.
+type BounceConfig struct {
+	Mailbox     string `yaml:"mailbox" env:"BOUNCE_MAILBOX" env-default:""`
+	MaildirPath string `yaml:"maildir_path" env:"BOUNCE_MAILDIR_PATH" env-default:"./bounces"`
+	IMAPHost    string `env:"BOUNCE_IMAP_HOST" env-default:""`
+	IMAPPort    int    `env:"BOUNCE_IMAP_PORT" env-default:"993"`
+	IMAPUser    string `env:"BOUNCE_IMAP_USER" env-default:""`
+	IMAPPass    string `env:"BOUNCE_IMAP_PASSWORD" env-default:""`
+	IMAPFolder  string `yaml:"imap_folder" env:"BOUNCE_IMAP_FOLDER" env-default:"INBOX"`
+	// IMAPTLS uses implicit TLS, otherwise STARTTLS is required.
+	IMAPTLS   bool `env:"BOUNCE_IMAP_SECURE" env-default:"true"`
+	Interval  int  `yaml:"interval" env-default:"5"`
+	BatchSize int  `yaml:"batch_size" env-default:"100"`
+}
+
+// Suppression modes decide what happens to an email addressed to
+// suppressed recipients.
+const (
+	// SuppressionRemove sends the email to the other recipients only.
+	SuppressionRemove = "remove"
+	// SuppressionReject refuses the whole email.
+	SuppressionReject = "reject"
+)
+
+// SuppressionConfig controls the suppression list. Hard bounces and
+// complaints add their address for the given number of days, 0 meaning
+// forever.
+type SuppressionConfig struct {
+	Mode           string `yaml:"mode" env:"SUPPRESSION_MODE" env-default:"remove"`
+	HardBounceDays int    `yaml:"hard_bounce_days" env-default:"180"`
+	ComplaintDays  int    `yaml:"complaint_days" env-default:"0"`
+}
+
+// JWTConfig accepts bearer tokens issued by the internal platform, signed
+// with keys from a JWKS file or URL. Without either, tokens are rejected.
+type JWTConfig struct {
+	JWKSFile string `yaml:"jwks_file" env:"JWT_JWKS_FILE" env-default:""`
+	JWKSURL  string `yaml:"jwks_url" env:"JWT_JWKS_URL" env-default:""`
+	// RefreshInterval is how often, in minutes, keys are fetched again
+	// from the URL. Unknown key IDs trigger a fetch sooner.
+	RefreshInterval int `yaml:"refresh_interval" env-default:"60"`
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string `yaml:"issuer" env:"JWT_ISSUER" env-default:""`
+	Audience string `yaml:"audience" env:"JWT_AUDIENCE" env-default:""`
+	// Leeway is the clock skew in seconds allowed when checking exp and nbf.
+	Leeway int `yaml:"leeway" env-default:"60"`
+	// The claims mapped to the client: its identifier, name (defaulting to
+	// the identifier), scopes as a space separated string or an array, and
+	// allowed senders.
+	ClientClaim  string `yaml:"client_claim" env-default:"sub"`
+	NameClaim    string `yaml:"name_claim" env-default:"client_name"`
+	ScopeClaim   string `yaml:"scope_claim" env-default:"scope"`
+	SendersClaim string `yaml:"senders_claim" env-default:"allowed_senders"`
+}
+
+// RateLimitConfig protects the relay from flooding callers. Requests are
+// limited by token buckets per client and per IP, kept by each replica:
+// rates are requests per second refilling a bucket of burst requests, 0
+// disabling the limit. Quotas cap the emails a client creates per UTC day
+// and month across replicas, 0 meaning unlimited.
+type RateLimitConfig struct {
+	ClientRate   float64 `yaml:"client_rate" env-default:"10"`
+	ClientBurst  int     `yaml:"client_burst" env-default:"20"`
+	IPRate       float64 `yaml:"ip_rate" env-default:"20"`
+	IPBurst      int     `yaml:"ip_burst" env-default:"40"`
+	DailyQuota   int     `yaml:"daily_quota" env:"DAILY_QUOTA" env-default:"0"`
+	MonthlyQuota int     `yaml:"monthly_quota" env:"MONTHLY_QUOTA" env-default:"0"`
+}
+
+// ThrottleConfig limits sending per recipient domain, as large mailbox
+// providers throttle senders that burst at them. Emails over a limit are
+// queued instead of failed, and the delivery worker sends them once the
+// domain has room, checking every Interval seconds. Limits are kept per
+// replica, and require the worker: setting Domains with an Interval of 0
+// is rejected.
+type ThrottleConfig struct {
+	Interval  int `yaml:"interval" env-default:"10"`
+	BatchSize int `yaml:"batch_size" env-default:"100"`
+	// Domains maps a recipient domain, which covers its subdomains, to
+	// its limits. Other domains are not limited.
+	Domains map[string]DomainLimit `yaml:"domains"`
+}
+
+// DomainLimit caps the messages being sent to a domain at once and those
+// started within a minute; 0 means unlimited.
+type DomainLimit struct {
+	Concurrency int `yaml:"concurrency"`
+	PerMinute   int `yaml:"per_minute"`
+}
+
+// MetricsConfig exposes Prometheus metrics at Path, outside the
+// authenticated API and its rate limits. It is off unless enabled, as
+// anyone reaching the port can scrape it, and scrapes query the database.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED" env-default:"false"`
+	Path    string `yaml:"path" env-default:"/metrics"`
+}
+
+// TracingConfig exports OpenTelemetry traces. Exporter is "otlp" to send
+// spans to a collector over OTLP/HTTP, "stdout" to print them, or "none".
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	// Endpoint is the host:port of the collector; empty uses the standard
+	// OTEL_EXPORTER_OTLP_ENDPOINT variable or localhost:4318.
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_INSECURE" env-default:"true"`
+	ServiceName string  `yaml:"service_name" env-default:"notification-service"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
 }
 
 type LoggerConfig struct {
@@ -82,5 +270,10 @@ func MustLoad() *Config {
 		log.Fatalf("cannot read config: %s", err)
 	}
 
+	// Deferred emails are only sent by the delivery worker
+	if len(cfg.Throttle.Domains) > 0 && cfg.Throttle.Interval <= 0 {
+		log.Fatal("throttle_config.domains requires a positive throttle_config.interval")
+	}
+
 	return &cfg
 }
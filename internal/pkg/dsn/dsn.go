@@ -0,0 +1,221 @@
+// Package dsn parses delivery status notifications (RFC 3464), the reports
+// mail servers send back when a message is bounced, delayed or delivered.
+package dsn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// ErrNotReport is returned for messages that are not delivery status
+// notifications, such as auto replies sent to the bounce address.
+var ErrNotReport = errors.New("not a delivery status notification")
+
+// Actions reported for a recipient.
+const (
+	ActionFailed    = "failed"
+	ActionDelayed   = "delayed"
+	ActionDelivered = "delivered"
+	ActionRelayed   = "relayed"
+	ActionExpanded  = "expanded"
+)
+
+// Report is a parsed delivery status notification.
+type Report struct {
+	// Header is the header of the notification itself.
+	Header mail.Header
+	// ReportingMTA is the server that produced the notification.
+	ReportingMTA string
+	// OriginalEnvelopeID is the ENVID the message was sent with, if any.
+	OriginalEnvelopeID string
+	// OriginalMessageID is the Message-ID of the returned message, empty
+	// when the notification does not include its header.
+	OriginalMessageID string
+	Recipients        []Recipient
+}
+
+// Recipient is the outcome for one recipient of the original message.
+type Recipient struct {
+	// FinalRecipient is the address the reporting server tried to deliver
+	// to, OriginalRecipient the one the message was sent to if reported.
+	FinalRecipient    string
+	OriginalRecipient string
+	Action            string
+	// Status is the enhanced status code, such as 5.1.1.
+	Status         string
+	RemoteMTA      string
+	DiagnosticCode string
+}
+
+// Address is the address the message was originally sent to.
+func (r Recipient) Address() string {
+	if r.OriginalRecipient != "" {
+		return r.OriginalRecipient
+	}
+	return r.FinalRecipient
+}
+
+// Permanent reports whether the status is a permanent failure.
+func (r Recipient) Permanent() bool {
+	return strings.HasPrefix(r.Status, "5")
+}
+
+// SMTPCode returns the reply code of an SMTP diagnostic, or 0 when the
+// diagnostic is not an SMTP reply.
+func (r Recipient) SMTPCode() int {
+	kind, text, ok := strings.Cut(r.DiagnosticCode, ";")
+	if !ok || !strings.EqualFold(strings.TrimSpace(kind), "smtp") {
+		return 0
+	}
+
+	text = strings.TrimSpace(text)
+	if len(text) < 3 {
+		return 0
+	}
+
+	code, err := strconv.Atoi(text[:3])
+	if err != nil || code < 200 || code > 599 {
+		return 0
+	}
+
+	return code
+}
+
+// Parse reads a notification: a multipart/report message with a
+// delivery-status part, optionally followed by the returned message or
+// its header.
+func Parse(r io.Reader) (*Report, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || !isDeliveryStatus(params["report-type"]) {
+		return nil, ErrNotReport
+	}
+
+	report := &Report{Header: msg.Header}
+	found := false
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+
+	for {
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report part: %w", err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body := decodePart(part)
+
+		switch partType {
+		case "message/delivery-status", "message/global-delivery-status":
+			if err := report.parseStatus(body); err != nil {
+				return nil, err
+			}
+			found = true
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/global-headers":
+			report.OriginalMessageID = originalMessageID(body)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: no delivery-status part", ErrNotReport)
+	}
+
+	return report, nil
+}
+
+func isDeliveryStatus(reportType string) bool {
+	return strings.EqualFold(reportType, "delivery-status") || strings.EqualFold(reportType, "global-delivery-status")
+}
+
+func decodePart(part *multipart.Part) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(part.Header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, part)
+	case "quoted-printable":
+		return quotedprintable.NewReader(part)
+	default:
+		return part
+	}
+}
+
+// parseStatus reads the per-message fields followed by one block of fields
+// per recipient, blocks being separated by blank lines.
+func (r *Report) parseStatus(body io.Reader) error {
+	tp := textproto.NewReader(bufio.NewReader(body))
+
+	for block := 0; ; block++ {
+		fields, err := tp.ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read delivery status: %w", err)
+		}
+
+		if len(fields) > 0 {
+			if block == 0 {
+				r.ReportingMTA = fieldValue(fields.Get("Reporting-MTA"))
+				r.OriginalEnvelopeID = strings.TrimSpace(fields.Get("Original-Envelope-Id"))
+			} else {
+				r.Recipients = append(r.Recipients, Recipient{
+					FinalRecipient:    address(fields.Get("Final-Recipient")),
+					OriginalRecipient: address(fields.Get("Original-Recipient")),
+					Action:            strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+					Status:            statusCode(fields.Get("Status")),
+					RemoteMTA:         fieldValue(fields.Get("Remote-MTA")),
+					DiagnosticCode:    strings.TrimSpace(fields.Get("Diagnostic-Code")),
+				})
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// originalMessageID reads the Message-ID from the returned message or
+// header, which may lack the blank line ending the header.
+func originalMessageID(body io.Reader) string {
+	data, err := io.ReadAll(io.LimitReader(body, 1<<20))
+	if err != nil {
+		return ""
+	}
+
+	header, _ := textproto.NewReader(bufio.NewReader(bytes.NewReader(data))).ReadMIMEHeader()
+
+	return strings.TrimSpace(header.Get("Message-Id"))
+}
+
+// fieldValue strips the type of a typed field such as "dns; mx.example.com".
+func fieldValue(value string) string {
+	if _, v, ok := strings.Cut(value, ";"); ok {
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(value)
+}
+
+func address(value string) string {
+	return strings.Trim(fieldValue(value), "<>")
+}
+
+// statusCode drops the comment some servers append to the status.
+func statusCode(value string) string {
+	code, _, _ := strings.Cut(strings.TrimSpace(value), " ")
+	return code
+}
@@ -0,0 +1,94 @@
+package dsn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func parseFile(t *testing.T, name string) (*Report, error) {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+func TestParse_Bounce(t *testing.T) {
+	report, err := parseFile(t, "postfix-bounce.eml")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if report.ReportingMTA != "mx.example.com" {
+		t.Errorf("ReportingMTA = %q", report.ReportingMTA)
+	}
+	if report.OriginalMessageID != "<6f1c0d3e-8a51-4f4e-9a52-3c0e7c5d2b10@example.com>" {
+		t.Errorf("OriginalMessageID = %q", report.OriginalMessageID)
+	}
+	if got := report.Header.Get("Delivered-To"); got != "bounces@example.com" {
+		t.Errorf("Delivered-To = %q", got)
+	}
+
+	if len(report.Recipients) != 2 {
+		t.Fatalf("got %d recipients, want 2", len(report.Recipients))
+	}
+
+	missing, full := report.Recipients[0], report.Recipients[1]
+
+	if missing.Address() != "missing@example.org" || missing.Action != ActionFailed || missing.Status != "5.1.1" ||
+		!missing.Permanent() || missing.SMTPCode() != 550 || missing.RemoteMTA != "mx.example.org" {
+		t.Errorf("first recipient = %+v", missing)
+	}
+	if want := "smtp; 550 5.1.1 <missing@example.org>: Recipient address rejected: User unknown"; missing.DiagnosticCode != want {
+		t.Errorf("DiagnosticCode = %q, want the unfolded %q", missing.DiagnosticCode, want)
+	}
+
+	if full.Address() != "full@example.org" || full.Status != "4.2.2" || full.Permanent() || full.SMTPCode() != 452 {
+		t.Errorf("second recipient = %+v", full)
+	}
+}
+
+func TestParse_Delayed(t *testing.T) {
+	report, err := parseFile(t, "delayed.eml")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if report.OriginalEnvelopeID != "0b7e4c2a" || report.OriginalMessageID != "<0b7e4c2a-1f3d-4e5a-8b6c-9d0e1f2a3b4c@example.com>" {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.Recipients) != 1 || report.Recipients[0].Action != ActionDelayed || report.Recipients[0].SMTPCode() != 421 {
+		t.Errorf("recipients = %+v, want one delayed", report.Recipients)
+	}
+}
+
+func TestParse_NotReport(t *testing.T) {
+	if _, err := parseFile(t, "auto-reply.eml"); !errors.Is(err, ErrNotReport) {
+		t.Errorf("Parse = %v, want ErrNotReport", err)
+	}
+}
+
+func TestRecipient_SMTPCode(t *testing.T) {
+	tests := []struct {
+		diagnostic string
+		want       int
+	}{
+		{"smtp; 550 5.1.1 User unknown", 550},
+		{"SMTP;421 Try later", 421},
+		{"x-unix; delivery failed", 0},
+		{"smtp; mailbox full", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := (Recipient{DiagnosticCode: tt.diagnostic}).SMTPCode(); got != tt.want {
+			t.Errorf("SMTPCode(%q) = %d, want %d", tt.diagnostic, got, tt.want)
+		}
+	}
+}
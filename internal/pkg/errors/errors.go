@@ -3,6 +3,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
@@ -13,6 +14,16 @@ var (
 	ErrQueueOperation    = errors.New("queue operation failed")
 	ErrStorageOperation  = errors.New("storage operation failed")
 	ErrDuplicateMessage  = errors.New("duplicate message")
+	ErrAlreadyExists     = errors.New("resource already exists")
+	ErrTooLarge          = errors.New("payload too large")
+	ErrGone              = errors.New("resource is no longer available")
+	ErrAttachmentInUse   = errors.New("attachment is referenced by emails")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrConflict          = errors.New("resource was modified concurrently")
+	ErrSuppressed        = errors.New("recipients are suppressed")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrForbidden         = errors.New("forbidden")
+	ErrQuotaExceeded     = errors.New("quota exceeded")
 )
 
 type AppError struct {
@@ -35,3 +46,39 @@ func NewAppError(code, message string, err error) *AppError {
 		Err:     err,
 	}
 }
+
+// FileError reports a problem with a specific attached file.
+type FileError struct {
+	Filename string
+	Err      error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("file %q: %v", e.Filename, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+func NewFileError(filename string, err error) *FileError {
+	return &FileError{
+		Filename: filename,
+		Err:      err,
+	}
+}
+
+// QuotaError reports an exhausted send quota and when it resets.
+type QuotaError struct {
+	Period  string
+	Limit   int
+	ResetAt time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %d emails exceeded, resets at %s", e.Period, e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
@@ -0,0 +1,168 @@
+// Package metrics holds the Prometheus metrics of the service.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "notification"
+
+// collectTimeout bounds the queries run while collecting a scrape.
+const collectTimeout = 5 * time.Second
+
+// Metrics records what the service does for Prometheus. Each Metrics has its
+// own registry, so tests can create as many as they need.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	emails       *prometheus.CounterVec
+	sendDuration *prometheus.HistogramVec
+	retries      *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "emails_total",
+			Help:      "Emails by the status they reached and the provider that sent them.",
+		}, []string{"status", "provider"}),
+		sendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "email_send_duration_seconds",
+			Help:      "Time taken to hand an email to the provider, by provider and result.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"provider", "result"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "email_retries_total",
+			Help:      "Send retries by reason: throttled for sends deferred over a domain limit, queued for the retries of the delivery worker.",
+		}, []string{"reason"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.emails,
+		m.sendDuration,
+		m.retries,
+	)
+
+	return m
+}
+
+// Register adds collectors reading state kept elsewhere, such as the
+// database pool.
+func (m *Metrics) Register(cs ...prometheus.Collector) {
+	m.registry.MustRegister(cs...)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest records an HTTP request. route is the pattern that matched,
+// never the raw path, to keep the number of series bounded.
+func (m *Metrics) ObserveRequest(method, route string, code int, duration time.Duration) {
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// EmailStatus records an email reaching status.
+func (m *Metrics) EmailStatus(status, provider string) {
+	m.emails.WithLabelValues(status, provider).Inc()
+}
+
+// ObserveSend records a send through the provider.
+func (m *Metrics) ObserveSend(provider string, success bool, duration time.Duration) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+
+	m.sendDuration.WithLabelValues(provider, result).Observe(duration.Seconds())
+}
+
+// Retry records a send deferred to be tried again, or tried again.
+func (m *Metrics) Retry(reason string) {
+	m.retries.WithLabelValues(reason).Inc()
+}
+
+// QueueDepth returns a collector reporting the number of queued emails as
+// counted by count at each scrape.
+func QueueDepth(count func(ctx context.Context) (int, error)) prometheus.Collector {
+	return &gaugeCollector{
+		value: func(ctx context.Context) (float64, error) {
+			n, err := count(ctx)
+			return float64(n), err
+		},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "email_queue_depth"),
+			"Emails queued to be sent.", nil, nil,
+		),
+	}
+}
+
+// AttachmentStoredBytes returns a collector reporting the size of the
+// attachment content kept in storage as summed by sum at each scrape.
+func AttachmentStoredBytes(sum func(ctx context.Context) (int64, error)) prometheus.Collector {
+	return &gaugeCollector{
+		value: func(ctx context.Context) (float64, error) {
+			n, err := sum(ctx)
+			return float64(n), err
+		},
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "attachment_stored_bytes"),
+			"Bytes of attachment content in storage.", nil, nil,
+		),
+	}
+}
+
+// gaugeCollector reports a gauge read from elsewhere at each scrape.
+type gaugeCollector struct {
+	value func(ctx context.Context) (float64, error)
+	desc  *prometheus.Desc
+}
+
+func (c *gaugeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *gaugeCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	v, err := c.value(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, v)
+}
@@ -0,0 +1,108 @@
+// Package ratelimit implements token bucket rate limits kept in memory.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that refilled completely are
+// dropped; a missing bucket is a full one.
+const sweepInterval = time.Minute
+
+// Limiter keeps a bucket of burst tokens per key, refilled at rate tokens
+// per second. Each request takes a token.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweptAt time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Result describes a limit after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until a token is available, zero when the
+	// request was allowed.
+	RetryAfter time.Duration
+	// Window is the time an empty bucket takes to refill.
+	Window time.Duration
+}
+
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key if one is left.
+func (l *Limiter) Allow(key string) Result {
+	return l.allow(key, time.Now())
+}
+
+func (l *Limiter) allow(key string, now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.sweptAt) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.updatedAt = now
+
+	result := Result{Limit: int(l.burst), Window: l.duration(l.burst)}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = l.duration(l.burst - b.tokens)
+
+	return result
+}
+
+// refill returns the tokens of a bucket at now.
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := max(now.Sub(b.updatedAt).Seconds(), 0)
+	return min(b.tokens+elapsed*l.rate, l.burst)
+}
+
+// duration returns the time taken to refill tokens.
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.sweptAt = now
+}
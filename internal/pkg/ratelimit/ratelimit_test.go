@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(2, 3)
+	now := time.Now()
+
+	for i := range 3 {
+		result := l.allow("client", now)
+		if !result.Allowed || result.Remaining != 2-i || result.Limit != 3 {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", i, result, 2-i)
+		}
+	}
+
+	result := l.allow("client", now)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond || result.Reset != 1500*time.Millisecond {
+		t.Errorf("exhausted = %+v, want a retry after half a second", result)
+	}
+
+	// Other keys have their own bucket
+	if result := l.allow("other", now); !result.Allowed {
+		t.Errorf("other key = %+v, want allowed", result)
+	}
+
+	// Tokens refill at the rate
+	if result := l.allow("client", now.Add(500*time.Millisecond)); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after refill = %+v, want allowed with none remaining", result)
+	}
+
+	if result := l.allow("client", now.Add(time.Hour)); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("after an hour = %+v, want a full bucket", result)
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	l := New(1, 1)
+	now := time.Now()
+
+	l.allow("idle", now)
+	l.allow("busy", now.Add(sweepInterval-time.Millisecond))
+	l.allow("busy", now.Add(sweepInterval))
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("full bucket was kept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("bucket in use was dropped")
+	}
+}
@@ -0,0 +1,66 @@
+// Package seal encrypts small secrets that are stored in the database, so
+// that a copy of the database alone does not reveal them.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidSealed is returned for data that was not sealed with the key of
+// the box, or was changed since.
+var ErrInvalidSealed = errors.New("invalid sealed data")
+
+// Box seals data with AES-256-GCM under a key derived from a server secret.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func New(key string) (*Box, error) {
+	if key == "" {
+		return nil, errors.New("seal: empty key")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("seal: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("seal: %w", err)
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+// Seal returns the encrypted plaintext, prefixed with a random nonce.
+func (b *Box) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("seal: %w", err)
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open returns the plaintext of data made by Seal.
+func (b *Box) Open(sealed []byte) ([]byte, error) {
+	size := b.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, ErrInvalidSealed
+	}
+
+	plaintext, err := b.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return nil, ErrInvalidSealed
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,55 @@
+package seal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestBox(t *testing.T) {
+	box, err := New("key")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	sealed, err := box.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatalf("sealed data contains the plaintext")
+	}
+
+	opened, err := box.Open(sealed)
+	if err != nil || string(opened) != "secret" {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+
+	other, _ := New("other key")
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name   string
+		box    *Box
+		sealed []byte
+	}{
+		{"other key", other, sealed},
+		{"tampered", box, tampered},
+		{"truncated", box, sealed[:4]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.box.Open(tt.sealed); !errors.Is(err, ErrInvalidSealed) {
+				t.Errorf("Open = %v, want ErrInvalidSealed", err)
+			}
+		})
+	}
+}
+
+func TestNew_RequiresKey(t *testing.T) {
+	if _, err := New(""); err == nil {
+		t.Error("New without a key succeeded")
+	}
+}
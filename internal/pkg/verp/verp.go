@@ -0,0 +1,110 @@
+// Package verp builds and decodes VERP return paths: envelope senders like
+// bounces+<token>@example.com whose token identifies the email and the
+// recipient a bounce is about. Tokens are signed so bounces cannot be
+// forged for arbitrary emails.
+package verp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotVERP is returned for addresses not built from the base address.
+	ErrNotVERP = errors.New("not a VERP address")
+	// ErrInvalidToken is returned when the token is malformed or its
+	// signature does not match.
+	ErrInvalidToken = errors.New("invalid VERP token")
+)
+
+// The token holds the email ID, the position of the recipient and a
+// truncated signature. Lower case base32 keeps it valid in a local part and
+// immune to servers changing the case; the whole local part stays within
+// the 64 characters allowed.
+const (
+	idSize        = 16
+	positionSize  = 2
+	signatureSize = 10
+	tokenSize     = idSize + positionSize + signatureSize
+)
+
+var encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Encoder builds return paths from a base address such as
+// bounces@example.com.
+type Encoder struct {
+	local  string
+	domain string
+	key    []byte
+}
+
+func New(address, key string) (*Encoder, error) {
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || local == "" || domain == "" || strings.Contains(local, "+") {
+		return nil, fmt.Errorf("invalid VERP address %q", address)
+	}
+
+	if key == "" {
+		return nil, errors.New("VERP signing key is not set")
+	}
+
+	return &Encoder{local: local, domain: domain, key: []byte(key)}, nil
+}
+
+// Address returns the return path for the recipient at position in the
+// email's recipient list.
+func (e *Encoder) Address(emailID uuid.UUID, position int) string {
+	token := make([]byte, idSize+positionSize, tokenSize)
+	copy(token, emailID[:])
+	binary.BigEndian.PutUint16(token[idSize:], uint16(position))
+
+	token = append(token, e.sign(token)...)
+
+	return e.local + "+" + encoding.EncodeToString(token) + "@" + e.domain
+}
+
+// Decode returns the email ID and recipient position carried by a return
+// path. Angle brackets and the case of the address are ignored.
+func (e *Encoder) Decode(address string) (uuid.UUID, int, error) {
+	address = strings.ToLower(strings.Trim(strings.TrimSpace(address), "<>"))
+
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || !strings.EqualFold(domain, e.domain) {
+		return uuid.Nil, 0, ErrNotVERP
+	}
+
+	base, encoded, ok := strings.Cut(local, "+")
+	if !ok || !strings.EqualFold(base, e.local) {
+		return uuid.Nil, 0, ErrNotVERP
+	}
+
+	token, err := encoding.DecodeString(encoded)
+	if err != nil || len(token) != tokenSize {
+		return uuid.Nil, 0, ErrInvalidToken
+	}
+
+	payload, signature := token[:idSize+positionSize], token[idSize+positionSize:]
+	if !hmac.Equal(signature, e.sign(payload)) {
+		return uuid.Nil, 0, ErrInvalidToken
+	}
+
+	emailID, err := uuid.FromBytes(payload[:idSize])
+	if err != nil {
+		return uuid.Nil, 0, ErrInvalidToken
+	}
+
+	return emailID, int(binary.BigEndian.Uint16(payload[idSize:])), nil
+}
+
+func (e *Encoder) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, e.key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:signatureSize]
+}
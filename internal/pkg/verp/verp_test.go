@@ -0,0 +1,66 @@
+package verp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEncoder(t *testing.T) {
+	enc, err := New("bounces@example.com", "key")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	emailID := uuid.New()
+	address := enc.Address(emailID, 3)
+
+	local, domain, _ := strings.Cut(address, "@")
+	if !strings.HasPrefix(local, "bounces+") || len(local) > 64 || domain != "example.com" {
+		t.Fatalf("Address = %q", address)
+	}
+
+	for _, variant := range []string{address, "<" + strings.ToUpper(address) + ">"} {
+		id, position, err := enc.Decode(variant)
+		if err != nil || id != emailID || position != 3 {
+			t.Errorf("Decode(%q) = %s, %d, %v", variant, id, position, err)
+		}
+	}
+
+	other, _ := New("bounces@example.com", "other key")
+	tampered := []byte(address)
+	tampered[len("bounces+")] ^= 1
+
+	tests := []struct {
+		name    string
+		address string
+		want    error
+	}{
+		{"other domain", local + "@example.org", ErrNotVERP},
+		{"plain address", "bounces@example.com", ErrNotVERP},
+		{"other local part", strings.Replace(address, "bounces+", "replies+", 1), ErrNotVERP},
+		{"tampered token", string(tampered), ErrInvalidToken},
+		{"short token", "bounces+abc@example.com", ErrInvalidToken},
+		{"other key", other.Address(emailID, 3), ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := enc.Decode(tt.address); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Decode = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, address := range []string{"", "bounces", "bounces+x@example.com", "@example.com"} {
+		if _, err := New(address, "key"); err == nil {
+			t.Errorf("New(%q) succeeded", address)
+		}
+	}
+
+	if _, err := New("bounces@example.com", ""); err == nil {
+		t.Error("New without a key succeeded")
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/dto"
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// APIKeyHandler manages the keys of client services. Its routes require the
+// admin scope.
+type APIKeyHandler struct {
+	manageAPIKeysUC *usecase.ManageAPIKeysUseCase
+	validator       *validator.Validate
+	logger          *logger.Logger
+}
+
+func NewAPIKeyHandler(manageAPIKeysUC *usecase.ManageAPIKeysUseCase, logger *logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		manageAPIKeysUC: manageAPIKeysUC,
+		validator:       validator.New(),
+		logger:          logger,
+	}
+}
+
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	var req dto.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "validation failed", err)
+		return
+	}
+
+	apiKey, key, err := h.manageAPIKeysUC.Create(r.Context(), usecase.APIKeyInput{
+		Name:             req.Name,
+		Scopes:           req.Scopes,
+		AllowedSenders:   req.AllowedSenders,
+		AllowedTemplates: req.AllowedTemplates,
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidInput) {
+			respondError(h.logger, w, http.StatusBadRequest, "invalid API key", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to create API key", err)
+		return
+	}
+
+	resp := buildAPIKeyResponse(apiKey)
+	resp.Key = key
+
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	keys, err := h.manageAPIKeysUC.List(r.Context())
+	if err != nil {
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to list API keys", err)
+		return
+	}
+
+	resp := dto.APIKeyListResponse{Keys: make([]dto.APIKeyResponse, 0, len(keys))}
+	for i := range keys {
+		resp.Keys = append(resp.Keys, *buildAPIKeyResponse(&keys[i]))
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid API key ID", err)
+		return
+	}
+
+	apiKey, err := h.manageAPIKeysUC.Revoke(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			respondError(h.logger, w, http.StatusNotFound, "API key not found", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to revoke API key", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, buildAPIKeyResponse(apiKey))
+}
+
+func buildAPIKeyResponse(k *entity.APIKey) *dto.APIKeyResponse {
+	resp := &dto.APIKeyResponse{
+		ID:               k.ID.String(),
+		Name:             k.Name,
+		Prefix:           k.Prefix,
+		Scopes:           make([]string, len(k.Scopes)),
+		AllowedSenders:   k.AllowedSenders,
+		AllowedTemplates: k.AllowedTemplates,
+		CreatedAt:        k.CreatedAt.Format(time.RFC3339),
+	}
+
+	for i, scope := range k.Scopes {
+		resp.Scopes[i] = string(scope)
+	}
+
+	if k.LastUsedAt != nil {
+		lastUsedAt := k.LastUsedAt.Format(time.RFC3339)
+		resp.LastUsedAt = &lastUsedAt
+	}
+
+	if k.RevokedAt != nil {
+		revokedAt := k.RevokedAt.Format(time.RFC3339)
+		resp.RevokedAt = &revokedAt
+	}
+
+	return resp
+}
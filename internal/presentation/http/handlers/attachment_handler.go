@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type AttachmentHandler struct {
+	uploadAttachmentUC   *usecase.UploadAttachmentUseCase
+	deleteAttachmentUC   *usecase.DeleteAttachmentUseCase
+	downloadAttachmentUC *usecase.DownloadAttachmentUseCase
+	links                *usecase.AttachmentLinks
+	storageCfg           config.StorageConfig
+	logger               *logger.Logger
+}
+
+func NewAttachmentHandler(
+	uploadAttachmentUC *usecase.UploadAttachmentUseCase,
+	deleteAttachmentUC *usecase.DeleteAttachmentUseCase,
+	downloadAttachmentUC *usecase.DownloadAttachmentUseCase,
+	links *usecase.AttachmentLinks,
+	storageCfg config.StorageConfig,
+	logger *logger.Logger,
+) *AttachmentHandler {
+	return &AttachmentHandler{
+		uploadAttachmentUC:   uploadAttachmentUC,
+		deleteAttachmentUC:   deleteAttachmentUC,
+		downloadAttachmentUC: downloadAttachmentUC,
+		links:                links,
+		storageCfg:           storageCfg,
+		logger:               logger,
+	}
+}
+
+type UploadAttachmentResponse struct {
+	ID        string `json:"id"`
+	Filename  string `json:"filename"`
+	Mimetype  string `json:"mimetype"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Upload stores the "file" form field and returns an attachment ID that
+// send requests can reference via attachmentIds.
+func (h *AttachmentHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	form, err := readMultipartForm(w, r, h.uploadAttachmentUC, h.storageCfg.MaxRequestSize, "file")
+	if err != nil {
+		respondError(h.logger, w, uploadErrorStatus(err), "failed to save file", err)
+		return
+	}
+
+	files := form.Files["file"]
+	if len(files) != 1 {
+		form.discard(r.Context())
+		respondError(h.logger, w, http.StatusBadRequest, "missing file", errors.New("exactly one \"file\" field is required"))
+		return
+	}
+
+	attachment := files[0].Attachment
+
+	respondJSON(w, http.StatusCreated, h.buildResponse(attachment))
+}
+
+func (h *AttachmentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid attachment ID", err)
+		return
+	}
+
+	if err := h.deleteAttachmentUC.Execute(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrNotFound):
+			respondError(h.logger, w, http.StatusNotFound, "attachment not found", err)
+		case errors.Is(err, apperrors.ErrAttachmentInUse):
+			respondError(h.logger, w, http.StatusConflict, "attachment is in use", err)
+		default:
+			respondError(h.logger, w, http.StatusInternalServerError, "failed to delete attachment", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Download streams an attachment of an email. Requests carrying a valid
+// signed link are served without the secret key.
+func (h *AttachmentHandler) Download(w http.ResponseWriter, r *http.Request) {
+	emailID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid email ID", err)
+		return
+	}
+
+	attachmentID, err := uuid.Parse(chi.URLParam(r, "attachmentId"))
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid attachment ID", err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	if sig := query.Get("signature"); sig != "" {
+		if err := h.links.Verify(emailID, attachmentID, query.Get("expires"), sig); err != nil {
+			respondError(h.logger, w, http.StatusForbidden, "invalid download link", err)
+			return
+		}
+	} else if client := usecase.ClientFromContext(r.Context()); client == nil {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	} else if !client.HasScope(entity.ScopeEmailsRead) {
+		respondError(h.logger, w, http.StatusForbidden, "insufficient scope",
+			fmt.Errorf("client %s lacks the %s scope", client.Name, entity.ScopeEmailsRead))
+		return
+	}
+
+	attachment, content, err := h.downloadAttachmentUC.Execute(r.Context(), emailID, attachmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrNotFound):
+			respondError(h.logger, w, http.StatusNotFound, "attachment not found", err)
+		case errors.Is(err, apperrors.ErrGone):
+			respondError(h.logger, w, http.StatusGone, "attachment content was deleted", err)
+		case errors.Is(err, apperrors.ErrForbidden):
+			respondError(h.logger, w, http.StatusForbidden, "access denied", err)
+		default:
+			respondError(h.logger, w, http.StatusInternalServerError, "failed to open attachment", err)
+		}
+		return
+	}
+	defer content.Close()
+
+	contentType := attachment.Mimetype
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": attachment.OriginalName,
+	}))
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		h.logger.Warn("Attachment download interrupted", zap.Any("attachment_id", attachmentID), zap.String("error", err.Error()))
+	}
+}
+
+func (h *AttachmentHandler) buildResponse(attachment *entity.Attachment) *UploadAttachmentResponse {
+	return &UploadAttachmentResponse{
+		ID:        attachment.ID.String(),
+		Filename:  attachment.OriginalName,
+		Mimetype:  attachment.Mimetype,
+		Size:      attachment.Size,
+		Hash:      attachment.Hash,
+		CreatedAt: attachment.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -3,58 +3,68 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/an3wers/notification-serv/internal/application/dto"
 	"github.com/an3wers/notification-serv/internal/application/usecase"
 	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
 	"github.com/an3wers/notification-serv/internal/pkg/config"
 	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
 	"github.com/an3wers/notification-serv/internal/pkg/logger"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"go.uber.org/zap"
 )
 
 type EmailHandler struct {
-	sendEmailUC      *usecase.SendEmailUseCase
-	getEmailStatusUC *usecase.GetEmailStatusUseCase
-	validator        *validator.Validate
-	storageCfg       config.StorageConfig
-	serverCfg        config.ServerConfig
-	logger           *logger.Logger
+	sendEmailUC        *usecase.SendEmailUseCase
+	getEmailStatusUC   *usecase.GetEmailStatusUseCase
+	uploadAttachmentUC *usecase.UploadAttachmentUseCase
+	deleteEmailUC      *usecase.DeleteEmailUseCase
+	getEmailEventsUC   *usecase.GetEmailEventsUseCase
+	cancelEmailUC      *usecase.CancelEmailUseCase
+	listEmailsUC       *usecase.ListEmailsUseCase
+	validator          *validator.Validate
+	storageCfg         config.StorageConfig
+	logger             *logger.Logger
 }
 
 func NewEmailHandler(
 	sendEmailUC *usecase.SendEmailUseCase,
 	getEmailStatusUC *usecase.GetEmailStatusUseCase,
+	uploadAttachmentUC *usecase.UploadAttachmentUseCase,
+	deleteEmailUC *usecase.DeleteEmailUseCase,
+	getEmailEventsUC *usecase.GetEmailEventsUseCase,
+	cancelEmailUC *usecase.CancelEmailUseCase,
+	listEmailsUC *usecase.ListEmailsUseCase,
 	storageCfg config.StorageConfig,
-	serverCfg config.ServerConfig,
 	logger *logger.Logger,
 ) *EmailHandler {
 	return &EmailHandler{
-		sendEmailUC:      sendEmailUC,
-		getEmailStatusUC: getEmailStatusUC,
-		validator:        validator.New(),
-		storageCfg:       storageCfg,
-		serverCfg:        serverCfg,
-		logger:           logger,
+		sendEmailUC:        sendEmailUC,
+		getEmailStatusUC:   getEmailStatusUC,
+		uploadAttachmentUC: uploadAttachmentUC,
+		deleteEmailUC:      deleteEmailUC,
+		getEmailEventsUC:   getEmailEventsUC,
+		cancelEmailUC:      cancelEmailUC,
+		listEmailsUC:       listEmailsUC,
+		validator:          validator.New(),
+		storageCfg:         storageCfg,
+		logger:             logger,
 	}
 }
 
 func (h *EmailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	isValidKey := h.checkSecretKey(r)
-
-	if !isValidKey {
-		h.respondError(w, http.StatusUnauthorized, "invalid secret key", errors.New("invalid secret key"))
+	if !authenticated(r) {
+		h.respondError(w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
 		return
 	}
 
@@ -63,6 +73,7 @@ func (h *EmailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
 
 	// normalize request
 	var normalizedReq dto.SendEmailNormalizedRequest
+	var form *multipartForm
 
 	// Parse JSON from form field or directly from body
 	contentType := r.Header.Get("Content-Type")
@@ -78,73 +89,40 @@ func (h *EmailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
 		normalizedReq = *data
 
 	} else {
-		// Parse multipart form
-		if err := r.ParseMultipartForm(h.storageCfg.MaxFileSize); err != nil {
-			h.respondError(w, http.StatusBadRequest, "failed to parse form", err)
+		// Stream multipart form, storing files as they arrive
+		data, err := readMultipartForm(w, r, h.uploadAttachmentUC, h.storageCfg.MaxRequestSize, "files")
+		if err != nil {
+			h.respondError(w, uploadErrorStatus(err), "failed to read form", err)
 			return
 		}
 
-		data, err := h.normalizeRequestFromFormData(r)
+		form = data
+
+		normalized, err := h.normalizeRequestFromFormData(form.Values)
 		if err != nil {
+			form.discard(ctx)
 			h.respondError(w, http.StatusBadRequest, "invalid request body", err)
 			return
 		}
 
-		normalizedReq = *data
+		normalizedReq = *normalized
 	}
 
 	// Validate normalized request
 	if err := h.validator.Struct(normalizedReq); err != nil {
+		form.discard(ctx)
 		h.respondError(w, http.StatusBadRequest, "validation failed", err)
 		return
 	}
 
-	// Handle file uploads
+	// Uploaded files
 	var attachments []dto.AttachmentDTO
 
-	if r.MultipartForm != nil && r.MultipartForm.File != nil {
-		files := r.MultipartForm.File["files"]
-
-		for _, fileHeader := range files {
-			file, err := fileHeader.Open()
-			if err != nil {
-				h.respondError(w, http.StatusBadRequest, "failed to open file", err)
-				return
-			}
-
-			defer file.Close()
-
-			// Generate unique filename
-			filename := uuid.New().String() + filepath.Ext(fileHeader.Filename)
-			filepath := filepath.Join(h.storageCfg.LocalPath, filename)
-
-			// Ensure upload directory exists
-			if err := os.MkdirAll(h.storageCfg.LocalPath, 0755); err != nil {
-				h.respondError(w, http.StatusInternalServerError, "failed to create upload directory", err)
-				return
-			}
-
-			// Save file
-			dst, err := os.Create(filepath)
-
-			if err != nil {
-				h.respondError(w, http.StatusInternalServerError, "failed to create file", err)
-				return
-			}
-
-			defer dst.Close()
-
-			if _, err := io.Copy(dst, file); err != nil {
-				h.respondError(w, http.StatusInternalServerError, "failed to save file", err)
-				return
-			}
-
+	if form != nil {
+		for _, file := range form.Files["files"] {
 			attachments = append(attachments, dto.AttachmentDTO{
-				Filename:     filename,
-				OriginalName: fileHeader.Filename,
-				Mimetype:     fileHeader.Header.Get("Content-Type"),
-				Size:         fileHeader.Size,
-				Path:         filepath,
+				ID:           file.Attachment.ID.String(),
+				OriginalName: file.Filename,
 			})
 		}
 	}
@@ -153,12 +131,38 @@ func (h *EmailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
 	email, err := h.sendEmailUC.Execute(ctx, &normalizedReq, attachments)
 
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "failed to send email", err)
+		// Email was not stored, so nothing references the uploads
+		if email == nil {
+			form.discard(ctx)
+		}
+
+		switch {
+		case errors.Is(err, apperrors.ErrInvalidInput):
+			h.respondError(w, http.StatusBadRequest, "invalid request", err)
+		case errors.Is(err, apperrors.ErrTooLarge):
+			h.respondError(w, http.StatusRequestEntityTooLarge, "attachments too large", err)
+		case errors.Is(err, apperrors.ErrSuppressed):
+			h.respondError(w, http.StatusUnprocessableEntity, "recipients suppressed", err)
+		case errors.Is(err, apperrors.ErrForbidden):
+			h.respondError(w, http.StatusForbidden, "sending not allowed", err)
+		case errors.Is(err, apperrors.ErrQuotaExceeded):
+			h.respondError(w, http.StatusTooManyRequests, "quota exceeded", err)
+		case errors.Is(err, apperrors.ErrConflict):
+			h.respondError(w, http.StatusConflict, "email changed while sending", err)
+		default:
+			h.respondError(w, http.StatusInternalServerError, "failed to send email", err)
+		}
 		return
 	}
 
-	// Build response
+	// Build response; deferred emails are accepted but not sent yet
 	response := h.buildEmailResponse(email)
+
+	if email.Status == entity.StatusQueued {
+		h.respondJSON(w, http.StatusAccepted, response)
+		return
+	}
+
 	h.respondJSON(w, http.StatusCreated, response)
 }
 
@@ -178,6 +182,10 @@ func (h *EmailHandler) GetEmailStatus(w http.ResponseWriter, r *http.Request) {
 			h.respondError(w, http.StatusNotFound, "email not found", err)
 			return
 		}
+		if errors.Is(err, apperrors.ErrForbidden) {
+			h.respondError(w, http.StatusForbidden, "access denied", err)
+			return
+		}
 		h.respondError(w, http.StatusInternalServerError, "failed to get email", err)
 		return
 	}
@@ -186,14 +194,230 @@ func (h *EmailHandler) GetEmailStatus(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, response)
 }
 
+func (h *EmailHandler) GetEmailEvents(w http.ResponseWriter, r *http.Request) {
+	emailID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "invalid email ID", err)
+		return
+	}
+
+	events, err := h.getEmailEventsUC.Execute(r.Context(), emailID)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			h.respondError(w, http.StatusNotFound, "email not found", err)
+			return
+		}
+		if errors.Is(err, apperrors.ErrForbidden) {
+			h.respondError(w, http.StatusForbidden, "access denied", err)
+			return
+		}
+		h.respondError(w, http.StatusInternalServerError, "failed to get email events", err)
+		return
+	}
+
+	response := &dto.EmailTimelineResponse{
+		EmailID: emailID.String(),
+		Events:  make([]dto.EmailEventResponse, 0, len(events)),
+	}
+
+	for _, event := range events {
+		item := dto.EmailEventResponse{
+			ID:        event.ID.String(),
+			Status:    string(event.ToStatus),
+			Actor:     string(event.Actor),
+			Provider:  event.Provider,
+			Detail:    event.Detail,
+			CreatedAt: event.CreatedAt.Format(time.RFC3339Nano),
+		}
+
+		if event.FromStatus != nil {
+			from := string(*event.FromStatus)
+			item.FromStatus = &from
+		}
+
+		response.Events = append(response.Events, item)
+	}
+
+	h.respondJSON(w, http.StatusOK, response)
+}
+
+func (h *EmailHandler) DeleteEmail(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		h.respondError(w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	emailID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "invalid email ID", err)
+		return
+	}
+
+	if err := h.deleteEmailUC.Execute(r.Context(), emailID); err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			h.respondError(w, http.StatusNotFound, "email not found", err)
+			return
+		}
+		if errors.Is(err, apperrors.ErrForbidden) {
+			h.respondError(w, http.StatusForbidden, "access denied", err)
+			return
+		}
+		h.respondError(w, http.StatusInternalServerError, "failed to delete email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CancelEmail stops an email that was not sent yet.
+func (h *EmailHandler) CancelEmail(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		h.respondError(w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	emailID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "invalid email ID", err)
+		return
+	}
+
+	// The reason is optional, so is the body
+	var req dto.CancelEmailRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.respondError(w, http.StatusBadRequest, "invalid request body", err)
+			return
+		}
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "validation failed", err)
+		return
+	}
+
+	email, err := h.cancelEmailUC.Execute(r.Context(), emailID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrNotFound):
+			h.respondError(w, http.StatusNotFound, "email not found", err)
+		case errors.Is(err, apperrors.ErrInvalidTransition):
+			h.respondError(w, http.StatusConflict, "email cannot be cancelled", err)
+		case errors.Is(err, apperrors.ErrConflict):
+			h.respondError(w, http.StatusConflict, "email was modified concurrently, retry", err)
+		case errors.Is(err, apperrors.ErrForbidden):
+			h.respondError(w, http.StatusForbidden, "access denied", err)
+		default:
+			h.respondError(w, http.StatusInternalServerError, "failed to cancel email", err)
+		}
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, h.buildEmailResponse(email))
+}
+
+// ListEmails lists emails newest first. status takes a comma separated list
+// of statuses, before pages using the nextBefore of the previous page.
+func (h *EmailHandler) ListEmails(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		h.respondError(w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	filter, err := parseEmailFilter(r.URL.Query())
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "invalid query", err)
+		return
+	}
+
+	page, err := h.listEmailsUC.Execute(r.Context(), *filter)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidInput) {
+			h.respondError(w, http.StatusBadRequest, "invalid query", err)
+			return
+		}
+		h.respondError(w, http.StatusInternalServerError, "failed to list emails", err)
+		return
+	}
+
+	response := &dto.EmailListResponse{
+		Emails: make([]dto.EmailResponse, 0, len(page.Emails)),
+	}
+
+	for i := range page.Emails {
+		response.Emails = append(response.Emails, *h.buildEmailResponse(&page.Emails[i]))
+	}
+
+	if page.NextBefore != nil {
+		next := page.NextBefore.Format(time.RFC3339Nano)
+		if page.NextBeforeID != nil {
+			next += "," + page.NextBeforeID.String()
+		}
+		response.NextBefore = &next
+	}
+
+	h.respondJSON(w, http.StatusOK, response)
+}
+
+func parseEmailFilter(query url.Values) (*repository.EmailFilter, error) {
+	var filter repository.EmailFilter
+
+	for _, value := range query["status"] {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) == "" {
+				continue
+			}
+
+			status, err := entity.ParseEmailStatus(name)
+			if err != nil {
+				return nil, err
+			}
+
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	// A time, or the time and ID of the last email of the previous page
+	if value := query.Get("before"); value != "" {
+		timestamp, rawID, hasID := strings.Cut(value, ",")
+
+		before, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("%w: before must be an RFC 3339 time", apperrors.ErrInvalidInput)
+		}
+		filter.Before = &before
+
+		if hasID {
+			id, err := uuid.Parse(rawID)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid email ID in before", apperrors.ErrInvalidInput)
+			}
+			filter.BeforeID = &id
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: limit must be a number", apperrors.ErrInvalidInput)
+		}
+		filter.Limit = limit
+	}
+
+	return &filter, nil
+}
+
 func (h *EmailHandler) buildEmailResponse(email *entity.Email) *dto.EmailResponse {
 	resp := &dto.EmailResponse{
-		ID:        email.ID.String(),
-		Status:    string(email.Status),
-		To:        email.To,
-		Subject:   email.Subject,
-		CreatedAt: email.CreatedAt.Format(time.RFC3339),
-		Error:     email.Error,
+		ID:              email.ID.String(),
+		Status:          string(email.Status),
+		To:              email.To,
+		Subject:         email.Subject,
+		Category:        email.Category,
+		ListUnsubscribe: email.ListUnsubscribe,
+		ClientID:        email.ClientID,
+		CreatedAt:       email.CreatedAt.Format(time.RFC3339),
+		Error:           email.Error,
 	}
 
 	if email.SentAt != nil {
@@ -201,11 +425,45 @@ func (h *EmailHandler) buildEmailResponse(email *entity.Email) *dto.EmailRespons
 		resp.SentAt = &sentAt
 	}
 
-	return resp
-}
+	if email.SendAfter != nil {
+		sendAfter := email.SendAfter.Format(time.RFC3339)
+		resp.SendAfter = &sendAfter
+	}
+
+	if email.RedactedAt != nil {
+		redactedAt := email.RedactedAt.Format(time.RFC3339)
+		resp.RedactedAt = &redactedAt
+	}
+
+	if email.PurgedAt != nil {
+		purgedAt := email.PurgedAt.Format(time.RFC3339)
+		resp.PurgedAt = &purgedAt
+	}
+
+	for _, att := range email.Attachments {
+		resp.Attachments = append(resp.Attachments, dto.AttachmentResponse{
+			ID:        att.ID.String(),
+			Filename:  att.OriginalName,
+			Mimetype:  att.Mimetype,
+			Size:      att.Size,
+			URL:       att.URL,
+			Offloaded: att.Offloaded,
+			Purged:    att.PurgedAt != nil,
+		})
+	}
+
+	for _, rcpt := range email.Recipients {
+		resp.Recipients = append(resp.Recipients, dto.RecipientResponse{
+			Address:   rcpt.Address,
+			Kind:      string(rcpt.Kind),
+			Status:    string(rcpt.Status),
+			SMTPCode:  rcpt.SMTPCode,
+			Response:  rcpt.Response,
+			UpdatedAt: rcpt.UpdatedAt.Format(time.RFC3339),
+		})
+	}
 
-func (h *EmailHandler) checkSecretKey(r *http.Request) bool {
-	return r.Header.Get("ssy") == h.serverCfg.SecretKey
+	return resp
 }
 
 func (h *EmailHandler) normalizeRequestFromJson(r *http.Request) (*dto.SendEmailNormalizedRequest, error) {
@@ -223,16 +481,21 @@ func (h *EmailHandler) normalizeRequestFromJson(r *http.Request) (*dto.SendEmail
 	bcc := h.parseEmailList(req.BCC)
 
 	normalized := &dto.SendEmailNormalizedRequest{
-		To:          to,
-		From:        nil,
-		DisplayName: nil,
-		CC:          cc,
-		BCC:         bcc,
-		Subject:     nil,
-		Body:        nil,
-		HTML:        req.HTML,
+		To:              to,
+		From:            nil,
+		DisplayName:     nil,
+		CC:              cc,
+		BCC:             bcc,
+		Subject:         nil,
+		Body:            nil,
+		HTML:            req.HTML,
+		AttachmentIDs:   req.AttachmentIDs,
+		ListUnsubscribe: req.ListUnsubscribe,
 	}
 
+	if req.Category != "" {
+		normalized.Category = &req.Category
+	}
 	if req.FromEmail != "" {
 		normalized.From = &req.FromEmail
 	}
@@ -253,11 +516,11 @@ func (h *EmailHandler) normalizeRequestFromJson(r *http.Request) (*dto.SendEmail
 	return normalized, nil
 }
 
-func (h *EmailHandler) normalizeRequestFromFormData(r *http.Request) (*dto.SendEmailNormalizedRequest, error) {
+func (h *EmailHandler) normalizeRequestFromFormData(form map[string][]string) (*dto.SendEmailNormalizedRequest, error) {
 
 	// Helper for getting string slice (required or optional)
 	getStrings := func(key string, required bool) ([]string, error) {
-		values := r.MultipartForm.Value[key]
+		values := form[key]
 		if required && (len(values) == 0 || (len(values) == 1 && values[0] == "")) {
 			return nil, errors.New("missing required field: " + key)
 		}
@@ -275,7 +538,7 @@ func (h *EmailHandler) normalizeRequestFromFormData(r *http.Request) (*dto.SendE
 	}
 
 	getStringPtr := func(key string) *string {
-		if vals, ok := r.MultipartForm.Value[key]; ok && len(vals) > 0 && vals[0] != "" {
+		if vals, ok := form[key]; ok && len(vals) > 0 && vals[0] != "" {
 			return &vals[0]
 		}
 		return nil
@@ -318,22 +581,34 @@ func (h *EmailHandler) normalizeRequestFromFormData(r *http.Request) (*dto.SendE
 
 	html := getStringPtr("html")
 
+	attachmentIDs, _ := getStrings("attachmentIds", false)
+
+	var listUnsubscribe bool
+	if value := getStringPtr("listUnsubscribe"); value != nil {
+		parsed, err := strconv.ParseBool(*value)
+		if err != nil {
+			return nil, errors.New("invalid field: listUnsubscribe")
+		}
+		listUnsubscribe = parsed
+	}
+
 	return &dto.SendEmailNormalizedRequest{
-		To:          to,
-		From:        from,
-		DisplayName: displayName,
-		CC:          cc,
-		BCC:         bcc,
-		Subject:     subject,
-		Body:        body,
-		HTML:        html,
+		To:              to,
+		From:            from,
+		DisplayName:     displayName,
+		CC:              cc,
+		BCC:             bcc,
+		Subject:         subject,
+		Body:            body,
+		HTML:            html,
+		AttachmentIDs:   attachmentIDs,
+		Category:        getStringPtr("category"),
+		ListUnsubscribe: listUnsubscribe,
 	}, nil
 }
 
 func (h *EmailHandler) respondJSON(w http.ResponseWriter, status int, data any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+	respondJSON(w, status, data)
 }
 
 func (h *EmailHandler) parseEmailList(emails []string) []string {
@@ -356,12 +631,5 @@ func (h *EmailHandler) parseEmailList(emails []string) []string {
 }
 
 func (h *EmailHandler) respondError(w http.ResponseWriter, status int, message string, err error) {
-	h.logger.Error(message, zap.String("error", err.Error()))
-
-	errorResponse := map[string]any{
-		"error":   message,
-		"details": err.Error(),
-	}
-
-	h.respondJSON(w, status, errorResponse)
+	respondError(h.logger, w, status, message, err)
 }
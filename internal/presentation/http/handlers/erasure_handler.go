@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/dto"
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type ErasureHandler struct {
+	eraseAddressUC *usecase.EraseAddressUseCase
+	validator      *validator.Validate
+	logger         *logger.Logger
+}
+
+func NewErasureHandler(
+	eraseAddressUC *usecase.EraseAddressUseCase,
+	logger *logger.Logger,
+) *ErasureHandler {
+	return &ErasureHandler{
+		eraseAddressUC: eraseAddressUC,
+		validator:      validator.New(),
+		logger:         logger,
+	}
+}
+
+// Erase removes an address from all stored emails and returns a report of
+// the affected records.
+func (h *ErasureHandler) Erase(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	var req dto.EraseAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "validation failed", err)
+		return
+	}
+
+	report, err := h.eraseAddressUC.Execute(r.Context(), req.Address)
+	if err != nil {
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to erase address", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.buildResponse(report))
+}
+
+func (h *ErasureHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid erasure ID", err)
+		return
+	}
+
+	report, err := h.eraseAddressUC.GetReport(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			respondError(h.logger, w, http.StatusNotFound, "erasure not found", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to get erasure", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, h.buildResponse(report))
+}
+
+func (h *ErasureHandler) buildResponse(report *entity.ErasureReport) *dto.ErasureReportResponse {
+	resp := &dto.ErasureReportResponse{
+		ID:                 report.ID.String(),
+		AddressHash:        report.AddressHash,
+		EmailsAffected:     len(report.EmailIDs),
+		EmailIDs:           make([]string, 0, len(report.EmailIDs)),
+		AttachmentsDeleted: len(report.AttachmentIDs),
+		AttachmentIDs:      make([]string, 0, len(report.AttachmentIDs)),
+		CreatedAt:          report.CreatedAt.Format(time.RFC3339),
+	}
+
+	for _, id := range report.EmailIDs {
+		resp.EmailIDs = append(resp.EmailIDs, id.String())
+	}
+
+	for _, id := range report.AttachmentIDs {
+		resp.AttachmentIDs = append(resp.AttachmentIDs, id.String())
+	}
+
+	return resp
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+)
+
+// maxFormValuesSize caps the fields of a multipart request that are not
+// files, which are held in memory whatever the request size limit, as
+// mime/multipart does for parsed forms.
+const maxFormValuesSize = 10 << 20
+
+// multipartForm holds the fields of a streamed multipart request and the
+// attachments stored from its file parts, keyed by form field name.
+type multipartForm struct {
+	Values map[string][]string
+	Files  map[string][]uploadedFile
+	batch  *usecase.UploadBatch
+}
+
+type uploadedFile struct {
+	Filename   string
+	Attachment *entity.Attachment
+}
+
+// readMultipartForm consumes the request body part by part. File parts are
+// streamed straight into storage instead of being buffered in memory or temp
+// files; only those of fileField are accepted. If reading fails, attachments
+// created so far are discarded.
+func readMultipartForm(
+	w http.ResponseWriter,
+	r *http.Request,
+	uploadUC *usecase.UploadAttachmentUseCase,
+	maxRequestSize int64,
+	fileField string,
+) (*multipartForm, error) {
+	ctx := r.Context()
+
+	if maxRequestSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidInput, err)
+	}
+
+	form := &multipartForm{
+		Values: make(map[string][]string),
+		Files:  make(map[string][]uploadedFile),
+		batch:  uploadUC.NewBatch(),
+	}
+
+	remaining := int64(maxFormValuesSize)
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			form.discard(ctx)
+			return nil, wrapFormError(err)
+		}
+
+		name := part.FormName()
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, remaining+1))
+			part.Close()
+			if err != nil {
+				form.discard(ctx)
+				return nil, wrapFormError(err)
+			}
+
+			remaining -= int64(len(value))
+			if remaining < 0 {
+				form.discard(ctx)
+				return nil, fmt.Errorf("%w: form fields exceed %d bytes", apperrors.ErrTooLarge, maxFormValuesSize)
+			}
+
+			form.Values[name] = append(form.Values[name], string(value))
+			continue
+		}
+
+		// Files under other names would be stored and never used
+		if name != fileField {
+			part.Close()
+			form.discard(ctx)
+			return nil, fmt.Errorf("%w: unexpected file field %q, files go in %q", apperrors.ErrInvalidInput, name, fileField)
+		}
+
+		attachment, err := form.batch.Upload(ctx, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			form.discard(ctx)
+			return nil, err
+		}
+
+		form.Files[name] = append(form.Files[name], uploadedFile{
+			Filename:   usecase.SanitizeFilename(part.FileName()),
+			Attachment: attachment,
+		})
+	}
+
+	return form, nil
+}
+
+// discard removes the attachments this request created.
+func (f *multipartForm) discard(ctx context.Context) {
+	if f == nil {
+		return
+	}
+
+	// The request context may already be cancelled
+	f.batch.Discard(context.WithoutCancel(ctx))
+}
+
+func wrapFormError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %v", apperrors.ErrInvalidInput, err)
+}
+
+// uploadErrorStatus maps an error from reading an upload to a response status.
+func uploadErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr), errors.Is(err, apperrors.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, apperrors.ErrInvalidInput):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
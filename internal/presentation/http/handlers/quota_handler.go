@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/dto"
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+)
+
+type QuotaHandler struct {
+	quotaUC *usecase.QuotaUseCase
+	logger  *logger.Logger
+}
+
+func NewQuotaHandler(quotaUC *usecase.QuotaUseCase, logger *logger.Logger) *QuotaHandler {
+	return &QuotaHandler{
+		quotaUC: quotaUC,
+		logger:  logger,
+	}
+}
+
+// Usage reports the quota usage of the client, or of the client in the
+// clientId parameter for admins.
+func (h *QuotaHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	clientID := r.URL.Query().Get("clientId")
+	if clientID == "" {
+		clientID = usecase.ClientFromContext(r.Context()).ID
+	}
+
+	usage, err := h.quotaUC.Usage(r.Context(), clientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrInvalidInput):
+			respondError(h.logger, w, http.StatusBadRequest, "invalid request", err)
+		case errors.Is(err, apperrors.ErrForbidden):
+			respondError(h.logger, w, http.StatusForbidden, "access denied", err)
+		default:
+			respondError(h.logger, w, http.StatusInternalServerError, "failed to get quota usage", err)
+		}
+		return
+	}
+
+	response := dto.QuotaResponse{
+		ClientID: clientID,
+		Quotas:   make([]dto.QuotaUsageResponse, 0, len(usage)),
+	}
+
+	for _, u := range usage {
+		quota := dto.QuotaUsageResponse{
+			Period:   string(u.Period),
+			Used:     u.Used,
+			ResetsAt: u.End.Format(time.RFC3339),
+		}
+
+		if u.Limit > 0 {
+			limit, remaining := u.Limit, u.Remaining()
+			quota.Limit = &limit
+			quota.Remaining = &remaining
+		}
+
+		response.Quotas = append(response.Quotas, quota)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
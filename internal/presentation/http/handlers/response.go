@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+func respondJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func respondError(log *logger.Logger, w http.ResponseWriter, status int, message string, err error) {
+	log.Error(message, zap.String("error", err.Error()))
+
+	errorResponse := map[string]any{
+		"error":   message,
+		"details": err.Error(),
+	}
+
+	// Name the offending attachment so clients can point at it
+	var fileErr *apperrors.FileError
+	if errors.As(err, &fileErr) {
+		errorResponse["file"] = fileErr.Filename
+	}
+
+	// Tell clients when their quota resets
+	var quotaErr *apperrors.QuotaError
+	if errors.As(err, &quotaErr) {
+		errorResponse["quota"] = quotaErr.Period
+		errorResponse["resetsAt"] = quotaErr.ResetAt.Format(time.RFC3339)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(quotaErr.ResetAt).Seconds()))))
+	}
+
+	respondJSON(w, status, errorResponse)
+}
+
+// authenticated reports whether the Authenticate middleware identified the
+// client of the request.
+func authenticated(r *http.Request) bool {
+	return usecase.ClientFromContext(r.Context()) != nil
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/dto"
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/repository"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+// maxImportSize limits the CSV file of an import.
+const maxImportSize = 16 << 20
+
+type SuppressionHandler struct {
+	manageSuppressionsUC *usecase.ManageSuppressionsUseCase
+	validator            *validator.Validate
+	logger               *logger.Logger
+}
+
+func NewSuppressionHandler(
+	manageSuppressionsUC *usecase.ManageSuppressionsUseCase,
+	logger *logger.Logger,
+) *SuppressionHandler {
+	return &SuppressionHandler{
+		manageSuppressionsUC: manageSuppressionsUC,
+		validator:            validator.New(),
+		logger:               logger,
+	}
+}
+
+func (h *SuppressionHandler) Add(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	var req dto.AddSuppressionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "validation failed", err)
+		return
+	}
+
+	suppression, err := h.manageSuppressionsUC.Add(r.Context(), usecase.SuppressionInput{
+		Address:   req.Address,
+		Category:  req.Category,
+		Reason:    req.Reason,
+		Detail:    req.Detail,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidInput) {
+			respondError(h.logger, w, http.StatusBadRequest, "validation failed", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to suppress address", err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, buildSuppressionResponse(suppression))
+}
+
+// Get and Remove address the entry covering every email unless the
+// category query parameter names another one.
+func (h *SuppressionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	address, err := url.PathUnescape(chi.URLParam(r, "address"))
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid address", err)
+		return
+	}
+
+	suppression, err := h.manageSuppressionsUC.Get(r.Context(), address, r.URL.Query().Get("category"))
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			respondError(h.logger, w, http.StatusNotFound, "address not suppressed", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to get suppression", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, buildSuppressionResponse(suppression))
+}
+
+func (h *SuppressionHandler) Remove(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	address, err := url.PathUnescape(chi.URLParam(r, "address"))
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid address", err)
+		return
+	}
+
+	if err := h.manageSuppressionsUC.Remove(r.Context(), address, r.URL.Query().Get("category")); err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			respondError(h.logger, w, http.StatusNotFound, "address not suppressed", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to remove suppression", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SuppressionHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	filter, err := parseSuppressionFilter(r.URL.Query())
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid query", err)
+		return
+	}
+
+	page, err := h.manageSuppressionsUC.List(r.Context(), *filter)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidInput) {
+			respondError(h.logger, w, http.StatusBadRequest, "invalid query", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to list suppressions", err)
+		return
+	}
+
+	response := &dto.SuppressionListResponse{
+		Suppressions: make([]dto.SuppressionResponse, 0, len(page.Suppressions)),
+	}
+
+	if page.Next != nil {
+		response.NextAfter = &page.Next.Address
+		response.NextAfterCategory = &page.Next.Category
+	}
+
+	for i := range page.Suppressions {
+		response.Suppressions = append(response.Suppressions, *buildSuppressionResponse(&page.Suppressions[i]))
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Import adds the entries of a CSV body, see
+// ManageSuppressionsUseCase.Import for the columns.
+func (h *SuppressionHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	imported, err := h.manageSuppressionsUC.Import(r.Context(), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &tooLarge):
+			respondError(h.logger, w, http.StatusRequestEntityTooLarge, "import too large", err)
+		case errors.Is(err, apperrors.ErrInvalidInput):
+			respondError(h.logger, w, http.StatusBadRequest, "invalid import", err)
+		default:
+			respondError(h.logger, w, http.StatusInternalServerError, "failed to import suppressions", err)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, &dto.SuppressionImportResponse{Imported: imported})
+}
+
+func (h *SuppressionHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="suppressions.csv"`)
+
+	// Headers are sent with the first row, so a failure can only be logged
+	if err := h.manageSuppressionsUC.Export(r.Context(), w); err != nil {
+		h.logger.Error("Failed to export suppressions", zap.String("error", err.Error()))
+	}
+}
+
+func parseSuppressionFilter(query url.Values) (*repository.SuppressionFilter, error) {
+	filter := repository.SuppressionFilter{
+		After:         query.Get("after"),
+		AfterCategory: query.Get("afterCategory"),
+	}
+
+	if value := query.Get("reason"); value != "" {
+		reason, err := entity.ParseSuppressionReason(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.Reason = reason
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: limit must be a number", apperrors.ErrInvalidInput)
+		}
+		filter.Limit = limit
+	}
+
+	return &filter, nil
+}
+
+func buildSuppressionResponse(s *entity.Suppression) *dto.SuppressionResponse {
+	resp := &dto.SuppressionResponse{
+		Address:   s.Address,
+		Category:  s.Category,
+		Reason:    string(s.Reason),
+		Source:    string(s.Source),
+		Detail:    s.Detail,
+		CreatedAt: s.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: s.UpdatedAt.Format(time.RFC3339),
+	}
+
+	if s.EmailID != nil {
+		id := s.EmailID.String()
+		resp.EmailID = &id
+	}
+
+	if s.ExpiresAt != nil {
+		expiresAt := s.ExpiresAt.Format(time.RFC3339)
+		resp.ExpiresAt = &expiresAt
+	}
+
+	return resp
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// unsubscribePage is shown to recipients following an unsubscribe link.
+// Without Action it only reports the outcome.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>Unsubscribe</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 4em auto">
+<p>{{.Message}}</p>
+{{if .Action}}<form method="post" action="{{.Action}}"><input type="hidden" name="List-Unsubscribe" value="One-Click"><button type="submit">Unsubscribe</button></form>{{end}}
+</body>
+</html>
+`))
+
+type unsubscribeView struct {
+	Message string
+	Action  string
+}
+
+// UnsubscribeHandler serves the links of List-Unsubscribe headers. They
+// are public: the signature in the link is the authorization.
+type UnsubscribeHandler struct {
+	unsubscribeUC *usecase.UnsubscribeUseCase
+	logger        *logger.Logger
+}
+
+func NewUnsubscribeHandler(unsubscribeUC *usecase.UnsubscribeUseCase, logger *logger.Logger) *UnsubscribeHandler {
+	return &UnsubscribeHandler{
+		unsubscribeUC: unsubscribeUC,
+		logger:        logger,
+	}
+}
+
+// Confirm asks the recipient to confirm. Opening the link changes nothing,
+// so that mail scanners following links do not unsubscribe anyone.
+func (h *UnsubscribeHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	req, err := h.unsubscribeUC.Verify(r.URL.Query())
+	if err != nil {
+		h.render(w, http.StatusBadRequest, unsubscribeView{Message: "This unsubscribe link is not valid."})
+		return
+	}
+
+	h.render(w, http.StatusOK, unsubscribeView{
+		Message: "Stop sending " + describeCategory(req.Category) + " to " + req.Address + "?",
+		Action:  r.URL.RequestURI(),
+	})
+}
+
+// Unsubscribe records the unsubscribe. Mail clients post here directly for
+// one-click unsubscribe (RFC 8058), recipients through the confirmation.
+func (h *UnsubscribeHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	req, err := h.unsubscribeUC.Execute(r.Context(), r.URL.Query())
+	if err != nil {
+		if errors.Is(err, apperrors.ErrInvalidInput) {
+			h.render(w, http.StatusBadRequest, unsubscribeView{Message: "This unsubscribe link is not valid."})
+			return
+		}
+
+		h.logger.Error("Failed to unsubscribe", zap.String("error", err.Error()))
+		h.render(w, http.StatusInternalServerError, unsubscribeView{Message: "Something went wrong, please try again later."})
+		return
+	}
+
+	h.render(w, http.StatusOK, unsubscribeView{
+		Message: req.Address + " will no longer receive " + describeCategory(req.Category) + ".",
+	})
+}
+
+func (h *UnsubscribeHandler) render(w http.ResponseWriter, status int, view unsubscribeView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := unsubscribePage.Execute(w, view); err != nil {
+		h.logger.Error("Failed to render unsubscribe page", zap.String("error", err.Error()))
+	}
+}
+
+func describeCategory(category string) string {
+	if category == "" {
+		return "emails"
+	}
+	return category + " emails"
+}
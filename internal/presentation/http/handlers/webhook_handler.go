@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/an3wers/notification-serv/internal/application/dto"
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// maxBounceSize limits a bounce posted to the inbound endpoint. Bounces
+// may return the whole original message, attachments included.
+const maxBounceSize = 32 << 20
+
+type WebhookHandler struct {
+	recordDeliveryEventUC *usecase.RecordDeliveryEventUseCase
+	processBouncesUC      *usecase.ProcessBouncesUseCase
+	validator             *validator.Validate
+	logger                *logger.Logger
+}
+
+func NewWebhookHandler(
+	recordDeliveryEventUC *usecase.RecordDeliveryEventUseCase,
+	processBouncesUC *usecase.ProcessBouncesUseCase,
+	logger *logger.Logger,
+) *WebhookHandler {
+	return &WebhookHandler{
+		recordDeliveryEventUC: recordDeliveryEventUC,
+		processBouncesUC:      processBouncesUC,
+		validator:             validator.New(),
+		logger:                logger,
+	}
+}
+
+// Delivery records a delivery, bounce or complaint reported by a provider
+// for one recipient. Reports that contradict the recorded state, such as a
+// second bounce, are answered with 409 so providers stop retrying them.
+func (h *WebhookHandler) Delivery(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	var req dto.DeliveryWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "validation failed", err)
+		return
+	}
+
+	outcome, err := entity.ParseRecipientOutcome(req.Event)
+	if err != nil {
+		respondError(h.logger, w, http.StatusBadRequest, "invalid event", err)
+		return
+	}
+
+	report := usecase.DeliveryReport{
+		EmailID:   uuid.MustParse(req.EmailID),
+		Recipient: req.Recipient,
+		Outcome:   outcome,
+		Permanent: req.BounceType != "soft",
+		Code:      req.SMTPCode,
+		Detail:    req.Detail,
+		Source:    entity.EventSource{Actor: entity.ActorWebhook, Provider: req.Provider},
+	}
+
+	email, err := h.recordDeliveryEventUC.Execute(r.Context(), report)
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrNotFound):
+			respondError(h.logger, w, http.StatusNotFound, "email not found", err)
+		case errors.Is(err, apperrors.ErrInvalidInput):
+			respondError(h.logger, w, http.StatusBadRequest, "invalid event", err)
+		case errors.Is(err, apperrors.ErrInvalidTransition):
+			respondError(h.logger, w, http.StatusConflict, "event does not apply", err)
+		case errors.Is(err, apperrors.ErrConflict):
+			respondError(h.logger, w, http.StatusConflict, "email was modified concurrently, retry", err)
+		default:
+			respondError(h.logger, w, http.StatusInternalServerError, "failed to record event", err)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"emailId": email.ID.String(),
+		"status":  string(email.Status),
+	})
+}
+
+// Bounce accepts a raw bounce message, as piped from an MTA, and records the
+// outcomes it reports. The recipient query parameters carry the envelope
+// recipients, which hold the VERP return path. Messages that are not
+// bounces or do not apply are accepted and ignored.
+func (h *WebhookHandler) Bounce(w http.ResponseWriter, r *http.Request) {
+	if !authenticated(r) {
+		respondError(h.logger, w, http.StatusUnauthorized, "authentication required", errors.New("no API key or secret key"))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBounceSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondError(h.logger, w, http.StatusRequestEntityTooLarge, "message too large", err)
+			return
+		}
+		respondError(h.logger, w, http.StatusBadRequest, "failed to read message", err)
+		return
+	}
+
+	applied, err := h.processBouncesUC.ProcessMessage(r.Context(), r.URL.Query()["recipient"], data)
+	if err != nil {
+		respondError(h.logger, w, http.StatusInternalServerError, "failed to process bounce", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]int{"applied": applied})
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Authenticate identifies the client from an API key, sent as a bearer
+// token or in X-API-Key, a JWT bearer token, or the legacy ssy secret, and
+// adds it to the request context. Invalid credentials are rejected here;
+// requests without any pass on unauthenticated and handlers decide whether
+// that is allowed.
+func Authenticate(authUC *usecase.AuthenticateUseCase, log *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Signed requests were authenticated by VerifySignature
+			if usecase.ClientFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var client *entity.Client
+			var err error
+
+			switch key, token, secret := r.Header.Get("X-API-Key"), bearerToken(r), r.Header.Get("ssy"); {
+			case key != "":
+				client, err = authUC.APIKey(r.Context(), key)
+			case entity.IsAPIKey(token):
+				client, err = authUC.APIKey(r.Context(), token)
+			case token != "":
+				client, err = authUC.Token(r.Context(), token)
+			case secret != "":
+				client, err = authUC.SharedSecret(secret)
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err != nil {
+				status := http.StatusUnauthorized
+				if !errors.Is(err, apperrors.ErrUnauthorized) {
+					status = http.StatusInternalServerError
+				}
+
+				log.Warn("Authentication failed", zap.String("path", r.URL.Path), zap.String("error", err.Error()))
+				respondError(w, status, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(usecase.WithClient(r.Context(), client)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	return ""
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	var message string
+	switch status {
+	case http.StatusUnauthorized:
+		message = "invalid credentials"
+	case http.StatusForbidden:
+		message = "insufficient scope"
+	case http.StatusRequestEntityTooLarge:
+		message = "request too large"
+	case http.StatusTooManyRequests:
+		message = "rate limit exceeded"
+	default:
+		message = "failed to authenticate"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="notifications"`)
+	}
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":   message,
+		"details": err.Error(),
+	})
+}
+
+// RequireScope lets through requests whose client was granted scope. It
+// must run after Authenticate.
+func RequireScope(scope entity.Scope, log *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := usecase.ClientFromContext(r.Context())
+
+			switch {
+			case client == nil:
+				respondError(w, http.StatusUnauthorized, errors.New("no API key or secret key"))
+				return
+			case !client.HasScope(scope):
+				err := fmt.Errorf("client %s lacks the %s scope", client.Name, scope)
+				log.Warn("Request forbidden", zap.String("path", r.URL.Path), zap.String("error", err.Error()))
+				respondError(w, http.StatusForbidden, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -8,9 +8,13 @@ import (
 
 func CORS() func(http.Handler) http.Handler {
 	return cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"}, // TODO: Set allowed origins
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID", "ssy", "Ssy"},
+		AllowedOrigins: []string{"*"}, // TODO: Set allowed origins
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{
+			"Accept", "Authorization", "Content-Type", "X-Request-ID", "X-API-Key", "ssy", "Ssy",
+			SignatureHeader, SignatureKeyHeader, SignatureTimestampHeader, SignatureNonceHeader,
+			"traceparent", "tracestate", "baggage",
+		},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/go-chi/chi/v5"
+)
+
+// unmatchedRoute labels requests that matched no route, so that probing
+// random paths does not create new series.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts and times requests per route.
+func Metrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			wrapped := &responseWriter{
+				ResponseWriter: w,
+				status:         http.StatusOK,
+			}
+
+			next.ServeHTTP(wrapped, r)
+
+			// The pattern is complete only once the request was routed
+			route := unmatchedRoute
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			m.ObserveRequest(r.Method, route, wrapped.status, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	apperrors "github.com/an3wers/notification-serv/internal/pkg/errors"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Headers of a signed request.
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureKeyHeader       = "X-Signature-Key"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+)
+
+// memoryBodySize is the size up to which signed bodies are buffered in
+// memory; larger ones, like multipart uploads, go to a temporary file.
+const memoryBodySize = 1 << 20
+
+// VerifySignature authenticates requests signed with an API key instead of
+// carrying it, and adds the client to the request context. The body is
+// hashed before the handler reads it, so it is buffered up to maxBodySize.
+// Requests without a signature pass on to Authenticate.
+func VerifySignature(authUC *usecase.AuthenticateUseCase, maxBodySize int64, log *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sig := r.Header.Get(SignatureHeader)
+			if sig == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			bodyHash, body, err := bufferBody(w, r, maxBodySize)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					respondError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", maxBodySize))
+					return
+				}
+
+				log.Error("Failed to read signed request", zap.String("error", err.Error()))
+				respondError(w, http.StatusInternalServerError, err)
+				return
+			}
+			defer body.Close()
+
+			client, err := authUC.Signature(r.Context(), usecase.SignedRequest{
+				KeyID:     r.Header.Get(SignatureKeyHeader),
+				Signature: sig,
+				Method:    r.Method,
+				Path:      r.URL.RequestURI(),
+				Timestamp: r.Header.Get(SignatureTimestampHeader),
+				Nonce:     r.Header.Get(SignatureNonceHeader),
+				BodyHash:  bodyHash,
+			})
+			if err != nil {
+				status := http.StatusUnauthorized
+				if !errors.Is(err, apperrors.ErrUnauthorized) {
+					status = http.StatusInternalServerError
+				}
+
+				log.Warn("Signature verification failed", zap.String("path", r.URL.Path), zap.String("error", err.Error()))
+				respondError(w, status, err)
+				return
+			}
+
+			r.Body = body
+			next.ServeHTTP(w, r.WithContext(usecase.WithClient(r.Context(), client)))
+		})
+	}
+}
+
+// bufferBody reads the body, returning its hex encoded SHA-256 and a copy
+// to hand to the handler. The copy must be closed. A limit of 0 means no
+// limit.
+func bufferBody(w http.ResponseWriter, r *http.Request, limit int64) (string, io.ReadCloser, error) {
+	src := r.Body
+	if limit > 0 {
+		src = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	hash := sha256.New()
+	body := io.TeeReader(src, hash)
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, body, memoryBodySize+1); err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, err
+	}
+
+	if buf.Len() <= memoryBodySize {
+		return hex.EncodeToString(hash.Sum(nil)), io.NopCloser(&buf), nil
+	}
+
+	file, err := os.CreateTemp("", "signed-body-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to buffer body: %w", err)
+	}
+
+	spooled := &tempFile{File: file}
+
+	if _, err := io.Copy(file, io.MultiReader(&buf, body)); err != nil {
+		spooled.Close()
+		return "", nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return "", nil, fmt.Errorf("failed to buffer body: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), spooled, nil
+}
+
+// tempFile is a temporary file removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
@@ -1,9 +1,15 @@
 package router
 
 import (
+	"net/netip"
 	"time"
 
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
 	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/ratelimit"
 	"github.com/an3wers/notification-serv/internal/presentation/http/handlers"
 	"github.com/an3wers/notification-serv/internal/presentation/http/middleware"
 	"github.com/go-chi/chi/v5"
@@ -13,14 +19,31 @@ import (
 func NewRouter(
 	healthHandler *handlers.HealthHandler,
 	emailHandler *handlers.EmailHandler,
+	attachmentHandler *handlers.AttachmentHandler,
+	erasureHandler *handlers.ErasureHandler,
+	webhookHandler *handlers.WebhookHandler,
+	suppressionHandler *handlers.SuppressionHandler,
+	unsubscribeHandler *handlers.UnsubscribeHandler,
+	apiKeyHandler *handlers.APIKeyHandler,
+	quotaHandler *handlers.QuotaHandler,
+	authUC *usecase.AuthenticateUseCase,
+	trustedProxies []netip.Prefix,
+	storageCfg config.StorageConfig,
+	rateLimitCfg config.RateLimitConfig,
+	m *metrics.Metrics,
+	metricsCfg config.MetricsConfig,
 	log *logger.Logger,
 ) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
 	r.Use(chimiddleware.RequestID)
-	r.Use(chimiddleware.RealIP)
+	r.Use(middleware.RealIP(trustedProxies))
+	r.Use(middleware.Tracing())
 	r.Use(middleware.Logger(log))
+	if metricsCfg.Enabled {
+		r.Use(middleware.Metrics(m))
+	}
 	r.Use(chimiddleware.Recoverer)
 	r.Use(middleware.CORS())
 	r.Use(chimiddleware.Timeout(60 * time.Second))
@@ -28,11 +51,80 @@ func NewRouter(
 	// Health check
 	r.Get("/health", healthHandler.Health)
 
+	if metricsCfg.Enabled {
+		r.Handle(metricsCfg.Path, m.Handler())
+	}
+
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// IPs are limited before any work is done for them, clients once
+		// they are known
+		if rateLimitCfg.IPRate > 0 {
+			r.Use(middleware.RateLimitIP(ratelimit.New(rateLimitCfg.IPRate, rateLimitCfg.IPBurst), log))
+		}
+
+		r.Use(middleware.VerifySignature(authUC, storageCfg.MaxRequestSize, log))
+		r.Use(middleware.Authenticate(authUC, log))
+
+		if rateLimitCfg.ClientRate > 0 {
+			r.Use(middleware.RateLimitClient(ratelimit.New(rateLimitCfg.ClientRate, rateLimitCfg.ClientBurst), log))
+		}
+
+		send := middleware.RequireScope(entity.ScopeEmailsSend, log)
+		read := middleware.RequireScope(entity.ScopeEmailsRead, log)
+		admin := middleware.RequireScope(entity.ScopeAdmin, log)
+
 		r.Route("/emails", func(r chi.Router) {
-			r.Post("/", emailHandler.SendEmail)
-			r.Get("/{id}", emailHandler.GetEmailStatus)
+			r.With(send).Post("/", emailHandler.SendEmail)
+			r.With(read).Get("/", emailHandler.ListEmails)
+			r.With(read).Get("/{id}", emailHandler.GetEmailStatus)
+			r.With(send).Delete("/{id}", emailHandler.DeleteEmail)
+			r.With(read).Get("/{id}/events", emailHandler.GetEmailEvents)
+			r.With(send).Post("/{id}/cancel", emailHandler.CancelEmail)
+			// Signed links need no client, the handler checks the scope otherwise
+			r.Get("/{id}/attachments/{attachmentId}", attachmentHandler.Download)
+		})
+
+		// Clients see their own quota, admins any
+		r.Get("/quota", quotaHandler.Usage)
+
+		r.Route("/attachments", func(r chi.Router) {
+			r.Use(send)
+			r.Post("/", attachmentHandler.Upload)
+			r.Delete("/{id}", attachmentHandler.Delete)
+		})
+
+		r.Route("/erasures", func(r chi.Router) {
+			r.Use(admin)
+			r.Post("/", erasureHandler.Erase)
+			r.Get("/{id}", erasureHandler.GetReport)
+		})
+
+		r.Route("/suppressions", func(r chi.Router) {
+			r.Use(admin)
+			r.Get("/", suppressionHandler.List)
+			r.Post("/", suppressionHandler.Add)
+			r.Post("/import", suppressionHandler.Import)
+			r.Get("/export", suppressionHandler.Export)
+			r.Get("/{address}", suppressionHandler.Get)
+			r.Delete("/{address}", suppressionHandler.Remove)
+		})
+
+		// Links in List-Unsubscribe headers, authorized by their signature
+		r.Get("/unsubscribe", unsubscribeHandler.Confirm)
+		r.Post("/unsubscribe", unsubscribeHandler.Unsubscribe)
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(admin)
+			r.Post("/delivery", webhookHandler.Delivery)
+			r.Post("/bounce", webhookHandler.Bounce)
+		})
+
+		r.Route("/admin/api-keys", func(r chi.Router) {
+			r.Use(admin)
+			r.Get("/", apiKeyHandler.List)
+			r.Post("/", apiKeyHandler.Create)
+			r.Delete("/{id}", apiKeyHandler.Revoke)
 		})
 	})
 
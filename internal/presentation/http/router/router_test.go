@@ -0,0 +1,1567 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/an3wers/notification-serv/internal/application/dto"
+	"github.com/an3wers/notification-serv/internal/application/usecase"
+	"github.com/an3wers/notification-serv/internal/domain/entity"
+	"github.com/an3wers/notification-serv/internal/domain/service"
+	"github.com/an3wers/notification-serv/internal/infrastructure/email"
+	"github.com/an3wers/notification-serv/internal/infrastructure/email/smtptest"
+	"github.com/an3wers/notification-serv/internal/infrastructure/jwks"
+	"github.com/an3wers/notification-serv/internal/infrastructure/jwks/jwkstest"
+	"github.com/an3wers/notification-serv/internal/infrastructure/persistence/memory"
+	"github.com/an3wers/notification-serv/internal/infrastructure/storage"
+	"github.com/an3wers/notification-serv/internal/pkg/config"
+	"github.com/an3wers/notification-serv/internal/pkg/logger"
+	"github.com/an3wers/notification-serv/internal/pkg/metrics"
+	"github.com/an3wers/notification-serv/internal/pkg/signature"
+	"github.com/an3wers/notification-serv/internal/pkg/tracing"
+	"github.com/an3wers/notification-serv/internal/presentation/http/handlers"
+	"github.com/an3wers/notification-serv/internal/presentation/http/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+)
+
+const testSecret = "test-secret"
+
+// testService is the router wired like in main, backed by memory
+// repositories, local storage and an in-process SMTP server.
+type testService struct {
+	http *httptest.Server
+	smtp *smtptest.Server
+}
+
+// newTestService starts the service; options adjust its configuration.
+func newTestService(t *testing.T, options ...func(cfg *config.Config)) *testService {
+	t.Helper()
+
+	smtpServer := smtptest.NewServer(t, smtptest.Options{
+		STARTTLS:       true,
+		AuthMechanisms: []string{"PLAIN", "LOGIN"},
+		Username:       "relay",
+		Password:       "relay-password",
+	})
+
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			SecretKey: testSecret, LegacySecretKey: true, SignatureMaxSkew: 300, SigningKeyEncryptionKey: "encryption-key",
+		},
+		SMTP: config.SMTPConfig{
+			Host:            smtpServer.Host,
+			Port:            smtpServer.Port,
+			Username:        "relay",
+			Password:        "relay-password",
+			From:            "noreply@example.com",
+			FromDisplayName: "Notifications",
+			Timeout:         5,
+		},
+		Storage: config.StorageConfig{
+			Provider:       "local",
+			LocalPath:      t.TempDir(),
+			MaxFileSize:    1 << 20,
+			MaxRequestSize: 4 << 20,
+		},
+		Links:       config.LinksConfig{BaseURL: "http://notifications.test", SigningKey: "link-key", TTL: 60},
+		Suppression: config.SuppressionConfig{Mode: config.SuppressionRemove, HardBounceDays: 180},
+		Metrics:     config.MetricsConfig{Enabled: true, Path: "/metrics"},
+	}
+
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	log := &logger.Logger{Logger: zap.NewNop()}
+
+	store := memory.NewStore()
+	emailRepo := memory.NewEmailRepository(store)
+	attachmentRepo := memory.NewAttachmentRepository(store)
+	suppressionRepo := memory.NewSuppressionRepository(store)
+	apiKeyRepo := memory.NewAPIKeyRepository(store)
+	transactor := memory.NewTransactor(store)
+
+	appMetrics := metrics.New()
+	appMetrics.Register(metrics.QueueDepth(emailRepo.CountQueued))
+	appMetrics.Register(metrics.AttachmentStoredBytes(attachmentRepo.StoredSize))
+
+	fileStorage := storage.NewLocalStorage(cfg.Storage)
+	unsubscribeLinks, err := usecase.NewUnsubscribeLinks(cfg.Links)
+	if err != nil {
+		t.Fatalf("failed to create unsubscribe links: %v", err)
+	}
+	emailProvider := email.NewSMTPProvider(cfg.SMTP, fileStorage, nil, unsubscribeLinks, appMetrics)
+
+	attachmentPolicy := usecase.NewAttachmentPolicy(cfg.Attachments)
+	attachmentLinks, err := usecase.NewAttachmentLinks(cfg.Links)
+	if err != nil {
+		t.Fatalf("failed to create attachment links: %v", err)
+	}
+	attachmentOffloader := usecase.NewAttachmentOffloader(attachmentLinks, cfg.Attachments)
+	quotaUC := usecase.NewQuotaUseCase(memory.NewQuotaRepository(store), cfg.RateLimit)
+	sendEmailUC := usecase.NewSendEmailUseCase(
+		emailRepo, attachmentRepo, suppressionRepo, transactor, emailProvider,
+		attachmentPolicy, attachmentLinks, attachmentOffloader, quotaUC, usecase.NewDomainThrottle(cfg.Throttle), appMetrics, cfg.SMTP, cfg.Suppression, log,
+	)
+	getEmailStatusUC := usecase.NewGetEmailStatusUseCase(emailRepo, attachmentLinks)
+	uploadAttachmentUC := usecase.NewUploadAttachmentUseCase(attachmentRepo, transactor, fileStorage, attachmentPolicy, cfg.Storage, log)
+	deleteAttachmentUC := usecase.NewDeleteAttachmentUseCase(attachmentRepo, fileStorage, log)
+	downloadAttachmentUC := usecase.NewDownloadAttachmentUseCase(emailRepo, fileStorage)
+	deleteEmailUC := usecase.NewDeleteEmailUseCase(emailRepo, log)
+	getEmailEventsUC := usecase.NewGetEmailEventsUseCase(emailRepo, memory.NewEmailEventRepository(store))
+	cancelEmailUC := usecase.NewCancelEmailUseCase(emailRepo, transactor, appMetrics, log)
+	listEmailsUC := usecase.NewListEmailsUseCase(emailRepo)
+	recordDeliveryEventUC := usecase.NewRecordDeliveryEventUseCase(emailRepo, suppressionRepo, transactor, appMetrics, cfg.Suppression, log)
+	processBouncesUC := usecase.NewProcessBouncesUseCase(nil, memory.NewLocker(), recordDeliveryEventUC, nil, cfg.Bounces, log)
+	// Erasure is not exercised here and has no memory repository
+	eraseAddressUC := usecase.NewEraseAddressUseCase(nil, deleteAttachmentUC, log)
+
+	signingKeys, err := usecase.NewSigningKeys(cfg.Server)
+	if err != nil {
+		t.Fatalf("failed to create signing keys: %v", err)
+	}
+
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	var tokenVerifier service.TokenVerifier
+	if cfg.JWT.JWKSFile != "" {
+		verifier, err := jwks.New(cfg.JWT)
+		if err != nil {
+			t.Fatalf("failed to create token verifier: %v", err)
+		}
+		tokenVerifier = verifier
+	}
+
+	r := NewRouter(
+		handlers.NewHealthHandler(nil),
+		handlers.NewEmailHandler(
+			sendEmailUC, getEmailStatusUC, uploadAttachmentUC, deleteEmailUC, getEmailEventsUC, cancelEmailUC, listEmailsUC, cfg.Storage, log,
+		),
+		handlers.NewAttachmentHandler(uploadAttachmentUC, deleteAttachmentUC, downloadAttachmentUC, attachmentLinks, cfg.Storage, log),
+		handlers.NewErasureHandler(eraseAddressUC, log),
+		handlers.NewWebhookHandler(recordDeliveryEventUC, processBouncesUC, log),
+		handlers.NewSuppressionHandler(usecase.NewManageSuppressionsUseCase(suppressionRepo, transactor, log), log),
+		handlers.NewUnsubscribeHandler(usecase.NewUnsubscribeUseCase(suppressionRepo, unsubscribeLinks, log), log),
+		handlers.NewAPIKeyHandler(usecase.NewManageAPIKeysUseCase(apiKeyRepo, signingKeys, log), log),
+		handlers.NewQuotaHandler(quotaUC, log),
+		usecase.NewAuthenticateUseCase(apiKeyRepo, memory.NewNonceRepository(store), tokenVerifier, signingKeys, cfg.Server, log),
+		trustedProxies,
+		cfg.Storage,
+		cfg.RateLimit,
+		appMetrics,
+		cfg.Metrics,
+		log,
+	)
+
+	httpServer := httptest.NewServer(r)
+	t.Cleanup(httpServer.Close)
+
+	return &testService{http: httpServer, smtp: smtpServer}
+}
+
+// do sends a request authenticated with the shared secret.
+func (s *testService) do(t *testing.T, method, path, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+
+	return s.doWith(t, http.Header{"Ssy": {testSecret}}, method, path, contentType, body)
+}
+
+// doWith sends a request with the given headers.
+func (s *testService) doWith(t *testing.T, header http.Header, method, path, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.http.URL+path, body)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	req.Header = header.Clone()
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.http.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func (s *testService) sendJSON(t *testing.T, request map[string]any) *http.Response {
+	t.Helper()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	return s.do(t, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+}
+
+// multipartBody builds a form with the given fields and files, keyed by
+// field name and then by filename.
+func multipartBody(t *testing.T, fields map[string]string, files map[string]map[string][]byte) (string, io.Reader) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			t.Fatalf("WriteField: %v", err)
+		}
+	}
+
+	for field, byName := range files {
+		for filename, content := range byName {
+			part, err := w.CreateFormFile(field, filename)
+			if err != nil {
+				t.Fatalf("CreateFormFile: %v", err)
+			}
+			part.Write(content)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	return w.FormDataContentType(), &buf
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	return v
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s = %d %s, want %d", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, body, want)
+	}
+}
+
+func (s *testService) onlyMessage(t *testing.T) smtptest.Message {
+	t.Helper()
+
+	messages := s.smtp.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("SMTP server received %d messages, want 1", len(messages))
+	}
+
+	return messages[0]
+}
+
+func TestSendEmail_JSON(t *testing.T) {
+	s := newTestService(t)
+
+	resp := s.sendJSON(t, map[string]any{
+		"to":      []string{"first@example.com; second@example.com"},
+		"bcc":     []string{"audit@example.com"},
+		"subject": "Order shipped",
+		"body":    "Your order is on its way.",
+		"html":    "<p>Your order is on its way.</p>",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	created := decode[dto.EmailResponse](t, resp)
+	if created.Status != "SENT" || created.SentAt == nil {
+		t.Errorf("response = %+v, want SENT", created)
+	}
+
+	msg := s.onlyMessage(t)
+
+	if !msg.TLS || msg.Auth == nil || msg.Auth.Username != "relay" {
+		t.Errorf("message sent with TLS %v and auth %+v, want STARTTLS and relay credentials", msg.TLS, msg.Auth)
+	}
+	if msg.From != "noreply@example.com" {
+		t.Errorf("MAIL FROM = %q, want the configured sender", msg.From)
+	}
+	if got := strings.Join(msg.To, ","); got != "first@example.com,second@example.com,audit@example.com" {
+		t.Errorf("RCPT TO = %s", got)
+	}
+
+	parsed, err := msg.Parse()
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := parsed.Header.Get("From"); got != `"Notifications" <noreply@example.com>` {
+		t.Errorf("From = %q", got)
+	}
+	if got := parsed.Header.Get("To"); got != "first@example.com, second@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	if got := parsed.Header.Get("Subject"); got != "Order shipped" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got := parsed.Header.Get("Bcc"); got != "" {
+		t.Errorf("Bcc header leaked: %q", got)
+	}
+
+	parts, containers, err := msg.Parts()
+	if err != nil {
+		t.Fatalf("Parts: %v", err)
+	}
+	if strings.Join(containers, ",") != "multipart/alternative" || len(parts) != 2 ||
+		parts[0].MediaType != "text/plain" || parts[1].MediaType != "text/html" {
+		t.Errorf("MIME structure = %v with %d parts, want text and HTML alternatives", containers, len(parts))
+	}
+
+	// The stored status matches what was sent
+	resp = s.do(t, http.MethodGet, "/api/v1/emails/"+created.ID, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if status := decode[dto.EmailResponse](t, resp); status.Status != "SENT" {
+		t.Errorf("GET status = %s, want SENT", status.Status)
+	}
+}
+
+func TestSendEmail_MultipartWithAttachments(t *testing.T) {
+	s := newTestService(t)
+
+	pdf := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("pdf content "), 200)...)
+	csv := []byte("id,name\n1,first\n2,second\n")
+
+	// A file uploaded earlier is referenced by ID
+	contentType, body := multipartBody(t, nil, map[string]map[string][]byte{"file": {"terms.pdf": pdf}})
+	resp := s.do(t, http.MethodPost, "/api/v1/attachments", contentType, body)
+	expectStatus(t, resp, http.StatusCreated)
+
+	uploaded := decode[handlers.UploadAttachmentResponse](t, resp)
+
+	contentType, body = multipartBody(t,
+		map[string]string{
+			"to":            "customer@example.com",
+			"fromEmail":     "billing@example.com",
+			"subject":       "Invoice",
+			"body":          "See attached.",
+			"attachmentIds": uploaded.ID,
+		},
+		map[string]map[string][]byte{"files": {"report.csv": csv}},
+	)
+	resp = s.do(t, http.MethodPost, "/api/v1/emails", contentType, body)
+	expectStatus(t, resp, http.StatusCreated)
+
+	created := decode[dto.EmailResponse](t, resp)
+	if len(created.Attachments) != 2 {
+		t.Fatalf("response lists %d attachments, want 2", len(created.Attachments))
+	}
+
+	msg := s.onlyMessage(t)
+	if msg.From != "billing@example.com" {
+		t.Errorf("MAIL FROM = %q, want the requested sender", msg.From)
+	}
+
+	parts, containers, err := msg.Parts()
+	if err != nil {
+		t.Fatalf("Parts: %v", err)
+	}
+	if strings.Join(containers, ",") != "multipart/mixed" || len(parts) != 3 {
+		t.Fatalf("MIME structure = %v with %d parts, want mixed with a body and two attachments", containers, len(parts))
+	}
+
+	if string(parts[0].Body) != "See attached." {
+		t.Errorf("body = %q", parts[0].Body)
+	}
+
+	// Uploads come first, then referenced attachments
+	attachments := map[string][]byte{"report.csv": csv, "terms.pdf": pdf}
+	for i, name := range []string{"report.csv", "terms.pdf"} {
+		part := parts[i+1]
+		if part.Filename != name || !bytes.Equal(part.Body, attachments[name]) {
+			t.Errorf("attachment %d = %q with %d bytes, want %q with %d bytes",
+				i, part.Filename, len(part.Body), name, len(attachments[name]))
+		}
+	}
+
+	// The signed link serves the same content
+	link := created.Attachments[1].URL
+	if link == nil {
+		t.Fatal("attachment has no download URL")
+	}
+
+	path := strings.TrimPrefix(*link, "http://notifications.test")
+	req, _ := http.NewRequest(http.MethodGet, s.http.URL+path, nil)
+
+	download, err := s.http.Client().Do(req)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	defer download.Body.Close()
+	expectStatus(t, download, http.StatusOK)
+
+	content, _ := io.ReadAll(download.Body)
+	if !bytes.Equal(content, pdf) || download.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("download = %s with %d bytes, want the PDF", download.Header.Get("Content-Type"), len(content))
+	}
+}
+
+func TestMultipartForm_Limits(t *testing.T) {
+	s := newTestService(t, func(cfg *config.Config) { cfg.Storage.MaxRequestSize = 0 })
+
+	fields := map[string]string{
+		"to":        "customer@example.com",
+		"fromEmail": "billing@example.com",
+		"subject":   "Invoice",
+		"body":      "See attached.",
+	}
+
+	// Files go in "files" when sending and in "file" when uploading
+	contentType, body := multipartBody(t, fields, map[string]map[string][]byte{"file": {"report.csv": []byte("id\n1\n")}})
+	resp := s.do(t, http.MethodPost, "/api/v1/emails", contentType, body)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	contentType, body = multipartBody(t, nil, map[string]map[string][]byte{"attachment": {"report.csv": []byte("id\n1\n")}})
+	resp = s.do(t, http.MethodPost, "/api/v1/attachments", contentType, body)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "unexpected file field") {
+		t.Errorf("response = %s, want the file field rejected", body)
+	}
+
+	// Fields other than files are capped without a request size limit
+	fields["body"] = strings.Repeat("x", 11<<20)
+	contentType, body = multipartBody(t, fields, nil)
+	resp = s.do(t, http.MethodPost, "/api/v1/emails", contentType, body)
+	expectStatus(t, resp, http.StatusRequestEntityTooLarge)
+
+	if n := len(s.smtp.Messages()); n != 0 {
+		t.Errorf("relay got %d messages, want 0", n)
+	}
+}
+
+func TestSendEmail_RelayRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		code    int
+		text    string
+	}{
+		{name: "permanent recipient failure", command: "RCPT", code: 550, text: "5.1.1 user unknown"},
+		{name: "temporary failure after data", command: smtptest.EOM, code: 451, text: "4.3.0 try again later"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			s.smtp.Reply(tt.command, tt.code, tt.text)
+
+			resp := s.sendJSON(t, map[string]any{
+				"to":      []string{"missing@example.com"},
+				"subject": "Hello",
+				"body":    "Hello",
+			})
+			expectStatus(t, resp, http.StatusInternalServerError)
+
+			errResp := decode[map[string]any](t, resp)
+			if details, _ := errResp["details"].(string); !strings.Contains(details, tt.text) {
+				t.Errorf("details = %q, want the relay reply %q", details, tt.text)
+			}
+
+			if n := len(s.smtp.Messages()); n != 0 {
+				t.Errorf("SMTP server accepted %d messages, want 0", n)
+			}
+		})
+	}
+}
+
+func TestSendEmail_PartialRecipients(t *testing.T) {
+	s := newTestService(t)
+	s.smtp.Reply("RCPT", 250, "2.1.5 OK")
+	s.smtp.Reply("RCPT", 550, "5.1.1 user unknown")
+
+	resp := s.sendJSON(t, map[string]any{
+		"to":      []string{"known@example.com", "unknown@example.com"},
+		"subject": "Hello",
+		"body":    "Hello",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	created := decode[dto.EmailResponse](t, resp)
+
+	if got := strings.Join(s.onlyMessage(t).To, ","); got != "known@example.com" {
+		t.Errorf("RCPT TO accepted = %s, want only the known address", got)
+	}
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails/"+created.ID, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	status := decode[dto.EmailResponse](t, resp)
+	if status.Status != "SENT" || len(status.Recipients) != 2 {
+		t.Fatalf("GET = %+v, want SENT with two recipients", status)
+	}
+
+	known, unknown := status.Recipients[0], status.Recipients[1]
+	if known.Status != "ACCEPTED" || known.Kind != "TO" || known.SMTPCode == nil || *known.SMTPCode != 250 {
+		t.Errorf("known recipient = %+v", known)
+	}
+	if unknown.Status != "REJECTED" || unknown.Response == nil || *unknown.Response != "5.1.1 user unknown" {
+		t.Errorf("unknown recipient = %+v", unknown)
+	}
+}
+
+func TestEmailEvents(t *testing.T) {
+	s := newTestService(t)
+
+	resp := s.sendJSON(t, map[string]any{
+		"to":      []string{"present@example.com"},
+		"subject": "Hello",
+		"body":    "Hello",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	created := decode[dto.EmailResponse](t, resp)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails/"+created.ID+"/events", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	timeline := decode[dto.EmailTimelineResponse](t, resp)
+	if timeline.EmailID != created.ID || len(timeline.Events) != 3 {
+		t.Fatalf("timeline = %+v, want three events", timeline)
+	}
+
+	createdEvent, sendingEvent, sentEvent := timeline.Events[0], timeline.Events[1], timeline.Events[2]
+	if createdEvent.FromStatus != nil || createdEvent.Status != "PENDING" || createdEvent.Actor != "API" {
+		t.Errorf("first event = %+v, want creation as PENDING by the API", createdEvent)
+	}
+	if sendingEvent.FromStatus == nil || *sendingEvent.FromStatus != "PENDING" || sendingEvent.Status != "SENDING" {
+		t.Errorf("second event = %+v, want PENDING to SENDING", sendingEvent)
+	}
+	if sentEvent.FromStatus == nil || *sentEvent.FromStatus != "SENDING" || sentEvent.Status != "SENT" ||
+		sentEvent.Provider != "smtp" || sentEvent.Detail == nil {
+		t.Errorf("third event = %+v, want SENDING to SENT through smtp", sentEvent)
+	}
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails/00000000-0000-0000-0000-000000000001/events", "", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestSendEmail_RequiresSecretKey(t *testing.T) {
+	s := newTestService(t)
+
+	req, _ := http.NewRequest(http.MethodPost, s.http.URL+"/api/v1/emails", strings.NewReader(`{"to":["a@example.com"]}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.http.Client().Do(req)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+
+	expectStatus(t, resp, http.StatusUnauthorized)
+
+	if n := len(s.smtp.Messages()); n != 0 {
+		t.Errorf("SMTP server accepted %d messages, want 0", n)
+	}
+}
+
+func TestDeliveryLifecycle(t *testing.T) {
+	s := newTestService(t)
+
+	resp := s.sendJSON(t, map[string]any{
+		"to":      []string{"first@example.com", "second@example.com"},
+		"subject": "Hello",
+		"body":    "Hello",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	sent := decode[dto.EmailResponse](t, resp)
+
+	report := func(recipient, event string) *http.Response {
+		body, _ := json.Marshal(map[string]any{
+			"emailId":   sent.ID,
+			"recipient": recipient,
+			"event":     event,
+			"provider":  "relay",
+			"smtpCode":  250,
+		})
+		return s.do(t, http.MethodPost, "/api/v1/webhooks/delivery", "application/json", bytes.NewReader(body))
+	}
+
+	// The email stays SENT until every recipient has an outcome
+	resp = report("first@example.com", "delivered")
+	expectStatus(t, resp, http.StatusOK)
+	if status := decode[map[string]string](t, resp)["status"]; status != "SENT" {
+		t.Errorf("after first delivery status = %s, want SENT", status)
+	}
+
+	resp = report("second@example.com", "bounced")
+	expectStatus(t, resp, http.StatusOK)
+	if status := decode[map[string]string](t, resp)["status"]; status != "DELIVERED" {
+		t.Errorf("after bounce status = %s, want DELIVERED", status)
+	}
+
+	expectStatus(t, report("second@example.com", "bounced"), http.StatusConflict)
+	expectStatus(t, report("other@example.com", "delivered"), http.StatusBadRequest)
+	expectStatus(t, s.do(t, http.MethodPost, "/api/v1/emails/"+sent.ID+"/cancel", "", nil), http.StatusConflict)
+
+	// A failed email can still be cancelled
+	s.smtp.Reply("RCPT", 550, "5.1.1 user unknown")
+	resp = s.sendJSON(t, map[string]any{
+		"to":      []string{"missing@example.com"},
+		"subject": "Hello",
+		"body":    "Hello",
+	})
+	expectStatus(t, resp, http.StatusInternalServerError)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails?status=failed", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	failed := decode[dto.EmailListResponse](t, resp)
+	if len(failed.Emails) != 1 || failed.Emails[0].Status != "FAILED" {
+		t.Fatalf("FAILED emails = %+v, want one", failed.Emails)
+	}
+
+	resp = s.do(t, http.MethodPost, "/api/v1/emails/"+failed.Emails[0].ID+"/cancel",
+		"application/json", strings.NewReader(`{"reason":"address removed"}`))
+	expectStatus(t, resp, http.StatusOK)
+	if cancelled := decode[dto.EmailResponse](t, resp); cancelled.Status != "CANCELLED" {
+		t.Errorf("cancelled status = %s, want CANCELLED", cancelled.Status)
+	}
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails?status=DELIVERED,CANCELLED&limit=1", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	page := decode[dto.EmailListResponse](t, resp)
+	if len(page.Emails) != 1 || page.Emails[0].Status != "CANCELLED" || page.NextBefore == nil {
+		t.Fatalf("first page = %+v, want the cancelled email and a next page", page)
+	}
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails?status=DELIVERED,CANCELLED&limit=1&before="+url.QueryEscape(*page.NextBefore), "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	page = decode[dto.EmailListResponse](t, resp)
+	if len(page.Emails) != 1 || page.Emails[0].ID != sent.ID || page.NextBefore != nil {
+		t.Fatalf("second page = %+v, want the delivered email only", page)
+	}
+
+	expectStatus(t, s.do(t, http.MethodGet, "/api/v1/emails?status=LOST", "", nil), http.StatusBadRequest)
+}
+
+func TestInboundBounce(t *testing.T) {
+	s := newTestService(t)
+
+	resp := s.sendJSON(t, map[string]any{
+		"to":      []string{"gone@example.org"},
+		"subject": "Hello",
+		"body":    "Hello",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	sent := decode[dto.EmailResponse](t, resp)
+
+	bounce := strings.ReplaceAll(`From: MAILER-DAEMON@mx.example.org
+To: bounces@example.com
+Subject: Undelivered Mail Returned to Sender
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b"
+
+--b
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+
+Final-Recipient: rfc822; gone@example.org
+Action: failed
+Status: 5.1.1
+Diagnostic-Code: smtp; 550 5.1.1 User unknown
+
+--b
+Content-Type: text/rfc822-headers
+
+Message-ID: <`+sent.ID+`@example.com>
+
+--b--
+`, "\n", "\r\n")
+
+	resp = s.do(t, http.MethodPost, "/api/v1/webhooks/bounce?recipient=bounces@example.com", "message/rfc822", strings.NewReader(bounce))
+	expectStatus(t, resp, http.StatusOK)
+
+	if applied := decode[map[string]int](t, resp)["applied"]; applied != 1 {
+		t.Errorf("applied = %d, want 1", applied)
+	}
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails/"+sent.ID, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	status := decode[dto.EmailResponse](t, resp)
+	if status.Status != "BOUNCED" || status.Recipients[0].Status != "BOUNCED" || *status.Recipients[0].SMTPCode != 550 {
+		t.Errorf("after bounce = %+v, want BOUNCED with code 550", status)
+	}
+
+	// Anything else sent to the bounce address is accepted and ignored
+	resp = s.do(t, http.MethodPost, "/api/v1/webhooks/bounce", "message/rfc822", strings.NewReader("Subject: Out of office\r\n\r\nAway\r\n"))
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestSuppressions(t *testing.T) {
+	s := newTestService(t)
+
+	resp := s.sendJSON(t, map[string]any{
+		"to":      []string{"first@example.com", "angry@example.com"},
+		"subject": "Hello",
+		"body":    "Hello",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	sent := decode[dto.EmailResponse](t, resp)
+
+	// A complaint suppresses the address
+	body, _ := json.Marshal(map[string]any{"emailId": sent.ID, "recipient": "angry@example.com", "event": "complained"})
+	expectStatus(t, s.do(t, http.MethodPost, "/api/v1/webhooks/delivery", "application/json", bytes.NewReader(body)), http.StatusOK)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/suppressions/"+url.PathEscape("Angry@example.com"), "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if got := decode[dto.SuppressionResponse](t, resp); got.Reason != "COMPLAINT" || got.Source != "WEBHOOK" ||
+		got.EmailID == nil || *got.EmailID != sent.ID || got.ExpiresAt != nil {
+		t.Errorf("suppression = %+v, want a permanent complaint from the webhook", got)
+	}
+
+	// Suppressed recipients are left out of later emails
+	resp = s.do(t, http.MethodPost, "/api/v1/suppressions", "application/json",
+		strings.NewReader(`{"address":"blocked@example.com","reason":"manual","detail":"asked by phone"}`))
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp = s.sendJSON(t, map[string]any{
+		"to":      []string{"second@example.com", "angry@example.com"},
+		"cc":      []string{"blocked@example.com"},
+		"subject": "Hello",
+		"body":    "Hello",
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	messages := s.smtp.Messages()
+	if got := strings.Join(messages[len(messages)-1].To, ","); got != "second@example.com" {
+		t.Errorf("RCPT TO = %s, want the unsuppressed address only", got)
+	}
+
+	partial := decode[dto.EmailResponse](t, resp)
+	if partial.Recipients[1].Status != "SUPPRESSED" || partial.Recipients[2].Status != "SUPPRESSED" {
+		t.Errorf("recipients = %+v, want the suppressed ones marked", partial.Recipients)
+	}
+
+	// An email to suppressed addresses only is refused and kept cancelled
+	resp = s.sendJSON(t, map[string]any{"to": []string{"blocked@example.com"}, "subject": "Hello", "body": "Hello"})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails?status=cancelled", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if cancelled := decode[dto.EmailListResponse](t, resp); len(cancelled.Emails) != 1 {
+		t.Errorf("cancelled emails = %+v, want the refused one", cancelled.Emails)
+	}
+
+	// Import, listing and export
+	csv := "address,reason,expires_at\nimported@example.com,hard_bounce,2099-01-01T00:00:00Z\nother@example.com,,\n"
+	resp = s.do(t, http.MethodPost, "/api/v1/suppressions/import", "text/csv", strings.NewReader(csv))
+	expectStatus(t, resp, http.StatusOK)
+	if imported := decode[dto.SuppressionImportResponse](t, resp).Imported; imported != 2 {
+		t.Errorf("imported = %d, want 2", imported)
+	}
+
+	resp = s.do(t, http.MethodPost, "/api/v1/suppressions/import", "text/csv", strings.NewReader("address\nnot an address\n"))
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/suppressions?limit=2", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	page := decode[dto.SuppressionListResponse](t, resp)
+	if len(page.Suppressions) != 2 || page.Suppressions[0].Address != "angry@example.com" || page.NextAfter == nil {
+		t.Fatalf("first page = %+v, want two entries and a next page", page)
+	}
+
+	resp = s.do(t, http.MethodGet, "/api/v1/suppressions?reason=HARD_BOUNCE", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if bounces := decode[dto.SuppressionListResponse](t, resp); len(bounces.Suppressions) != 1 || bounces.Suppressions[0].Address != "imported@example.com" {
+		t.Errorf("hard bounces = %+v, want the imported one", bounces.Suppressions)
+	}
+
+	resp = s.do(t, http.MethodGet, "/api/v1/suppressions/export", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	exported, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(string(exported)), "\n")
+	if len(lines) != 5 || lines[0] != "address,category,reason,source,expires_at,detail,created_at" ||
+		!strings.HasPrefix(lines[3], "imported@example.com,,HARD_BOUNCE,IMPORT,2099-01-01T00:00:00Z,,") {
+		t.Errorf("export =\n%s", exported)
+	}
+
+	// Removing the entry lets the address receive email again
+	expectStatus(t, s.do(t, http.MethodDelete, "/api/v1/suppressions/blocked@example.com", "", nil), http.StatusNoContent)
+	expectStatus(t, s.do(t, http.MethodDelete, "/api/v1/suppressions/blocked@example.com", "", nil), http.StatusNotFound)
+
+	resp = s.sendJSON(t, map[string]any{"to": []string{"blocked@example.com"}, "subject": "Hello", "body": "Hello"})
+	expectStatus(t, resp, http.StatusCreated)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	s := newTestService(t)
+
+	resp := s.sendJSON(t, map[string]any{
+		"to":              []string{"reader@example.com"},
+		"subject":         "Weekly news",
+		"body":            "News",
+		"category":        "newsletter",
+		"listUnsubscribe": true,
+	})
+	expectStatus(t, resp, http.StatusCreated)
+
+	if created := decode[dto.EmailResponse](t, resp); created.Category == nil || *created.Category != "newsletter" || !created.ListUnsubscribe {
+		t.Errorf("response = %+v, want the category and List-Unsubscribe", created)
+	}
+
+	parsed, err := s.onlyMessage(t).Parse()
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", got)
+	}
+
+	link, ok := strings.CutPrefix(parsed.Header.Get("List-Unsubscribe"), "<http://notifications.test")
+	if !ok || !strings.HasSuffix(link, ">") {
+		t.Fatalf("List-Unsubscribe = %q, want a link to the service", parsed.Header.Get("List-Unsubscribe"))
+	}
+	link = strings.TrimSuffix(link, ">")
+
+	// Opening the link only asks for confirmation
+	resp = s.do(t, http.MethodGet, link, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	page, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(page), "<form") {
+		t.Errorf("confirmation page =\n%s", page)
+	}
+
+	expectStatus(t, s.do(t, http.MethodGet, "/api/v1/suppressions/reader@example.com?category=newsletter", "", nil), http.StatusNotFound)
+
+	// A tampered link is rejected
+	tampered := strings.Replace(link, "reader%40example.com", "other%40example.com", 1)
+	expectStatus(t, s.do(t, http.MethodPost, tampered, "application/x-www-form-urlencoded",
+		strings.NewReader("List-Unsubscribe=One-Click")), http.StatusBadRequest)
+
+	// One-click unsubscribe records the category
+	expectStatus(t, s.do(t, http.MethodPost, link, "application/x-www-form-urlencoded",
+		strings.NewReader("List-Unsubscribe=One-Click")), http.StatusOK)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/suppressions/reader@example.com?category=newsletter", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if got := decode[dto.SuppressionResponse](t, resp); got.Reason != "UNSUBSCRIBE" || got.Source != "RECIPIENT" || got.Category != "newsletter" {
+		t.Errorf("suppression = %+v, want an unsubscribe from the newsletter", got)
+	}
+
+	// Later newsletters are refused, other emails still go out
+	resp = s.sendJSON(t, map[string]any{"to": []string{"reader@example.com"}, "subject": "News", "body": "News", "category": "newsletter"})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+
+	resp = s.sendJSON(t, map[string]any{"to": []string{"reader@example.com"}, "subject": "Receipt", "body": "Receipt"})
+	expectStatus(t, resp, http.StatusCreated)
+
+	if n := len(s.smtp.Messages()); n != 2 {
+		t.Errorf("SMTP server received %d messages, want 2", n)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestService(t)
+
+	// The shared secret acts as an admin and issues the first keys
+	resp := s.do(t, http.MethodPost, "/api/v1/admin/api-keys", "application/json",
+		strings.NewReader(`{"name":"billing","scopes":["emails:send","emails:read"]}`))
+	expectStatus(t, resp, http.StatusCreated)
+
+	created := decode[dto.APIKeyResponse](t, resp)
+	if !strings.HasPrefix(created.Key, created.Prefix) || created.Name != "billing" || len(created.Scopes) != 2 {
+		t.Errorf("created = %+v", created)
+	}
+
+	bearer := http.Header{"Authorization": {"Bearer " + created.Key}}
+
+	// Emails record the client that sent them
+	body, _ := json.Marshal(map[string]any{"to": []string{"customer@example.com"}, "subject": "Invoice", "body": "Invoice"})
+	resp = s.doWith(t, bearer, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	expectStatus(t, resp, http.StatusCreated)
+
+	if sent := decode[dto.EmailResponse](t, resp); sent.ClientID == nil || *sent.ClientID != created.ID {
+		t.Errorf("ClientID = %v, want %s", sent.ClientID, created.ID)
+	}
+
+	resp = s.doWith(t, http.Header{"X-Api-Key": {created.Key}}, http.MethodGet, "/api/v1/emails", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	// Keys without the admin scope cannot manage keys
+	expectStatus(t, s.doWith(t, bearer, http.MethodGet, "/api/v1/admin/api-keys", "", nil), http.StatusForbidden)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/admin/api-keys", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	keys := decode[dto.APIKeyListResponse](t, resp).Keys
+	if len(keys) != 1 || keys[0].ID != created.ID || keys[0].Key != "" || keys[0].LastUsedAt == nil {
+		t.Errorf("keys = %+v, want the used key without its secret", keys)
+	}
+
+	// Revoked and unknown keys are rejected
+	resp = s.do(t, http.MethodDelete, "/api/v1/admin/api-keys/"+created.ID, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if revoked := decode[dto.APIKeyResponse](t, resp); revoked.RevokedAt == nil {
+		t.Errorf("revoked = %+v, want a revocation time", revoked)
+	}
+
+	expectStatus(t, s.doWith(t, bearer, http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+	expectStatus(t, s.doWith(t, http.Header{"Authorization": {"Bearer nsk_unknown"}}, http.MethodGet, "/api/v1/emails", "", nil),
+		http.StatusUnauthorized)
+}
+
+func TestAPIKeys_LegacySecretDisabled(t *testing.T) {
+	s := newTestService(t, func(cfg *config.Config) { cfg.Server.LegacySecretKey = false })
+
+	expectStatus(t, s.do(t, http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+}
+
+// createAPIKey issues a key with the shared secret and returns headers
+// authenticating with it.
+func (s *testService) createAPIKey(t *testing.T, request map[string]any) (dto.APIKeyResponse, http.Header) {
+	t.Helper()
+
+	body, _ := json.Marshal(request)
+	resp := s.do(t, http.MethodPost, "/api/v1/admin/api-keys", "application/json", bytes.NewReader(body))
+	expectStatus(t, resp, http.StatusCreated)
+
+	created := decode[dto.APIKeyResponse](t, resp)
+	return created, http.Header{"Authorization": {"Bearer " + created.Key}}
+}
+
+func TestScopes(t *testing.T) {
+	s := newTestService(t)
+
+	_, sender := s.createAPIKey(t, map[string]any{
+		"name":           "billing",
+		"scopes":         []string{"emails:send"},
+		"allowedSenders": []string{"billing@example.com", "@billing.example.com"},
+	})
+	_, reader := s.createAPIKey(t, map[string]any{"name": "support", "scopes": []string{"emails:send", "emails:read"}})
+
+	send := func(header http.Header, request map[string]any) *http.Response {
+		body, _ := json.Marshal(request)
+		return s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	}
+
+	// Senders are limited to the allowed addresses and domains
+	resp := send(sender, map[string]any{"fromEmail": "noreply@example.com", "to": []string{"a@example.com"}, "subject": "Hi", "body": "Hi"})
+	expectStatus(t, resp, http.StatusForbidden)
+
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "may not send from noreply@example.com") {
+		t.Errorf("response = %s, want the reason", body)
+	}
+
+	resp = send(sender, map[string]any{"fromEmail": "invoices@billing.example.com", "to": []string{"a@example.com"}, "subject": "Hi", "body": "Hi"})
+	expectStatus(t, resp, http.StatusCreated)
+
+	billed := decode[dto.EmailResponse](t, resp)
+
+	// Reading needs its scope
+	resp = s.doWith(t, sender, http.MethodGet, "/api/v1/emails/"+billed.ID, "", nil)
+	expectStatus(t, resp, http.StatusForbidden)
+
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "lacks the emails:read scope") {
+		t.Errorf("response = %s, want the missing scope", body)
+	}
+
+	// Clients only see their own emails
+	resp = send(reader, map[string]any{"to": []string{"b@example.com"}, "subject": "Hi", "body": "Hi"})
+	expectStatus(t, resp, http.StatusCreated)
+
+	supported := decode[dto.EmailResponse](t, resp)
+
+	expectStatus(t, s.doWith(t, reader, http.MethodGet, "/api/v1/emails/"+supported.ID, "", nil), http.StatusOK)
+	expectStatus(t, s.doWith(t, reader, http.MethodGet, "/api/v1/emails/"+billed.ID, "", nil), http.StatusForbidden)
+	expectStatus(t, s.doWith(t, reader, http.MethodGet, "/api/v1/emails/"+billed.ID+"/events", "", nil), http.StatusForbidden)
+	expectStatus(t, s.doWith(t, reader, http.MethodPost, "/api/v1/emails/"+billed.ID+"/cancel", "", nil), http.StatusForbidden)
+
+	resp = s.doWith(t, reader, http.MethodGet, "/api/v1/emails", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if listed := decode[dto.EmailListResponse](t, resp); len(listed.Emails) != 1 || listed.Emails[0].ID != supported.ID {
+		t.Errorf("listed = %+v, want the client's email only", listed.Emails)
+	}
+
+	// Admins see everything
+	resp = s.do(t, http.MethodGet, "/api/v1/emails", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if listed := decode[dto.EmailListResponse](t, resp); len(listed.Emails) != 2 {
+		t.Errorf("admin listed %d emails, want 2", len(listed.Emails))
+	}
+
+	// Administration needs the admin scope
+	expectStatus(t, s.doWith(t, reader, http.MethodGet, "/api/v1/suppressions", "", nil), http.StatusForbidden)
+	expectStatus(t, s.doWith(t, reader, http.MethodGet, "/api/v1/admin/api-keys", "", nil), http.StatusForbidden)
+}
+
+func TestAttachmentOwners(t *testing.T) {
+	s := newTestService(t)
+
+	_, billing := s.createAPIKey(t, map[string]any{"name": "billing", "scopes": []string{"emails:send"}})
+	_, support := s.createAPIKey(t, map[string]any{"name": "support", "scopes": []string{"emails:send"}})
+
+	upload := func(header http.Header, name string, content []byte) string {
+		contentType, body := multipartBody(t, nil, map[string]map[string][]byte{"file": {name: content}})
+		resp := s.doWith(t, header, http.MethodPost, "/api/v1/attachments", contentType, body)
+		expectStatus(t, resp, http.StatusCreated)
+		return decode[handlers.UploadAttachmentResponse](t, resp).ID
+	}
+	send := func(header http.Header, attachmentID string) *http.Response {
+		body, _ := json.Marshal(map[string]any{
+			"to": []string{"a@example.com"}, "subject": "Hi", "body": "Hi", "attachmentIds": []string{attachmentID},
+		})
+		return s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	}
+	remove := func(header http.Header, attachmentID string) *http.Response {
+		return s.doWith(t, header, http.MethodDelete, "/api/v1/attachments/"+attachmentID, "", nil)
+	}
+
+	invoice := upload(billing, "invoice.txt", []byte("invoice 42"))
+
+	// Another client can neither send nor delete it
+	expectStatus(t, send(support, invoice), http.StatusBadRequest)
+	expectStatus(t, remove(support, invoice), http.StatusNotFound)
+	expectStatus(t, send(billing, invoice), http.StatusCreated)
+
+	// Uploading the same content shares the attachment; deleting it only
+	// drops the deleting client's ownership
+	shared := []byte("terms and conditions")
+	terms := upload(billing, "terms.txt", shared)
+	if id := upload(support, "terms.txt", shared); id != terms {
+		t.Fatalf("second upload = %s, want the deduplicated %s", id, terms)
+	}
+
+	expectStatus(t, remove(support, terms), http.StatusNoContent)
+	expectStatus(t, send(support, terms), http.StatusBadRequest)
+	expectStatus(t, send(billing, terms), http.StatusCreated)
+}
+
+func TestAttachmentOwners_Names(t *testing.T) {
+	s := newTestService(t)
+
+	_, billing := s.createAPIKey(t, map[string]any{"name": "billing", "scopes": []string{"emails:send"}})
+	_, support := s.createAPIKey(t, map[string]any{"name": "support", "scopes": []string{"emails:send"}})
+
+	upload := func(header http.Header, name string) handlers.UploadAttachmentResponse {
+		contentType, body := multipartBody(t, nil, map[string]map[string][]byte{"file": {name: []byte("terms and conditions")}})
+		resp := s.doWith(t, header, http.MethodPost, "/api/v1/attachments", contentType, body)
+		expectStatus(t, resp, http.StatusCreated)
+		return decode[handlers.UploadAttachmentResponse](t, resp)
+	}
+	send := func(header http.Header, attachmentIDs ...string) *http.Response {
+		body, _ := json.Marshal(map[string]any{
+			"to": []string{"a@example.com"}, "subject": "Hi", "body": "Hi", "attachmentIds": attachmentIDs,
+		})
+		return s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	}
+
+	// The same content uploaded under another name keeps that name
+	terms := upload(billing, "terms.txt")
+	conditions := upload(support, "conditions.txt")
+	if conditions.ID != terms.ID || conditions.Filename != "conditions.txt" {
+		t.Fatalf("second upload = %s named %q, want %s named conditions.txt", conditions.ID, conditions.Filename, terms.ID)
+	}
+
+	expectStatus(t, send(support, conditions.ID), http.StatusCreated)
+	expectStatus(t, send(billing, terms.ID), http.StatusCreated)
+
+	messages := s.smtp.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("SMTP server received %d messages, want 2", len(messages))
+	}
+
+	for i, want := range []string{"conditions.txt", "terms.txt"} {
+		parts, _, err := messages[i].Parts()
+		if err != nil {
+			t.Fatalf("Parts: %v", err)
+		}
+		if len(parts) != 2 || parts[1].Filename != want {
+			t.Errorf("message %d attaches %+v, want %s", i, parts, want)
+		}
+	}
+
+	// An attachment cannot be listed twice
+	expectStatus(t, send(billing, terms.ID, terms.ID), http.StatusBadRequest)
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	issuer := jwkstest.NewIssuer(t, "platform-1")
+
+	s := newTestService(t, func(cfg *config.Config) {
+		cfg.JWT = config.JWTConfig{
+			JWKSFile:     issuer.WriteFile(t),
+			Issuer:       "https://auth.example.com",
+			Audience:     "notifications",
+			Leeway:       60,
+			ClientClaim:  "sub",
+			NameClaim:    "client_name",
+			ScopeClaim:   "scope",
+			SendersClaim: "allowed_senders",
+		}
+	})
+
+	bearer := http.Header{"Authorization": {"Bearer " + issuer.Token(t, map[string]any{
+		"iss":             "https://auth.example.com",
+		"aud":             "notifications",
+		"sub":             "orders-service",
+		"scope":           "emails:send emails:read",
+		"allowed_senders": []string{"@example.com"},
+	})}}
+
+	body, _ := json.Marshal(map[string]any{"to": []string{"customer@example.com"}, "subject": "Order", "body": "Order"})
+	resp := s.doWith(t, bearer, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	expectStatus(t, resp, http.StatusCreated)
+
+	sent := decode[dto.EmailResponse](t, resp)
+	if sent.ClientID == nil || *sent.ClientID != "orders-service" {
+		t.Errorf("ClientID = %v, want orders-service", sent.ClientID)
+	}
+
+	expectStatus(t, s.doWith(t, bearer, http.MethodGet, "/api/v1/emails/"+sent.ID, "", nil), http.StatusOK)
+	expectStatus(t, s.doWith(t, bearer, http.MethodGet, "/api/v1/admin/api-keys", "", nil), http.StatusForbidden)
+
+	// API keys keep working next to tokens
+	_, apiKey := s.createAPIKey(t, map[string]any{"name": "support", "scopes": []string{"emails:read"}})
+	expectStatus(t, s.doWith(t, apiKey, http.MethodGet, "/api/v1/emails", "", nil), http.StatusOK)
+
+	// Tokens for another audience or signed by another issuer are rejected
+	wrongAudience := issuer.Token(t, map[string]any{"iss": "https://auth.example.com", "aud": "billing", "sub": "orders-service"})
+	forged := jwkstest.NewIssuer(t, "platform-1").Token(t, map[string]any{
+		"iss": "https://auth.example.com", "aud": "notifications", "sub": "orders-service", "scope": "admin",
+	})
+
+	for _, token := range []string{wrongAudience, forged, "not-a-token"} {
+		header := http.Header{"Authorization": {"Bearer " + token}}
+		expectStatus(t, s.doWith(t, header, http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+	}
+}
+
+func TestJWTAuthentication_NotConfigured(t *testing.T) {
+	s := newTestService(t)
+
+	token := jwkstest.NewIssuer(t, "platform-1").Token(t, map[string]any{"sub": "orders-service", "scope": "admin"})
+	header := http.Header{"Authorization": {"Bearer " + token}}
+
+	expectStatus(t, s.doWith(t, header, http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+}
+
+// signed returns headers signing a request with an API key.
+func signed(key dto.APIKeyResponse, method, path string, body []byte, timestamp time.Time, nonce string) http.Header {
+	return signedWith(entity.SigningKey(key.Key), key.ID, method, path, body, timestamp, nonce)
+}
+
+func signedWith(signingKey, keyID, method, path string, body []byte, timestamp time.Time, nonce string) http.Header {
+	sum := sha256.Sum256(body)
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	return http.Header{
+		"X-Signature":           {signature.New(signingKey).Sign(method, path, ts, nonce, hex.EncodeToString(sum[:]))},
+		"X-Signature-Key":       {keyID},
+		"X-Signature-Timestamp": {ts},
+		"X-Signature-Nonce":     {nonce},
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	s := newTestService(t, func(cfg *config.Config) { cfg.Storage.MaxFileSize = 4 << 20 })
+
+	key, _ := s.createAPIKey(t, map[string]any{"name": "billing", "scopes": []string{"emails:send", "emails:read"}})
+	now := time.Now()
+
+	body, _ := json.Marshal(map[string]any{"to": []string{"customer@example.com"}, "subject": "Invoice", "body": "Invoice"})
+	header := signed(key, http.MethodPost, "/api/v1/emails", body, now, "nonce-0000000001")
+
+	resp := s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	expectStatus(t, resp, http.StatusCreated)
+
+	if sent := decode[dto.EmailResponse](t, resp); sent.ClientID == nil || *sent.ClientID != key.ID {
+		t.Errorf("ClientID = %v, want %s", sent.ClientID, key.ID)
+	}
+
+	// Replays are rejected
+	resp = s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	expectStatus(t, resp, http.StatusUnauthorized)
+
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "nonce was already used") {
+		t.Errorf("response = %s, want the replay reported", body)
+	}
+
+	// Multipart bodies are signed whole, large ones included
+	contentType, form := multipartBody(t, nil, map[string]map[string][]byte{
+		"file": {"report.csv": bytes.Repeat([]byte("id,name\n1,first\n"), 100_000)},
+	})
+	data, _ := io.ReadAll(form)
+
+	header = signed(key, http.MethodPost, "/api/v1/attachments", data, now, "nonce-0000000002")
+	resp = s.doWith(t, header, http.MethodPost, "/api/v1/attachments", contentType, bytes.NewReader(data))
+	expectStatus(t, resp, http.StatusCreated)
+
+	if uploaded := decode[handlers.UploadAttachmentResponse](t, resp); uploaded.Size != int64(len("id,name\n1,first\n")*100_000) {
+		t.Errorf("uploaded %d bytes", uploaded.Size)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		path   string
+		body   []byte
+	}{
+		{
+			name:   "TamperedBody",
+			header: signed(key, http.MethodPost, "/api/v1/emails", []byte(`{"to":["other@example.com"]}`), now, "nonce-0000000003"),
+			path:   "/api/v1/emails",
+			body:   body,
+		},
+		{
+			name:   "TamperedQuery",
+			header: signed(key, http.MethodPost, "/api/v1/emails", body, now, "nonce-0000000004"),
+			path:   "/api/v1/emails?sendAt=tomorrow",
+			body:   body,
+		},
+		{
+			name:   "StaleTimestamp",
+			header: signed(key, http.MethodPost, "/api/v1/emails", body, now.Add(-10*time.Minute), "nonce-0000000005"),
+			path:   "/api/v1/emails",
+			body:   body,
+		},
+		{
+			name:   "ShortNonce",
+			header: signed(key, http.MethodPost, "/api/v1/emails", body, now, "1"),
+			path:   "/api/v1/emails",
+			body:   body,
+		},
+		{
+			name:   "OtherKey",
+			header: signed(dto.APIKeyResponse{ID: key.ID, Key: key.Key + "x"}, http.MethodPost, "/api/v1/emails", body, now, "nonce-0000000006"),
+			path:   "/api/v1/emails",
+			body:   body,
+		},
+		{
+			// The stored hash of the key must not be enough to sign
+			name: "StoredHash",
+			header: signedWith(hex.EncodeToString(entity.HashAPIKey(key.Key)), key.ID,
+				http.MethodPost, "/api/v1/emails", body, now, "nonce-0000000007"),
+			path: "/api/v1/emails",
+			body: body,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.doWith(t, tt.header, http.MethodPost, tt.path, "application/json", bytes.NewReader(tt.body))
+			expectStatus(t, resp, http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestSignedRequests_UnlimitedBody(t *testing.T) {
+	s := newTestService(t, func(cfg *config.Config) { cfg.Storage.MaxRequestSize = 0 })
+
+	key, _ := s.createAPIKey(t, map[string]any{"name": "billing", "scopes": []string{"emails:send"}})
+
+	body, _ := json.Marshal(map[string]any{"to": []string{"customer@example.com"}, "subject": "Invoice", "body": "Invoice"})
+	header := signed(key, http.MethodPost, "/api/v1/emails", body, time.Now(), "nonce-0000000001")
+
+	expectStatus(t, s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body)), http.StatusCreated)
+}
+
+func TestSignedRequests_Disabled(t *testing.T) {
+	s := newTestService(t, func(cfg *config.Config) { cfg.Server.SigningKeyEncryptionKey = "" })
+
+	key, bearer := s.createAPIKey(t, map[string]any{"name": "billing", "scopes": []string{"emails:read"}})
+
+	header := signed(key, http.MethodGet, "/api/v1/emails", nil, time.Now(), "nonce-0000000001")
+	expectStatus(t, s.doWith(t, header, http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+
+	// The key still works as a bearer token
+	expectStatus(t, s.doWith(t, bearer, http.MethodGet, "/api/v1/emails", "", nil), http.StatusOK)
+}
+
+func TestRateLimits(t *testing.T) {
+	s := newTestService(t, func(cfg *config.Config) {
+		cfg.RateLimit = config.RateLimitConfig{ClientRate: 0.01, ClientBurst: 2, IPRate: 0.01, IPBurst: 6}
+	})
+
+	_, billing := s.createAPIKey(t, map[string]any{"name": "billing", "scopes": []string{"emails:read"}})
+	_, support := s.createAPIKey(t, map[string]any{"name": "support", "scopes": []string{"emails:read"}})
+
+	resp := s.doWith(t, billing, http.MethodGet, "/api/v1/emails", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "1" || resp.Header.Get("RateLimit-Limit") != "2" {
+		t.Errorf("RateLimit headers = %v, want the client limit", resp.Header)
+	}
+
+	expectStatus(t, s.doWith(t, billing, http.MethodGet, "/api/v1/emails", "", nil), http.StatusOK)
+
+	resp = s.doWith(t, billing, http.MethodGet, "/api/v1/emails", "", nil)
+	expectStatus(t, resp, http.StatusTooManyRequests)
+
+	if retry, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retry < 1 || retry > 100 {
+		t.Errorf("Retry-After = %q, want the time until a request is allowed", resp.Header.Get("Retry-After"))
+	}
+
+	// Clients have their own buckets, but share the one of their IP
+	expectStatus(t, s.doWith(t, support, http.MethodGet, "/api/v1/emails", "", nil), http.StatusOK)
+
+	resp = s.doWith(t, http.Header{}, http.MethodGet, "/api/v1/emails", "", nil)
+	expectStatus(t, resp, http.StatusTooManyRequests)
+
+	if got := resp.Header.Get("RateLimit-Limit"); got != "6" {
+		t.Errorf("RateLimit-Limit = %q, want the IP limit", got)
+	}
+}
+
+func TestRateLimits_ForwardedFor(t *testing.T) {
+	limited := func(proxies []string) func(cfg *config.Config) {
+		return func(cfg *config.Config) {
+			cfg.Server.TrustedProxies = proxies
+			cfg.RateLimit = config.RateLimitConfig{IPRate: 0.01, IPBurst: 2}
+		}
+	}
+	forwarded := func(ip string) http.Header {
+		return http.Header{"X-Forwarded-For": {ip}, "X-Real-Ip": {ip}}
+	}
+
+	// Clients cannot spoof their address to get a fresh bucket
+	s := newTestService(t, limited(nil))
+
+	expectStatus(t, s.doWith(t, forwarded("203.0.113.1"), http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+	expectStatus(t, s.doWith(t, forwarded("203.0.113.2"), http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+	expectStatus(t, s.doWith(t, forwarded("203.0.113.3"), http.MethodGet, "/api/v1/emails", "", nil), http.StatusTooManyRequests)
+
+	// Behind a trusted proxy, the forwarded client address is limited
+	s = newTestService(t, limited([]string{"127.0.0.0/8", "::1"}))
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		expectStatus(t, s.doWith(t, forwarded(ip), http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+	}
+
+	// Addresses the client prepended itself are skipped
+	spoofed := http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.1"}}
+	expectStatus(t, s.doWith(t, spoofed, http.MethodGet, "/api/v1/emails", "", nil), http.StatusUnauthorized)
+	expectStatus(t, s.doWith(t, forwarded("203.0.113.1"), http.MethodGet, "/api/v1/emails", "", nil), http.StatusTooManyRequests)
+}
+
+func TestQuotas(t *testing.T) {
+	s := newTestService(t, func(cfg *config.Config) {
+		cfg.RateLimit = config.RateLimitConfig{DailyQuota: 5, MonthlyQuota: 2}
+	})
+
+	billingKey, billing := s.createAPIKey(t, map[string]any{"name": "billing", "scopes": []string{"emails:send"}})
+	_, support := s.createAPIKey(t, map[string]any{"name": "support", "scopes": []string{"emails:send"}})
+
+	send := func(header http.Header) *http.Response {
+		body, _ := json.Marshal(map[string]any{"to": []string{"customer@example.com"}, "subject": "Invoice", "body": "Invoice"})
+		return s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body))
+	}
+
+	expectStatus(t, send(billing), http.StatusCreated)
+	expectStatus(t, send(billing), http.StatusCreated)
+
+	resp := send(billing)
+	expectStatus(t, resp, http.StatusTooManyRequests)
+
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("quota refusal has no Retry-After")
+	}
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), `"quota":"monthly"`) {
+		t.Errorf("response = %s, want the exhausted quota", body)
+	}
+
+	// The legacy secret has no quota
+	expectStatus(t, s.sendJSON(t, map[string]any{"to": []string{"customer@example.com"}, "subject": "Hi", "body": "Hi"}), http.StatusCreated)
+
+	// The refused email did not count against the daily quota
+	resp = s.doWith(t, billing, http.MethodGet, "/api/v1/quota", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	quota := decode[dto.QuotaResponse](t, resp)
+	if quota.ClientID != billingKey.ID || len(quota.Quotas) != 2 {
+		t.Fatalf("quota = %+v", quota)
+	}
+
+	for _, q := range quota.Quotas {
+		if q.Used != 2 || q.Limit == nil || q.Remaining == nil {
+			t.Errorf("%s quota = %+v, want 2 used", q.Period, q)
+		} else if q.Period == "daily" && *q.Remaining != 3 || q.Period == "monthly" && *q.Remaining != 0 {
+			t.Errorf("%s quota remaining = %d", q.Period, *q.Remaining)
+		}
+	}
+
+	// Only admins see the quota of other clients
+	expectStatus(t, s.doWith(t, support, http.MethodGet, "/api/v1/quota?clientId="+billingKey.ID, "", nil), http.StatusForbidden)
+	expectStatus(t, s.do(t, http.MethodGet, "/api/v1/quota?clientId="+billingKey.ID, "", nil), http.StatusOK)
+	expectStatus(t, s.do(t, http.MethodGet, "/api/v1/quota", "", nil), http.StatusBadRequest)
+}
+
+func TestMetrics(t *testing.T) {
+	s := newTestService(t)
+
+	scrape := func() string {
+		// Scraping needs no credentials
+		resp := s.doWith(t, http.Header{}, http.MethodGet, "/metrics", "", nil)
+		expectStatus(t, resp, http.StatusOK)
+
+		raw, _ := io.ReadAll(resp.Body)
+		return string(raw)
+	}
+
+	contentType, body := multipartBody(t, nil, map[string]map[string][]byte{"file": {"notes.txt": []byte("meeting notes")}})
+	resp := s.do(t, http.MethodPost, "/api/v1/attachments", contentType, body)
+	expectStatus(t, resp, http.StatusCreated)
+
+	notes := decode[handlers.UploadAttachmentResponse](t, resp)
+
+	resp = s.sendJSON(t, map[string]any{"to": []string{"customer@example.com"}, "subject": "Hi", "body": "Hi"})
+	expectStatus(t, resp, http.StatusCreated)
+
+	sent := decode[dto.EmailResponse](t, resp)
+
+	expectStatus(t, s.do(t, http.MethodGet, "/api/v1/emails/"+uuid.NewString(), "", nil), http.StatusNotFound)
+	expectStatus(t, s.do(t, http.MethodGet, "/no-such-page", "", nil), http.StatusNotFound)
+
+	// Statuses reached after sending are counted too
+	report, _ := json.Marshal(map[string]any{"emailId": sent.ID, "recipient": "customer@example.com", "event": "delivered", "provider": "relay"})
+	expectStatus(t, s.do(t, http.MethodPost, "/api/v1/webhooks/delivery", "application/json", bytes.NewReader(report)), http.StatusOK)
+
+	s.smtp.Reply("RCPT", 550, "5.1.1 user unknown")
+	expectStatus(t, s.sendJSON(t, map[string]any{"to": []string{"missing@example.com"}, "subject": "Hi", "body": "Hi"}),
+		http.StatusInternalServerError)
+
+	resp = s.do(t, http.MethodGet, "/api/v1/emails?status=failed", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	failed := decode[dto.EmailListResponse](t, resp)
+	if len(failed.Emails) != 1 {
+		t.Fatalf("FAILED emails = %+v, want one", failed.Emails)
+	}
+	expectStatus(t, s.do(t, http.MethodPost, "/api/v1/emails/"+failed.Emails[0].ID+"/cancel", "", nil), http.StatusOK)
+
+	exposition := scrape()
+
+	for _, want := range []string{
+		`notification_http_requests_total{code="201",method="POST",route="/api/v1/emails"} 1`,
+		`notification_http_requests_total{code="404",method="GET",route="/api/v1/emails/{id}"} 1`,
+		`notification_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`notification_http_request_duration_seconds_count{method="POST",route="/api/v1/emails"} 2`,
+		`notification_emails_total{provider="smtp",status="SENT"} 1`,
+		`notification_emails_total{provider="relay",status="DELIVERED"} 1`,
+		`notification_emails_total{provider="smtp",status="FAILED"} 1`,
+		`notification_emails_total{provider="",status="CANCELLED"} 1`,
+		`notification_email_send_duration_seconds_count{provider="smtp",result="success"} 1`,
+		`notification_attachment_stored_bytes 13`,
+		`notification_email_queue_depth 0`,
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+
+	// Paths are never used as labels
+	if strings.Contains(exposition, "no-such-page") {
+		t.Error("metrics are labelled with a raw path")
+	}
+
+	// Stored bytes follow deletions
+	expectStatus(t, s.do(t, http.MethodDelete, "/api/v1/attachments/"+notes.ID, "", nil), http.StatusNoContent)
+
+	if exposition := scrape(); !strings.Contains(exposition, "notification_attachment_stored_bytes 0") {
+		t.Error("metrics lack notification_attachment_stored_bytes 0 after the deletion")
+	}
+
+	// Metrics are only served when enabled
+	disabled := newTestService(t, func(cfg *config.Config) { cfg.Metrics = config.MetricsConfig{} })
+	expectStatus(t, disabled.doWith(t, http.Header{}, http.MethodGet, "/metrics", "", nil), http.StatusNotFound)
+}
+
+func TestTracing(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	s := newTestService(t)
+
+	const traceID, callerSpanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+
+	body, _ := json.Marshal(map[string]any{"to": []string{"customer@example.com"}, "subject": "Hi", "body": "Hi"})
+	header := http.Header{"Ssy": {testSecret}, "Traceparent": {"00-" + traceID + "-" + callerSpanID + "-01"}}
+	expectStatus(t, s.doWith(t, header, http.MethodPost, "/api/v1/emails", "application/json", bytes.NewReader(body)), http.StatusCreated)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	// Each span continues the caller's trace under the one before it
+	parents := []struct{ name, parent string }{
+		{"POST /api/v1/emails", ""},
+		{"SendEmailUseCase.Execute", "POST /api/v1/emails"},
+		{"smtp.send", "SendEmailUseCase.Execute"},
+		{"smtp.dial", "smtp.send"},
+		{"smtp.auth", "smtp.send"},
+		{"smtp.data", "smtp.send"},
+	}
+
+	for _, p := range parents {
+		span, ok := spans[p.name]
+		if !ok {
+			t.Errorf("no %s span among %d", p.name, len(spans))
+			continue
+		}
+
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("%s trace = %s, want the caller's", p.name, got)
+		}
+
+		wantParent := callerSpanID
+		if p.parent != "" {
+			wantParent = spans[p.parent].SpanContext().SpanID().String()
+		}
+		if got := span.Parent().SpanID().String(); got != wantParent {
+			t.Errorf("%s parent = %s, want %s", p.name, got, wantParent)
+		}
+	}
+}